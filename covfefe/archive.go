@@ -0,0 +1,296 @@
+package covfefe
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"crawshaw.io/sqlite/sqlitex"
+	"github.com/dghubble/go-twitter/twitter"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// archiveFiles are the files of a Twitter "Download your data" archive that
+// are imported, in order, with the kind of the Messages they produce. Large
+// files are split into parts like tweets-part1.js. Older archives call
+// tweets.js tweet.js.
+var archiveFiles = []struct {
+	name, kind string
+}{
+	{"account", "archive-account"},
+	{"tweets", "archive-tweet"},
+	{"tweet", "archive-tweet"},
+	{"deleted-tweets", "archive-tweet"},
+	{"like", "archive-like"},
+	{"follower", "archive-follower"},
+	{"following", "archive-following"},
+}
+
+// archiveTweet is a tweet from a data export, which unlike API tweets has
+// string IDs and no user.
+type archiveTweet struct {
+	ID                string `json:"id_str"`
+	CreatedAt         string `json:"created_at"`
+	DeletedAt         string `json:"deleted_at"`
+	FullText          string `json:"full_text"`
+	InReplyToStatusID string `json:"in_reply_to_status_id_str"`
+	Entities          struct {
+		Media []archiveMedia `json:"media"`
+	} `json:"entities"`
+	ExtendedEntities struct {
+		Media []archiveMedia `json:"media"`
+	} `json:"extended_entities"`
+}
+
+type archiveMedia struct {
+	ID            string            `json:"id_str"`
+	MediaURLHttps string            `json:"media_url_https"`
+	VideoInfo     twitter.VideoInfo `json:"video_info"`
+}
+
+type archiveAccount struct {
+	AccountID          string `json:"accountId"`
+	Username           string `json:"username"`
+	AccountDisplayName string `json:"accountDisplayName"`
+}
+
+// Import loads a Twitter data export zip into the database, processing every
+// item like a fetched message with an "archive:<account ID>" source, and
+// copying the attached media into mediaPath. Importing the same archive again
+// is a no-op.
+func Import(dbPath, mediaPath, archivePath string) error {
+	db, err := sqlitex.Open("file:"+dbPath, 0, 5)
+	if err != nil {
+		return errors.Wrap(err, "failed to open database")
+	}
+	defer db.Close()
+
+	c := newCovfefe(db, mediaPath)
+	c.rescan = true // Don't hit the API, we don't have credentials.
+	if err := c.initDB(); err != nil {
+		return err
+	}
+
+	r, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return errors.Wrap(err, "failed to open archive")
+	}
+	defer r.Close()
+
+	files := make(map[string]*zip.File)
+	for _, f := range r.File {
+		files[f.Name] = f
+	}
+
+	accountItems, err := readArchiveFile(files, "account")
+	if err != nil {
+		return err
+	}
+	if len(accountItems) != 1 {
+		return errors.Errorf("expected one account in the archive, found %d", len(accountItems))
+	}
+	var account archiveAccount
+	if err := json.Unmarshal(accountItems[0], &account); err != nil {
+		return errors.Wrap(err, "failed to parse account.js")
+	}
+	owner, err := strconv.ParseInt(account.AccountID, 10, 64)
+	if err != nil {
+		return errors.Wrap(err, "invalid account ID")
+	}
+	source := "archive:" + account.AccountID
+
+	log := log.WithField("account", account.Username)
+	for _, af := range archiveFiles {
+		items, err := readArchiveFile(files, af.name)
+		if err != nil {
+			return err
+		}
+		if len(items) == 0 {
+			continue
+		}
+		log.WithField("file", af.name).WithField("items", len(items)).Info("Importing")
+
+		for _, item := range items {
+			m := &Message{source: source, kind: af.kind, msg: item}
+			c.Handle(m)
+			if af.kind == "archive-tweet" && m.id != 0 {
+				c.importMedia(files, item, owner, m.id)
+			}
+		}
+	}
+	return nil
+}
+
+// readArchiveFile returns the items of data/<name>.js and its parts. These
+// are JavaScript files assigning an array to a global, where each item is
+// usually wrapped in an object with a single key like "tweet".
+func readArchiveFile(files map[string]*zip.File, name string) ([]json.RawMessage, error) {
+	var names []string
+	for n := range files {
+		base := strings.TrimPrefix(n, "data/")
+		if base == name+".js" || strings.HasPrefix(base, name+"-part") && strings.HasSuffix(base, ".js") {
+			names = append(names, n)
+		}
+	}
+	sort.Strings(names)
+
+	var items []json.RawMessage
+	for _, n := range names {
+		rc, err := files[n].Open()
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to open %s", n)
+		}
+		js, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read %s", n)
+		}
+
+		i := bytes.IndexByte(js, '=')
+		if i < 0 {
+			return nil, errors.Errorf("%s does not look like an archive file", n)
+		}
+		var part []json.RawMessage
+		if err := json.Unmarshal(js[i+1:], &part); err != nil {
+			return nil, errors.Wrapf(err, "failed to parse %s", n)
+		}
+
+		for _, item := range part {
+			var wrapper map[string]json.RawMessage
+			if err := json.Unmarshal(item, &wrapper); err == nil && len(wrapper) == 1 {
+				for _, v := range wrapper {
+					item = v
+				}
+			}
+			// Compact, so that the same item hashes the same across exports
+			// with different indentation.
+			var buf bytes.Buffer
+			if err := json.Compact(&buf, item); err != nil {
+				return nil, errors.Wrapf(err, "failed to parse %s", n)
+			}
+			items = append(items, buf.Bytes())
+		}
+	}
+	return items, nil
+}
+
+// importMedia copies the media attached to an archive tweet, which are stored
+// as data/tweets_media/<tweet ID>-<file name>, or data/tweet_media/ in older
+// archives. Videos and GIFs come with their thumbnail and one MP4 variant.
+// OCR of the images is left to the job queue.
+func (c *Covfefe) importMedia(files map[string]*zip.File, item []byte, owner, message int64) {
+	var tweet archiveTweet
+	if err := json.Unmarshal(item, &tweet); err != nil {
+		return
+	}
+	tweetID, err := strconv.ParseInt(tweet.ID, 10, 64)
+	if err != nil {
+		return
+	}
+	media := tweet.Entities.Media
+	if len(tweet.ExtendedEntities.Media) > 0 {
+		media = tweet.ExtendedEntities.Media
+	}
+	for _, m := range media {
+		log := log.WithFields(log.Fields{"media": m.ID, "tweet": tweet.ID})
+		id, err := strconv.ParseInt(m.ID, 10, 64)
+		if err != nil {
+			log.WithError(err).Error("Invalid media ID")
+			continue
+		}
+		if hash := c.importMediaFile(files, tweet.ID, id, "image", m.MediaURLHttps, message); hash != "" {
+			c.enqueueJob("ocr", &ocrJob{Hash: hash, Tweet: tweetID, User: owner}, message)
+		}
+		if v := bestVideoVariant(m.VideoInfo.Variants); v != nil {
+			c.importMediaFile(files, tweet.ID, id, "video", v.URL, message)
+		}
+	}
+}
+
+func (c *Covfefe) importMediaFile(files map[string]*zip.File, tweetID string, id int64, variant, mediaURL string, message int64) (hash string) {
+	log := log.WithFields(log.Fields{"media": id, "tweet": tweetID, "variant": variant})
+	u, err := url.Parse(mediaURL)
+	if err != nil {
+		log.WithError(err).Error("Invalid media URL")
+		return ""
+	}
+	base := fmt.Sprintf("%s-%s", tweetID, path.Base(u.Path))
+	f := files["data/tweets_media/"+base]
+	if f == nil {
+		f = files["data/tweet_media/"+base]
+	}
+	if f == nil {
+		log.Debug("Media not in the archive")
+		return ""
+	}
+	rc, err := f.Open()
+	if err != nil {
+		log.WithError(err).Error("Failed to open media")
+		return ""
+	}
+	data, err := ioutil.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		log.WithError(err).Error("Failed to read media")
+		return ""
+	}
+	hash, err = c.saveMedia(data, id, variant, mediaURL, message)
+	if err != nil {
+		log.WithError(err).Error("Failed to save media")
+		return ""
+	}
+	return hash
+}
+
+func (c *Covfefe) processArchiveTweet(id int64, tweet *archiveTweet, owner int64) {
+	log := log.WithFields(log.Fields{"message": id, "tweet": tweet.ID})
+
+	tweetID, err := strconv.ParseInt(tweet.ID, 10, 64)
+	if err != nil {
+		log.WithError(err).Error("Invalid tweet ID")
+		return
+	}
+	new, err := c.insertTweet(&twitter.Tweet{
+		ID: tweetID, CreatedAt: tweet.CreatedAt, User: &twitter.User{ID: owner},
+	}, id)
+	if err != nil {
+		log.WithError(err).Error("Failed to insert tweet")
+		return
+	}
+	if new {
+		c.indexText(tweet.FullText, "text", tweetID, owner, id)
+		if tweet.InReplyToStatusID != "" {
+			parent, err := strconv.ParseInt(tweet.InReplyToStatusID, 10, 64)
+			if err != nil {
+				log.WithError(err).Error("Invalid parent tweet ID")
+			} else {
+				c.processThread(id, &twitter.Tweet{ID: tweetID, InReplyToStatusID: parent})
+			}
+		}
+	}
+	if tweet.DeletedAt != "" {
+		c.deletedTweet(tweetID, id)
+	}
+}
+
+// archiveOwners returns the account IDs from the "archive:" sources of m.
+func archiveOwners(m *Message) []int64 {
+	var owners []int64
+	for _, id := range m.sourceIDs("archive:") {
+		owner, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			log.WithError(err).WithField("source", "archive:"+id).Error("Invalid archive source")
+			continue
+		}
+		owners = append(owners, owner)
+	}
+	return owners
+}
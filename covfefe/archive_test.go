@@ -0,0 +1,158 @@
+package covfefe
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// zipTestFiles returns a zip archive of files, keyed by name.
+func zipTestFiles(t *testing.T, files map[string][]byte) []byte {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, data := range files {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// loadTestArchive returns the contents of testdata/archive, keyed by their
+// path in a data export.
+func loadTestArchive(t *testing.T) map[string][]byte {
+	files := make(map[string][]byte)
+	root := filepath.Join("testdata", "archive")
+	if err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		name, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(name)] = data
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestReadArchiveFile(t *testing.T) {
+	data := zipTestFiles(t, map[string][]byte{
+		"data/tweets-part2.js": []byte("window.YTD.tweets.part1 = [ {\n  \"tweet\" : { \"id_str\" : \"3\" }\n} ]"),
+		"data/tweets-part1.js": []byte("window.YTD.tweets.part0 = [ {\n  \"tweet\" : { \"id_str\" : \"1\" }\n}, " +
+			"{\n  \"tweet\" : { \"id_str\" : \"2\" }\n} ]"),
+		"data/tweets.js.bak":     []byte("not an archive file"),
+		"data/follower.js":       []byte(`window.YTD.follower.part0 = [ { "accountId" : "2", "userLink" : "x" } ]`),
+		"data/ad-engagements.js": []byte("nope"),
+		"data/like.js":           []byte("[]"),
+	})
+	r, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string]*zip.File)
+	for _, f := range r.File {
+		files[f.Name] = f
+	}
+
+	read := func(name string) []string {
+		items, err := readArchiveFile(files, name)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		var res []string
+		for _, item := range items {
+			res = append(res, string(item))
+		}
+		return res
+	}
+
+	// Parts are read in order, and single-key wrappers are removed.
+	if got, exp := read("tweets"), []string{`{"id_str":"1"}`, `{"id_str":"2"}`,
+		`{"id_str":"3"}`}; !reflect.DeepEqual(got, exp) {
+		t.Errorf("tweets: got %q, expected %q", got, exp)
+	}
+	if got, exp := read("follower"), []string{`{"accountId":"2","userLink":"x"}`}; !reflect.DeepEqual(got, exp) {
+		t.Errorf("follower: got %q, expected %q", got, exp)
+	}
+	if got := read("account"); got != nil {
+		t.Errorf("missing file: got %q", got)
+	}
+	if _, err := readArchiveFile(files, "like"); err == nil {
+		t.Error("like.js without an assignment was accepted")
+	}
+}
+
+func TestImport(t *testing.T) {
+	c, dbPath, cleanup := newTestCovfefe(t)
+	defer cleanup()
+
+	dir, err := ioutil.TempDir("", "covfefe-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	archivePath := filepath.Join(dir, "twitter.zip")
+	if err := ioutil.WriteFile(archivePath, zipTestFiles(t, loadTestArchive(t)), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Import(dbPath, c.mediaPath, archivePath); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		query    string
+		expected []string
+	}{
+		{"SELECT DISTINCT source FROM Messages", []string{`["archive:1"]`}},
+		{"SELECT kind || ' ' || COUNT(*) FROM Messages GROUP BY kind ORDER BY kind", []string{
+			"archive-account 1", "archive-follower 1", "archive-following 1",
+			"archive-like 1", "archive-tweet 4"}},
+		{"SELECT id || ' ' || user || ' ' || (deleted IS NOT NULL) FROM Tweets ORDER BY id",
+			[]string{"10 1 0", "11 1 0", "12 1 0", "13 1 1"}},
+		{"SELECT handle || ' ' || name FROM Users", []string{"u1 User One"}},
+		{"SELECT follower || ' ' || target FROM Follows ORDER BY follower", []string{"1 3", "2 1"}},
+		{"SELECT id || ' ' || variant FROM Media", []string{"20 image"}},
+		{"SELECT tweet FROM SearchIndex WHERE SearchIndex MATCH 'aardvark'", []string{"10"}},
+	} {
+		if got := queryStrings(t, c, tc.query); !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("%s: got %q, expected %q", tc.query, got, tc.expected)
+		}
+	}
+
+	// Importing the same archive again adds nothing.
+	counts := func() []string {
+		var res []string
+		for _, table := range []string{"Messages", "Tweets", "Users", "Follows", "Media", "SearchIndex", "Jobs"} {
+			res = append(res, table+" "+strings.Join(queryStrings(t, c, "SELECT COUNT(*) FROM "+table), ""))
+		}
+		return res
+	}
+	before := counts()
+	if err := Import(dbPath, c.mediaPath, archivePath); err != nil {
+		t.Fatal(err)
+	}
+	if after := counts(); !reflect.DeepEqual(before, after) {
+		t.Errorf("importing again changed the row counts from %q to %q", before, after)
+	}
+}
@@ -1,10 +1,9 @@
 package main
 
 import (
-	"encoding/json"
 	"flag"
-	"io/ioutil"
 	"log/syslog"
+	"net/http"
 
 	"filippo.io/mostly-harmless/covfefe"
 	log "github.com/sirupsen/logrus"
@@ -14,7 +13,9 @@ import (
 func main() {
 	dbFile := flag.String("db", "twitter.db", "The path of the SQLite DB")
 	mediaPath := flag.String("media", "twitter-media", "The folder to store media files in")
-	credsFile := flag.String("creds", "creds.json", "The path of the credentials JSON")
+	credsFile := flag.String("creds", "creds.json", "The path of the credentials file")
+	credsKeyFile := flag.String("creds-key", "", "The file containing the credentials passphrase (default $"+covfefe.CredentialsPassphraseEnv+")")
+	metricsAddr := flag.String("metrics", "127.0.0.1:6053", "The address to serve /metrics and /healthz on, or empty to disable")
 	syslogFlag := flag.Bool("syslog", false, "Also log to syslog")
 	debugFlag := flag.Bool("debug", false, "Enable debug logging")
 	flag.Parse()
@@ -30,16 +31,21 @@ func main() {
 		log.AddHook(hook)
 	}
 
-	credsJSON, err := ioutil.ReadFile(*credsFile)
+	secret, err := covfefe.CredentialsSecret(*credsKeyFile)
 	if err != nil {
-		log.WithError(err).Fatal("Failed to read credentials file")
+		log.WithError(err).Fatal("Failed to read credentials passphrase")
 	}
-	creds := &covfefe.Credentials{}
-	if err := json.Unmarshal(credsJSON, creds); err != nil {
-		log.WithError(err).Fatal("Failed to parse credentials file")
+	store := covfefe.OpenCredentials(*credsFile, secret)
+
+	if *metricsAddr != "" {
+		go func() {
+			log.WithField("address", *metricsAddr).Info("Serving metrics")
+			err := http.ListenAndServe(*metricsAddr, covfefe.MetricsHandler())
+			log.WithError(err).Error("Metrics listener failed")
+		}()
 	}
 
-	if err := covfefe.Run(*dbFile, *mediaPath, creds); err != nil {
+	if err := covfefe.Run(*dbFile, *mediaPath, store); err != nil {
 		log.WithError(err).Fatal("Failed to run fetcher")
 	}
 }
@@ -0,0 +1,76 @@
+// Command creds inspects and edits the encrypted credentials file.
+//
+//	creds [-creds creds.json] [-creds-key file] show|dump|load
+//
+// show lists the accounts and whether they are active, dump prints the
+// decrypted JSON, and load replaces the contents with JSON from stdin. load
+// can also be used to encrypt a legacy plaintext file, by piping dump into it.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"text/tabwriter"
+
+	"filippo.io/mostly-harmless/covfefe"
+	log "github.com/sirupsen/logrus"
+)
+
+func main() {
+	credsFile := flag.String("creds", "creds.json", "The path of the credentials file")
+	credsKeyFile := flag.String("creds-key", "", "The file containing the credentials passphrase (default $"+covfefe.CredentialsPassphraseEnv+")")
+	flag.Parse()
+
+	secret, err := covfefe.CredentialsSecret(*credsKeyFile)
+	if err != nil {
+		log.WithError(err).Fatal("Failed to read credentials passphrase")
+	}
+	store := covfefe.OpenCredentials(*credsFile, secret)
+
+	switch flag.Arg(0) {
+	case "", "show":
+		creds, err := store.Load()
+		if err != nil {
+			log.WithError(err).Fatal("Failed to load credentials")
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "ACCOUNT\tID\tSTATUS")
+		for _, a := range creds.Accounts {
+			status := "active"
+			switch {
+			case a.Revoked != nil:
+				status = fmt.Sprintf("revoked at %v: %s", a.Revoked, a.RevokedReason)
+			case a.UserID == 0:
+				status = "not verified yet"
+			}
+			fmt.Fprintf(w, "@%s\t%d\t%s\n", a.ScreenName, a.UserID, status)
+		}
+		w.Flush()
+	case "dump":
+		creds, err := store.Load()
+		if err != nil {
+			log.WithError(err).Fatal("Failed to load credentials")
+		}
+		out, err := json.MarshalIndent(creds, "", "    ")
+		if err != nil {
+			log.WithError(err).Fatal("Failed to marshal credentials")
+		}
+		os.Stdout.Write(append(out, '\n'))
+	case "load":
+		in, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			log.WithError(err).Fatal("Failed to read stdin")
+		}
+		if err := store.Update(func(creds *covfefe.Credentials) error {
+			*creds = covfefe.Credentials{}
+			return json.Unmarshal(in, creds)
+		}); err != nil {
+			log.WithError(err).Fatal("Failed to save credentials")
+		}
+	default:
+		log.WithField("command", flag.Arg(0)).Fatal("Unknown command")
+	}
+}
@@ -1,29 +1,30 @@
 package main
 
 import (
-	"encoding/json"
 	"flag"
 	"fmt"
-	"io/ioutil"
 	"os"
 
 	"filippo.io/mostly-harmless/covfefe"
+	twitterAPI "github.com/dghubble/go-twitter/twitter"
 	"github.com/dghubble/oauth1"
 	"github.com/dghubble/oauth1/twitter"
 	log "github.com/sirupsen/logrus"
 )
 
 func main() {
-	credsFile := flag.String("creds", "creds.json", "The path of the credentials JSON")
+	credsFile := flag.String("creds", "creds.json", "The path of the credentials file")
+	credsKeyFile := flag.String("creds-key", "", "The file containing the credentials passphrase (default $"+covfefe.CredentialsPassphraseEnv+")")
 	flag.Parse()
 
-	credsJSON, err := ioutil.ReadFile(*credsFile)
+	secret, err := covfefe.CredentialsSecret(*credsKeyFile)
 	if err != nil {
-		log.WithError(err).Fatal("Failed to read credentials file")
+		log.WithError(err).Fatal("Failed to read credentials passphrase")
 	}
-	creds := &covfefe.Credentials{}
-	if err := json.Unmarshal(credsJSON, creds); err != nil {
-		log.WithError(err).Fatal("Failed to parse credentials file")
+	store := covfefe.OpenCredentials(*credsFile, secret)
+	creds, err := store.Load()
+	if err != nil {
+		log.WithError(err).Fatal("Failed to load credentials")
 	}
 
 	config := oauth1.Config{
@@ -34,7 +35,7 @@ func main() {
 	}
 
 	var requestToken string
-	if len(os.Args) == 1 {
+	if flag.NArg() == 0 {
 		newToken, _, err := config.RequestToken()
 		if err != nil {
 			log.WithError(err).Fatal("RequestToken failed")
@@ -46,7 +47,7 @@ func main() {
 		fmt.Fprintf(os.Stderr, "URL: %s\n", authorizationURL.String())
 		requestToken = newToken
 	} else {
-		requestToken = os.Args[1]
+		requestToken = flag.Arg(0)
 	}
 
 	fmt.Fprintf(os.Stderr, "Paste your PIN here: ")
@@ -60,14 +61,19 @@ func main() {
 		log.WithError(err).Fatal("AccessToken failed")
 	}
 
-	creds.Accounts = append(creds.Accounts, covfefe.Account{
-		Token: accessToken, TokenSecret: accessSecret,
+	client := twitterAPI.NewClient(config.Client(oauth1.NoContext, oauth1.NewToken(accessToken, accessSecret)))
+	user, _, err := client.Accounts.VerifyCredentials(&twitterAPI.AccountVerifyParams{
+		SkipStatus: twitterAPI.Bool(true),
 	})
-
-	res, err := json.MarshalIndent(creds, "", "\t")
 	if err != nil {
-		log.WithError(err).Fatal("MarshalIndent failed")
+		log.WithError(err).Fatal("VerifyCredentials failed")
+	}
+
+	if err := store.Enroll(covfefe.Account{
+		Token: accessToken, TokenSecret: accessSecret,
+		UserID: user.ID, ScreenName: user.ScreenName,
+	}); err != nil {
+		log.WithError(err).Fatal("Failed to save credentials")
 	}
-	os.Stdout.Write(res)
-	os.Stdout.WriteString("\n")
+	log.WithField("account", user.ScreenName).Info("Enrolled account")
 }
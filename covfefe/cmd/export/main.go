@@ -0,0 +1,71 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"crawshaw.io/sqlite"
+	"filippo.io/mostly-harmless/covfefe"
+	log "github.com/sirupsen/logrus"
+)
+
+func main() {
+	dbFile := flag.String("db", "twitter.db", "The path of the SQLite DB")
+	mediaPath := flag.String("media", "twitter-media", "The folder media files are stored in")
+	usersFlag := flag.String("users", "", "Comma-separated user IDs or handles to export")
+	fromFlag := flag.String("from", "", "Export tweets created from this date, as YYYY-MM-DD")
+	toFlag := flag.String("to", "", "Export tweets created up to this date, included, as YYYY-MM-DD")
+	sourceFlag := flag.String("source", "", "Export tweets received from this source, like tl:51049452")
+	formatFlag := flag.String("format", "jsonl", "The output format: "+strings.Join(covfefe.ExportFormats, ", "))
+	outFlag := flag.String("o", "-", "The output file, or - for stdout")
+	flag.Parse()
+
+	f := &covfefe.ExportFilter{Source: *sourceFlag}
+	if *usersFlag != "" {
+		f.Users = strings.Split(*usersFlag, ",")
+	}
+	if *fromFlag != "" {
+		t, err := time.Parse("2006-01-02", *fromFlag)
+		if err != nil {
+			log.WithError(err).Fatal("Invalid -from date")
+		}
+		f.From = t
+	}
+	if *toFlag != "" {
+		t, err := time.Parse("2006-01-02", *toFlag)
+		if err != nil {
+			log.WithError(err).Fatal("Invalid -to date")
+		}
+		f.To = t.AddDate(0, 0, 1)
+	}
+
+	if err := covfefe.Migrate(*dbFile); err != nil {
+		log.WithError(err).Fatal("Failed to migrate database")
+	}
+	conn, err := sqlite.OpenConn("file:"+*dbFile, 0)
+	if err != nil {
+		log.WithError(err).Fatal("Failed to open database")
+	}
+	defer conn.Close()
+
+	var w io.Writer = os.Stdout
+	if *outFlag != "-" {
+		out, err := os.Create(*outFlag)
+		if err != nil {
+			log.WithError(err).Fatal("Failed to create output file")
+		}
+		defer func() {
+			if err := out.Close(); err != nil {
+				log.WithError(err).Fatal("Failed to write output file")
+			}
+		}()
+		w = out
+	}
+
+	if err := covfefe.Export(conn, w, *formatFlag, f, *mediaPath); err != nil {
+		log.WithError(err).Fatal("Failed to export")
+	}
+}
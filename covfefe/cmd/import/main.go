@@ -0,0 +1,35 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"filippo.io/mostly-harmless/covfefe"
+	log "github.com/sirupsen/logrus"
+)
+
+func main() {
+	dbFile := flag.String("db", "twitter.db", "The path of the SQLite DB")
+	mediaPath := flag.String("media", "twitter-media", "The folder to store media files in")
+	debugFlag := flag.Bool("debug", false, "Enable debug logging")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] twitter-archive.zip...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *debugFlag {
+		log.SetLevel(log.DebugLevel)
+	}
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	for _, archive := range flag.Args() {
+		if err := covfefe.Import(*dbFile, *mediaPath, archive); err != nil {
+			log.WithError(err).WithField("archive", archive).Fatal("Failed to import archive")
+		}
+	}
+}
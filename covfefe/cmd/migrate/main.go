@@ -0,0 +1,33 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"filippo.io/mostly-harmless/covfefe"
+	log "github.com/sirupsen/logrus"
+)
+
+func main() {
+	dbFile := flag.String("db", "twitter.db", "The path of the SQLite DB")
+	dryRun := flag.Bool("n", false, "Only print the pending migrations")
+	flag.Parse()
+
+	if *dryRun {
+		pending, err := covfefe.PendingMigrations(*dbFile)
+		if err != nil {
+			log.WithError(err).Fatal("Failed to list migrations")
+		}
+		if len(pending) == 0 {
+			fmt.Println("The database is up to date.")
+		}
+		for _, m := range pending {
+			fmt.Printf("-- Migration %d: %s\n%s\n\n", m.Version, m.Description, m.SQL)
+		}
+		return
+	}
+
+	if err := covfefe.Migrate(*dbFile); err != nil {
+		log.WithError(err).Fatal("Failed to migrate database")
+	}
+}
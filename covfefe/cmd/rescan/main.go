@@ -11,8 +11,10 @@ import (
 
 func main() {
 	dbFile := flag.String("db", "twitter.db", "The path of the SQLite DB")
+	mediaPath := flag.String("media", "twitter-media", "The folder media files are stored in")
 	debugFlag := flag.Bool("debug", false, "Enable debug logging")
 	pprofFlag := flag.Bool("pprof", false, "Write a CPU profile")
+	fullFlag := flag.Bool("full", false, "Rebuild all derived tables instead of processing new messages")
 	flag.Parse()
 
 	if *debugFlag {
@@ -31,7 +33,7 @@ func main() {
 		defer pprof.StopCPUProfile()
 	}
 
-	if err := covfefe.Rescan(*dbFile); err != nil {
+	if err := covfefe.Rescan(*dbFile, *mediaPath, *fullFlag); err != nil {
 		log.WithError(err).Fatal("Failed to run rescan")
 	}
 }
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"flag"
+	"os"
+
+	"filippo.io/mostly-harmless/covfefe"
+	log "github.com/sirupsen/logrus"
+)
+
+func main() {
+	dbFile := flag.String("db", "twitter.db", "The path of the SQLite DB")
+	mediaPath := flag.String("media", "twitter-media", "The folder media files are stored in")
+	flag.Parse()
+
+	problems, err := covfefe.VerifyMedia(*dbFile, *mediaPath)
+	if err != nil {
+		log.WithError(err).Fatal("Failed to verify media")
+	}
+	for _, p := range problems {
+		log := log.WithFields(log.Fields{
+			"media": p.ID, "variant": p.Variant, "path": p.Path,
+		})
+		switch {
+		case os.IsNotExist(p.Err):
+			log.Error("Missing media")
+		case p.Err == covfefe.ErrCorruptBlob:
+			log.Error("Corrupt media")
+		default:
+			log.WithError(p.Err).Error("Failed to read media")
+		}
+	}
+	if len(problems) > 0 {
+		os.Exit(1)
+	}
+	log.Info("All media verified")
+}
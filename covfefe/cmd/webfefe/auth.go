@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"filippo.io/mostly-harmless/covfefe"
+)
+
+// A viewer is the logged in user a request is authorized as. Admins can see
+// every message, other users only the ones received by their own account,
+// according to the source IDs of the message.
+type viewer struct {
+	ID    int64
+	Admin bool
+}
+
+type viewerKey struct{}
+
+func viewerFromRequest(r *http.Request) *viewer {
+	v, _ := r.Context().Value(viewerKey{}).(*viewer)
+	return v
+}
+
+// visibleSQL is an SQL condition on a Messages row, true if it's visible to
+// the viewer whose visibleSources are bound to $visible.
+const visibleSQL = `($visible = '[]' OR EXISTS (
+	SELECT 1 FROM json_each(Messages.source) WHERE value IN (
+		SELECT value FROM json_each($visible))))`
+
+// visibleSources returns the JSON array of source IDs the viewer can see, or
+// an empty one if the viewer can see everything.
+func (v *viewer) visibleSources() string {
+	if v.Admin {
+		return "[]"
+	}
+	sources, _ := json.Marshal(covfefe.AccountSources(v.ID))
+	return string(sources)
+}
+
+// canSee returns whether the viewer can see a message with the given
+// Messages.source column.
+func (v *viewer) canSee(sourceJSON string) bool {
+	return len(v.seenSources(sourceJSON)) > 0
+}
+
+// seenSources returns the source IDs in the given Messages.source column that
+// the viewer can see. Other sources would reveal which other accounts
+// received the message.
+func (v *viewer) seenSources(sourceJSON string) []string {
+	var sources []string
+	if err := json.Unmarshal([]byte(sourceJSON), &sources); err != nil {
+		return nil
+	}
+	if v.Admin {
+		return sources
+	}
+	allowed := make(map[string]bool)
+	for _, s := range covfefe.AccountSources(v.ID) {
+		allowed[s] = true
+	}
+	var seen []string
+	for _, s := range sources {
+		if allowed[s] {
+			seen = append(seen, s)
+		}
+	}
+	return seen
+}
+
+func (s *Server) loggedIn(fn http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, _ := s.store.Get(r, "webfefe")
+		loggedIn, _ := session.Values["logged-in"].(bool)
+		id, ok := session.Values["twitter-user"].(int64)
+		if !loggedIn || !ok {
+			http.Redirect(w, r, "/login", http.StatusFound)
+			return
+		}
+		v := &viewer{ID: id, Admin: s.admins[id]}
+		fn(w, r.WithContext(context.WithValue(r.Context(), viewerKey{}, v)))
+	}
+}
+
+// admin is like loggedIn, but only lets admins through, for pages which are
+// not filtered by account.
+func (s *Server) admin(fn http.HandlerFunc) http.HandlerFunc {
+	return s.loggedIn(func(w http.ResponseWriter, r *http.Request) {
+		if !viewerFromRequest(r).Admin {
+			http.Error(w, "Only admins can see this page.", http.StatusForbidden)
+			return
+		}
+		fn(w, r)
+	})
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"crawshaw.io/sqlite"
+	"crawshaw.io/sqlite/sqlitex"
+	"filippo.io/mostly-harmless/covfefe"
+	"filippo.io/mostly-harmless/covfefe/cmd/webfefe/data"
+	"github.com/dghubble/oauth1"
+	"github.com/gorilla/sessions"
+	"github.com/shurcooL/httpfs/html/vfstemplate"
+)
+
+func newTestServer(t *testing.T) (s *Server, cleanup func()) {
+	dir, err := ioutil.TempDir("", "webfefe-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbPath := filepath.Join(dir, "twitter.db")
+	if err := covfefe.Migrate(dbPath); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	db, err := sqlitex.Open("file:"+dbPath, 0, 5)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	cleanup = func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+	s = &Server{
+		withConn: func(f func(conn *sqlite.Conn) error) error {
+			conn := db.Get(context.Background())
+			defer db.Put(conn)
+			return f(conn)
+		},
+		mediaPath:    filepath.Join(dir, "media"),
+		tmpl:         template.Must(vfstemplate.ParseGlob(data.Templates, nil, "*.tmpl")),
+		store:        sessions.NewCookieStore([]byte("test")),
+		oauth1Config: &oauth1.Config{},
+		admins:       map[int64]bool{1: true},
+	}
+	return s, cleanup
+}
+
+// loginCookie returns a session cookie for the given Twitter user ID.
+func loginCookie(t *testing.T, s *Server, id int64) *http.Cookie {
+	r := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	session, _ := s.store.Get(r, "webfefe")
+	session.Values["logged-in"] = true
+	session.Values["twitter-user"] = id
+	if err := session.Save(r, w); err != nil {
+		t.Fatal(err)
+	}
+	return w.Result().Cookies()[0]
+}
+
+func TestAuthorization(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+
+	// Tweet 10 was received on the home timeline of account 2, tweet 11 on
+	// the one of account 3, and tweet 12 by both.
+	if err := s.withConn(func(conn *sqlite.Conn) error {
+		for _, m := range []struct {
+			id, tweet int64
+			source    string
+		}{
+			{1, 10, `["tl:2"]`}, {2, 11, `["tl:3"]`}, {3, 12, `["at:3","lk:2"]`},
+		} {
+			json := fmt.Sprintf(`{"id": %d, "id_str": "%d", "full_text": "tweet %d",
+				"user": {"id": 5, "screen_name": "five"}}`, m.tweet, m.tweet, m.tweet)
+			if err := sqlitex.Exec(conn, `INSERT INTO Messages (id, json, source, kind)
+				VALUES (?, ?, ?, 'tweet');`, nil, m.id, json, m.source); err != nil {
+				return err
+			}
+			if err := sqlitex.Exec(conn, `INSERT INTO Tweets (id, created, user, message)
+				VALUES (?, '2019-01-02 10:00:00 +0000 UTC', 5, ?);`, nil, m.tweet, m.id); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	h := s.Handler()
+	get := func(path string, user int64) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", path, nil)
+		if user != 0 {
+			r.AddCookie(loginCookie(t, s, user))
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	for _, tc := range []struct {
+		path string
+		user int64
+		code int
+		body string
+	}{
+		{"/", 0, http.StatusFound, ""},
+		{"/id/10", 0, http.StatusFound, ""},
+		{"/", 1, http.StatusOK, "There are 3 entries in the database"},
+		{"/", 2, http.StatusOK, "There are 2 entries from your account"},
+		{"/", 4, http.StatusOK, "There are 0 entries from your account"},
+		{"/id/10", 1, http.StatusOK, "tweet 10"},
+		{"/id/11", 1, http.StatusOK, "tweet 11"},
+		{"/id/10", 2, http.StatusOK, "tweet 10"},
+		{"/id/12", 2, http.StatusOK, "tweet 12"},
+		{"/id/11", 2, http.StatusNotFound, ""},
+		{"/id/13", 2, http.StatusNotFound, ""},
+		{"/id/10", 3, http.StatusNotFound, ""},
+		{"/jobs", 1, http.StatusOK, "Background jobs"},
+		{"/jobs", 2, http.StatusForbidden, ""},
+		{"/thread/10", 2, http.StatusForbidden, ""},
+		{"/user/5", 2, http.StatusForbidden, ""},
+	} {
+		w := get(tc.path, tc.user)
+		if w.Code != tc.code {
+			t.Errorf("GET %s as %d: got status %d, expected %d", tc.path, tc.user, w.Code, tc.code)
+			continue
+		}
+		if !strings.Contains(w.Body.String(), tc.body) {
+			t.Errorf("GET %s as %d: body doesn't contain %q", tc.path, tc.user, tc.body)
+		}
+	}
+
+	// The tweet page only lists the sources of the viewer's account.
+	if body := get("/id/12", 2).Body.String(); !strings.Contains(body, "lk:2") || strings.Contains(body, "at:3") {
+		t.Errorf("tweet 12 for account 2 shows the wrong sources: %q", body)
+	}
+	if body := get("/id/12", 1).Body.String(); !strings.Contains(body, "lk:2") || !strings.Contains(body, "at:3") {
+		t.Errorf("tweet 12 for an admin shows the wrong sources: %q", body)
+	}
+
+	w := get("/export?format=jsonl", 3)
+	if w.Code != http.StatusOK {
+		t.Fatalf("export: got status %d", w.Code)
+	}
+	if body := w.Body.String(); strings.Contains(body, "tweet 10") ||
+		!strings.Contains(body, "tweet 11") || !strings.Contains(body, "tweet 12") {
+		t.Errorf("export for account 3 = %q", body)
+	}
+}
@@ -23,6 +23,20 @@ var Templates = func() http.FileSystem {
 			name:    "/",
 			modTime: time.Date(2019, 7, 7, 2, 18, 56, 119686666, time.UTC),
 		},
+		"/accounts.html.tmpl": &vfsgen۰CompressedFileInfo{
+			name:             "accounts.html.tmpl",
+			modTime:          time.Date(2026, 10, 16, 13, 8, 16, 562673569, time.UTC),
+			uncompressedSize: 473,
+
+			compressedContent: []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x5d\x50\x41\x4e\xc3\x30\x10\x3c\x93\x57\xac\xa2\x88\x53\xe5\x48\x1c\xc1\x8d\x40\xe2\xc2\xa5\x87\x56\x7d\x80\x71\x36\x8d\x95\xc4\x2e\xb6\x93\x0a\x59\xfe\x3b\xdb\x38\xa1\x85\x9b\x67\x76\x76\x67\x3c\x21\x78\x1c\xce\xbd\xf0\x08\x79\x8b\xa2\x66\xad\x1f\x7a\xe6\x89\xca\x63\xcc\x32\xde\x3e\x55\x6f\x52\x9a\x51\x7b\xc7\x4b\x02\x59\x16\x82\x15\xfa\x84\xc0\x68\xfe\xc0\xcf\x55\x08\xaa\x01\x76\x74\x68\x3f\xde\x63\xe4\x02\x5a\x8b\xcd\x36\x2f\x47\x62\xca\x10\x7e\x27\x79\xf5\x4a\xe8\x20\x2d\xa2\xde\x89\x01\x49\x5b\x0a\xda\xc6\xde\xd1\xfb\xa8\x3b\x6d\x2e\x1a\x44\x32\x23\x5a\xd7\x57\x83\xc7\x41\xd5\xb5\xf1\x2f\x90\x6c\xf6\x38\x99\x0e\x69\xc2\x9d\xb7\x46\x9f\x2a\x9b\x08\x5e\x2e\x18\x84\x27\xe9\x4d\x97\xee\xc3\x7d\x44\x21\xbd\x9a\x70\x35\xd6\xc6\xc3\x84\x56\x35\x0a\x6b\xf8\xc6\x9b\x73\x08\x17\xe5\x5b\x60\x07\x33\x5a\x89\x2e\xc6\xbb\x28\xa9\x81\x42\x6d\xa0\x70\xf0\xbc\xbd\x76\x31\xe7\x2b\x54\x8c\x1b\x58\x4e\x84\x50\xb8\x39\x40\x02\xff\xce\x2e\x09\xf7\x28\x9c\xd1\xf4\x9f\xcf\xde\xc8\xee\x6b\x34\x1e\xa9\x13\x76\x2d\xe7\x0f\x93\xb6\xd7\xd0\x73\xf1\x3b\xb3\xb6\xe5\x00\xb5\x35\x7d\x8f\x35\xcb\x56\xe9\x0f\x9e\x85\x4e\x52\xd9\x01\x00\x00"),
+		},
+		"/export.html.tmpl": &vfsgen۰CompressedFileInfo{
+			name:             "export.html.tmpl",
+			modTime:          time.Date(2026, 10, 16, 13, 3, 31, 606656551, time.UTC),
+			uncompressedSize: 826,
+
+			compressedContent: []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x75\x92\xcf\x6e\xd4\x30\x10\xc6\xcf\xe4\x29\x46\x3e\x97\x04\xaa\xf6\x00\xca\xe6\xd4\x22\x71\x43\x42\x3c\x80\x37\x9e\xc4\x06\xff\x93\x3d\xd9\x74\x89\xf6\xdd\x19\x7b\xb7\xa5\xc0\x72\x8a\xfd\x65\xbe\xf9\x8d\xed\x6f\xdb\x08\x5d\xb4\x92\x10\x84\x46\xa9\x5a\x4d\xce\xb6\xc4\x92\x38\x9d\x9a\xa6\xd7\xb7\xc3\xe3\x53\x0c\x89\xfa\x8e\x97\x2c\xc4\xe1\x21\xac\xde\x06\xa9\x40\x5a\x0b\xb4\x22\x52\x06\x27\x69\xd4\xc6\xcf\x40\x1a\x61\x32\x96\x30\xe5\x1b\x30\x7e\xb4\x8b\x2a\xb2\x42\x8b\x84\x0a\x82\xc7\xdc\xc2\xa3\x8b\x74\x6c\x2e\x65\x67\x2f\xe0\x01\xd3\x91\x4a\x8f\x96\x29\x53\x48\x0e\xe4\x48\x26\xf8\x9d\xe8\xb0\x4e\x20\xc0\x21\xe9\xa0\x76\x62\x46\x12\x43\xf3\x86\x67\xe9\x8d\x8f\x0b\x01\x1d\x23\xee\x04\xe1\x13\x17\x79\xe9\x78\xbd\x64\x6e\x2d\xe0\x20\xed\xc2\xbb\x6d\x6b\xbf\xc8\x24\x5d\x6e\xab\x7e\x3a\x09\xe0\x33\x8f\xa8\x83\x55\x98\x76\xe2\x1b\xab\xa0\xa5\x57\x16\x33\x84\x04\x9f\x1f\x78\xfa\x31\x38\x27\xdf\x66\x8c\xec\xe4\xd9\x2b\xf1\x7f\xb8\x1c\x96\x34\xe2\x15\xde\xf9\xc7\x3f\xc0\xaf\x55\xbe\x01\x6b\x7e\x20\x90\xfd\x78\xff\xfe\xdd\xdd\x87\xbb\xfb\xdb\x6b\xc7\x52\x4c\x7f\xe6\x4c\x29\xb8\x2b\x94\x22\x33\xe3\xef\x09\x5f\x3b\x29\x5c\xf1\x51\xb8\xb8\xe2\xb0\x6d\x49\xfa\x19\xa1\xfd\xc4\x57\x2f\x89\xef\xa8\xdf\x2f\x44\xc1\x5f\x7a\xe5\x65\xef\xcc\xcb\x79\xa7\x5a\xf4\xba\x63\x69\x54\x3f\x7d\x77\xf6\x71\xdb\x6d\x43\xaf\x38\x46\x7d\x57\xea\xcf\xe9\xe9\x33\xa5\xe0\xe7\xe1\x7b\x0e\xde\xf6\xdd\x65\x07\x26\xd7\xe8\x24\xb9\xf2\x2b\xe7\x2c\x67\xe4\x17\xe0\xb4\x40\xe4\x97\xb1\xc6\x63\x0b\xcf\xce\x31\x1f\x5e\x7c\x0d\xfb\x4a\x55\x0a\x6b\xad\xac\x71\xfc\x5d\x5a\xc2\xfc\x07\x43\xc2\x4f\x13\x21\x4c\xbc\xc8\x24\xc9\x8c\x10\x19\x05\xab\x21\x5d\xf8\x8d\x43\x65\x64\x09\x70\xc1\xaf\xda\x70\x30\x47\xe9\x61\x8f\xb0\x67\x44\x2e\x09\x9e\xa6\x3a\x4e\xf3\x0b\x16\x03\x81\xaa\x3a\x03\x00\x00"),
+		},
 		"/head.html.tmpl": &vfsgen۰CompressedFileInfo{
 			name:             "head.html.tmpl",
 			modTime:          time.Date(2019, 5, 8, 23, 47, 8, 109530808, time.UTC),
@@ -30,23 +44,59 @@ var Templates = func() http.FileSystem {
 
 			compressedContent: []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x84\x53\x4d\x73\xd3\x30\x10\xbd\xfb\x57\x2c\x9a\xe1\x56\x37\x71\x29\xd0\x31\x56\x18\x28\x3d\x70\x82\x61\x60\x06\x8e\x8a\xb5\xb1\x76\x2a\x4b\x46\x5a\x3b\x09\x1f\xff\x9d\xb1\x9d\x26\x71\x9a\x29\x3a\xd8\x92\xde\x6a\xf5\xde\xd3\x6e\xf1\xec\xc3\xa7\xdb\xaf\x3f\x3e\xdf\x81\xe1\xda\x2e\x92\xa2\xff\x81\x55\xae\x92\x02\x9d\x58\x24\x49\x61\x50\xe9\x45\x02\x00\x50\xd4\xc8\x0a\x4a\xa3\x42\x44\x96\xa2\xe5\x55\x7a\x23\x8e\x21\xc3\xdc\xa4\xf8\xb3\xa5\x4e\x8a\xef\xe9\xb7\x77\xe9\xad\xaf\x1b\xc5\xb4\xb4\x28\xa0\xf4\x8e\xd1\xb1\x14\x1f\xef\x24\xea\x0a\x27\x27\x9d\xaa\x51\x8a\x8e\x70\xdd\xf8\xc0\x47\xc1\x6b\xd2\x6c\xa4\xc6\x8e\x4a\x4c\x87\xc5\x05\x90\x23\x26\x65\xd3\x58\x2a\x8b\x32\xeb\x59\x0e\x99\x98\xd8\xe2\xe2\xd6\x77\x2b\x5c\x61\x31\x1b\x97\x3b\xcc\x92\xbb\x07\x13\x70\x25\x45\xcf\x32\xe6\xb3\xd9\xca\x3b\x8e\x97\x95\xf7\x95\x45\xd5\x50\xbc\x2c\x7d\x3d\x2b\x63\x7c\xbb\x52\x35\xd9\xad\x7c\x4f\xcc\x18\xfe\x7c\x51\x16\xd7\x6a\x2b\x20\xa0\x95\x22\xf2\xd6\x62\x34\x88\xbc\xbf\x76\xd8\x1a\xc5\xf4\xe3\xb2\xe7\xae\xc8\x61\x80\xdf\xfb\xcd\x7e\x0c\xec\x73\x50\x2d\xfb\x37\x13\xa0\x56\x9b\x74\x07\xbe\x9e\xcf\x9b\xcd\x14\x6d\x94\xd6\xe4\xaa\x1c\xb2\x1e\x83\xec\x65\xb3\x81\xf9\x21\xe4\x6f\xb2\x9f\x2e\xbd\xde\x9e\xdc\xd9\x6b\x4c\x47\x3d\x39\x88\x07\x29\x67\x4f\x9b\xec\xe2\x30\xbf\x7a\x32\xcf\xe8\xcc\xf9\x34\xe4\x9a\x96\x4f\x4e\xef\x25\xdc\x9c\x8a\x1b\xf2\x46\xfa\x85\xf9\x20\xec\x0c\xf8\x04\xf9\xc1\x3b\x72\x0f\xde\x5d\xcf\x9f\x4f\x31\x83\x54\x19\xce\x21\xbb\x3e\xce\x7c\x6c\x58\xcb\xec\xdd\x39\xa9\x23\xa5\xab\x47\x8f\xd1\x61\x60\x2a\x95\x4d\x95\xa5\xca\xe5\xb0\xf4\xcc\xbe\x9e\xc6\x2c\x55\x79\x5f\x05\xdf\x3a\x9d\x83\xf3\x0e\x4f\x50\x1f\x34\x86\x1c\xb2\x66\x03\xd1\x5b\xd2\x60\x7b\x96\x55\xc0\xed\xb9\xc0\x34\x28\x4d\x6d\xcc\xe1\x3f\xee\x3c\x7a\x92\x89\xef\x2f\x9a\x0d\xbc\x9a\x9a\xd0\x7f\x8b\xd9\xae\x76\x8b\xd9\xd8\xe5\x49\xd1\xd7\xd0\xae\x31\x35\x75\x50\x5a\x15\xa3\x14\xfb\x92\x16\x87\x3a\x2f\x4c\x76\xe8\x35\x93\x2d\x92\x7f\x01\x00\x00\xff\xff\xc5\x19\x1f\xc9\x4c\x04\x00\x00"),
 		},
-		"/home.html.tmpl": &vfsgen۰FileInfo{
-			name:    "home.html.tmpl",
-			modTime: time.Date(2019, 5, 8, 23, 47, 10, 395147216, time.UTC),
-			content: []byte("\x7b\x7b\x74\x65\x6d\x70\x6c\x61\x74\x65\x20\x22\x68\x65\x61\x64\x2e\x68\x74\x6d\x6c\x2e\x74\x6d\x70\x6c\x22\x7d\x7d\x0a\x0a\x3c\x70\x3e\x54\x68\x65\x72\x65\x20\x61\x72\x65\x20\x7b\x7b\x2e\x7d\x7d\x20\x65\x6e\x74\x72\x69\x65\x73\x20\x69\x6e\x20\x74\x68\x65\x20\x64\x61\x74\x61\x62\x61\x73\x65\x2e\x0a"),
+		"/home.html.tmpl": &vfsgen۰CompressedFileInfo{
+			name:             "home.html.tmpl",
+			modTime:          time.Date(2026, 10, 16, 13, 8, 16, 656348467, time.UTC),
+			uncompressedSize: 427,
+
+			compressedContent: []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x6d\x50\xc1\x4e\xc5\x20\x10\x3c\xdb\xaf\xd8\x70\xf0\xd8\x7e\x80\x94\xe4\x69\xfc\x02\x8d\x77\x5a\xb6\x0f\xb4\x40\x85\xad\xbe\x17\xc2\xbf\xbb\xed\x6b\x62\x4c\x3c\x10\x26\xb3\x33\xcb\x0c\xa5\x10\xfa\x65\xd6\x84\x20\x2c\x6a\xd3\x5a\xf2\x73\x4b\x4c\x89\x5a\x9b\x46\x2e\xea\xd5\x62\x42\xd0\x7c\x4a\x69\x9f\xe2\x1a\xa8\x56\xc0\x40\xc9\x61\x66\xca\x4d\xd0\xbe\x39\xfc\xc6\xd4\x9e\x8c\x77\xa1\x56\x17\x80\x2c\x82\xd1\xa4\x07\x9d\xb1\x14\x9c\x33\xd6\x3a\xa5\xe8\xe1\x1a\xd7\x04\x7a\x1c\xb7\x35\x3c\x08\xa6\xd6\x96\x5f\x99\x62\xf2\x4c\x93\x8b\xa1\x17\x5d\x46\x9d\x46\x2b\xc0\x23\xd9\x68\x7a\x71\x46\x12\xaa\xb9\x93\x2e\x2c\x2b\x01\x5d\x17\xec\x05\xe1\x85\x04\x04\xed\x19\x7f\x0a\xe0\x06\x23\xda\x38\x1b\x4c\xbd\x78\xd9\xfd\x7b\x88\x0d\xb8\x2f\xdc\xed\xc3\x4a\x14\xc3\xe1\xcf\xeb\xe0\x1d\xaf\xbd\x69\x65\x77\x1b\xaa\x46\x76\x5b\x16\xb5\x37\xff\xaf\x9c\xd4\x60\x13\x4e\x9c\xf2\x3d\x0e\x59\xa8\x47\x3d\x7e\x9c\x13\xd7\x31\xb0\x11\xb2\xd3\x0a\xee\xbd\x33\x26\xd2\x03\xfc\x8a\x8f\xca\x6c\x38\x1d\xe8\xaf\xf2\xf8\x8b\x5f\x03\x5e\x96\x98\x38\xdf\xf3\x7e\x6f\xe2\xe6\x07\xc3\x92\x12\xe9\xab\x01\x00\x00"),
+		},
+		"/jobs.html.tmpl": &vfsgen۰CompressedFileInfo{
+			name:             "jobs.html.tmpl",
+			modTime:          time.Date(2026, 10, 16, 12, 53, 59, 301207066, time.UTC),
+			uncompressedSize: 447,
+
+			compressedContent: []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x85\x50\xcb\x6a\xc3\x30\x10\x3c\xc7\x5f\xb1\xb8\xd0\xa3\x02\xc9\xb1\xc6\x90\x3e\x02\xa5\x25\x97\x7e\x81\x62\xad\x6d\x35\xb6\xe5\xc8\x6b\xda\x22\xf4\xef\xdd\x55\x9d\x50\x7a\xe9\x49\xd2\xcc\xce\x43\x1b\x02\x61\x3f\x76\x9a\x10\xf2\x16\xb5\x51\x2d\xf5\x9d\x22\x86\xf2\x18\xb3\xac\x68\x37\xe5\xbd\xae\x4e\x8d\x77\xf3\x60\xe0\xdd\x1d\xa7\x62\xcd\x58\x96\x85\xe0\xf5\xd0\x20\xa8\x07\x66\x68\xe2\xe1\x55\x31\x96\x21\xa8\x17\x3b\x98\x18\xe1\xb6\xb7\xc6\x38\xba\x03\x86\xde\x48\xd3\x3c\xfd\x01\x93\x8e\x65\x21\x60\x37\xe1\xa2\x3f\xb8\x94\x01\x5f\x48\x4a\x18\xb1\x92\xac\x0f\x4b\x2d\xa8\xbd\xb6\x1d\x9a\x34\xda\x6e\xcb\x57\x3d\x11\xd4\x0c\xcd\x1e\xa5\xd5\xb6\xcc\x56\xd7\x56\x32\x24\x86\x37\x9c\xf4\xfc\xc8\xd1\xff\x34\xd3\x35\xa1\x17\x64\x47\xb2\x10\x4a\xd8\x72\x65\xa7\x10\x6c\x0d\x78\x86\x45\x00\xf9\xc8\xd5\xec\xd0\xf0\x92\xae\x76\x03\x7e\x12\x6b\xc4\xe4\xc0\xd7\xc5\x28\xc6\xcb\x37\xb8\xcf\xd1\x97\x45\xe5\x0c\xca\x9e\x76\xbe\xe1\x90\x62\x9d\xde\x89\xec\x5c\x75\x3a\xcf\x8e\x12\xfd\xe4\xbd\xf3\xc2\xff\x82\xe5\x7f\x3f\x5e\x97\xf3\x1b\x9c\x83\x04\xcc\xbf\x01\x00\x00"),
+		},
+		"/search.html.tmpl": &vfsgen۰CompressedFileInfo{
+			name:             "search.html.tmpl",
+			modTime:          time.Date(2026, 10, 16, 13, 5, 35, 186413050, time.UTC),
+			uncompressedSize: 1119,
+
+			compressedContent: []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x85\x93\x5d\x6f\xd3\x30\x14\x86\xaf\x97\x5f\x71\x64\x21\xb4\x49\x90\xb4\xd3\x76\x01\xa4\x11\x88\x6a\x82\x3b\xb4\x32\xee\xdd\xe4\xb4\xb6\xea\xd8\xa9\x73\x42\x37\x45\xfe\xef\xd8\xf9\xe8\x07\x0b\xe2\xaa\xc7\xe7\xe3\x7d\xde\xd8\xa7\x6d\x4b\x58\x56\x8a\x13\x02\x13\xc8\x8b\x58\x50\xa9\x62\xf2\x29\xe6\x5c\x14\xa5\xe2\x36\x5b\x21\xb7\xb9\x48\x13\x1f\xfa\xc4\xc6\xd8\x12\x78\x4e\xd2\xe8\x05\x4b\xea\xae\xc6\xa0\x44\x12\xa6\x58\xb0\x2d\x12\xcb\xa2\xab\xb4\xca\x52\xa9\xab\x86\x80\x5e\x2a\x5c\x30\xc2\x67\x62\xa0\x79\xe9\xe3\x3d\x83\xdf\x5c\x35\x3e\x6a\xdb\xf8\x07\xb7\xbc\xac\xe3\xbd\x73\x0c\xbc\x8b\x1c\x85\x51\x05\xda\x05\x7b\x68\x94\x7a\x1f\xc6\x60\xdf\xa0\x7d\xe9\x44\xd7\x0d\x91\xd1\x83\x64\xdd\xac\x4b\xe9\x61\xa3\xbb\xbe\xf8\x1f\x76\x53\xa3\x9d\xc0\x87\xf4\x2b\x07\x4f\x3e\x09\x82\xeb\x42\x21\x18\x0b\xdf\x97\x9d\x87\x7f\x29\xd7\xa6\xb1\x39\x4e\x68\xf7\x85\x57\xea\xab\x2e\xfd\x0e\x94\xdc\x21\x90\xfa\x78\x3f\x9f\xdd\x7d\xb8\xbb\xbf\x9d\xba\xbd\xc2\xbf\xce\xc8\xd9\x58\x53\x4e\x50\x42\xda\x33\xfe\x76\x78\x3e\x49\x66\x62\x8e\xcc\x30\xa5\xf8\x1a\xd5\x25\x36\x17\x98\xef\xd6\xe6\x79\x14\x28\x50\x21\x61\x71\x54\x99\x33\x68\x5b\xb9\x81\x51\x6b\xa8\x3b\xd7\x0d\x62\xd1\xb6\xa8\xfd\x29\x83\x65\x5f\x00\xa3\xd5\x4b\x9a\xf4\xa4\x28\x4d\xc2\x26\xf9\x8d\xba\xd0\xf0\x8b\xd0\x7d\x7f\xdb\x2a\xd4\x10\x3f\x62\xdd\x28\xaa\x9d\x03\xdb\x47\x5d\x33\xee\xe1\xfa\xbc\x7c\x03\xf3\xd9\xcc\xf7\x5c\x07\x00\x90\x40\x58\x63\x4d\x21\x09\xdc\x22\xd4\xc2\x1c\xf4\xcd\xe0\x26\x4e\x93\x2a\x8b\x86\x43\x80\x5b\xae\xb7\x78\x46\x1a\xf0\x1e\xf3\x26\xfe\x25\xf1\x80\x36\xfe\x52\x94\x52\x3b\x97\x72\x10\x16\x37\x7e\xeb\xc3\xbe\x24\xfe\x12\x9f\xfa\xbd\xc9\x06\xb9\xb6\x3d\x48\x12\x10\x7f\xeb\x96\xc6\xb9\xcf\xbe\x25\x64\x51\xd5\x18\x7e\x87\xfe\x63\xf7\x14\x23\xe1\xa3\x5a\x74\xd5\xdf\xcc\xcf\x03\x22\x39\xf7\xb6\x94\x45\x61\xe8\x13\x9c\x6c\xc8\x22\x98\x18\xea\xc1\x45\xfc\xd5\x22\xef\x9e\xe0\x42\xe7\x38\xea\x3b\x1e\x24\xaa\x11\x1e\x2f\xc7\x17\x83\x93\x7a\x4d\xd6\xe8\x6d\x36\x3c\x66\x9a\x0c\xe7\xa3\x58\xba\x56\x26\xdf\xed\x1b\x43\x18\x88\x2b\x2d\xab\x2a\xf0\xfd\x3f\xf0\x54\x38\x5e\xf0\x1f\xb7\xe4\x04\xb5\x5f\x04\x00\x00"),
+		},
+		"/thread.html.tmpl": &vfsgen۰CompressedFileInfo{
+			name:             "thread.html.tmpl",
+			modTime:          time.Date(2026, 10, 16, 12, 57, 50, 692733526, time.UTC),
+			uncompressedSize: 685,
+
+			compressedContent: []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x65\x92\x4d\x4e\xc3\x30\x10\x85\xd7\xcd\x29\x46\x59\x20\x58\x60\x57\x2c\x4b\x1a\x21\xb5\x0b\x10\x42\x62\x51\x0e\xe0\x36\xd3\xd8\x22\xb1\x5b\x7b\xda\x82\xa2\xdc\x9d\x71\x9a\x26\x50\x56\xf1\xdf\xfb\xde\xbc\x99\x34\x0d\x61\xbd\xab\x14\x21\xa4\x1a\x55\x21\x34\xd5\x95\x20\x3e\x4a\xdb\x36\x49\x32\xfd\x90\x2f\x9c\x3d\xa2\x0f\x8a\x8c\xb3\xa0\xbc\x3b\xd8\x02\x9a\x46\xbc\x2c\xdb\x36\x93\x7c\x9f\x24\x4d\xe3\x95\x2d\x11\xc4\x4a\x7b\x66\xb0\x70\x92\x15\xe6\x08\x81\xbe\x2b\x9c\xa7\xb5\xf2\xa5\xb1\xf7\x15\x6e\x69\xc6\x4a\xb3\x85\x92\x40\x2c\x71\x47\x1a\xa6\x6d\xcb\xac\x6e\x1d\x57\x58\x05\x6c\xdb\x29\x2f\x2c\x63\xb0\x4e\xf3\x64\xd2\x29\xc4\x9b\x09\xc1\xd8\x32\xb2\x27\xd9\x2e\xcf\x14\xb0\xd7\x76\x9e\x6a\xa2\x5d\x98\x49\x49\x27\x43\x84\x5e\x6c\x5c\x2d\x8d\x3c\xe1\x5a\x06\x52\x74\x08\xb2\x2f\x35\xcd\x87\x9a\x55\x0e\x37\xb5\x29\x0a\x47\x8f\x60\x1d\x81\xb1\x40\x1a\x39\xda\x46\x9b\x23\x46\xc3\x73\x19\x57\x4e\xf2\x10\xd0\x47\xdc\x07\x7f\xcf\x40\xf6\xd4\x20\x9e\x95\x2d\x2a\x7e\xff\xc4\x77\x63\x88\xe1\x61\x1f\x26\xfa\x32\x71\x70\x1e\xb9\xa6\xf8\x53\xe4\x82\x7b\x48\x38\x2a\xba\xfc\xb8\x07\xf1\x6a\xb8\xf3\xe9\xfe\xe0\x08\x79\x38\x03\x28\x1e\x70\x67\xe2\x4c\xde\x95\x47\x4b\x83\xe5\x45\xcc\xfd\xad\xb0\x43\x8e\xee\x81\xbc\xb3\x65\x5e\x9c\x6f\x32\xd9\xef\xe1\x36\x20\xf2\x98\x09\xba\xb1\xf4\xb2\xbb\x2b\x60\xac\x66\x98\xdf\x3f\x26\x69\x13\x80\x4e\x88\x34\x60\x47\x7d\xb6\xae\xdc\xe6\xb3\x0b\x11\xc3\xae\xf0\x8b\x62\xd2\x5f\xa7\xdd\x00\xce\xaf\x33\xc9\xbf\x51\x9e\x5c\xf6\x3f\xe0\xc5\xcf\x6f\xad\x02\x00\x00"),
 		},
 		"/tweet_page.html.tmpl": &vfsgen۰CompressedFileInfo{
 			name:             "tweet_page.html.tmpl",
-			modTime:          time.Date(2019, 7, 13, 20, 45, 50, 803696399, time.UTC),
-			uncompressedSize: 732,
+			modTime:          time.Date(2026, 10, 16, 13, 5, 35, 186022997, time.UTC),
+			uncompressedSize: 821,
+
+			compressedContent: []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x95\x52\xc1\x4e\x83\x40\x10\x3d\x97\xaf\xd8\xf0\x01\x6c\x62\x7b\x6a\xd6\x8d\x8d\xc6\x44\x0f\x35\x4a\xf5\x4e\xd9\x21\x10\x81\xc5\x65\xb0\x26\x84\x7f\x77\x86\x2d\x4a\x4d\x35\xf1\x02\xbb\x6f\x66\xde\xbc\x79\xb3\x7d\x8f\x50\x35\x65\x82\x20\xc2\x1c\x12\x13\xe5\x58\x95\x11\x12\x14\x0e\x43\x10\xf4\xbd\x81\xac\xa8\x29\x88\x07\x00\x64\x6c\xa1\x1a\xdd\xf7\xd1\x73\x0b\x2e\xda\x26\x15\x0c\x83\x50\x89\xc8\x1d\x64\x97\x61\x8e\xd8\xb4\x6b\x29\xf1\x50\x20\x52\x3c\xb5\x95\x9c\x72\xe3\xd4\x01\xd4\xbe\x22\xd4\x57\xe7\x60\x25\x13\x3d\xf2\xab\x7d\x69\xd3\xd7\xb7\xce\x22\x50\x2f\x22\xcb\x45\x74\xdb\x95\xe5\x0e\x3e\x70\x18\xa8\x94\x3f\x50\xb6\x30\x5e\x26\x14\x6a\xc3\x1c\xb3\x5a\x4f\xf6\x5f\x75\xb2\xc5\x04\xbb\x96\x63\x77\x37\x2c\x96\x0e\xd7\x0e\xc8\x23\xb3\xc1\xa3\xca\x63\xb7\x20\x50\xf9\x85\xde\xb1\x37\xa2\xee\xaa\x3d\x38\xc1\x82\xf8\x3e\xd6\x2a\x49\x61\xb6\xf1\xdb\x65\x6f\xa4\xf0\x49\xde\x63\x3f\xa0\xaf\x7a\x82\x31\x01\x4c\x3c\x8a\x18\x0d\xcf\x97\xfa\x08\x0b\x9b\x89\xa3\x2c\xa2\x5e\xd2\x80\xe7\xa8\x99\x75\x31\xd1\x3e\xb2\x13\x33\x36\xa2\x5b\xe9\x11\x3c\x25\x5b\x11\xd9\x6f\x6c\x8b\x69\xdc\xaf\xb1\x4f\x45\xff\xec\xc1\x8a\xcf\xb4\xf8\x43\xef\x8c\xb8\xc8\x44\xf4\x52\xc0\x81\xb6\xb2\x31\x55\x51\x53\xe9\x6c\x89\x12\xe9\x9f\x18\x79\x62\x73\xa8\xb9\x40\xa4\xb6\x7e\x07\xd7\x26\x58\xd8\x9a\xb7\xa4\x24\x3f\xd5\x69\x51\x8d\x8e\x6d\xe7\x52\x58\x0b\x95\x5a\xc3\x0f\x2b\xf2\x00\x6b\x1b\x11\xce\xe7\x44\x47\xc7\x29\xe5\x3e\x7e\xd8\xce\x13\x28\x16\x7c\x02\x35\x97\xd1\x96\x35\x03\x00\x00"),
+		},
+		"/user.html.tmpl": &vfsgen۰CompressedFileInfo{
+			name:             "user.html.tmpl",
+			modTime:          time.Date(2026, 10, 16, 12, 57, 50, 605412245, time.UTC),
+			uncompressedSize: 1117,
 
-			compressedContent: []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x94\x91\x5d\x6a\xeb\x30\x10\x85\x9f\xed\x55\x08\x2f\x40\x82\x24\x4f\x41\x77\xb8\x97\x5b\x0a\xed\x43\x4a\xeb\x74\x01\x8e\x3d\x41\xa1\xf2\x4f\xe5\x31\x29\x08\xef\xbd\x8c\x64\xe7\xa7\xa4\x85\xbe\x04\x74\x72\xe6\x9b\x33\xc7\xde\x13\xd6\x9d\x2d\x08\x45\x66\xb0\xa8\xa4\xa1\xda\x4a\xaa\x3b\x9b\x8d\x63\x9a\x7a\x5f\xe1\xfe\xd0\xa0\xc8\xe8\x88\x48\xac\x25\xba\x03\xef\xe5\x6b\x8f\x4e\x6e\x8a\x1a\xc7\x51\xe8\x42\x18\x87\xfb\x3f\x99\x21\xea\xfa\xb5\x52\x74\x3c\x10\xa1\x93\x65\x5b\xab\xd9\x9b\x97\x0e\xb1\x89\x13\x19\xfc\xbd\x25\x6b\x55\x40\xe0\xeb\x9d\x6d\xcb\xb7\xf7\xa1\x25\x04\xef\x8f\x07\x32\x42\xde\x0f\xd6\x6e\xf1\x83\xc6\xd1\x7b\xc9\x3f\x68\x7b\x0c\x8f\x59\xc5\xa6\x62\xc6\xc5\x6c\x84\xfd\x36\x9d\xea\xa9\xa0\xa1\xe7\xff\x1e\xee\x38\xac\xf7\xf2\xbf\xc3\x82\xb0\xfa\x47\x53\xca\x69\x5b\x9a\x6a\xb3\x80\x2d\x77\x23\x9a\xa1\xde\xa1\x13\x1c\x88\xdf\x61\x56\x2b\xb3\x00\xae\xf1\xdc\x72\x2c\x52\x44\x53\xec\x38\x1e\x18\xa7\x5e\x30\x18\xb0\xca\x43\x88\x50\xb8\x59\xc2\x24\x8b\x76\x2f\xa6\x58\x5a\x99\x25\xa4\xc9\x2d\x34\x53\x93\x19\xfb\xcc\x4d\x5c\xd0\x12\x6d\x56\x10\xc4\x6b\xd8\x0a\xd2\xe4\x3b\x5a\x32\x9f\x7b\x3a\xfb\x3a\xf4\xd7\x1d\x9c\xf8\xc6\x8a\x1f\xf2\x9e\xfb\xec\x20\x6f\x07\x57\xe2\x5a\xe8\xb2\xad\xf8\xfb\xcb\x28\x30\x22\x28\x5a\x75\xc0\x46\x87\x70\xb2\x3c\xe6\x4f\x9b\x4b\x83\x43\x48\x3f\x03\x00\x00\xff\xff\x64\xb4\x9e\xbd\xdc\x02\x00\x00"),
+			compressedContent: []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xad\x93\xc1\x6a\xdc\x30\x10\x86\xcf\xeb\xa7\x10\x3e\x84\x96\x80\x0c\xcd\xad\x71\x4c\x68\x43\x69\x28\x84\x42\x92\x07\x50\xa4\xf1\x4a\x44\x96\x36\xd2\x38\xdb\x62\xfc\xee\x1d\xad\xad\xf5\x6e\x12\x08\x81\x9e\x6c\xfd\x9a\x19\xcd\xff\x31\x33\x0c\x08\xdd\xc6\x0a\x04\x56\x6a\x10\x8a\x6b\xec\x2c\x47\x92\xca\x71\x2c\x8a\x5a\x7f\x69\xee\x23\x04\x36\x0c\xfc\xfa\x6a\x1c\xeb\x8a\x84\x24\x9f\x35\xbf\x83\x6f\x8d\x05\xa6\x4d\x44\x1f\xfe\xd2\xcd\x19\xdd\x0c\x43\x10\x6e\x0d\x8c\xcf\xd7\x91\xaa\xac\xea\x4d\x43\xf9\xb7\x00\x6e\x1c\xd9\x49\x67\x94\xf2\x78\x9e\x4a\xde\x88\x0e\x48\xaa\x05\xd3\x01\xda\x8b\x52\x23\x6e\xe2\xd7\xaa\xc2\xad\x41\x84\xc0\xa5\xef\x2a\x0a\xfb\x29\x9c\xb2\x14\x58\x36\x97\x07\xa7\xba\x12\x4d\xb1\x1a\x06\x8a\xd5\x8c\x7f\x33\x9e\xa4\x07\xeb\xe5\xe3\x53\xef\x11\xd2\x8b\x29\xe6\x48\x01\xa7\xa8\x1f\xfa\xda\x08\x73\x63\x37\x9e\x6d\x66\x27\x91\x1a\xe4\x45\x8e\x2a\x72\xe5\x1f\xde\x5a\xbf\x85\x30\x59\x21\x97\x59\x60\x52\x27\xaf\x71\xb2\xbe\xda\x5b\x4f\x71\x93\x67\xd3\x32\x78\x62\xfc\x97\x71\x8a\x95\xed\x2e\x8d\xb0\x9e\xe6\x06\x08\x85\xeb\xe3\x79\x7e\x91\x92\x32\x88\xaa\x27\xe8\xc9\x7a\x7e\x2b\x99\xcf\x0d\x65\x00\x97\x3b\x8b\xb9\xd8\x51\xf0\x5c\x72\x42\xb4\xda\x23\x7f\x00\xdc\x92\xc9\x84\xfe\xd6\x38\x99\xd8\x53\xad\x74\xbc\x77\x68\x6c\xea\xe1\x00\xd2\x5b\x18\x8c\x5b\x1f\x63\x88\xcc\xb7\x0c\x83\x90\x8f\xa0\x98\x90\xd2\xf7\x0e\x3f\x4c\x64\xfa\x01\x95\xbd\xf4\xee\x40\x79\x8f\x8d\xfa\x08\x1b\xf5\x5f\xd9\x24\x0c\x77\x94\x95\x1d\x2f\xe3\x3f\xa9\xf3\x8c\x2d\xad\x1b\x55\xcd\x9b\x94\x5a\xe6\xdf\x03\xd0\xe6\xcd\xcd\x2c\x9b\xb1\xc4\x23\x7d\xc5\x41\x8e\xf4\xee\x99\x26\x51\xa0\xf1\x2e\xcf\x3f\x21\xe5\x57\x60\x61\x57\x68\xa9\x11\x31\x78\xb7\x6e\xd4\x74\x53\x57\xf3\x99\x7d\x4a\x63\xce\x04\x26\x67\xfb\xb4\xcf\x7b\xce\x2f\x56\xe8\x0e\xfe\xe0\x8b\x35\x7a\xb5\x3f\xb8\xf3\xca\x44\x90\xda\x3c\x83\x5a\x56\xe8\x1f\xca\x3c\x82\x67\x5d\x04\x00\x00"),
 		},
 	}
 	fs["/"].(*vfsgen۰DirInfo).entries = []os.FileInfo{
+		fs["/accounts.html.tmpl"].(os.FileInfo),
+		fs["/export.html.tmpl"].(os.FileInfo),
 		fs["/head.html.tmpl"].(os.FileInfo),
 		fs["/home.html.tmpl"].(os.FileInfo),
+		fs["/jobs.html.tmpl"].(os.FileInfo),
+		fs["/search.html.tmpl"].(os.FileInfo),
+		fs["/thread.html.tmpl"].(os.FileInfo),
 		fs["/tweet_page.html.tmpl"].(os.FileInfo),
+		fs["/user.html.tmpl"].(os.FileInfo),
 	}
 
 	return fs
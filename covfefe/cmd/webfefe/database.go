@@ -13,10 +13,13 @@ import (
 )
 
 func (s *Server) Home(w http.ResponseWriter, r *http.Request) {
+	v := viewerFromRequest(r)
 	if err := s.withConn(func(conn *sqlite.Conn) error {
-		return sqlitex.Exec(conn, "SELECT COUNT(*) FROM Messages;", func(stmt *sqlite.Stmt) error {
-			return s.tmpl.ExecuteTemplate(w, "home.html.tmpl", stmt.ColumnInt64(0))
-		})
+		return sqlitex.Exec(conn, "SELECT COUNT(*) FROM Messages WHERE "+visibleSQL+";", func(stmt *sqlite.Stmt) error {
+			return s.tmpl.ExecuteTemplate(w, "home.html.tmpl", map[string]interface{}{
+				"Count": stmt.ColumnInt64(0), "Viewer": v,
+			})
+		}, v.visibleSources())
 	}); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -48,7 +51,10 @@ func (s *Server) Tweet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if tweetJSON == nil {
+	// Tweets the viewer can't see are reported as not found, so as not to
+	// reveal which tweets are archived.
+	v := viewerFromRequest(r)
+	if tweetJSON == nil || !v.canSee(tweetSource) {
 		http.Error(w, "Tweet not found.", http.StatusNotFound)
 		return
 	}
@@ -65,8 +71,9 @@ func (s *Server) Tweet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	source, _ := json.Marshal(v.seenSources(tweetSource))
 	if err := s.tmpl.ExecuteTemplate(w, "tweet_page.html.tmpl", map[string]interface{}{
-		"Tweet": tweet, "Source": tweetSource, "JSON": out.String(),
+		"Tweet": tweet, "Source": string(source), "JSON": out.String(), "Viewer": v,
 	}); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"crawshaw.io/sqlite"
+	"filippo.io/mostly-harmless/covfefe"
+	"github.com/sirupsen/logrus"
+)
+
+var exportContentTypes = map[string]string{
+	"jsonl": "application/x-ndjson",
+	"csv":   "text/csv; charset=utf-8",
+	"html":  "application/zip",
+}
+
+var exportExtensions = map[string]string{
+	"jsonl": "jsonl",
+	"csv":   "csv",
+	"html":  "zip",
+}
+
+func (s *Server) Export(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	params := map[string]string{
+		"users": q.Get("users"), "source": q.Get("source"),
+		"from": q.Get("from"), "to": q.Get("to"), "format": q.Get("format"),
+	}
+
+	if params["format"] == "" {
+		if err := s.tmpl.ExecuteTemplate(w, "export.html.tmpl", map[string]interface{}{
+			"Params": params, "Formats": covfefe.ExportFormats,
+		}); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	contentType, ok := exportContentTypes[params["format"]]
+	if !ok {
+		http.Error(w, "Unknown format.", http.StatusBadRequest)
+		return
+	}
+
+	f := &covfefe.ExportFilter{Source: params["source"]}
+	if v := viewerFromRequest(r); !v.Admin {
+		f.Accounts = []int64{v.ID}
+	}
+	if u := params["users"]; u != "" {
+		f.Users = strings.FieldsFunc(u, func(r rune) bool { return r == ',' || r == ' ' })
+	}
+	if d := params["from"]; d != "" {
+		t, err := time.Parse("2006-01-02", d)
+		if err != nil {
+			http.Error(w, "Invalid from date.", http.StatusBadRequest)
+			return
+		}
+		f.From = t
+	}
+	if d := params["to"]; d != "" {
+		t, err := time.Parse("2006-01-02", d)
+		if err != nil {
+			http.Error(w, "Invalid to date.", http.StatusBadRequest)
+			return
+		}
+		f.To = t.AddDate(0, 0, 1)
+	}
+
+	name := fmt.Sprintf("covfefe-export-%s.%s", time.Now().UTC().Format("20060102-150405"),
+		exportExtensions[params["format"]])
+	ew := &exportWriter{w: w, header: func(h http.Header) {
+		h.Set("Content-Type", contentType)
+		h.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	}}
+	if err := s.withConn(func(conn *sqlite.Conn) error {
+		return covfefe.Export(conn, ew, params["format"], f, s.mediaPath)
+	}); err != nil {
+		if !ew.wrote {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		// Too late to change the status, the download will be truncated.
+		logrus.WithError(err).Error("Export failed")
+	}
+}
+
+// exportWriter sets the download headers on the first Write, so that errors
+// occurring before any output, like an unknown user, can still be reported.
+type exportWriter struct {
+	w      http.ResponseWriter
+	header func(http.Header)
+	wrote  bool
+}
+
+func (ew *exportWriter) Write(p []byte) (int, error) {
+	if !ew.wrote {
+		ew.header(ew.w.Header())
+		ew.wrote = true
+	}
+	return ew.w.Write(p)
+}
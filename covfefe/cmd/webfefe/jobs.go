@@ -0,0 +1,27 @@
+package main
+
+import (
+	"net/http"
+
+	"crawshaw.io/sqlite"
+	"filippo.io/mostly-harmless/covfefe"
+)
+
+func (s *Server) Jobs(w http.ResponseWriter, r *http.Request) {
+	var counts []covfefe.JobCount
+	var failed []covfefe.FailedJob
+	if err := s.withConn(func(conn *sqlite.Conn) (err error) {
+		counts, failed, err = covfefe.JobStatus(conn)
+		return err
+	}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := s.tmpl.ExecuteTemplate(w, "jobs.html.tmpl", map[string]interface{}{
+		"Counts": counts, "Failed": failed,
+	}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
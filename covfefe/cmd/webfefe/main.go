@@ -2,13 +2,10 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"flag"
 	"html/template"
-	"io/ioutil"
 	"log"
 	"net/http"
-	"sync"
 	"time"
 
 	"crawshaw.io/sqlite"
@@ -26,18 +23,24 @@ import (
 func main() {
 	dbFile := flag.String("db", "twitter.db", "The path of the SQLite DB")
 	mediaPath := flag.String("media", "twitter-media", "The folder to store media files in")
-	credsFile := flag.String("creds", "creds.json", "The path of the credentials JSON")
+	credsFile := flag.String("creds", "creds.json", "The path of the credentials file")
+	credsKeyFile := flag.String("creds-key", "", "The file containing the credentials passphrase (default $"+covfefe.CredentialsPassphraseEnv+")")
 	listenAddr := flag.String("listen", "127.0.0.1:6052", "The address to listen on for HTTP")
 	baseAddr := flag.String("base", "http://localhost:6052", "The base address at which we run")
 	flag.Parse()
 
-	credsJSON, err := ioutil.ReadFile(*credsFile)
+	secret, err := covfefe.CredentialsSecret(*credsKeyFile)
 	if err != nil {
-		logrus.WithError(err).Fatal("Failed to read credentials file")
+		logrus.WithError(err).Fatal("Failed to read credentials passphrase")
 	}
-	creds := &covfefe.Credentials{}
-	if err := json.Unmarshal(credsJSON, creds); err != nil {
-		logrus.WithError(err).Fatal("Failed to parse credentials file")
+	credsStore := covfefe.OpenCredentials(*credsFile, secret)
+	creds, err := credsStore.Load()
+	if err != nil {
+		logrus.WithError(err).Fatal("Failed to load credentials")
+	}
+
+	if err := covfefe.Migrate(*dbFile); err != nil {
+		logrus.WithError(err).Fatal("Failed to migrate database")
 	}
 
 	db, err := sqlitex.Open("file:"+*dbFile, 0, 5)
@@ -56,7 +59,7 @@ func main() {
 			return f(conn)
 		},
 		mediaPath: *mediaPath,
-		credsPath: *credsFile,
+		creds:     credsStore,
 		tmpl:      template.Must(vfstemplate.ParseGlob(data.Templates, nil, "*.tmpl")),
 		store:     sessions.NewCookieStore([]byte(creds.APISecret)),
 		oauth1Config: &oauth1.Config{
@@ -67,11 +70,10 @@ func main() {
 		},
 	}
 
-	knownUsers, err := loadKnownUsers(s.oauth1Config, creds.Accounts)
-	if err != nil {
-		logrus.WithError(err).Fatal("Failed to load known users")
+	s.admins = make(map[int64]bool)
+	for _, id := range creds.Admins {
+		s.admins[id] = true
 	}
-	s.knownUsers = knownUsers
 
 	logrus.WithField("address", *listenAddr).Info("Starting...")
 	logrus.WithError((&http.Server{
@@ -100,9 +102,8 @@ type Server struct {
 	mediaPath string
 	tmpl      *template.Template
 
-	credsMu    sync.Mutex
-	credsPath  string
-	knownUsers map[int64]bool
+	creds  *covfefe.CredentialsStore
+	admins map[int64]bool
 
 	store        sessions.Store
 	oauth1Config *oauth1.Config
@@ -112,6 +113,12 @@ func (s *Server) Handler() http.Handler {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/", s.loggedIn(s.Home))
 	mux.HandleFunc("/id/", s.loggedIn(s.Tweet))
+	mux.HandleFunc("/thread/", s.admin(s.Thread))
+	mux.HandleFunc("/user/", s.admin(s.User))
+	mux.HandleFunc("/search", s.loggedIn(s.Search))
+	mux.HandleFunc("/jobs", s.admin(s.Jobs))
+	mux.HandleFunc("/accounts", s.admin(s.Accounts))
+	mux.HandleFunc("/export", s.loggedIn(s.Export))
 	mux.Handle("/login", twitterLogin.LoginHandler(s.oauth1Config, nil))
 	mux.Handle("/callback", twitterLogin.CallbackHandler(s.oauth1Config, http.HandlerFunc(s.Login), nil))
 	return mux
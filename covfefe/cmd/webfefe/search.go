@@ -0,0 +1,143 @@
+package main
+
+import (
+	"html"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+
+	"crawshaw.io/sqlite"
+)
+
+type searchResult struct {
+	Tweet   int64
+	User    int64
+	Handle  string
+	Field   string
+	Snippet template.HTML
+	Created string
+	Deleted bool
+}
+
+func (s *Server) Search(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	params := map[string]string{
+		"q": q.Get("q"), "user": q.Get("user"), "source": q.Get("source"),
+		"from": q.Get("from"), "to": q.Get("to"), "deleted": q.Get("deleted"),
+	}
+
+	// Tweets.created sorts lexicographically, so dates can be compared as
+	// strings, after checking they are dates.
+	var from, to string
+	if f := params["from"]; f != "" {
+		t, err := time.Parse("2006-01-02", f)
+		if err != nil {
+			http.Error(w, "Invalid from date.", http.StatusBadRequest)
+			return
+		}
+		from = t.Format("2006-01-02")
+	}
+	if f := params["to"]; f != "" {
+		t, err := time.Parse("2006-01-02", f)
+		if err != nil {
+			http.Error(w, "Invalid to date.", http.StatusBadRequest)
+			return
+		}
+		to = t.AddDate(0, 0, 1).Format("2006-01-02")
+	}
+	deleted := params["deleted"] != ""
+	v := viewerFromRequest(r)
+
+	var results []searchResult
+	if params["q"] != "" {
+		if err := s.withConn(func(conn *sqlite.Conn) error {
+			search := func(match string) error {
+				sql := `SELECT SearchIndex.tweet, SearchIndex.user, SearchIndex.field,
+					snippet(SearchIndex, 0, char(2), char(3), '…', 24),
+					Tweets.created, Tweets.deleted IS NOT NULL,
+					(SELECT handle FROM Users WHERE Users.id = SearchIndex.user
+						ORDER BY first_seen DESC LIMIT 1)
+				FROM SearchIndex
+				LEFT JOIN Tweets ON Tweets.id = SearchIndex.tweet
+				LEFT JOIN Messages ON Messages.id = SearchIndex.message
+				WHERE SearchIndex MATCH $q
+				AND ($user = '' OR SearchIndex.user = CAST($user AS INTEGER) OR SearchIndex.user IN (
+					SELECT id FROM Users WHERE handle = $user COLLATE NOCASE))
+				AND ($from = '' OR Tweets.created >= $from)
+				AND ($to = '' OR Tweets.created < $to)
+				AND ($source = '' OR EXISTS (
+					SELECT 1 FROM json_each(Messages.source) WHERE value = $source))
+				AND (NOT $deleted OR Tweets.deleted IS NOT NULL)
+				AND ` + visibleSQL + `
+				ORDER BY rank LIMIT 100;`
+				stmt, err := conn.Prepare(sql)
+				if err != nil {
+					return err
+				}
+				defer stmt.Reset()
+				stmt.SetText("$q", match)
+				stmt.SetText("$user", strings.TrimPrefix(params["user"], "@"))
+				stmt.SetText("$from", from)
+				stmt.SetText("$to", to)
+				stmt.SetText("$source", params["source"])
+				stmt.SetBool("$deleted", deleted)
+				stmt.SetText("$visible", v.visibleSources())
+				for {
+					if hasRow, err := stmt.Step(); err != nil {
+						return err
+					} else if !hasRow {
+						break
+					}
+					snippet := html.EscapeString(stmt.ColumnText(3))
+					snippet = strings.Replace(snippet, "\x02", "<mark>", -1)
+					snippet = strings.Replace(snippet, "\x03", "</mark>", -1)
+					results = append(results, searchResult{
+						Tweet:   stmt.ColumnInt64(0),
+						User:    stmt.ColumnInt64(1),
+						Field:   stmt.ColumnText(2),
+						Snippet: template.HTML(snippet),
+						Created: stmt.ColumnText(4),
+						Deleted: stmt.ColumnInt(5) != 0,
+						Handle:  stmt.ColumnText(6),
+					})
+				}
+				return nil
+			}
+			// Queries are FTS5 expressions, but if the query isn't valid
+			// search for its words as plain text instead, so that input
+			// like "don't" or "C++" works.
+			err := search(params["q"])
+			if sqlite.ErrCode(err) == sqlite.SQLITE_ERROR {
+				results = nil
+				err = search(ftsQuote(params["q"]))
+			}
+			return err
+		}); err != nil {
+			if sqlite.ErrCode(err) == sqlite.SQLITE_ERROR {
+				// Most likely a syntax error in the FTS5 query.
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := s.tmpl.ExecuteTemplate(w, "search.html.tmpl", map[string]interface{}{
+		"Params": params, "Results": results, "Viewer": v,
+	}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// ftsQuote turns each word of q into an FTS5 string, which matches it as a
+// plain phrase.
+func ftsQuote(q string) string {
+	var words []string
+	for _, w := range strings.Fields(q) {
+		words = append(words, `"`+strings.Replace(w, `"`, `""`, -1)+`"`)
+	}
+	return strings.Join(words, " ")
+}
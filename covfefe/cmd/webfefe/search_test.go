@@ -0,0 +1,95 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"testing"
+
+	"crawshaw.io/sqlite"
+	"crawshaw.io/sqlite/sqlitex"
+)
+
+func TestSearch(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+
+	if err := s.withConn(func(conn *sqlite.Conn) error {
+		for _, m := range []struct {
+			id, tweet int64
+			source    string
+			created   string
+			text      string
+		}{
+			{1, 10, `["tl:2"]`, "2019-01-02", "the aardvark says don't panic"},
+			{2, 11, `["tl:3"]`, "2019-01-03", "a bandicoot writing C++"},
+			{3, 12, `["tl:2"]`, "2019-01-04", "another aardvark"},
+		} {
+			if err := sqlitex.Exec(conn, `INSERT INTO Messages (id, json, source, kind)
+				VALUES (?, '{}', ?, 'tweet');`, nil, m.id, m.source); err != nil {
+				return err
+			}
+			if err := sqlitex.Exec(conn, `INSERT INTO Tweets (id, created, user, message)
+				VALUES (?, ?, 5, ?);`, nil, m.tweet, m.created+" 10:00:00 +0000 UTC", m.id); err != nil {
+				return err
+			}
+			if err := sqlitex.Exec(conn, `INSERT INTO SearchIndex (text, field, tweet, user, message)
+				VALUES (?, 'text', ?, 5, ?);`, nil, m.text, m.tweet, m.id); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	h := s.Handler()
+	tweetLink := regexp.MustCompile(`href="/id/(\d+)"`)
+	for _, tc := range []struct {
+		query url.Values
+		user  int64
+		code  int
+		found []string
+	}{
+		{url.Values{"q": {"aardvark"}}, 1, http.StatusOK, []string{"10", "12"}},
+		{url.Values{"q": {"aardvark OR bandicoot"}}, 1, http.StatusOK, []string{"10", "11", "12"}},
+		{url.Values{"q": {`"another aardvark"`}}, 1, http.StatusOK, []string{"12"}},
+		{url.Values{"q": {"aardvark"}, "from": {"2019-01-03"}}, 1, http.StatusOK, []string{"12"}},
+		{url.Values{"q": {"aardvark"}, "source": {"tl:3"}}, 1, http.StatusOK, nil},
+		{url.Values{"q": {"aardvark"}, "from": {"yesterday"}}, 1, http.StatusBadRequest, nil},
+
+		// Invalid FTS5 syntax is searched as plain words.
+		{url.Values{"q": {"don't"}}, 1, http.StatusOK, []string{"10"}},
+		{url.Values{"q": {"C++"}}, 1, http.StatusOK, []string{"11"}},
+		{url.Values{"q": {`"bandicoot`}}, 1, http.StatusOK, []string{"11"}},
+		{url.Values{"q": {"NEAR(aardvark"}}, 1, http.StatusOK, nil},
+		{url.Values{"q": {"aardvark AND"}}, 1, http.StatusOK, nil},
+
+		// Other users only find the tweets of their own account.
+		{url.Values{"q": {"aardvark OR bandicoot"}}, 2, http.StatusOK, []string{"10", "12"}},
+		{url.Values{"q": {"bandicoot"}}, 4, http.StatusOK, nil},
+	} {
+		r := httptest.NewRequest("GET", "/search?"+tc.query.Encode(), nil)
+		r.AddCookie(loginCookie(t, s, tc.user))
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tc.code {
+			t.Errorf("%v as %d: got status %d, expected %d: %s", tc.query, tc.user, w.Code, tc.code, w.Body)
+			continue
+		}
+		if tc.code != http.StatusOK {
+			continue
+		}
+		var found []string
+		for _, m := range tweetLink.FindAllStringSubmatch(w.Body.String(), -1) {
+			found = append(found, m[1])
+		}
+		sort.Strings(found) // Results are sorted by rank.
+		if !reflect.DeepEqual(found, tc.found) {
+			t.Errorf("%v as %d: found %v, expected %v", tc.query, tc.user, found, tc.found)
+		}
+	}
+}
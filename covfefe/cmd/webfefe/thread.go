@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"crawshaw.io/sqlite"
+	"filippo.io/mostly-harmless/covfefe"
+)
+
+func (s *Server) Thread(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, "/thread/"), 10, 64)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var thread []covfefe.ThreadTweet
+	if err := s.withConn(func(conn *sqlite.Conn) (err error) {
+		thread, err = covfefe.Thread(conn, id)
+		return err
+	}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	for _, t := range thread {
+		if t.ID == id && t.Missing {
+			http.Error(w, "Tweet not found.", http.StatusNotFound)
+			return
+		}
+	}
+
+	if err := s.tmpl.ExecuteTemplate(w, "thread.html.tmpl", map[string]interface{}{
+		"ID": id, "Thread": thread,
+	}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"crawshaw.io/sqlite"
+	"filippo.io/mostly-harmless/covfefe"
+)
+
+func (s *Server) User(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, "/user/"), 10, 64)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var report *covfefe.UserReport
+	if err := s.withConn(func(conn *sqlite.Conn) (err error) {
+		report, err = covfefe.UserHistory(conn, id)
+		return err
+	}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if len(report.Profiles) == 0 && len(report.Followers) == 0 && len(report.Following) == 0 {
+		http.Error(w, "User not found.", http.StatusNotFound)
+		return
+	}
+
+	if err := s.tmpl.ExecuteTemplate(w, "user.html.tmpl", report); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -24,48 +24,70 @@ type Credentials struct {
 	APIKey    string `json:"API_KEY"`
 	APISecret string `json:"API_SECRET"`
 	Accounts  []Account
+
+	Mastodon []MastodonAccount `json:"MASTODON,omitempty"`
+
+	// Admins are the Twitter user IDs allowed to see every message in
+	// webfefe. Other users only see messages received by their own account.
+	Admins []int64 `json:"ADMINS,omitempty"`
 }
 
 type Account struct {
 	Token       string `json:"TOKEN"`
 	TokenSecret string `json:"TOKEN_SECRET"`
+
+	// Sources is the list of source names to run for this account, from the
+	// keys of sources. If empty, DefaultSources are run.
+	Sources []string `json:"SOURCES,omitempty"`
+
+	// UserID and ScreenName are filled in when the token is verified.
+	UserID     int64  `json:"USER_ID,omitempty"`
+	ScreenName string `json:"SCREEN_NAME,omitempty"`
+
+	// Revoked is set when the API rejects the token. Revoked accounts are
+	// skipped until they are enrolled again.
+	Revoked       *time.Time `json:"REVOKED,omitempty"`
+	RevokedReason string     `json:"REVOKED_REASON,omitempty"`
 }
 
 type Covfefe struct {
 	withConn   func(f func(conn *sqlite.Conn) error) error
 	wg         sync.WaitGroup
 	httpClient *http.Client
-	msgIDs     *lru.Cache
-	mediaPath  string
-	rescan     bool
+	// api wraps httpClient, which uses app-only authentication, for requests
+	// not tied to an account, like hydrating tweets.
+	api       *apiClient
+	msgIDs    *lru.Cache
+	mediaPath string
+	rescan    bool
 }
 
-func Run(dbPath, mediaPath string, creds *Credentials) error {
+// Run fetches messages from the accounts in the credentials store until
+// SIGINT or SIGTERM. Accounts whose tokens are rejected are marked as revoked
+// in the store.
+func Run(dbPath, mediaPath string, store *CredentialsStore) error {
+	creds, err := store.Load()
+	if err != nil {
+		return err
+	}
+	if err := creds.checkSources(); err != nil {
+		return err
+	}
+
 	db, err := sqlitex.Open("file:"+dbPath, 0, 5)
 	if err != nil {
 		return errors.Wrap(err, "failed to open database")
 	}
 	defer db.Close()
 
-	c := &Covfefe{
-		withConn: func(f func(conn *sqlite.Conn) error) error {
-			conn := db.Get(context.Background())
-			defer db.Put(conn)
-			if err := sqlitex.Exec(conn, "PRAGMA foreign_keys = ON;", nil); err != nil {
-				return err
-			}
-			return f(conn)
-		},
-		msgIDs:    lru.New(1 << 16),
-		mediaPath: mediaPath,
-	}
-
+	c := newCovfefe(db, mediaPath)
 	c.httpClient = (&clientcredentials.Config{
 		ClientID:     creds.APIKey,
 		ClientSecret: creds.APISecret,
 		TokenURL:     "https://api.twitter.com/oauth2/token",
 	}).Client(context.Background())
 	c.httpClient.Timeout = 1 * time.Minute
+	c.api = newAPIClient(c.httpClient)
 
 	if err := c.initDB(); err != nil {
 		return err
@@ -85,16 +107,42 @@ func Run(dbPath, mediaPath string, creds *Credentials) error {
 		log.WithField("signal", s).Info("Received signal, stopping...")
 	}, syscall.SIGINT, syscall.SIGTERM)
 
-	g, ctx := errgroup.WithContext(ctx)
+	// Sources don't share a cancelable Context, so that a source failing
+	// permanently, for example because its credentials got revoked, doesn't
+	// stop the others. They are only stopped by the signal.
+	var g errgroup.Group
+	g.Go(func() error {
+		return errors.Wrap(c.runJobs(ctx, messages), "jobs")
+	})
 	config := oauth1.NewConfig(creds.APIKey, creds.APISecret)
+	revoke := func(account Account, err error) {
+		if err := store.Revoke(account.Token, err); err != nil {
+			log.WithError(err).Error("Failed to mark account as revoked")
+		}
+	}
 	for i, account := range creds.Accounts {
+		if account.Revoked != nil {
+			log.WithFields(log.Fields{
+				"position": i, "account": account.ScreenName, "revoked": account.Revoked,
+			}).Warn("Skipping revoked account")
+			continue
+		}
 		token := oauth1.NewToken(account.Token, account.TokenSecret)
 		httpClient := config.Client(oauth1.NoContext, token)
 		httpClient.Timeout = 10 * time.Second
+		// All sources of an account share its rate limits.
+		api := newAPIClient(httpClient)
 
-		user, err := verifyCredentials(ctx, httpClient)
+		user, err := verifyCredentials(ctx, api)
+		if isRevoked(err) {
+			log.WithFields(log.Fields{
+				"position": i, "account": account.ScreenName,
+			}).WithError(err).Error("Credentials revoked")
+			revoke(account, err)
+			continue
+		}
 		if err != nil {
-			log.WithField("position", i).WithError(err).Error("Invalid credentials")
+			log.WithField("position", i).WithError(err).Error("Failed to verify credentials")
 			continue
 		}
 
@@ -102,39 +150,93 @@ func Run(dbPath, mediaPath string, creds *Credentials) error {
 			"account": user.ScreenName, "id": user.ID,
 		})
 
-		for _, timeline := range []string{"home", "mentions", "user", "likes"} {
-			timeline := timeline
-			g.Go(func() error {
-				log.WithField("timeline", timeline).Info("Starting to monitor timeline")
-				m := &twitterClient{c: httpClient, u: user, m: messages}
-				return errors.Wrapf(m.followTimeline(ctx, timeline),
-					"%s of %d", timeline, user.ID)
-			})
+		if account.UserID != user.ID || account.ScreenName != user.ScreenName {
+			if err := store.SetAccountUser(account.Token, user.ID, user.ScreenName); err != nil {
+				log.WithError(err).Warn("Failed to record account user")
+			}
 		}
 
-		g.Go(func() error {
-			log.Info("Starting to fetch followers")
-			m := &twitterClient{c: httpClient, u: user, m: messages}
-			for {
-				if err := m.fetchFollowers(ctx, user.ID); err != nil {
-					return errors.Wrapf(err, "followers of %d", user.ID)
+		names := account.Sources
+		if len(names) == 0 {
+			names = DefaultSources
+		}
+		for _, name := range names {
+			source := sources[name](api, user)
+			log := log.WithField("source", name)
+			account := account
+			ctx, health := withSourceHealth(ctx, user.ScreenName, name)
+			g.Go(func() error {
+				log.Info("Starting source")
+				err := source.Run(ctx, messages)
+				if err != nil && ctx.Err() == nil {
+					log.WithError(err).Error("Source stopped")
 				}
-				log.Debug("Starting over fetching followers")
-				select {
-				case <-ctx.Done():
-					return ctx.Err()
-				case <-time.NewTimer(24 * time.Hour).C:
+				health.stop(err)
+				if isRevoked(err) {
+					revoke(account, err)
 				}
-			}
+				return nil
+			})
+		}
+	}
+
+	for i, account := range creds.Mastodon {
+		m := newMastodonClient(account)
+		user, err := m.verifyCredentials(ctx)
+		if err != nil {
+			log.WithField("position", i).WithError(err).Error("Invalid Mastodon credentials")
+			continue
+		}
+		m.u = user
+
+		log := log.WithFields(log.Fields{
+			"account": user.URL, "id": user.ID,
 		})
+
+		names := account.Sources
+		if len(names) == 0 {
+			names = DefaultMastodonSources
+		}
+		for _, name := range names {
+			source := mastodonSources[name](m)
+			log := log.WithField("source", name)
+			ctx, health := withSourceHealth(ctx, user.URL, name)
+			g.Go(func() error {
+				log.Info("Starting source")
+				err := source.Run(ctx, messages)
+				if err != nil && ctx.Err() == nil {
+					log.WithError(err).Error("Source stopped")
+				}
+				health.stop(err)
+				return nil
+			})
+		}
 	}
-	log.WithError(g.Wait()).Error("Stopped following timelines")
+	if err := g.Wait(); err != nil {
+		log.WithError(err).Error("Background jobs failed")
+	}
+	log.Info("Stopped following timelines")
 
 	close(messages)
 	c.wg.Wait()
 	return nil
 }
 
+func newCovfefe(db *sqlitex.Pool, mediaPath string) *Covfefe {
+	return &Covfefe{
+		withConn: func(f func(conn *sqlite.Conn) error) error {
+			conn := db.Get(context.Background())
+			defer db.Put(conn)
+			if err := sqlitex.Exec(conn, "PRAGMA foreign_keys = ON;", nil); err != nil {
+				return err
+			}
+			return f(conn)
+		},
+		msgIDs:    lru.New(1 << 16),
+		mediaPath: mediaPath,
+	}
+}
+
 // contextWithSignal acts like context.WithCancel, but the returned Context is
 // also cancelled when one of the passed signals is received. A function f, if
 // not nil, is called before cancelling the Context.
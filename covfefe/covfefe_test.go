@@ -0,0 +1,49 @@
+package covfefe
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"crawshaw.io/sqlite"
+	"crawshaw.io/sqlite/sqlitex"
+)
+
+// newTestCovfefe returns a Covfefe backed by a fresh database in a temporary
+// directory, which is removed by the returned cleanup function.
+func newTestCovfefe(t *testing.T) (c *Covfefe, dbPath string, cleanup func()) {
+	dir, err := ioutil.TempDir("", "covfefe-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbPath = filepath.Join(dir, "twitter.db")
+	db, err := sqlitex.Open("file:"+dbPath, 0, 5)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	cleanup = func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+	c = newCovfefe(db, filepath.Join(dir, "media"))
+	if err := c.initDB(); err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	return c, dbPath, cleanup
+}
+
+func queryStrings(t *testing.T, c *Covfefe, query string, args ...interface{}) []string {
+	var res []string
+	if err := c.withConn(func(conn *sqlite.Conn) error {
+		return sqlitex.Exec(conn, query, func(stmt *sqlite.Stmt) error {
+			res = append(res, stmt.ColumnText(0))
+			return nil
+		}, args...)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
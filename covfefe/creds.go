@@ -0,0 +1,268 @@
+package covfefe
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Credentials files are encrypted with NaCl secretbox, under a key derived
+// from a passphrase with scrypt. The format is
+//
+//	credsMagic || salt (16 bytes) || nonce (24 bytes) || secretbox
+//
+// A fresh salt and nonce are generated every time the file is saved. Files
+// starting with "{" are legacy plaintext JSON, and get encrypted on the first
+// update.
+const credsMagic = "covfefe-creds-v1\n"
+
+// CredentialsPassphraseEnv is the environment variable the credentials
+// passphrase is read from, if no key file is specified.
+const CredentialsPassphraseEnv = "COVFEFE_CREDS_PASSPHRASE"
+
+// credsScryptN is the scrypt cost parameter, a var so tests can make it
+// cheaper.
+var credsScryptN = 1 << 15
+
+// A CredentialsStore reads and atomically updates an encrypted credentials
+// file. Updates are serialized across processes with a lock file, as the
+// file is shared by covfefe and webfefe.
+type CredentialsStore struct {
+	path   string
+	secret []byte
+}
+
+// CredentialsSecret returns the passphrase protecting the credentials, read
+// from keyFile if not empty, or from the environment otherwise. It returns
+// nil if neither is set.
+func CredentialsSecret(keyFile string) ([]byte, error) {
+	if keyFile != "" {
+		secret, err := ioutil.ReadFile(keyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read credentials key file")
+		}
+		secret = bytes.TrimRight(secret, "\r\n")
+		if len(secret) == 0 {
+			return nil, errors.New("empty credentials key file")
+		}
+		return secret, nil
+	}
+	if p := os.Getenv(CredentialsPassphraseEnv); p != "" {
+		return []byte(p), nil
+	}
+	return nil, nil
+}
+
+// OpenCredentials returns a store for the credentials file at path. secret
+// can be nil only to read legacy plaintext files.
+func OpenCredentials(path string, secret []byte) *CredentialsStore {
+	return &CredentialsStore{path: path, secret: secret}
+}
+
+// Load reads and decrypts the credentials.
+func (s *CredentialsStore) Load() (*Credentials, error) {
+	data, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read credentials file")
+	}
+	plaintext, err := s.open(data)
+	if err != nil {
+		return nil, err
+	}
+	creds := &Credentials{}
+	if err := json.Unmarshal(plaintext, creds); err != nil {
+		return nil, errors.Wrap(err, "failed to parse credentials file")
+	}
+	return creds, nil
+}
+
+func (s *CredentialsStore) open(data []byte) ([]byte, error) {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		log.WithField("path", s.path).Warn("Credentials file is not encrypted")
+		return data, nil
+	}
+	if !bytes.HasPrefix(data, []byte(credsMagic)) {
+		return nil, errors.New("unknown credentials file format")
+	}
+	if s.secret == nil {
+		return nil, errors.New("credentials file is encrypted, but no passphrase was provided")
+	}
+	data = data[len(credsMagic):]
+	if len(data) < 16+24+secretbox.Overhead {
+		return nil, errors.New("truncated credentials file")
+	}
+	salt, data := data[:16], data[16:]
+	var nonce [24]byte
+	copy(nonce[:], data)
+	key, err := s.key(salt)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, ok := secretbox.Open(nil, data[24:], &nonce, key)
+	if !ok {
+		return nil, errors.New("failed to decrypt credentials file: wrong passphrase?")
+	}
+	return plaintext, nil
+}
+
+func (s *CredentialsStore) key(salt []byte) (*[32]byte, error) {
+	k, err := scrypt.Key(s.secret, salt, credsScryptN, 8, 1, 32)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	var key [32]byte
+	copy(key[:], k)
+	return &key, nil
+}
+
+func (s *CredentialsStore) seal(plaintext []byte) ([]byte, error) {
+	if s.secret == nil {
+		return nil, errors.New("can't save credentials without a passphrase")
+	}
+	salt := make([]byte, 16)
+	var nonce [24]byte
+	if _, err := rand.Read(salt); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	key, err := s.key(salt)
+	if err != nil {
+		return nil, err
+	}
+	out := append([]byte(credsMagic), salt...)
+	out = append(out, nonce[:]...)
+	return secretbox.Seal(out, plaintext, &nonce, key), nil
+}
+
+// Update loads the credentials, calls f to modify them, and saves them,
+// encrypted, if f returns nil. The file is replaced atomically, and only
+// readable by its owner.
+func (s *CredentialsStore) Update(f func(*Credentials) error) error {
+	if s.secret == nil {
+		return errors.New("can't save credentials without a passphrase")
+	}
+
+	lock, err := os.OpenFile(s.path+".lock", os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return errors.Wrap(err, "failed to open credentials lock")
+	}
+	defer lock.Close()
+	if err := syscall.Flock(int(lock.Fd()), syscall.LOCK_EX); err != nil {
+		return errors.Wrap(err, "failed to lock credentials")
+	}
+	defer syscall.Flock(int(lock.Fd()), syscall.LOCK_UN)
+
+	creds, err := s.Load()
+	if os.IsNotExist(errors.Cause(err)) {
+		creds, err = &Credentials{}, nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := f(creds); err != nil {
+		return err
+	}
+	return s.save(creds)
+}
+
+func (s *CredentialsStore) save(creds *Credentials) error {
+	plaintext, err := json.MarshalIndent(creds, "", "    ")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	data, err := s.seal(plaintext)
+	if err != nil {
+		return err
+	}
+
+	// ioutil.TempFile creates the file with mode 0600.
+	f, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".tmp-")
+	if err != nil {
+		return errors.Wrap(err, "failed to create credentials file")
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return errors.Wrap(err, "failed to write credentials file")
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return errors.Wrap(err, "failed to write credentials file")
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return errors.Wrap(err, "failed to write credentials file")
+	}
+	if err := os.Rename(f.Name(), s.path); err != nil {
+		os.Remove(f.Name())
+		return errors.Wrap(err, "failed to replace credentials file")
+	}
+	return nil
+}
+
+// Revoke marks the account with the given token as revoked, so that it's
+// skipped until it's enrolled again.
+func (s *CredentialsStore) Revoke(token string, reason error) error {
+	return s.Update(func(creds *Credentials) error {
+		for i := range creds.Accounts {
+			a := &creds.Accounts[i]
+			if a.Token == token && a.Revoked == nil {
+				now := time.Now().UTC()
+				a.Revoked = &now
+				a.RevokedReason = reason.Error()
+			}
+		}
+		return nil
+	})
+}
+
+// SetAccountUser records which user the account with the given token belongs
+// to, as returned by verifyCredentials.
+func (s *CredentialsStore) SetAccountUser(token string, id int64, screenName string) error {
+	return s.Update(func(creds *Credentials) error {
+		for i := range creds.Accounts {
+			a := &creds.Accounts[i]
+			if a.Token == token {
+				a.UserID, a.ScreenName = id, screenName
+			}
+		}
+		return nil
+	})
+}
+
+// Enroll adds an account, or replaces the tokens of an existing account of
+// the same user, clearing its revocation.
+func (s *CredentialsStore) Enroll(account Account) error {
+	return s.Update(func(creds *Credentials) error {
+		for i := range creds.Accounts {
+			a := &creds.Accounts[i]
+			if a.Token == account.Token || account.UserID != 0 && a.UserID == account.UserID {
+				a.Token, a.TokenSecret = account.Token, account.TokenSecret
+				a.UserID, a.ScreenName = account.UserID, account.ScreenName
+				a.Revoked, a.RevokedReason = nil, ""
+				return nil
+			}
+		}
+		creds.Accounts = append(creds.Accounts, account)
+		return nil
+	})
+}
+
+// isRevoked returns whether err is the API rejecting the credentials.
+func isRevoked(err error) bool {
+	e, ok := errors.Cause(err).(*apiError)
+	return ok && e.status == 401
+}
@@ -0,0 +1,125 @@
+package covfefe
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestCredentialsStore(t *testing.T) {
+	defer func(n int) { credsScryptN = n }(credsScryptN)
+	credsScryptN = 1 << 10
+
+	dir, err := ioutil.TempDir("", "covfefe-creds")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "creds.json")
+
+	// Legacy plaintext files are readable without a passphrase, and get
+	// encrypted on the first update.
+	if err := ioutil.WriteFile(path, []byte(`{"API_KEY": "key", "API_SECRET": "secret",
+		"Accounts": [{"TOKEN": "t1", "TOKEN_SECRET": "s1"}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if creds, err := OpenCredentials(path, nil).Load(); err != nil {
+		t.Fatal(err)
+	} else if creds.APIKey != "key" || len(creds.Accounts) != 1 {
+		t.Errorf("unexpected plaintext credentials: %+v", creds)
+	}
+	if err := OpenCredentials(path, nil).Revoke("t1", errors.New("nope")); err == nil {
+		t.Errorf("expected an error updating without a passphrase")
+	}
+
+	store := OpenCredentials(path, []byte("hunter2"))
+	if err := store.SetAccountUser("t1", 1, "one"); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, []byte(credsMagic)) || bytes.Contains(data, []byte("secret")) {
+		t.Errorf("credentials file is not encrypted: %q", data)
+	}
+	if fi, err := os.Stat(path); err != nil {
+		t.Fatal(err)
+	} else if fi.Mode().Perm() != 0600 {
+		t.Errorf("credentials file mode is %v", fi.Mode())
+	}
+
+	if _, err := OpenCredentials(path, []byte("hunter3")).Load(); err == nil {
+		t.Errorf("expected an error with the wrong passphrase")
+	}
+	if _, err := OpenCredentials(path, nil).Load(); err == nil {
+		t.Errorf("expected an error without a passphrase")
+	}
+
+	if err := store.Revoke("t1", errors.New("Invalid or expired token.")); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Enroll(Account{Token: "t2", TokenSecret: "s2", UserID: 2, ScreenName: "two"}); err != nil {
+		t.Fatal(err)
+	}
+	creds, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(creds.Accounts) != 2 || creds.APISecret != "secret" {
+		t.Fatalf("unexpected credentials: %+v", creds)
+	}
+	if a := creds.Accounts[0]; a.Revoked == nil || a.RevokedReason != "Invalid or expired token." ||
+		a.UserID != 1 || a.ScreenName != "one" {
+		t.Errorf("account not revoked: %+v", a)
+	}
+	if a := creds.Accounts[1]; a.Revoked != nil || a.Token != "t2" {
+		t.Errorf("unexpected new account: %+v", a)
+	}
+
+	// Enrolling a known user again replaces its tokens and clears the
+	// revocation.
+	if err := store.Enroll(Account{Token: "t3", TokenSecret: "s3", UserID: 1, ScreenName: "one"}); err != nil {
+		t.Fatal(err)
+	}
+	creds, err = store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a := creds.Accounts[0]; len(creds.Accounts) != 2 || a.Revoked != nil || a.Token != "t3" {
+		t.Errorf("account not re-enrolled: %+v", creds.Accounts)
+	}
+
+	if matches, _ := filepath.Glob(filepath.Join(dir, "creds.json.tmp-*")); len(matches) != 0 {
+		t.Errorf("temporary files left behind: %v", matches)
+	}
+}
+
+func TestVerifyCredentialsRevoked(t *testing.T) {
+	status := http.StatusUnauthorized
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"errors": [{"code": 89, "message": "Invalid or expired token."}]}`, status)
+	}))
+	defer srv.Close()
+	target, _ := url.Parse(srv.URL)
+	client := &http.Client{Transport: rewriteTransport{target}}
+
+	_, err := verifyCredentials(context.Background(), newAPIClient(client))
+	if !isRevoked(err) {
+		t.Errorf("401 not detected as revoked: %v", err)
+	}
+
+	status = http.StatusServiceUnavailable
+	_, err = verifyCredentials(context.Background(), newAPIClient(client))
+	if err == nil || isRevoked(err) {
+		t.Errorf("503 detected as revoked: %v", err)
+	}
+}
@@ -19,37 +19,7 @@ func (c *Covfefe) execSQL(query string, args ...interface{}) error {
 }
 
 func (c *Covfefe) initDB() error {
-	return errors.Wrap(c.withConn(func(conn *sqlite.Conn) error {
-		return sqlitex.ExecScript(conn, `
-			CREATE TABLE IF NOT EXISTS Messages (
-				id INTEGER PRIMARY KEY,
-				received DATETIME DEFAULT (DATETIME('now')),
-				json TEXT NOT NULL,
-				source TEXT NOT NULL, -- JSON array of source IDs
-				kind TEXT -- tweet / event / del / deletion / follower
-			);
-			CREATE TABLE IF NOT EXISTS Tweets (
-				id INTEGER PRIMARY KEY,
-				created DATETIME NOT NULL,
-				user INTEGER NOT NULL,
-				message INTEGER NOT NULL REFERENCES Messages(id),
-				deleted INTEGER REFERENCES Messages(id)
-			);
-			CREATE TABLE IF NOT EXISTS Users (
-				id INTEGER NOT NULL,
-				handle TEXT NOT NULL,
-				name TEXT NOT NULL,
-				bio TEXT NOT NULL,
-				first_seen INTEGER NOT NULL REFERENCES Messages(id),
-				UNIQUE (id, handle, name, bio) ON CONFLICT IGNORE
-			);
-			CREATE TABLE IF NOT EXISTS Follows (
-				follower INTEGER NOT NULL,
-				target INTEGER NOT NULL,
-				first_seen INTEGER NOT NULL REFERENCES Messages(id),
-				UNIQUE (target, follower) ON CONFLICT IGNORE
-			);`)
-	}), "failed to initialize database")
+	return errors.Wrap(c.withConn(migrate), "failed to initialize database")
 }
 
 func (c *Covfefe) insertMessage(m *Message) error {
@@ -62,23 +32,45 @@ func (c *Covfefe) insertMessage(m *Message) error {
 
 	h, _ := blake2b.New256([]byte(m.kind))
 	h.Write(m.msg)
-	log = log.WithField("hash", base64.RawURLEncoding.EncodeToString(h.Sum(nil)))
-
-	if id, ok := c.msgIDs.Get(h); ok {
+	hash := h.Sum(nil)
+	log = log.WithField("hash", base64.RawURLEncoding.EncodeToString(hash))
+
+	id, ok := c.msgIDs.Get(string(hash))
+	if ok {
+		metricMessageCache.add(1, "hit")
+	} else {
+		metricMessageCache.add(1, "miss")
+		// Not in the cache, but it might have been stored by a previous run.
+		err := c.withConn(func(conn *sqlite.Conn) error {
+			return sqlitex.Exec(conn, "SELECT id FROM Messages WHERE hash = ?",
+				func(stmt *sqlite.Stmt) error {
+					id, ok = stmt.GetInt64("id"), true
+					return nil
+				}, hash)
+		})
+		if err != nil {
+			return errors.Wrap(err, "failed select query")
+		}
+	}
+	if ok {
 		log.WithField("id", id).Debug("Duplicate message")
 
 		err := c.execSQL(`UPDATE Messages SET source = json_insert(
-			source, '$[' || json_array_length(source) || ']', ?) WHERE id = ?;`, m.source, id)
+			source, '$[' || json_array_length(source) || ']', ?) WHERE id = ?
+			AND NOT EXISTS (SELECT 1 FROM json_each(source) WHERE value = ?);`,
+			m.source, id, m.source)
 		if err != nil {
 			return errors.Wrap(err, "failed update query")
 		}
 		m.id = id.(int64)
+		c.msgIDs.Add(string(hash), m.id)
+		metricMessages.add(1, "duplicate")
 		return nil
 	}
 
 	err := c.withConn(func(conn *sqlite.Conn) error {
-		query := `INSERT INTO Messages (json, source, kind) VALUES (?, json_array(?), ?)`
-		err := sqlitex.Exec(conn, query, nil, m.msg, m.source, m.kind)
+		query := `INSERT INTO Messages (json, source, kind, hash) VALUES (?, json_array(?), ?, ?)`
+		err := sqlitex.Exec(conn, query, nil, m.msg, m.source, m.kind, hash)
 		if err != nil {
 			return err
 		}
@@ -90,8 +82,9 @@ func (c *Covfefe) insertMessage(m *Message) error {
 	}
 
 	log.WithField("id", m.id).Debug("New message")
+	metricMessages.add(1, "inserted")
 
-	c.msgIDs.Add(h, m.id)
+	c.msgIDs.Add(string(hash), m.id)
 	return nil
 }
 
@@ -119,10 +112,15 @@ func (c *Covfefe) seenTweet(id int64) (found bool, err error) {
 	return
 }
 
-func (c *Covfefe) insertUser(user *twitter.User, message int64) error {
-	return errors.Wrap(c.execSQL(
-		`INSERT INTO Users (id, handle, name, bio, first_seen) VALUES (?, ?, ?, ?, ?);`,
-		user.ID, user.ScreenName, user.Name, user.Description, message), "failed insert query")
+func (c *Covfefe) insertUser(user *twitter.User, message int64) (new bool, err error) {
+	err = c.withConn(func(conn *sqlite.Conn) error {
+		err := sqlitex.Exec(conn,
+			`INSERT INTO Users (id, handle, name, bio, first_seen) VALUES (?, ?, ?, ?, ?);`,
+			nil, user.ID, user.ScreenName, user.Name, user.Description, message)
+		new = conn.Changes() > 0
+		return err
+	})
+	return new, errors.Wrap(err, "failed insert query")
 }
 
 func (c *Covfefe) insertFollow(follower, target, message int64) error {
@@ -131,6 +129,35 @@ func (c *Covfefe) insertFollow(follower, target, message int64) error {
 		follower, target, message), "failed insert query")
 }
 
+func (c *Covfefe) insertThreadEdge(tweet, parent int64, kind string, message int64) error {
+	return errors.Wrap(c.execSQL(
+		`INSERT INTO Threads (tweet, parent, kind, first_seen) VALUES (?, ?, ?, ?);`,
+		tweet, parent, kind, message), "failed insert query")
+}
+
+func (c *Covfefe) insertFollowEvent(follower, followed int64, kind string, snapshot, previous int64) {
+	err := c.execSQL(`INSERT INTO FollowEvents (follower, followed, kind, snapshot, previous)
+		VALUES (?, ?, ?, ?, ?);`, follower, followed, kind, snapshot, previous)
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"follower": follower, "followed": followed, "kind": kind,
+		}).Error("Failed to insert follow event")
+	}
+}
+
+func (c *Covfefe) indexText(text, field string, tweet, user, message int64) {
+	if text == "" {
+		return
+	}
+	err := c.execSQL(`INSERT INTO SearchIndex (text, field, tweet, user, message)
+		VALUES (?, ?, ?, ?, ?);`, text, field, tweet, user, message)
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"tweet": tweet, "user": user, "field": field,
+		}).Error("Failed to index text")
+	}
+}
+
 func (c *Covfefe) deletedTweet(tweet, message int64) {
 	err := c.execSQL(`UPDATE Tweets SET deleted = ? WHERE id = ?`, message, tweet)
 	if err != nil {
@@ -138,6 +165,61 @@ func (c *Covfefe) deletedTweet(tweet, message int64) {
 	}
 }
 
+func (c *Covfefe) insertToot(status *mastodonStatus, instance string, message int64) (new bool, err error) {
+	err = c.execSQL(
+		`INSERT INTO Toots (uri, id, instance, created, account, message) VALUES (?, ?, ?, ?, ?, ?)`,
+		status.URI, status.ID, instance, status.CreatedAt, status.Account.URL, message)
+	if sqlite.ErrCode(err) == sqlite.SQLITE_CONSTRAINT_PRIMARYKEY {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.Wrap(err, "failed insert query")
+	}
+	return true, nil
+}
+
+func (c *Covfefe) insertMastodonUser(account *mastodonAccount, message int64) error {
+	return errors.Wrap(c.execSQL(
+		`INSERT INTO MastodonUsers (url, acct, name, bio, first_seen) VALUES (?, ?, ?, ?, ?);`,
+		account.URL, account.Acct, account.DisplayName, account.Note, message), "failed insert query")
+}
+
+func (c *Covfefe) insertMastodonFollow(follower, target string, message int64) error {
+	return errors.Wrap(c.execSQL(
+		`INSERT INTO MastodonFollows (follower, target, first_seen) VALUES (?, ?, ?);`,
+		follower, target, message), "failed insert query")
+}
+
+// deletedToot marks as deleted the toot with the given ID, which is local to
+// instance.
+func (c *Covfefe) deletedToot(instance, id string, message int64) {
+	err := c.execSQL(`UPDATE Toots SET deleted = ? WHERE instance = ? AND id = ?`, message, instance, id)
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"toot": id, "instance": instance,
+		}).Error("Failed to delete toot")
+	}
+}
+
+func (c *Covfefe) insertMedia(id int64, variant, hash, mime, url string, message int64) error {
+	return errors.Wrap(c.execSQL(
+		`INSERT INTO Media (id, variant, hash, type, url, first_seen) VALUES (?, ?, ?, ?, ?, ?);`,
+		id, variant, hash, mime, url, message), "failed insert query")
+}
+
+// mediaHash returns the blob hash of a media variant, or "" if it was never
+// stored.
+func (c *Covfefe) mediaHash(id int64, variant string) (hash string, err error) {
+	err = errors.Wrap(c.withConn(func(conn *sqlite.Conn) error {
+		return sqlitex.Exec(conn, "SELECT hash FROM Media WHERE id = ? AND variant = ?",
+			func(stmt *sqlite.Stmt) error {
+				hash = stmt.GetText("hash")
+				return nil
+			}, id, variant)
+	}), "failed select query")
+	return
+}
+
 func mustParseTime(CreatedAt string) time.Time {
 	t, err := time.Parse(time.RubyDate, CreatedAt)
 	if err != nil {
@@ -0,0 +1,503 @@
+package covfefe
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"crawshaw.io/sqlite"
+	"crawshaw.io/sqlite/sqlitex"
+	"github.com/h2non/filetype"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// ExportFormats are the formats supported by Export.
+var ExportFormats = []string{"jsonl", "csv", "html"}
+
+// An ExportFilter selects the tweets to export. Zero fields match everything.
+// Deleted tweets are always included.
+type ExportFilter struct {
+	// Users are user IDs or handles, with or without the @.
+	Users []string
+	// From and To bound the creation time of the tweets. To is exclusive.
+	From, To time.Time
+	// Source is a source ID the message containing the tweet must carry,
+	// like "tl:51049452".
+	Source string
+	// Accounts, if not empty, restricts the export to messages received on
+	// behalf of these Twitter accounts, and their sources to the ones of these
+	// accounts. See AccountSources.
+	Accounts []int64
+}
+
+// An ExportedTweet is a tweet selected by an ExportFilter.
+type ExportedTweet struct {
+	ID      int64
+	User    int64
+	Handle  string
+	Text    string
+	Created string
+	// Deleted is the time the deletion was received, if the tweet was
+	// deleted.
+	Deleted string
+	// InReplyTo and Quotes are the IDs of the parent tweets, if any.
+	InReplyTo, Quotes int64
+
+	// Message is the ID of the message the tweet was first seen in, and
+	// Source and JSON are its columns.
+	Message int64
+	Source  []string
+	JSON    json.RawMessage
+
+	Media []ExportedMedia
+}
+
+// An ExportedMedia is a stored media variant attached to an exported tweet.
+type ExportedMedia struct {
+	ID      int64
+	Variant string
+	// Hash is empty for images saved before the media store, which have no
+	// Media rows and are only found in HTML exports.
+	Hash string
+	Type string
+}
+
+// exportTime formats t like the DATETIME columns, so that it can be compared
+// with them as a string.
+func exportTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format("2006-01-02 15:04:05")
+}
+
+// ExportTweets calls fn for each tweet selected by f, oldest first.
+func ExportTweets(conn *sqlite.Conn, f *ExportFilter, fn func(*ExportedTweet) error) error {
+	users := []int64{}
+	for _, u := range f.Users {
+		u = strings.TrimPrefix(strings.TrimSpace(u), "@")
+		if u == "" {
+			continue
+		}
+		if id, err := strconv.ParseInt(u, 10, 64); err == nil {
+			users = append(users, id)
+			continue
+		}
+		found := false
+		if err := sqlitex.Exec(conn, `SELECT DISTINCT id FROM Users WHERE handle = ? COLLATE NOCASE;`,
+			func(stmt *sqlite.Stmt) error {
+				users = append(users, stmt.ColumnInt64(0))
+				found = true
+				return nil
+			}, u); err != nil {
+			return errors.Wrap(err, "failed to resolve handle")
+		}
+		if !found {
+			return errors.Errorf("unknown user %q", u)
+		}
+	}
+	usersJSON, err := json.Marshal(users)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	accountSources := []string{}
+	allowed := make(map[string]bool)
+	for _, a := range f.Accounts {
+		for _, s := range AccountSources(a) {
+			accountSources = append(accountSources, s)
+			allowed[s] = true
+		}
+	}
+	sourcesJSON, err := json.Marshal(accountSources)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	stmt, err := conn.Prepare(`SELECT Tweets.id, Tweets.user, Tweets.created, Tweets.message,
+			Messages.json, Messages.source,
+			(SELECT received FROM Messages AS Deletions WHERE Deletions.id = Tweets.deleted),
+			(SELECT handle FROM Users WHERE Users.id = Tweets.user
+				ORDER BY first_seen DESC LIMIT 1)
+		FROM Tweets JOIN Messages ON Messages.id = Tweets.message
+		WHERE ($users = '[]' OR Tweets.user IN (SELECT value FROM json_each($users)))
+		AND ($from = '' OR Tweets.created >= $from)
+		AND ($to = '' OR Tweets.created < $to)
+		AND ($source = '' OR EXISTS (
+			SELECT 1 FROM json_each(Messages.source) WHERE value = $source))
+		AND ($sources = '[]' OR EXISTS (
+			SELECT 1 FROM json_each(Messages.source) WHERE value IN (
+				SELECT value FROM json_each($sources))))
+		ORDER BY Tweets.created, Tweets.id;`)
+	if err != nil {
+		return errors.Wrap(err, "failed to prepare export query")
+	}
+	defer stmt.Reset()
+	stmt.SetText("$users", string(usersJSON))
+	stmt.SetText("$from", exportTime(f.From))
+	stmt.SetText("$to", exportTime(f.To))
+	stmt.SetText("$source", f.Source)
+	stmt.SetText("$sources", string(sourcesJSON))
+
+	for {
+		if hasRow, err := stmt.Step(); err != nil {
+			return errors.Wrap(err, "failed to run export query")
+		} else if !hasRow {
+			return nil
+		}
+		t := &ExportedTweet{
+			ID:      stmt.ColumnInt64(0),
+			User:    stmt.ColumnInt64(1),
+			Created: stmt.ColumnText(2),
+			Message: stmt.ColumnInt64(3),
+			JSON:    json.RawMessage(stmt.ColumnText(4)),
+			Deleted: stmt.ColumnText(6),
+			Handle:  stmt.ColumnText(7),
+		}
+		if err := json.Unmarshal([]byte(stmt.ColumnText(5)), &t.Source); err != nil {
+			return errors.Wrapf(err, "failed to parse source of message %d", t.Message)
+		}
+		if len(f.Accounts) > 0 {
+			// The other sources would reveal which other accounts received
+			// the message.
+			var sources []string
+			for _, s := range t.Source {
+				if allowed[s] {
+					sources = append(sources, s)
+				}
+			}
+			t.Source = sources
+		}
+		if err := loadExportedTweet(conn, t); err != nil {
+			return err
+		}
+		if err := fn(t); err != nil {
+			return err
+		}
+	}
+}
+
+func loadExportedTweet(conn *sqlite.Conn, t *ExportedTweet) error {
+	tweet := messageTweet(t.JSON, t.ID)
+	t.Text = jsonTweetText(tweet)
+
+	if err := sqlitex.Exec(conn, `SELECT parent, kind FROM Threads WHERE tweet = ?;`,
+		func(stmt *sqlite.Stmt) error {
+			switch stmt.GetText("kind") {
+			case "reply":
+				t.InReplyTo = stmt.GetInt64("parent")
+			case "quote":
+				t.Quotes = stmt.GetInt64("parent")
+			}
+			return nil
+		}, t.ID); err != nil {
+		return errors.Wrap(err, "failed to query parents")
+	}
+
+	for _, id := range jsonTweetMediaIDs(tweet) {
+		if err := sqlitex.Exec(conn, `SELECT variant, hash, type FROM Media
+			WHERE id = ? ORDER BY variant;`,
+			func(stmt *sqlite.Stmt) error {
+				t.Media = append(t.Media, ExportedMedia{
+					ID: id, Variant: stmt.GetText("variant"),
+					Hash: stmt.GetText("hash"), Type: stmt.GetText("type"),
+				})
+				return nil
+			}, id); err != nil {
+			return errors.Wrap(err, "failed to query media")
+		}
+	}
+	return nil
+}
+
+// jsonTweetMediaIDs returns the IDs of the media attached to a decoded tweet.
+func jsonTweetMediaIDs(tweet map[string]interface{}) []int64 {
+	var media []interface{}
+	if e, ok := tweet["extended_entities"].(map[string]interface{}); ok {
+		media, _ = e["media"].([]interface{})
+	}
+	var ids []int64
+	for _, m := range media {
+		m, _ := m.(map[string]interface{})
+		id, err := strconv.ParseInt(jsonString(m["id_str"]), 10, 64)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func jsonString(v interface{}) string {
+	s, _ := v.(string)
+	return s
+}
+
+// Export writes the tweets selected by f to w in the given format:
+//
+//   - "jsonl", the raw JSON of each message containing a selected tweet, one
+//     per line;
+//   - "csv", one flattened row per tweet;
+//   - "html", a zip of a static site with a page listing the tweets and the
+//     media files they reference, read from mediaPath, to be browsed offline.
+func Export(conn *sqlite.Conn, w io.Writer, format string, f *ExportFilter, mediaPath string) error {
+	switch format {
+	case "jsonl":
+		return exportJSONL(conn, w, f)
+	case "csv":
+		return exportCSV(conn, w, f)
+	case "html":
+		return exportHTML(conn, w, f, mediaPath)
+	default:
+		return errors.Errorf("unknown export format %q", format)
+	}
+}
+
+func exportJSONL(conn *sqlite.Conn, w io.Writer, f *ExportFilter) error {
+	mw := newMessageWriter(w)
+	if err := ExportTweets(conn, f, mw.write); err != nil {
+		return err
+	}
+	return mw.flush()
+}
+
+// A messageWriter writes the raw message of each tweet as a line of JSON,
+// skipping messages already written, as a message can contain more than one
+// tweet, like a retweet.
+type messageWriter struct {
+	w    *bufio.Writer
+	buf  bytes.Buffer
+	seen map[int64]bool
+}
+
+func newMessageWriter(w io.Writer) *messageWriter {
+	return &messageWriter{w: bufio.NewWriter(w), seen: make(map[int64]bool)}
+}
+
+func (mw *messageWriter) write(t *ExportedTweet) error {
+	if mw.seen[t.Message] {
+		return nil
+	}
+	mw.seen[t.Message] = true
+	// Compact, as archive imports might be indented.
+	mw.buf.Reset()
+	if err := json.Compact(&mw.buf, t.JSON); err != nil {
+		return errors.Wrapf(err, "invalid JSON in message %d", t.Message)
+	}
+	mw.buf.WriteByte('\n')
+	_, err := mw.w.Write(mw.buf.Bytes())
+	return errors.WithStack(err)
+}
+
+func (mw *messageWriter) flush() error {
+	return errors.WithStack(mw.w.Flush())
+}
+
+func exportCSV(conn *sqlite.Conn, w io.Writer, f *ExportFilter) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"id", "created", "user", "handle", "text", "in_reply_to", "quotes",
+		"deleted", "source", "message", "media"})
+	formatID := func(id int64) string {
+		if id == 0 {
+			return ""
+		}
+		return strconv.FormatInt(id, 10)
+	}
+	if err := ExportTweets(conn, f, func(t *ExportedTweet) error {
+		var media []string
+		for _, m := range t.Media {
+			media = append(media, m.Hash)
+		}
+		return cw.Write([]string{
+			formatID(t.ID), t.Created, formatID(t.User), t.Handle, t.Text,
+			formatID(t.InReplyTo), formatID(t.Quotes), t.Deleted,
+			strings.Join(t.Source, " "), formatID(t.Message), strings.Join(media, " "),
+		})
+	}); err != nil {
+		return err
+	}
+	cw.Flush()
+	return errors.WithStack(cw.Error())
+}
+
+// exportMediaName returns the name of a media file in an HTML export. Blobs
+// have no extension, but browsers are pickier with local files.
+func exportMediaName(m ExportedMedia) string {
+	name := m.Hash
+	if name == "" {
+		name = strconv.FormatInt(m.ID, 10)
+	}
+	ext := ""
+	for _, t := range filetype.Types {
+		if t.MIME.Value == m.Type && (ext == "" || t.Extension < ext) {
+			ext = t.Extension
+		}
+	}
+	if ext == "" {
+		return "media/" + name
+	}
+	return "media/" + name + "." + ext
+}
+
+// legacyMediaTypes are the extensions and types of the <media ID>.<ext> files
+// saved before the media store.
+var legacyMediaTypes = []struct{ ext, mime string }{
+	{"jpg", "image/jpeg"},
+	{"png", "image/png"},
+}
+
+// exportMediaFiles returns the files in mediaPath of the media of t, keyed by
+// their name in the export, and drops the missing ones from t.Media, so that
+// the page doesn't link them. Images without Media rows are looked up in the
+// legacy <media ID>.<ext> files.
+func exportMediaFiles(t *ExportedTweet, mediaPath string) map[string]string {
+	files := make(map[string]string)
+	log := log.WithField("tweet", t.ID)
+	stored := make(map[int64]bool)
+	var media []ExportedMedia
+	for _, m := range t.Media {
+		stored[m.ID] = true
+		path := blobPath(mediaPath, m.Hash)
+		if _, err := os.Stat(path); err != nil {
+			log.WithError(err).WithField("media", m.ID).Warn("Skipping missing media")
+			continue
+		}
+		files[exportMediaName(m)] = path
+		media = append(media, m)
+	}
+	for _, id := range jsonTweetMediaIDs(messageTweet(t.JSON, t.ID)) {
+		if stored[id] {
+			continue
+		}
+		for _, l := range legacyMediaTypes {
+			path := filepath.Join(mediaPath, fmt.Sprintf("%d.%s", id, l.ext))
+			if _, err := os.Stat(path); err != nil {
+				continue
+			}
+			m := ExportedMedia{ID: id, Variant: "image", Type: l.mime}
+			files[exportMediaName(m)] = path
+			media = append(media, m)
+			break
+		}
+	}
+	t.Media = media
+	return files
+}
+
+var exportTemplate = template.Must(template.New("index.html").Funcs(template.FuncMap{
+	"mediaName": exportMediaName,
+	"isVideo":   func(m ExportedMedia) bool { return strings.HasPrefix(m.Type, "video/") },
+}).Parse(`<!DOCTYPE html>
+<meta charset="utf-8">
+<title>covfefe export</title>
+<style>
+	body { font-family: sans-serif; max-width: 50em; margin: 0 auto; }
+	.tweet { border-bottom: 1px solid #ccc; padding: 1em 0; }
+	.deleted { background: #fee; }
+	img, video { max-width: 100%; }
+</style>
+
+<h1>covfefe export</h1>
+<p>{{len .Tweets}} tweets{{with .Filter}}{{with .Users}}, by {{range $i, $u := .}}{{if $i}}, {{end}}{{$u}}{{end}}{{end}}{{with .Source}}, from source {{.}}{{end}}{{end}}{{with .From}}, from {{.}}{{end}}{{with .To}}, until {{.}}{{end}}.
+Exported at {{.Exported}}.</p>
+
+{{range .Tweets}}
+<div class="tweet{{if .Deleted}} deleted{{end}}" id="{{.ID}}">
+	<p><strong>{{with .Handle}}@{{.}}{{else}}{{.User}}{{end}}</strong>
+	&middot; {{.Created}} &middot; {{.ID}}
+	{{with .InReplyTo}}&middot; reply to <a href="#{{.}}">{{.}}</a>{{end}}
+	{{with .Quotes}}&middot; quotes <a href="#{{.}}">{{.}}</a>{{end}}
+	{{with .Deleted}}&middot; <strong>deleted</strong> at {{.}}{{end}}
+	<blockquote>{{.Text}}</blockquote>
+	{{range .Media}}{{if isVideo .}}<video controls src="{{mediaName .}}"></video>
+	{{else}}<img src="{{mediaName .}}" alt="">
+	{{end}}{{end}}
+</div>
+{{end}}
+`))
+
+func exportHTML(conn *sqlite.Conn, w io.Writer, f *ExportFilter, mediaPath string) error {
+	var tweets []*ExportedTweet
+	if err := ExportTweets(conn, f, func(t *ExportedTweet) error {
+		tweets = append(tweets, t)
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	var names []string
+	files := make(map[string]string)
+	for _, t := range tweets {
+		for name, path := range exportMediaFiles(t, mediaPath) {
+			if _, ok := files[name]; !ok {
+				names = append(names, name)
+			}
+			files[name] = path
+		}
+	}
+	sort.Strings(names)
+
+	z := zip.NewWriter(w)
+	page, err := z.Create("index.html")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if err := exportTemplate.Execute(page, map[string]interface{}{
+		"Tweets": tweets, "Filter": f, "Exported": time.Now().UTC().Format(time.RFC3339),
+		"From": exportTime(f.From), "To": exportTime(f.To),
+	}); err != nil {
+		return errors.Wrap(err, "failed to render index")
+	}
+
+	// The raw messages are included too, as the page only shows a summary.
+	messages, err := z.Create("messages.jsonl")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	mw := newMessageWriter(messages)
+	for _, t := range tweets {
+		if err := mw.write(t); err != nil {
+			return err
+		}
+	}
+	if err := mw.flush(); err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		if err := exportBlob(z, name, files[name]); err != nil {
+			return err
+		}
+	}
+
+	return errors.WithStack(z.Close())
+}
+
+// exportBlob copies the file at path into z. Files that can't be opened are
+// skipped, as failing would abort an export that was already partly sent.
+func exportBlob(z *zip.Writer, name, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		log.WithError(err).WithField("file", name).Warn("Skipping unreadable media")
+		return nil
+	}
+	defer f.Close()
+	// Media is already compressed.
+	w, err := z.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	_, err = io.Copy(w, f)
+	return errors.Wrap(err, "failed to copy media")
+}
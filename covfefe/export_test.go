@@ -0,0 +1,230 @@
+package covfefe
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"crawshaw.io/sqlite"
+)
+
+func TestExport(t *testing.T) {
+	c, _, cleanup := newTestCovfefe(t)
+	defer cleanup()
+	c.rescan = true // Don't queue jobs.
+
+	c.Handle(testTweet(1, 1, 0, "first", ""))
+	c.Handle(testTweet(2, 2, 1, "reply", ""))
+	c.Handle(testTweet(3, 1, 0, "with a picture", `, "extended_entities": {"media": [
+		{"id": 30, "id_str": "30", "media_url_https": "https://example.com/30.png"}]}`))
+	c.Handle(testTweet(4, 1, 0, "regrets", ""))
+	c.Handle(&Message{source: "h:1", kind: "del", msg: []byte(`{"id": 4, "id_str": "4", "user_id": 1}`)})
+
+	hash := storeTestBlob(t, c, testPNG)
+	if err := c.insertMedia(30, "image", hash, "image/png", "https://example.com/30.png", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	export := func(format string, f *ExportFilter) []byte {
+		var buf bytes.Buffer
+		if err := c.withConn(func(conn *sqlite.Conn) error {
+			return Export(conn, &buf, format, f, c.mediaPath)
+		}); err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		return buf.Bytes()
+	}
+
+	byU1 := &ExportFilter{Users: []string{"@U1"}}
+	lines := strings.Split(strings.TrimSpace(string(export("jsonl", byU1))), "\n")
+	if len(lines) != 3 || !strings.Contains(lines[0], `"full_text":"first"`) ||
+		!strings.Contains(lines[2], `"full_text":"regrets"`) {
+		t.Errorf("unexpected JSONL export: %q", lines)
+	}
+
+	rows, err := csv.NewReader(bytes.NewReader(export("csv", &ExportFilter{}))).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 5 {
+		t.Fatalf("got %d CSV rows, expected 5", len(rows))
+	}
+	if exp := []string{"2", "2019-01-02 10:02:00 +0000 UTC", "2", "u2", "reply", "1", "",
+		"", "h:1", "2", ""}; !reflect.DeepEqual(rows[2], exp) {
+		t.Errorf("reply row = %q, expected %q", rows[2], exp)
+	}
+	if rows[3][10] != hash {
+		t.Errorf("media column = %q, expected %q", rows[3][10], hash)
+	}
+	if rows[4][7] == "" {
+		t.Errorf("deleted tweet not marked: %q", rows[4])
+	}
+
+	between := &ExportFilter{
+		From: time.Date(2019, 1, 2, 10, 2, 0, 0, time.UTC),
+		To:   time.Date(2019, 1, 2, 10, 4, 0, 0, time.UTC),
+	}
+	rows, err = csv.NewReader(bytes.NewReader(export("csv", between))).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 || rows[1][0] != "2" || rows[2][0] != "3" {
+		t.Errorf("unexpected date range export: %q", rows)
+	}
+
+	if rows := export("jsonl", &ExportFilter{Source: "tl:1"}); len(rows) != 0 {
+		t.Errorf("unexpected export for another source: %q", rows)
+	}
+
+	bundle := export("html", byU1)
+	z, err := zip.NewReader(bytes.NewReader(bundle), int64(len(bundle)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string][]byte)
+	for _, f := range z.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[f.Name], err = ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Close()
+	}
+	media := "media/" + hash + ".png"
+	if !bytes.Equal(files[media], testPNG) {
+		t.Errorf("media missing from bundle, got files %v", reflect.ValueOf(files).MapKeys())
+	}
+	index := string(files["index.html"])
+	for _, s := range []string{"with a picture", `src="` + media + `"`, "<strong>deleted</strong>"} {
+		if !strings.Contains(index, s) {
+			t.Errorf("index.html doesn't contain %q", s)
+		}
+	}
+	if strings.Contains(index, "reply") {
+		t.Errorf("index.html contains a tweet by another user")
+	}
+
+	if err := c.withConn(func(conn *sqlite.Conn) error {
+		return Export(conn, ioutil.Discard, "jsonl", &ExportFilter{Users: []string{"nobody"}}, c.mediaPath)
+	}); err == nil {
+		t.Errorf("expected an error for an unknown user")
+	}
+}
+
+func TestExportAccountSources(t *testing.T) {
+	c, _, cleanup := newTestCovfefe(t)
+	defer cleanup()
+	c.rescan = true // Don't queue jobs.
+
+	// Tweet 1 was received by both accounts, tweet 2 only by account 2.
+	for _, source := range []string{"tl:1", "lk:2"} {
+		m := testTweet(1, 3, 0, "shared", "")
+		m.source = source
+		c.Handle(m)
+	}
+	m := testTweet(2, 3, 0, "private", "")
+	m.source = "tl:2"
+	c.Handle(m)
+
+	export := func(format string) string {
+		var buf bytes.Buffer
+		if err := c.withConn(func(conn *sqlite.Conn) error {
+			return Export(conn, &buf, format, &ExportFilter{Accounts: []int64{1}}, c.mediaPath)
+		}); err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		return buf.String()
+	}
+
+	rows, err := csv.NewReader(strings.NewReader(export("csv"))).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[1][0] != "1" || rows[1][8] != "tl:1" {
+		t.Errorf("unexpected export for account 1: %q", rows)
+	}
+	if jsonl := export("jsonl"); strings.Contains(jsonl, "lk:2") || strings.Contains(jsonl, "private") {
+		t.Errorf("JSONL export for account 1 reveals account 2: %q", jsonl)
+	}
+	var all []*ExportedTweet
+	if err := c.withConn(func(conn *sqlite.Conn) error {
+		return ExportTweets(conn, &ExportFilter{}, func(t *ExportedTweet) error {
+			all = append(all, t)
+			return nil
+		})
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 2 || !reflect.DeepEqual(all[0].Source, []string{"tl:1", "lk:2"}) {
+		t.Errorf("unfiltered export lost sources: %+v", all)
+	}
+}
+
+func TestExportHTMLMedia(t *testing.T) {
+	c, _, cleanup := newTestCovfefe(t)
+	defer cleanup()
+	c.rescan = true // Don't queue jobs.
+
+	c.Handle(testTweet(1, 1, 0, "stored and missing", `, "extended_entities": {"media": [
+		{"id": 30, "id_str": "30", "media_url_https": "https://example.com/30.png"},
+		{"id": 31, "id_str": "31", "media_url_https": "https://example.com/31.png"}]}`))
+	c.Handle(testTweet(2, 1, 0, "legacy", `, "extended_entities": {"media": [
+		{"id": 40, "id_str": "40", "media_url_https": "https://example.com/40.png"}]}`))
+
+	hash := storeTestBlob(t, c, testPNG)
+	if err := c.insertMedia(30, "image", hash, "image/png", "https://example.com/30.png", 1); err != nil {
+		t.Fatal(err)
+	}
+	// Media 31 has a row, but its blob went missing from the store.
+	missing := strings.Repeat("ab", 32)
+	if err := c.insertMedia(31, "image", missing, "image/png", "https://example.com/31.png", 1); err != nil {
+		t.Fatal(err)
+	}
+	// Media 40 was saved before the media store, and has no row.
+	if err := ioutil.WriteFile(filepath.Join(c.mediaPath, "40.png"), testPNG, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := c.withConn(func(conn *sqlite.Conn) error {
+		return Export(conn, &buf, "html", &ExportFilter{}, c.mediaPath)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	z, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	var index []byte
+	for _, f := range z.File {
+		names = append(names, f.Name)
+		if f.Name == "index.html" {
+			r, err := f.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			index, _ = ioutil.ReadAll(r)
+			r.Close()
+		}
+	}
+	if exp := []string{"index.html", "messages.jsonl", "media/40.png",
+		"media/" + hash + ".png"}; !reflect.DeepEqual(names, exp) {
+		t.Errorf("bundle files = %q, expected %q", names, exp)
+	}
+	if strings.Contains(string(index), missing) {
+		t.Errorf("index.html links the missing media")
+	}
+	if !strings.Contains(string(index), `src="media/40.png"`) {
+		t.Errorf("index.html doesn't link the legacy media")
+	}
+}
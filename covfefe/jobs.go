@@ -0,0 +1,356 @@
+package covfefe
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"crawshaw.io/sqlite"
+	"crawshaw.io/sqlite/sqlitex"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// Jobs are the side effects of processing messages which are slow or can
+// fail, like downloading media, running OCR on it, and fetching parent tweets.
+// They are stored in the Jobs table, so they survive restarts, and run by a
+// bounded pool of workers, with exponential backoff on failure.
+
+const (
+	jobWorkers     = 4
+	maxJobAttempts = 10
+	maxJobBackoff  = 24 * time.Hour
+)
+
+// jobInterval and jobMinBackoff are vars so tests can speed them up.
+var (
+	jobInterval   = 10 * time.Second
+	jobMinBackoff = 1 * time.Minute
+)
+
+type job struct {
+	id       int64
+	kind     string
+	args     []byte
+	message  int64
+	attempts int
+}
+
+// mediaJob downloads a media variant, and queues OCR for images. Tweet and
+// User are where the OCR text will be indexed.
+type mediaJob struct {
+	Media   int64  `json:"media"`
+	Variant string `json:"variant"`
+	URL     string `json:"url"`
+	Tweet   int64  `json:"tweet"`
+	User    int64  `json:"user"`
+}
+
+// ocrJob runs OCR on a stored image, unless already done, and indexes it.
+type ocrJob struct {
+	Hash  string `json:"hash"`
+	Tweet int64  `json:"tweet"`
+	User  int64  `json:"user"`
+}
+
+// parentJob fetches the tweet Tweet is replying to.
+type parentJob struct {
+	Tweet  int64 `json:"tweet"`
+	Parent int64 `json:"parent"`
+}
+
+// enqueueJob stores a job, unless one with the same kind and args exists.
+func (c *Covfefe) enqueueJob(kind string, args interface{}, message int64) {
+	log := log.WithFields(log.Fields{"kind": kind, "message": message})
+	j, err := json.Marshal(args)
+	if err != nil {
+		log.WithError(err).Error("Failed to marshal job")
+		return
+	}
+	if err := c.execSQL(`INSERT INTO Jobs (kind, args, message) VALUES (?, ?, ?);`,
+		kind, string(j), message); err != nil {
+		log.WithError(err).Error("Failed to enqueue job")
+	}
+}
+
+// runJobs runs due jobs until ctx is cancelled. Messages produced by jobs,
+// like hydrated parent tweets, are sent to messages.
+func (c *Covfefe) runJobs(ctx context.Context, messages chan<- *Message) error {
+	// Jobs left running by a previous run were interrupted.
+	if err := c.execSQL(`UPDATE Jobs SET status = 'pending' WHERE status = 'running';`); err != nil {
+		return errors.Wrap(err, "failed to reset running jobs")
+	}
+
+	jobs := make(chan *job)
+	var wg sync.WaitGroup
+	for i := 0; i < jobWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			for j := range jobs {
+				c.runJob(ctx, j, messages)
+			}
+			wg.Done()
+		}()
+	}
+	defer wg.Wait()
+	defer close(jobs)
+
+	tick := time.NewTicker(jobInterval)
+	defer tick.Stop()
+
+	for {
+		due, err := c.claimJobs(jobWorkers)
+		if err != nil {
+			return err
+		}
+		for _, j := range due {
+			select {
+			case jobs <- j:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		if len(due) == jobWorkers {
+			// There might be more.
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-tick.C:
+		}
+	}
+}
+
+// claimJobs marks up to n due jobs as running, and returns them.
+func (c *Covfefe) claimJobs(n int) (jobs []*job, err error) {
+	err = c.withConn(func(conn *sqlite.Conn) (err error) {
+		defer sqlitex.Save(conn)(&err)
+		if err := sqlitex.Exec(conn, `SELECT id, kind, args, message, attempts FROM Jobs
+			WHERE status = 'pending' AND next_attempt <= DATETIME('now')
+			ORDER BY next_attempt, id LIMIT ?;`,
+			func(stmt *sqlite.Stmt) error {
+				jobs = append(jobs, &job{
+					id:       stmt.GetInt64("id"),
+					kind:     stmt.GetText("kind"),
+					args:     []byte(stmt.GetText("args")),
+					message:  stmt.GetInt64("message"),
+					attempts: int(stmt.GetInt64("attempts")),
+				})
+				return nil
+			}, n); err != nil {
+			return err
+		}
+		for _, j := range jobs {
+			if err := sqlitex.Exec(conn, `UPDATE Jobs SET status = 'running' WHERE id = ?;`,
+				nil, j.id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return jobs, errors.Wrap(err, "failed to claim jobs")
+}
+
+func (c *Covfefe) runJob(ctx context.Context, j *job, messages chan<- *Message) {
+	log := log.WithFields(log.Fields{
+		"job": j.id, "kind": j.kind, "attempt": j.attempts + 1,
+	})
+
+	var err error
+	switch j.kind {
+	case "media":
+		args := new(mediaJob)
+		if err = json.Unmarshal(j.args, args); err == nil {
+			err = c.runMediaJob(args, j.message)
+		}
+	case "ocr":
+		args := new(ocrJob)
+		if err = json.Unmarshal(j.args, args); err == nil {
+			err = c.runOCRJob(args, j.message)
+		}
+	case "parent":
+		args := new(parentJob)
+		if err = json.Unmarshal(j.args, args); err == nil {
+			err = c.runParentJob(ctx, args, messages)
+		}
+	default:
+		err = errors.Errorf("unknown job kind %q", j.kind)
+	}
+
+	if err == nil {
+		log.Debug("Job done")
+		if err := c.execSQL(`UPDATE Jobs SET status = 'done', attempts = attempts + 1,
+			error = NULL WHERE id = ?;`, j.id); err != nil {
+			log.WithError(err).Error("Failed to update job")
+		}
+		return
+	}
+
+	if ctx.Err() != nil {
+		// Interrupted, not failed. Try again at the next run.
+		if err := c.execSQL(`UPDATE Jobs SET status = 'pending' WHERE id = ?;`, j.id); err != nil {
+			log.WithError(err).Error("Failed to update job")
+		}
+		return
+	}
+
+	if rl, ok := errors.Cause(err).(*rateLimitedError); ok {
+		// Not the job's fault, so it doesn't count as an attempt.
+		log.WithField("reset", rl.reset).Debug("Job rate limited")
+		delay := fmt.Sprintf("+%d seconds", int(time.Until(rl.reset)/time.Second)+1)
+		if err := c.execSQL(`UPDATE Jobs SET status = 'pending',
+			next_attempt = DATETIME('now', ?) WHERE id = ?;`, delay, j.id); err != nil {
+			log.WithError(err).Error("Failed to update job")
+		}
+		return
+	}
+
+	status := "pending"
+	if j.attempts+1 >= maxJobAttempts {
+		status = "failed"
+		log.WithError(err).Error("Job failed, giving up")
+	} else {
+		log.WithError(err).Warn("Job failed, will retry")
+	}
+	backoff := fmt.Sprintf("+%d seconds", int(jobBackoff(j.attempts)/time.Second))
+	if err := c.execSQL(`UPDATE Jobs SET status = ?, attempts = attempts + 1, error = ?,
+		next_attempt = DATETIME('now', ?) WHERE id = ?;`,
+		status, err.Error(), backoff, j.id); err != nil {
+		log.WithError(err).Error("Failed to update job")
+	}
+}
+
+// jobBackoff returns the delay before retrying a job which failed after the
+// given number of previous attempts.
+func jobBackoff(attempts int) time.Duration {
+	d := jobMinBackoff
+	for i := 0; i < attempts && d < maxJobBackoff; i++ {
+		d *= 2
+	}
+	if d > maxJobBackoff {
+		d = maxJobBackoff
+	}
+	return d
+}
+
+func (c *Covfefe) runMediaJob(args *mediaJob, message int64) error {
+	hash, err := c.mediaHash(args.Media, args.Variant)
+	if err != nil {
+		return err
+	}
+	if hash == "" {
+		body, err := c.httpGet(args.URL)
+		if err != nil {
+			metricMediaFailures.add(1)
+			return err
+		}
+		hash, err = c.saveMedia(body, args.Media, args.Variant, args.URL, message)
+		if err != nil {
+			return err
+		}
+	}
+	if args.Variant == "image" {
+		c.enqueueJob("ocr", &ocrJob{Hash: hash, Tweet: args.Tweet, User: args.User}, message)
+	}
+	return nil
+}
+
+func (c *Covfefe) runOCRJob(args *ocrJob, message int64) error {
+	name := blobPath(c.mediaPath, args.Hash)
+	// The same image might have been processed for another media ID.
+	if _, err := os.Stat(name + ".txt"); os.IsNotExist(err) {
+		start := time.Now()
+		out, err := exec.Command("tesseract", name, name).CombinedOutput()
+		metricOCRDuration.observe(time.Since(start).Seconds())
+		if err != nil {
+			return errors.Wrapf(err, "tesseract failed: %s", out)
+		}
+	}
+	text, err := ioutil.ReadFile(name + ".txt")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	c.indexText(strings.TrimSpace(string(text)), "ocr", args.Tweet, args.User, message)
+	return nil
+}
+
+func (c *Covfefe) runParentJob(ctx context.Context, args *parentJob, messages chan<- *Message) error {
+	if seen, err := c.seenTweet(args.Parent); err != nil {
+		return err
+	} else if seen {
+		return nil
+	}
+	parent, err := c.hydrateTweet(ctx, args.Parent)
+	if err != nil {
+		return err
+	}
+	select {
+	case messages <- &Message{
+		source: fmt.Sprintf("parent:%d", args.Tweet),
+		kind:   "tweet",
+		msg:    parent,
+	}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// A JobCount is the number of jobs of a kind with a given status.
+type JobCount struct {
+	Kind, Status string
+	Count        int64
+}
+
+// A FailedJob is a job whose last attempt failed.
+type FailedJob struct {
+	ID          int64
+	Kind        string
+	Args        string
+	Status      string
+	Attempts    int64
+	NextAttempt string
+	Error       string
+}
+
+// JobStatus returns the number of jobs by kind and status, and the most
+// recently failed jobs, for the status page.
+func JobStatus(conn *sqlite.Conn) ([]JobCount, []FailedJob, error) {
+	var counts []JobCount
+	if err := sqlitex.Exec(conn, `SELECT kind, status, COUNT(*) FROM Jobs
+		GROUP BY kind, status ORDER BY kind, status;`,
+		func(stmt *sqlite.Stmt) error {
+			counts = append(counts, JobCount{
+				Kind: stmt.ColumnText(0), Status: stmt.ColumnText(1), Count: stmt.ColumnInt64(2),
+			})
+			return nil
+		}); err != nil {
+		return nil, nil, errors.Wrap(err, "failed to count jobs")
+	}
+	var failed []FailedJob
+	if err := sqlitex.Exec(conn, `SELECT id, kind, args, status, attempts, next_attempt, error
+		FROM Jobs WHERE error IS NOT NULL ORDER BY next_attempt DESC LIMIT 50;`,
+		func(stmt *sqlite.Stmt) error {
+			failed = append(failed, FailedJob{
+				ID:          stmt.GetInt64("id"),
+				Kind:        stmt.GetText("kind"),
+				Args:        stmt.GetText("args"),
+				Status:      stmt.GetText("status"),
+				Attempts:    stmt.GetInt64("attempts"),
+				NextAttempt: stmt.GetText("next_attempt"),
+				Error:       stmt.GetText("error"),
+			})
+			return nil
+		}); err != nil {
+		return nil, nil, errors.Wrap(err, "failed to list failed jobs")
+	}
+	return counts, failed, nil
+}
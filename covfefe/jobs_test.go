@@ -0,0 +1,168 @@
+package covfefe
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"crawshaw.io/sqlite"
+)
+
+// rewriteTransport sends all requests to a test server.
+type rewriteTransport struct {
+	target *url.URL
+}
+
+func (t rewriteTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r.URL.Scheme = t.target.Scheme
+	r.URL.Host = t.target.Host
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+// runTestJobs runs the job queue, handling the messages it produces, until
+// there are no more pending jobs.
+func runTestJobs(t *testing.T, c *Covfefe) {
+	defer func(i, b time.Duration) { jobInterval, jobMinBackoff = i, b }(jobInterval, jobMinBackoff)
+	jobInterval, jobMinBackoff = 10*time.Millisecond, 0
+
+	ctx, cancel := context.WithCancel(context.Background())
+	messages := make(chan *Message)
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		c.HandleChan(messages)
+		wg.Done()
+	}()
+	errc := make(chan error, 1)
+	go func() {
+		errc <- c.runJobs(ctx, messages)
+		wg.Done()
+	}()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		pending := queryStrings(t, c, "SELECT COUNT(*) FROM Jobs WHERE status IN ('pending', 'running')")
+		if pending[0] == "0" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%s jobs still pending", pending[0])
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	if err := <-errc; err != context.Canceled {
+		t.Errorf("runJobs returned %v", err)
+	}
+	close(messages)
+	wg.Wait()
+}
+
+func TestJobs(t *testing.T) {
+	var mu sync.Mutex
+	attempts := make(map[string]int)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		attempts[r.URL.Path]++
+		n := attempts[r.URL.Path]
+		mu.Unlock()
+		switch {
+		case r.URL.Path == "/flaky.png" && n == 1:
+			http.Error(w, "try again", http.StatusServiceUnavailable)
+		case r.URL.Path == "/flaky.png":
+			w.Write(testPNG)
+		case r.URL.Path == "/1.1/statuses/show.json" && r.URL.Query().Get("id") == "100":
+			w.Write([]byte(`{"id": 100, "created_at": "Wed Jan 02 09:00:00 +0000 2019",
+				"full_text": "the parent", "user": {"id": 2}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	target, _ := url.Parse(srv.URL)
+
+	c, _, cleanup := newTestCovfefe(t)
+	defer cleanup()
+	c.httpClient = &http.Client{Transport: rewriteTransport{target}}
+	c.api = newAPIClient(c.httpClient)
+
+	// Pretend OCR already ran on the image, as tesseract might not be installed.
+	hash := storeTestBlob(t, c, testPNG)
+	if err := ioutil.WriteFile(blobPath(c.mediaPath, hash)+".txt", []byte("words in a picture\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c.Handle(&Message{source: "h:1", kind: "tweet", msg: []byte(`{"id": 101,
+		"created_at": "Wed Jan 02 10:00:00 +0000 2019", "user": {"id": 1},
+		"in_reply_to_status_id": 100, "extended_entities": {"media": [
+			{"id": 10, "media_url_https": "https://pbs.twimg.com/flaky.png"},
+			{"id": 11, "media_url_https": "https://pbs.twimg.com/gone.png"}]}}`)})
+
+	// Handle only queues the side effects.
+	if media := queryStrings(t, c, "SELECT id FROM Media"); len(media) != 0 {
+		t.Fatalf("media saved before running jobs: %v", media)
+	}
+
+	runTestJobs(t, c)
+
+	jobs := queryStrings(t, c, `SELECT kind || ' ' || status || ' ' || attempts
+		FROM Jobs ORDER BY id`)
+	if exp := []string{
+		"media done 2", "media failed 10", "parent done 1", "ocr done 1",
+	}; !reflect.DeepEqual(jobs, exp) {
+		t.Errorf("Jobs = %v, expected %v", jobs, exp)
+	}
+
+	tweets := queryStrings(t, c, "SELECT id FROM Tweets ORDER BY id")
+	if exp := []string{"100", "101"}; !reflect.DeepEqual(tweets, exp) {
+		t.Errorf("Tweets = %v, expected %v", tweets, exp)
+	}
+	ocr := queryStrings(t, c, "SELECT tweet || ' ' || text FROM SearchIndex WHERE field = 'ocr'")
+	if exp := []string{"101 words in a picture"}; !reflect.DeepEqual(ocr, exp) {
+		t.Errorf("OCR index = %v, expected %v", ocr, exp)
+	}
+
+	var counts []JobCount
+	var failed []FailedJob
+	if err := c.withConn(func(conn *sqlite.Conn) (err error) {
+		counts, failed, err = JobStatus(conn)
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if exp := []JobCount{
+		{"media", "done", 1}, {"media", "failed", 1}, {"ocr", "done", 1}, {"parent", "done", 1},
+	}; !reflect.DeepEqual(counts, exp) {
+		t.Errorf("JobStatus counts = %v, expected %v", counts, exp)
+	}
+	if len(failed) != 1 || failed[0].Kind != "media" || failed[0].Status != "failed" {
+		t.Errorf("JobStatus failed = %+v", failed)
+	}
+}
+
+func storeTestBlob(t *testing.T, c *Covfefe, data []byte) string {
+	hash, err := storeBlob(c.mediaPath, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hash
+}
+
+func TestJobBackoff(t *testing.T) {
+	if d := jobBackoff(0); d != jobMinBackoff {
+		t.Errorf("first backoff is %v", d)
+	}
+	if d := jobBackoff(3); d != 8*jobMinBackoff {
+		t.Errorf("fourth backoff is %v", d)
+	}
+	if d := jobBackoff(100); d != maxJobBackoff {
+		t.Errorf("backoff is not capped: %v", d)
+	}
+}
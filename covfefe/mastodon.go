@@ -0,0 +1,337 @@
+package covfefe
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// A MastodonAccount is a Mastodon user we have an access token for.
+type MastodonAccount struct {
+	// Instance is the base URL of the instance, like "https://mastodon.social".
+	Instance    string `json:"INSTANCE"`
+	AccessToken string `json:"ACCESS_TOKEN"`
+
+	// Sources is the list of source names to run for this account, from the
+	// keys of mastodonSources. If empty, DefaultMastodonSources are run.
+	Sources []string `json:"SOURCES,omitempty"`
+}
+
+type mastodonAccount struct {
+	ID          string `json:"id"`
+	Username    string `json:"username"`
+	Acct        string `json:"acct"`
+	URL         string `json:"url"`
+	DisplayName string `json:"display_name"`
+	Note        string `json:"note"`
+	Locked      bool   `json:"locked"`
+}
+
+type mastodonStatus struct {
+	ID          string           `json:"id"`
+	URI         string           `json:"uri"`
+	CreatedAt   time.Time        `json:"created_at"`
+	Visibility  string           `json:"visibility"`
+	Account     *mastodonAccount `json:"account"`
+	Reblog      *mastodonStatus  `json:"reblog"`
+	InReplyToID string           `json:"in_reply_to_id"`
+	Content     string           `json:"content"`
+}
+
+type mastodonNotification struct {
+	ID      string           `json:"id"`
+	Type    string           `json:"type"`
+	Account *mastodonAccount `json:"account"`
+	Status  *mastodonStatus  `json:"status"`
+}
+
+// mastodonDeletion is the message stored for a delete event from the
+// streaming API, which only carries the instance-local status ID.
+type mastodonDeletion struct {
+	ID       string `json:"id"`
+	Instance string `json:"instance"`
+}
+
+type mastodonClient struct {
+	c        *http.Client
+	instance string
+	token    string
+	u        *mastodonAccount
+}
+
+func newMastodonClient(account MastodonAccount) *mastodonClient {
+	return &mastodonClient{
+		// No Timeout, as the streaming API keeps the response open.
+		c:        &http.Client{},
+		instance: strings.TrimSuffix(account.Instance, "/"),
+		token:    account.AccessToken,
+	}
+}
+
+func (m *mastodonClient) get(ctx context.Context, path string) (r *http.Response, err error) {
+	defer func() { observeFetch(ctx, err) }()
+	u := path
+	if !strings.HasPrefix(u, "https://") && !strings.HasPrefix(u, "http://") {
+		u = m.instance + path
+	}
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+m.token)
+	r, err = m.c.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error getting %s", u)
+	}
+	if r.StatusCode != http.StatusOK {
+		defer r.Body.Close()
+		var e struct {
+			Error string
+		}
+		json.NewDecoder(r.Body).Decode(&e)
+		if e.Error != "" {
+			return nil, errors.Errorf("error getting %s: %s", u, e.Error)
+		}
+		return nil, errors.Errorf("error getting %s: %s", u, r.Status)
+	}
+	return r, nil
+}
+
+// getJSON is like apiClient.getJSON, but also returns the URL of the
+// "prev" page from the Link header, if any, which returns newer items.
+func (m *mastodonClient) getJSON(ctx context.Context, path string, v interface{}) (prev string, err error) {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Minute)
+	defer cancel()
+	r, err := m.get(ctx, path)
+	if err != nil {
+		return "", err
+	}
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		return "", errors.Wrapf(err, "error reading and decoding %q", path)
+	}
+	return linkPrev(r.Header.Get("Link")), nil
+}
+
+var linkPrevRe = regexp.MustCompile(`<([^>]+)>;\s*rel="prev"`)
+
+func linkPrev(link string) string {
+	if m := linkPrevRe.FindStringSubmatch(link); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+func (m *mastodonClient) verifyCredentials(ctx context.Context) (*mastodonAccount, error) {
+	var u *mastodonAccount
+	if _, err := m.getJSON(ctx, "/api/v1/accounts/verify_credentials", &u); err != nil {
+		return nil, err
+	}
+	if u == nil || u.ID == "" {
+		return nil, errors.New("empty verify_credentials response")
+	}
+	return u, nil
+}
+
+// mastodonSources maps the source names usable in MastodonAccount.Sources to
+// constructors, which receive a client with a verified account.
+var mastodonSources = map[string]func(m *mastodonClient) Source{
+	"home":          newMastodonTimelineSource("home"),
+	"notifications": newMastodonTimelineSource("notifications"),
+	"favourites":    newMastodonTimelineSource("favourites"),
+	"statuses":      newMastodonTimelineSource("statuses"),
+	"deletions":     newMastodonDeletionsSource,
+}
+
+// DefaultMastodonSources are the sources run for Mastodon accounts that don't
+// specify any.
+var DefaultMastodonSources = []string{
+	"home", "notifications", "favourites", "statuses", "deletions",
+}
+
+type mastodonTimelineSource struct {
+	m        *mastodonClient
+	timeline string
+}
+
+func newMastodonTimelineSource(timeline string) func(m *mastodonClient) Source {
+	return func(m *mastodonClient) Source {
+		return &mastodonTimelineSource{m: m, timeline: timeline}
+	}
+}
+
+// These are vars so tests can speed them up.
+var (
+	mastodonInterval = 1 * time.Minute
+	// mastodonMaxBackoff caps the wait before retrying a failed request,
+	// which starts at mastodonInterval and doubles with each failure.
+	mastodonMaxBackoff = 15 * time.Minute
+)
+
+func (s *mastodonTimelineSource) Run(ctx context.Context, m chan<- *Message) error {
+	log := logrus.WithFields(logrus.Fields{
+		"account": s.m.u.URL, "timeline": s.timeline,
+	})
+
+	var (
+		source   string
+		kind     = "mastodon-status"
+		endpoint string
+	)
+	switch s.timeline {
+	case "home":
+		source = "mh:" + s.m.u.URL
+		endpoint = "/api/v1/timelines/home?limit=40"
+	case "notifications":
+		source = "mn:" + s.m.u.URL
+		kind = "mastodon-notification"
+		endpoint = "/api/v1/notifications?limit=30"
+	case "favourites":
+		source = "mf:" + s.m.u.URL
+		endpoint = "/api/v1/favourites?limit=40"
+	case "statuses":
+		source = "ms:" + s.m.u.URL
+		endpoint = "/api/v1/accounts/" + url.PathEscape(s.m.u.ID) + "/statuses?limit=40"
+	default:
+		return errors.Errorf("unknown timeline %q", s.timeline)
+	}
+
+	tick := time.NewTicker(mastodonInterval)
+	defer tick.Stop()
+
+	// Failures are retried forever, so that an instance outage doesn't stop
+	// the source, but back off while they are consecutive.
+	var failures int
+	for {
+		var items []json.RawMessage
+		prev, err := s.m.getJSON(ctx, endpoint, &items)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			d := backoffDelay(failures, mastodonInterval, mastodonMaxBackoff)
+			failures++
+			log.WithField("failures", failures).WithField("delay", d).WithError(err).
+				Error("Failed to fetch timeline")
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(d):
+			}
+			continue
+		}
+		failures = 0
+
+		log.WithField("items", len(items)).Debug("Fetched timeline")
+
+		// Items are newest first, but we'd rather store them in order.
+		for i := len(items) - 1; i >= 0; i-- {
+			select {
+			case m <- &Message{source: source, kind: kind, msg: items[i]}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		// Unlike Twitter, Mastodon provides a link to the page of newer items,
+		// which works for favourites too, whose pagination IDs are internal.
+		if len(items) > 0 && prev != "" {
+			endpoint = prev
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-tick.C:
+		}
+	}
+}
+
+// mastodonDeletionsSource listens to the user streaming API for delete events,
+// which are not otherwise observable by polling.
+type mastodonDeletionsSource struct {
+	m *mastodonClient
+}
+
+func newMastodonDeletionsSource(m *mastodonClient) Source {
+	return &mastodonDeletionsSource{m: m}
+}
+
+func (s *mastodonDeletionsSource) Run(ctx context.Context, m chan<- *Message) error {
+	log := logrus.WithFields(logrus.Fields{"account": s.m.u.URL})
+	source := "mx:" + s.m.u.URL
+
+	// Streams eventually get disconnected, so they are reconnected forever,
+	// backing off only while connecting fails.
+	var failures int
+	for {
+		connected, err := s.stream(ctx, source, m)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if connected {
+			failures = 0
+		}
+		d := backoffDelay(failures, mastodonInterval, mastodonMaxBackoff)
+		failures++
+		log.WithField("failures", failures).WithField("delay", d).WithError(err).
+			Error("Streaming connection failed")
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(d):
+		}
+	}
+}
+
+// stream reads delete events from one streaming connection until it fails.
+// connected reports whether the connection was established.
+func (s *mastodonDeletionsSource) stream(ctx context.Context, source string, m chan<- *Message) (connected bool, err error) {
+	r, err := s.m.get(ctx, "/api/v1/streaming/user")
+	if err != nil {
+		return false, err
+	}
+	defer r.Body.Close()
+
+	// The body is a text/event-stream, where events are separated by empty
+	// lines, and we only care about the delete ones. The server also sends a
+	// comment line as a heartbeat every few seconds, so any line shows that
+	// the connection is alive.
+	var event string
+	scanner := bufio.NewScanner(r.Body)
+	for scanner.Scan() {
+		observeAlive(ctx)
+		line := scanner.Text()
+		switch {
+		case line == "":
+			event = ""
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:") && event == "delete":
+			del, err := json.Marshal(&mastodonDeletion{
+				ID:       strings.TrimSpace(strings.TrimPrefix(line, "data:")),
+				Instance: s.m.instance,
+			})
+			if err != nil {
+				return true, err
+			}
+			select {
+			case m <- &Message{source: source, kind: "mastodon-deletion", msg: del}:
+			case <-ctx.Done():
+				return true, ctx.Err()
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return true, err
+	}
+	return true, errors.Errorf("stream closed by %s", s.m.instance)
+}
@@ -0,0 +1,207 @@
+package covfefe
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newMastodonStandIn serves the recorded API responses in testdata/mastodon.
+func newMastodonStandIn(t *testing.T) *httptest.Server {
+	files := map[string]string{
+		"/api/v1/accounts/verify_credentials": "verify_credentials.json",
+		"/api/v1/timelines/home":              "home.json",
+		"/api/v1/notifications":               "notifications.json",
+		"/api/v1/favourites":                  "favourites.json",
+		"/api/v1/accounts/1/statuses":         "statuses.json",
+		"/api/v1/streaming/user":              "streaming.txt",
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test-token" {
+			http.Error(w, `{"error": "The access token is invalid"}`, http.StatusUnauthorized)
+			return
+		}
+		name, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if strings.HasSuffix(name, ".json") {
+			w.Header().Set("Content-Type", "application/json")
+		} else {
+			w.Header().Set("Content-Type", "text/event-stream")
+		}
+		http.ServeFile(w, r, "testdata/mastodon/"+name)
+	}))
+}
+
+func TestMastodonSources(t *testing.T) {
+	defer func(d time.Duration) { mastodonInterval = d }(mastodonInterval)
+	mastodonInterval = 1 * time.Hour
+
+	srv := newMastodonStandIn(t)
+	defer srv.Close()
+	c, _, cleanup := newTestCovfefe(t)
+	defer cleanup()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	m := newMastodonClient(MastodonAccount{Instance: srv.URL + "/", AccessToken: "test-token"})
+	user, err := m.verifyCredentials(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.u = user
+
+	// Run each source on its own, so that the deletion is processed last, as
+	// it would be in practice.
+	expected := map[string]int{
+		"home": 3, "notifications": 2, "favourites": 1, "statuses": 2, "deletions": 1,
+	}
+	for _, name := range DefaultMastodonSources {
+		ctx, cancel := context.WithCancel(ctx)
+		messages := make(chan *Message)
+		errc := make(chan error, 1)
+		go func() { errc <- mastodonSources[name](m).Run(ctx, messages) }()
+		for i := 0; i < expected[name]; i++ {
+			select {
+			case msg := <-messages:
+				c.Handle(msg)
+			case err := <-errc:
+				t.Fatalf("%s: source stopped: %v", name, err)
+			}
+		}
+		cancel()
+		if err := <-errc; err != context.Canceled {
+			t.Errorf("%s: unexpected error: %v", name, err)
+		}
+	}
+
+	toots := queryStrings(t, c, "SELECT id FROM Toots ORDER BY id")
+	if exp := []string{
+		"109400000000000001", "109400000000000003", "109400000000000004",
+		"109400000000000010", "109400000000000011", "109400000000000020",
+	}; !reflect.DeepEqual(toots, exp) {
+		t.Errorf("Toots = %v, expected %v", toots, exp)
+	}
+
+	deleted := queryStrings(t, c, "SELECT id FROM Toots WHERE deleted IS NOT NULL")
+	if exp := []string{"109400000000000001"}; !reflect.DeepEqual(deleted, exp) {
+		t.Errorf("deleted Toots = %v, expected %v", deleted, exp)
+	}
+
+	users := queryStrings(t, c, "SELECT acct FROM MastodonUsers ORDER BY acct")
+	if exp := []string{
+		"alice", "archivist", "bob", "carol@other.example", "dave", "erin@other.example", "frank",
+	}; !reflect.DeepEqual(users, exp) {
+		t.Errorf("MastodonUsers = %v, expected %v", users, exp)
+	}
+
+	follows := queryStrings(t, c, "SELECT follower || ' ' || target FROM MastodonFollows")
+	if exp := []string{
+		"https://example.social/@dave https://example.social/@archivist",
+	}; !reflect.DeepEqual(follows, exp) {
+		t.Errorf("MastodonFollows = %v, expected %v", follows, exp)
+	}
+
+	private := queryStrings(t, c, "SELECT COUNT(*) FROM Messages WHERE json LIKE '%Secret%'")
+	if exp := []string{"0"}; !reflect.DeepEqual(private, exp) {
+		t.Errorf("private toot was stored")
+	}
+}
+
+func TestMastodonRetry(t *testing.T) {
+	defer func(d, max time.Duration) {
+		mastodonInterval, mastodonMaxBackoff = d, max
+	}(mastodonInterval, mastodonMaxBackoff)
+	mastodonInterval, mastodonMaxBackoff = 1*time.Millisecond, 4*time.Millisecond
+
+	// The first requests to each endpoint fail, more times than sources used
+	// to tolerate, and then the stand-in works, closing each stream after
+	// one deletion.
+	standIn := newMastodonStandIn(t)
+	defer standIn.Close()
+	target, _ := url.Parse(standIn.URL)
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	var mu sync.Mutex
+	failures := make(map[string]int)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		fail := r.URL.Path != "/api/v1/accounts/verify_credentials" && failures[r.URL.Path] < 6
+		if fail {
+			failures[r.URL.Path]++
+		}
+		mu.Unlock()
+		if fail {
+			http.Error(w, `{"error": "Down for maintenance"}`, http.StatusServiceUnavailable)
+			return
+		}
+		proxy.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	m := newMastodonClient(MastodonAccount{Instance: srv.URL + "/", AccessToken: "test-token"})
+	user, err := m.verifyCredentials(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.u = user
+
+	for name, expected := range map[string]int{"home": 3, "deletions": 7} {
+		ctx, cancel := context.WithCancel(ctx)
+		messages := make(chan *Message)
+		errc := make(chan error, 1)
+		go func() { errc <- mastodonSources[name](m).Run(ctx, messages) }()
+		for i := 0; i < expected; i++ {
+			select {
+			case <-messages:
+			case err := <-errc:
+				t.Fatalf("%s: source stopped after %d messages: %v", name, i, err)
+			case <-ctx.Done():
+				t.Fatalf("%s: timed out after %d messages", name, i)
+			}
+		}
+		cancel()
+		if err := <-errc; err != context.Canceled {
+			t.Errorf("%s: unexpected error: %v", name, err)
+		}
+	}
+}
+
+func TestMastodonDeletionInstance(t *testing.T) {
+	c, _, cleanup := newTestCovfefe(t)
+	defer cleanup()
+
+	// Status IDs are local to the instance they were fetched from, so the
+	// same ID can refer to different toots on different instances.
+	status := func(uri string) []byte {
+		return []byte(`{"id": "42", "uri": "` + uri + `", "created_at": "2022-11-09T10:00:00Z",
+			"visibility": "public", "account": {"id": "1", "url": "https://example.social/@alice"}}`)
+	}
+	c.Handle(&Message{source: "ms:https://example.social/@alice", kind: "mastodon-status",
+		msg: status("https://example.social/users/alice/statuses/42")})
+	c.Handle(&Message{source: "mh:https://other.example/@bob", kind: "mastodon-status",
+		msg: status("https://example.social/users/alice/statuses/1234")})
+	c.Handle(&Message{source: "mx:https://other.example/@bob", kind: "mastodon-deletion",
+		msg: []byte(`{"id": "42", "instance": "https://other.example"}`)})
+
+	toots := queryStrings(t, c, "SELECT instance || ' ' || id FROM Toots ORDER BY uri")
+	if exp := []string{"other.example 42", "example.social 42"}; !reflect.DeepEqual(toots, exp) {
+		t.Errorf("Toots = %v, expected %v", toots, exp)
+	}
+	deleted := queryStrings(t, c, "SELECT uri FROM Toots WHERE deleted IS NOT NULL")
+	if exp := []string{"https://example.social/users/alice/statuses/1234"}; !reflect.DeepEqual(deleted, exp) {
+		t.Errorf("deleted Toots = %v, expected %v", deleted, exp)
+	}
+}
@@ -0,0 +1,160 @@
+package covfefe
+
+import (
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"crawshaw.io/sqlite"
+	"crawshaw.io/sqlite/sqlitex"
+	"github.com/dghubble/go-twitter/twitter"
+	"github.com/h2non/filetype"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/blake2b"
+)
+
+// Media files are stored once per content in mediaPath, as blobs named after
+// the hex BLAKE2b-256 of their contents, sharded by its first byte. The Media
+// table maps each media ID and variant to a blob. OCR output for images is
+// stored next to the blob by an ocr job, with a .txt extension.
+//
+// Media saved before the store was introduced are named <media ID>.<ext>.
+
+func blobPath(mediaPath, hash string) string {
+	return filepath.Join(mediaPath, hash[:2], hash)
+}
+
+// storeBlob writes data to the media store, unless a blob with the same
+// contents is already there, and returns its hash.
+func storeBlob(mediaPath string, data []byte) (string, error) {
+	h := blake2b.Sum256(data)
+	hash := hex.EncodeToString(h[:])
+	name := blobPath(mediaPath, hash)
+
+	if _, err := os.Stat(name); err == nil {
+		return hash, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	// Write to a temporary file first, so that blobs are never truncated.
+	f, err := ioutil.TempFile(filepath.Dir(name), "tmp-")
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", errors.WithStack(err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", errors.WithStack(err)
+	}
+	if err := os.Chmod(f.Name(), 0644); err != nil {
+		os.Remove(f.Name())
+		return "", errors.WithStack(err)
+	}
+	if err := os.Rename(f.Name(), name); err != nil {
+		os.Remove(f.Name())
+		return "", errors.WithStack(err)
+	}
+	return hash, nil
+}
+
+// saveMedia stores data as the given variant of media id, and returns the hash
+// of its blob.
+func (c *Covfefe) saveMedia(data []byte, id int64, variant, url string, message int64) (string, error) {
+	t, err := filetype.Match(data)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	hash, err := storeBlob(c.mediaPath, data)
+	if err != nil {
+		return "", err
+	}
+	return hash, c.insertMedia(id, variant, hash, t.MIME.Value, url, message)
+}
+
+// bestVideoVariant returns the highest-bitrate MP4 variant, or nil if there
+// are none. Animated GIFs have a single variant with zero bitrate, and the
+// HLS playlists are not worth archiving.
+func bestVideoVariant(variants []twitter.VideoVariant) *twitter.VideoVariant {
+	var best *twitter.VideoVariant
+	for i, v := range variants {
+		if v.ContentType != "video/mp4" {
+			continue
+		}
+		if best == nil || v.Bitrate > best.Bitrate {
+			best = &variants[i]
+		}
+	}
+	return best
+}
+
+// ErrCorruptBlob is the MediaProblem error of blobs whose contents don't
+// match their hash.
+var ErrCorruptBlob = errors.New("blob contents do not match its hash")
+
+// A MediaProblem is a Media row whose blob is missing or corrupt.
+type MediaProblem struct {
+	ID      int64
+	Variant string
+	Path    string
+
+	// Err is ErrCorruptBlob, or an error from reading the blob, for which
+	// os.IsNotExist returns true if it's missing.
+	Err error
+}
+
+// VerifyMedia re-hashes the blob of every row of the Media table, and returns
+// the ones that are missing or corrupt.
+func VerifyMedia(dbPath, mediaPath string) ([]MediaProblem, error) {
+	conn, err := sqlite.OpenConn("file:"+dbPath, 0)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open database")
+	}
+	defer conn.Close()
+
+	// Blobs are shared by media, so only check each once.
+	checked := make(map[string]error)
+	var problems []MediaProblem
+	err = sqlitex.Exec(conn, "SELECT id, variant, hash FROM Media ORDER BY hash;",
+		func(stmt *sqlite.Stmt) error {
+			hash := stmt.GetText("hash")
+			err, ok := checked[hash]
+			if !ok {
+				err = verifyBlob(mediaPath, hash)
+				checked[hash] = err
+			}
+			if err != nil {
+				problems = append(problems, MediaProblem{
+					ID:      stmt.GetInt64("id"),
+					Variant: stmt.GetText("variant"),
+					Path:    blobPath(mediaPath, hash),
+					Err:     err,
+				})
+			}
+			return nil
+		})
+	return problems, errors.Wrap(err, "failed to list media")
+}
+
+func verifyBlob(mediaPath, hash string) error {
+	f, err := os.Open(blobPath(mediaPath, hash))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	h, _ := blake2b.New256(nil)
+	if _, err := io.Copy(h, f); err != nil {
+		return err
+	}
+	if hex.EncodeToString(h.Sum(nil)) != hash {
+		return ErrCorruptBlob
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package covfefe
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/dghubble/go-twitter/twitter"
+)
+
+var (
+	testPNG = []byte("\x89PNG\r\n\x1a\n" + "not really an image")
+	testMP4 = []byte("\x00\x00\x00\x18ftypmp42" + "not really a video")
+)
+
+func TestMediaStore(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/a.png", "/b.png", "/thumb.png":
+			w.Write(testPNG)
+		case "/high.mp4":
+			w.Write(testMP4)
+		default:
+			http.Error(w, "wrong variant", http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	c, dbPath, cleanup := newTestCovfefe(t)
+	defer cleanup()
+	c.httpClient = srv.Client()
+
+	// The same image posted twice under different media IDs, and a video.
+	c.Handle(&Message{source: "h:1", kind: "tweet", msg: []byte(`{"id": 1, "created_at": "Wed Jan 02 10:00:00 +0000 2019", "user": {"id": 1},
+		"extended_entities": {"media": [
+			{"id": 10, "media_url_https": "` + srv.URL + `/a.png"},
+			{"id": 11, "media_url_https": "` + srv.URL + `/b.png"}]}}`)})
+	c.Handle(&Message{source: "h:1", kind: "tweet", msg: []byte(`{"id": 2, "created_at": "Wed Jan 02 10:00:00 +0000 2019", "user": {"id": 1},
+		"extended_entities": {"media": [{"id": 20, "type": "video",
+			"media_url_https": "` + srv.URL + `/thumb.png", "video_info": {"variants": [
+				{"content_type": "application/x-mpegURL", "url": "` + srv.URL + `/pl.m3u8"},
+				{"content_type": "video/mp4", "bitrate": 256000, "url": "` + srv.URL + `/low.mp4"},
+				{"content_type": "video/mp4", "bitrate": 2176000, "url": "` + srv.URL + `/high.mp4"},
+				{"content_type": "video/mp4", "bitrate": 832000, "url": "` + srv.URL + `/mid.mp4"}]}}]}}`)})
+
+	runTestJobs(t, c)
+
+	media := queryStrings(t, c, `SELECT id || ' ' || variant || ' ' || type
+		FROM Media ORDER BY id, variant`)
+	if exp := []string{
+		"10 image image/png", "11 image image/png", "20 image image/png", "20 video video/mp4",
+	}; !reflect.DeepEqual(media, exp) {
+		t.Errorf("Media = %v, expected %v", media, exp)
+	}
+	blobs := queryStrings(t, c, "SELECT DISTINCT hash FROM Media")
+	if len(blobs) != 2 {
+		t.Errorf("expected 2 blobs, got %d", len(blobs))
+	}
+
+	problems, err := VerifyMedia(dbPath, c.mediaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 0 {
+		t.Errorf("unexpected problems: %v", problems)
+	}
+
+	png, mp4 := storedBlob(t, c, 10), storedBlob(t, c, 20)
+	if err := ioutil.WriteFile(png, []byte("garbage"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(mp4); err != nil {
+		t.Fatal(err)
+	}
+	problems, err = VerifyMedia(dbPath, c.mediaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var corrupt, missing []int64
+	for _, p := range problems {
+		switch {
+		case p.Err == ErrCorruptBlob:
+			corrupt = append(corrupt, p.ID)
+		case os.IsNotExist(p.Err):
+			missing = append(missing, p.ID)
+		default:
+			t.Errorf("unexpected error: %v", p.Err)
+		}
+	}
+	if len(corrupt) != 3 || len(missing) != 1 || missing[0] != 20 {
+		t.Errorf("got corrupt %v and missing %v", corrupt, missing)
+	}
+}
+
+func storedBlob(t *testing.T, c *Covfefe, id int64) string {
+	hash := queryStrings(t, c, "SELECT hash FROM Media WHERE id = ? ORDER BY variant DESC", id)
+	if len(hash) == 0 {
+		t.Fatalf("media %d not stored", id)
+	}
+	return blobPath(c.mediaPath, hash[0])
+}
+
+func TestBestVideoVariant(t *testing.T) {
+	if v := bestVideoVariant(nil); v != nil {
+		t.Errorf("got %v for no variants", v)
+	}
+	gif := []twitter.VideoVariant{{ContentType: "video/mp4", URL: "gif.mp4"}}
+	if v := bestVideoVariant(gif); v == nil || v.URL != "gif.mp4" {
+		t.Errorf("got %v for GIF", v)
+	}
+}
@@ -0,0 +1,291 @@
+package covfefe
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Metrics are served in the Prometheus text format by MetricsHandler. They
+// are few and simple enough that a client library isn't worth the dependency.
+
+var (
+	metricFetches = newMetricVec("counter", "covfefe_fetches_total",
+		"Successful API requests made by sources.", "account", "source")
+	metricFetchErrors = newMetricVec("counter", "covfefe_fetch_errors_total",
+		"Failed API requests made by sources, including the retried ones.", "account", "source")
+	metricLastSuccess = newMetricVec("gauge", "covfefe_fetch_last_success_timestamp_seconds",
+		"Time of the last successful API request made by a source.", "account", "source")
+	metricMessages = newMetricVec("counter", "covfefe_messages_total",
+		"Messages received, by whether they were inserted or deduplicated.", "result")
+	metricMessageCache = newMetricVec("counter", "covfefe_message_cache_lookups_total",
+		"Lookups of message hashes in the in-memory cache, by hit or miss.", "result")
+	metricMediaFailures = newMetricVec("counter", "covfefe_media_download_failures_total",
+		"Failed media downloads.")
+	metricOCRDuration = newHistogram("covfefe_ocr_duration_seconds",
+		"Time spent running tesseract on an image.", []float64{0.5, 1, 2, 5, 10, 30, 60})
+)
+
+var allMetrics = []interface{ write(w io.Writer) }{
+	metricFetches, metricFetchErrors, metricLastSuccess, metricMessages,
+	metricMessageCache, metricMediaFailures, metricOCRDuration,
+}
+
+// A metricVec is a counter or gauge, with a value for each combination of
+// label values.
+type metricVec struct {
+	typ, name, help string
+	labels          []string
+
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+func newMetricVec(typ, name, help string, labels ...string) *metricVec {
+	return &metricVec{typ: typ, name: name, help: help, labels: labels,
+		values: make(map[string]float64)}
+}
+
+func (m *metricVec) key(labelValues []string) string {
+	if len(labelValues) != len(m.labels) {
+		panic("covfefe: wrong number of labels for " + m.name)
+	}
+	var pairs []string
+	for i, l := range m.labels {
+		v := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(labelValues[i])
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, l, v))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func (m *metricVec) add(v float64, labelValues ...string) {
+	k := m.key(labelValues)
+	m.mu.Lock()
+	m.values[k] += v
+	m.mu.Unlock()
+}
+
+func (m *metricVec) set(v float64, labelValues ...string) {
+	k := m.key(labelValues)
+	m.mu.Lock()
+	m.values[k] = v
+	m.mu.Unlock()
+}
+
+func (m *metricVec) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.typ)
+	if len(m.labels) == 0 && len(m.values) == 0 {
+		fmt.Fprintf(w, "%s 0\n", m.name)
+	}
+	var keys []string
+	for k := range m.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s%s %v\n", m.name, k, m.values[k])
+	}
+}
+
+type histogram struct {
+	name, help string
+	buckets    []float64
+
+	mu     sync.Mutex
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func newHistogram(name, help string, buckets []float64) *histogram {
+	return &histogram{name: name, help: help, buckets: buckets,
+		counts: make([]uint64, len(buckets))}
+}
+
+func (h *histogram) observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, b := range h.buckets {
+		if v <= b {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+func (h *histogram) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	for i, b := range h.buckets {
+		fmt.Fprintf(w, "%s_bucket{le=\"%v\"} %d\n", h.name, b, h.counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", h.name, h.count)
+	fmt.Fprintf(w, "%s_sum %v\n%s_count %d\n", h.name, h.sum, h.name, h.count)
+}
+
+// sourceHealthInterval is how often a source is expected to succeed or report
+// that it's alive. Sources can legitimately wait up to a whole rate limit
+// window for a request, so it's that plus some slack. Sources that are idle on
+// purpose for longer, like between passes or while reading a stream, report
+// with observeAlive or waitAlive instead.
+var sourceHealthInterval = 20 * time.Minute
+
+// A sourceHealth tracks the requests of a running source, which finds it in
+// its Context.
+type sourceHealth struct {
+	account, source string
+
+	mu          sync.Mutex
+	started     time.Time
+	lastSuccess time.Time
+	lastAlive   time.Time
+	stopped     error
+}
+
+var (
+	healthMu      sync.Mutex
+	healthSources []*sourceHealth
+)
+
+type sourceHealthKey struct{}
+
+// withSourceHealth registers a running source, and returns a Context for it
+// which makes observeFetch update its metrics and health.
+func withSourceHealth(ctx context.Context, account, source string) (context.Context, *sourceHealth) {
+	h := &sourceHealth{account: account, source: source, started: time.Now()}
+	healthMu.Lock()
+	healthSources = append(healthSources, h)
+	healthMu.Unlock()
+	return context.WithValue(ctx, sourceHealthKey{}, h), h
+}
+
+// observeFetch records the result of an API request, if made by a source.
+func observeFetch(ctx context.Context, err error) {
+	h, ok := ctx.Value(sourceHealthKey{}).(*sourceHealth)
+	if !ok {
+		return
+	}
+	if err != nil {
+		metricFetchErrors.add(1, h.account, h.source)
+		return
+	}
+	now := time.Now()
+	metricFetches.add(1, h.account, h.source)
+	metricLastSuccess.set(float64(now.Unix()), h.account, h.source)
+	h.mu.Lock()
+	h.lastSuccess = now
+	h.mu.Unlock()
+}
+
+// observeAlive records that a source is working even if it's not making
+// requests, if ctx belongs to a source.
+func observeAlive(ctx context.Context) {
+	h, ok := ctx.Value(sourceHealthKey{}).(*sourceHealth)
+	if !ok {
+		return
+	}
+	h.mu.Lock()
+	h.lastAlive = time.Now()
+	h.mu.Unlock()
+}
+
+// waitAlive waits for d, calling observeAlive along the way, and returns early
+// with ctx.Err() if ctx is done.
+func waitAlive(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	tick := time.NewTicker(sourceHealthInterval / 4)
+	defer tick.Stop()
+	for {
+		observeAlive(ctx)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+			return nil
+		case <-tick.C:
+		}
+	}
+}
+
+func (h *sourceHealth) stop(err error) {
+	if err == nil {
+		err = errors.New("stopped")
+	}
+	h.mu.Lock()
+	h.stopped = err
+	h.mu.Unlock()
+}
+
+// problem returns why the source is unhealthy, or "" if it's healthy.
+func (h *sourceHealth) problem(now time.Time) string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.stopped != nil {
+		return fmt.Sprintf("stopped: %v", h.stopped)
+	}
+	last := h.started
+	for _, t := range []time.Time{h.lastSuccess, h.lastAlive} {
+		if t.After(last) {
+			last = t
+		}
+	}
+	if since := now.Sub(last); since > sourceHealthInterval {
+		if h.lastSuccess.IsZero() {
+			return fmt.Sprintf("no success since starting %v ago", since.Round(time.Second))
+		}
+		return fmt.Sprintf("last success %v ago", now.Sub(h.lastSuccess).Round(time.Second))
+	}
+	return ""
+}
+
+// MetricsHandler serves the metrics at /metrics, and at /healthz a check
+// that fails if any source hasn't succeeded or reported that it's alive within
+// sourceHealthInterval.
+func MetricsHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		for _, m := range allMetrics {
+			m.write(w)
+		}
+	})
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		healthMu.Lock()
+		sources := append([]*sourceHealth(nil), healthSources...)
+		healthMu.Unlock()
+
+		now := time.Now()
+		var problems []string
+		for _, h := range sources {
+			if p := h.problem(now); p != "" {
+				problems = append(problems, fmt.Sprintf("%s of %s: %s", h.source, h.account, p))
+			}
+		}
+		if len(sources) == 0 {
+			problems = append(problems, "no sources running")
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if len(problems) > 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintln(w, strings.Join(problems, "\n"))
+			return
+		}
+		fmt.Fprintf(w, "ok, %d sources\n", len(sources))
+	})
+	return mux
+}
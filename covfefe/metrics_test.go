@@ -0,0 +1,114 @@
+package covfefe
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestMetrics(t *testing.T) {
+	defer func(i time.Duration) { sourceHealthInterval = i }(sourceHealthInterval)
+	defer func(s []*sourceHealth) { healthSources = s }(healthSources)
+	healthSources = nil
+
+	h := MetricsHandler()
+	get := func(path string) (int, string) {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		body, _ := ioutil.ReadAll(w.Body)
+		return w.Code, string(body)
+	}
+
+	if code, _ := get("/healthz"); code != 503 {
+		t.Errorf("healthz without sources: got %d", code)
+	}
+
+	home, homeHealth := withSourceHealth(context.Background(), "alice", "home")
+	likes, _ := withSourceHealth(context.Background(), "alice", "likes")
+	observeFetch(home, nil)
+	observeFetch(home, errors.New("oops"))
+	observeFetch(likes, nil)
+	observeFetch(context.Background(), nil) // not a source, ignored
+
+	if code, body := get("/healthz"); code != 200 {
+		t.Errorf("healthz: got %d: %s", code, body)
+	}
+	_, body := get("/metrics")
+	for _, line := range []string{
+		`covfefe_fetches_total{account="alice",source="home"} 1`,
+		`covfefe_fetch_errors_total{account="alice",source="home"} 1`,
+		"# TYPE covfefe_ocr_duration_seconds histogram",
+		`covfefe_ocr_duration_seconds_bucket{le="+Inf"} `,
+	} {
+		if !strings.Contains(body, line) {
+			t.Errorf("metrics don't contain %q", line)
+		}
+	}
+
+	homeHealth.stop(errors.New("credentials revoked"))
+	if code, body := get("/healthz"); code != 503 || !strings.Contains(body, "home of alice: stopped") ||
+		strings.Contains(body, "likes") {
+		t.Errorf("healthz with a stopped source: got %d: %s", code, body)
+	}
+
+	sourceHealthInterval = 0
+	time.Sleep(time.Millisecond)
+	if code, body := get("/healthz"); code != 503 || !strings.Contains(body, "likes of alice: last success") {
+		t.Errorf("healthz with a stale source: got %d: %s", code, body)
+	}
+}
+
+func TestHealthIdleSources(t *testing.T) {
+	defer func(i time.Duration) { sourceHealthInterval = i }(sourceHealthInterval)
+	defer func(s []*sourceHealth) { healthSources = s }(healthSources)
+	healthSources = nil
+	sourceHealthInterval = 100 * time.Millisecond
+
+	h := MetricsHandler()
+	healthz := func() (int, string) {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/healthz", nil))
+		body, _ := ioutil.ReadAll(w.Body)
+		return w.Code, string(body)
+	}
+
+	// A source that made one request and then waits for a long time, like
+	// followers between passes, and one that reads a stream that only sends
+	// heartbeats, like Mastodon deletions.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	waiting, _ := withSourceHealth(ctx, "alice", "followers")
+	streaming, _ := withSourceHealth(ctx, "alice", "deletions")
+	observeFetch(waiting, nil)
+	observeFetch(streaming, nil)
+	go waitAlive(waiting, time.Hour)
+	go func() {
+		tick := time.NewTicker(10 * time.Millisecond)
+		defer tick.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-tick.C:
+				observeAlive(streaming)
+			}
+		}
+	}()
+
+	time.Sleep(3 * sourceHealthInterval)
+	if code, body := healthz(); code != 200 {
+		t.Errorf("healthz with idle sources: got %d: %s", code, body)
+	}
+
+	cancel()
+	time.Sleep(2 * sourceHealthInterval)
+	if code, body := healthz(); code != 503 || !strings.Contains(body, "followers of alice: last success") ||
+		!strings.Contains(body, "deletions of alice: last success") {
+		t.Errorf("healthz with stuck sources: got %d: %s", code, body)
+	}
+}
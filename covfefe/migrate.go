@@ -0,0 +1,459 @@
+package covfefe
+
+import (
+	"fmt"
+
+	"crawshaw.io/sqlite"
+	"crawshaw.io/sqlite/sqlitex"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// A Migration is a step in the evolution of the database schema. The schema
+// version, stored as PRAGMA user_version, is the Version of the last applied
+// Migration.
+type Migration struct {
+	Version     int
+	Description string
+	SQL         string
+}
+
+// baseline is the schema created from scratch for a new database. It matches
+// the schema after migration 6, and later migrations are applied on top of it.
+var baseline = Migration{
+	Version:     6,
+	Description: "Create the baseline schema",
+	SQL: `
+		CREATE TABLE Messages (
+			id INTEGER PRIMARY KEY,
+			received DATETIME DEFAULT (DATETIME('now')),
+			json TEXT NOT NULL,
+			source TEXT NOT NULL, -- JSON array of source IDs
+			kind TEXT -- tweet / event / del / deletion / follower
+		);
+		CREATE TABLE Tweets (
+			id INTEGER PRIMARY KEY,
+			created DATETIME NOT NULL,
+			user INTEGER NOT NULL,
+			message INTEGER NOT NULL REFERENCES Messages(id),
+			deleted INTEGER REFERENCES Messages(id)
+		);
+		CREATE TABLE Users (
+			id INTEGER NOT NULL,
+			handle TEXT NOT NULL,
+			name TEXT NOT NULL,
+			bio TEXT NOT NULL,
+			first_seen INTEGER NOT NULL REFERENCES Messages(id),
+			UNIQUE (id, handle, name, bio) ON CONFLICT IGNORE
+		);
+		CREATE TABLE Follows (
+			follower INTEGER NOT NULL,
+			target INTEGER NOT NULL,
+			first_seen INTEGER NOT NULL REFERENCES Messages(id),
+			UNIQUE (target, follower) ON CONFLICT IGNORE
+		);`,
+}
+
+// migrations must be kept in order, and never modified once deployed.
+//
+// Migrations 1 to 6 predate schema versioning, and used to be run by hand.
+// They are kept to upgrade old databases, whose version is inferred by
+// legacySchemaVersion. Their VACUUM steps were dropped, as VACUUM can't run
+// inside a transaction.
+var migrations = []Migration{
+	{
+		Version:     1,
+		Description: "Add Messages.account and synthetic deletion messages",
+		SQL: `
+			CREATE TABLE new_Messages (
+				id INTEGER PRIMARY KEY,
+				received DATETIME DEFAULT (DATETIME('now')),
+				json TEXT NOT NULL,
+				account TEXT NOT NULL
+			);
+			INSERT INTO new_Messages SELECT id, created, json, 'FiloSottile' FROM Messages;
+			DROP TABLE Messages;
+			ALTER TABLE new_Messages RENAME TO Messages;
+
+			CREATE TABLE new_Tweets (
+				id INTEGER PRIMARY KEY,
+				created DATETIME NOT NULL,
+				user TEXT NOT NULL,
+				message INTEGER NOT NULL REFERENCES Messages(id),
+				deleted INTEGER REFERENCES Messages(id)
+			);
+			INSERT INTO Messages (received, json, account)
+				SELECT deleted, json_object(
+					'id', id, 'id_str', CAST(id AS TEXT), 'user_id', NULL, 'user_id_str', NULL, 'synthetic', 1
+				), 'FiloSottile' FROM Tweets WHERE deleted IS NOT NULL;
+			INSERT INTO new_Tweets SELECT id, created, user, message, (
+				SELECT id FROM Messages WHERE Tweets.deleted IS NOT NULL
+				AND json_extract(json, '$.synthetic') AND json_extract(json, '$.id') = Tweets.id
+			) FROM Tweets;
+			DROP TABLE Tweets;
+			ALTER TABLE new_Tweets RENAME TO Tweets;`,
+	},
+	{
+		Version:     2,
+		Description: "Turn Messages.account into a JSON array",
+		SQL: `
+			UPDATE Messages SET account = json_array(account) WHERE NOT json_valid(account);`,
+	},
+	{
+		Version:     3,
+		Description: "Add Users and Follows, and switch accounts to numeric IDs",
+		SQL: `
+			CREATE TABLE Users (
+				id INTEGER NOT NULL,
+				handle TEXT NOT NULL,
+				name TEXT NOT NULL,
+				bio TEXT NOT NULL,
+				first_seen INTEGER NOT NULL REFERENCES Messages(id),
+				UNIQUE (id, handle, name, bio) ON CONFLICT IGNORE
+			);
+			CREATE TABLE Follows (
+				follower INTEGER NOT NULL,
+				target INTEGER NOT NULL,
+				first_seen INTEGER NOT NULL REFERENCES Messages(id),
+				UNIQUE (target, follower) ON CONFLICT IGNORE
+			);
+
+			DELETE FROM Tweets;
+
+			CREATE TABLE new_Messages (
+				id INTEGER PRIMARY KEY,
+				received DATETIME DEFAULT (DATETIME('now')),
+				json TEXT NOT NULL,
+				account TEXT NOT NULL -- JSON array of IDs
+			);
+			INSERT INTO new_Messages SELECT id, received, json,
+				replace(replace(replace(replace(account, '"FiloSottile"', 51049452), '"Benjojo12"', 40015387),
+				'"kgibilterra"', 27384801), '"AnnaOpss"', 503152671) FROM Messages;
+			DROP TABLE Messages;
+			ALTER TABLE new_Messages RENAME TO Messages;`,
+	},
+	{
+		Version:     4,
+		Description: "Drop the Media table, now that media lives on disk",
+		SQL: `
+			DROP TABLE Media;`,
+	},
+	{
+		Version:     5,
+		Description: "Replace Messages.account with Messages.source",
+		SQL: `
+			CREATE TABLE new_Messages (
+				id INTEGER PRIMARY KEY,
+				received DATETIME DEFAULT (DATETIME('now')),
+				json TEXT NOT NULL,
+				source TEXT NOT NULL -- JSON array of source IDs
+			);
+			INSERT INTO new_Messages SELECT id, received, json,
+				replace(replace(replace(account, '[', '["tl:'), ',', '","tl:'), ']', '"]')
+			FROM Messages;
+			DROP TABLE Messages;
+			ALTER TABLE new_Messages RENAME TO Messages;`,
+	},
+	{
+		Version:     6,
+		Description: "Add Messages.kind",
+		SQL: `
+			ALTER TABLE Messages ADD COLUMN kind TEXT;
+
+			UPDATE Messages SET kind = 'tweet'
+			WHERE json_extract(json, '$.retweet_count') IS NOT NULL;
+
+			UPDATE Messages SET kind = 'event' WHERE kind IS NULL
+			AND json_extract(json, '$.event') IS NOT NULL;
+
+			UPDATE Messages SET kind = 'del' WHERE kind IS NULL
+			AND json_extract(json, '$.synthetic') IS NOT NULL;
+			UPDATE Messages SET kind = 'del' WHERE kind IS NULL
+			AND json_extract(json, '$.user_id_str') IS NOT NULL;
+
+			UPDATE Messages SET kind = 'deletion' WHERE kind IS NULL
+			AND json_extract(json, '$.delete') IS NOT NULL;`,
+	},
+	{
+		Version:     7,
+		Description: "Add Toots, MastodonUsers and MastodonFollows",
+		SQL: `
+			CREATE TABLE Toots (
+				uri TEXT PRIMARY KEY,
+				id TEXT NOT NULL, -- local to the instance it was fetched from
+				created DATETIME NOT NULL,
+				account TEXT NOT NULL, -- MastodonUsers.url
+				message INTEGER NOT NULL REFERENCES Messages(id),
+				deleted INTEGER REFERENCES Messages(id)
+			);
+			CREATE INDEX Toots_id ON Toots (id);
+			CREATE TABLE MastodonUsers (
+				url TEXT NOT NULL,
+				acct TEXT NOT NULL,
+				name TEXT NOT NULL,
+				bio TEXT NOT NULL,
+				first_seen INTEGER NOT NULL REFERENCES Messages(id),
+				UNIQUE (url, acct, name, bio) ON CONFLICT IGNORE
+			);
+			CREATE TABLE MastodonFollows (
+				follower TEXT NOT NULL,
+				target TEXT NOT NULL,
+				first_seen INTEGER NOT NULL REFERENCES Messages(id),
+				UNIQUE (target, follower) ON CONFLICT IGNORE
+			);`,
+	},
+	{
+		Version:     8,
+		Description: "Add Messages.hash for deduplication across runs",
+		SQL: `
+			-- Keyed BLAKE2b-256 of json, with kind as the key. NULL for
+			-- messages stored before this migration.
+			ALTER TABLE Messages ADD COLUMN hash BLOB;
+			CREATE INDEX Messages_hash ON Messages (hash);`,
+	},
+	{
+		Version:     9,
+		Description: "Add the SearchIndex full-text table, populated by rescan",
+		SQL: `
+			CREATE VIRTUAL TABLE SearchIndex USING fts5(
+				text,
+				field UNINDEXED, -- text / retweet / quote / ocr / bio
+				tweet UNINDEXED, -- Tweets.id, or 0 for bios
+				user UNINDEXED,
+				message UNINDEXED -- Messages.id
+			);`,
+	},
+	{
+		Version:     10,
+		Description: "Add Checkpoints for incremental rescans",
+		SQL: `
+			CREATE TABLE Checkpoints (
+				name TEXT PRIMARY KEY,
+				message INTEGER NOT NULL -- last processed Messages.id
+			);`,
+	},
+	{
+		Version:     11,
+		Description: "Add Media, mapping media variants to content-addressed blobs",
+		SQL: `
+			CREATE TABLE Media (
+				id INTEGER NOT NULL, -- media ID
+				variant TEXT NOT NULL, -- image / video
+				hash TEXT NOT NULL, -- hex BLAKE2b-256 of the blob
+				type TEXT NOT NULL, -- MIME type
+				url TEXT NOT NULL,
+				first_seen INTEGER NOT NULL REFERENCES Messages(id),
+				UNIQUE (id, variant) ON CONFLICT IGNORE
+			);
+			CREATE INDEX Media_hash ON Media (hash);`,
+	},
+	{
+		Version:     12,
+		Description: "Add Jobs, the queue of background side effects",
+		SQL: `
+			CREATE TABLE Jobs (
+				id INTEGER PRIMARY KEY,
+				kind TEXT NOT NULL, -- media / ocr / parent
+				args TEXT NOT NULL, -- JSON
+				message INTEGER NOT NULL REFERENCES Messages(id),
+				status TEXT NOT NULL DEFAULT 'pending', -- pending / running / done / failed
+				attempts INTEGER NOT NULL DEFAULT 0,
+				next_attempt DATETIME NOT NULL DEFAULT (DATETIME('now')),
+				error TEXT, -- of the last failed attempt
+				UNIQUE (kind, args) ON CONFLICT IGNORE
+			);
+			CREATE INDEX Jobs_status ON Jobs (status, next_attempt);`,
+	},
+	{
+		Version:     13,
+		Description: "Add the Threads reply and quote graph, populated by rescan",
+		SQL: `
+			CREATE TABLE Threads (
+				tweet INTEGER NOT NULL,
+				parent INTEGER NOT NULL, -- might not be in Tweets
+				kind TEXT NOT NULL, -- reply / quote
+				first_seen INTEGER NOT NULL REFERENCES Messages(id),
+				UNIQUE (tweet, parent, kind) ON CONFLICT IGNORE
+			);
+			CREATE INDEX Threads_parent ON Threads (parent);`,
+	},
+	{
+		Version:     14,
+		Description: "Add FollowerSnapshots and FollowEvents, populated by rescan",
+		SQL: `
+			CREATE TABLE FollowerSnapshots (
+				message INTEGER PRIMARY KEY REFERENCES Messages(id),
+				followed INTEGER NOT NULL,
+				taken DATETIME NOT NULL,
+				followers INTEGER NOT NULL -- count
+			);
+			CREATE INDEX FollowerSnapshots_followed ON FollowerSnapshots (followed, message);
+			CREATE TABLE FollowEvents (
+				follower INTEGER NOT NULL,
+				followed INTEGER NOT NULL,
+				kind TEXT NOT NULL, -- follow / unfollow
+				snapshot INTEGER NOT NULL REFERENCES Messages(id),
+				previous INTEGER NOT NULL REFERENCES Messages(id)
+			);
+			CREATE INDEX FollowEvents_followed ON FollowEvents (followed);
+			CREATE INDEX FollowEvents_follower ON FollowEvents (follower);`,
+	},
+	{
+		Version:     15,
+		Description: "Add Toots.instance, populated by rescan",
+		SQL: `
+			-- Host of the account that fetched the toot, which scopes Toots.id.
+			ALTER TABLE Toots ADD COLUMN instance TEXT;
+			DROP INDEX Toots_id;
+			CREATE INDEX Toots_instance_id ON Toots (instance, id);`,
+	},
+}
+
+// emptySchema is the version of a database with no tables.
+const emptySchema = -1
+
+// Migrate applies any pending migrations to the database at dbPath.
+// Run and Rescan do this automatically.
+func Migrate(dbPath string) error {
+	conn, err := sqlite.OpenConn("file:"+dbPath, 0)
+	if err != nil {
+		return errors.Wrap(err, "failed to open database")
+	}
+	defer conn.Close()
+	return migrate(conn)
+}
+
+// PendingMigrations returns the migrations that Migrate would apply to the
+// database at dbPath, without modifying it.
+func PendingMigrations(dbPath string) ([]Migration, error) {
+	conn, err := sqlite.OpenConn("file:"+dbPath, 0)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open database")
+	}
+	defer conn.Close()
+	return pendingMigrations(conn)
+}
+
+func pendingMigrations(conn *sqlite.Conn) ([]Migration, error) {
+	version, err := schemaVersion(conn)
+	if err != nil {
+		return nil, err
+	}
+	latest := migrations[len(migrations)-1].Version
+	if version > latest {
+		return nil, errors.Errorf("database schema version %d is newer than the latest known %d", version, latest)
+	}
+
+	var pending []Migration
+	if version == emptySchema {
+		pending = append(pending, baseline)
+		version = baseline.Version
+	}
+	for _, m := range migrations {
+		if m.Version > version {
+			pending = append(pending, m)
+		}
+	}
+	return pending, nil
+}
+
+func migrate(conn *sqlite.Conn) (err error) {
+	pending, err := pendingMigrations(conn)
+	if err != nil {
+		return err
+	}
+
+	// Table rebuilds would otherwise trip foreign keys, and the pragma is a
+	// no-op inside a transaction, so they are disabled for the duration.
+	foreignKeys, err := sqlitex.ResultInt(conn.Prep("PRAGMA foreign_keys;"))
+	if err != nil {
+		return errors.Wrap(err, "failed to read foreign keys setting")
+	}
+	if err := sqlitex.Exec(conn, "PRAGMA foreign_keys = OFF;", nil); err != nil {
+		return errors.Wrap(err, "failed to disable foreign keys")
+	}
+	defer func() {
+		// PRAGMA statements don't accept parameters.
+		q := fmt.Sprintf("PRAGMA foreign_keys = %d;", foreignKeys)
+		if fkErr := sqlitex.ExecTransient(conn, q, nil); fkErr != nil && err == nil {
+			err = errors.Wrap(fkErr, "failed to restore foreign keys")
+		}
+	}()
+
+	for _, m := range pending {
+		log.WithFields(log.Fields{
+			"version": m.Version, "description": m.Description,
+		}).Info("Applying migration")
+		if err := applyMigration(conn, m); err != nil {
+			return errors.Wrapf(err, "migration %d failed", m.Version)
+		}
+	}
+	return nil
+}
+
+func applyMigration(conn *sqlite.Conn, m Migration) (err error) {
+	defer sqlitex.Save(conn)(&err)
+
+	if err := sqlitex.ExecScript(conn, m.SQL); err != nil {
+		return err
+	}
+	// PRAGMA statements don't accept parameters.
+	return sqlitex.ExecScript(conn, fmt.Sprintf("PRAGMA user_version = %d;", m.Version))
+}
+
+func schemaVersion(conn *sqlite.Conn) (int, error) {
+	version, err := sqlitex.ResultInt(conn.Prep("PRAGMA user_version;"))
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to read schema version")
+	}
+	if version != 0 {
+		return version, nil
+	}
+	return legacySchemaVersion(conn)
+}
+
+// legacySchemaVersion infers the version of a database which predates schema
+// versioning from the shape of its tables.
+func legacySchemaVersion(conn *sqlite.Conn) (int, error) {
+	tables := make(map[string]bool)
+	if err := sqlitex.Exec(conn, "SELECT name FROM sqlite_master WHERE type = 'table';",
+		func(stmt *sqlite.Stmt) error {
+			tables[stmt.GetText("name")] = true
+			return nil
+		}); err != nil {
+		return 0, errors.Wrap(err, "failed to list tables")
+	}
+	columns := make(map[string]bool)
+	if err := sqlitex.Exec(conn, "PRAGMA table_info(Messages);",
+		func(stmt *sqlite.Stmt) error {
+			columns[stmt.GetText("name")] = true
+			return nil
+		}); err != nil {
+		return 0, errors.Wrap(err, "failed to list Messages columns")
+	}
+
+	switch {
+	case !tables["Messages"]:
+		return emptySchema, nil
+	case columns["kind"]:
+		return 6, nil
+	case columns["source"]:
+		return 5, nil
+	case !columns["account"]:
+		return 0, nil
+	case tables["Users"] && !tables["Media"]:
+		return 4, nil
+	case tables["Users"]:
+		return 3, nil
+	}
+
+	notArrays, err := sqlitex.ResultInt(conn.Prep(
+		"SELECT COUNT(*) FROM Messages WHERE NOT json_valid(account);"))
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to inspect Messages.account")
+	}
+	if notArrays > 0 {
+		return 1, nil
+	}
+	return 2, nil
+}
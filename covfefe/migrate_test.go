@@ -0,0 +1,211 @@
+package covfefe
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"crawshaw.io/sqlite"
+	"crawshaw.io/sqlite/sqlitex"
+)
+
+// legacySchema is the schema of a database before migration 1.
+const legacySchema = `
+	CREATE TABLE Messages (
+		id INTEGER PRIMARY KEY,
+		created DATETIME DEFAULT (DATETIME('now')),
+		json TEXT NOT NULL
+	);
+	CREATE TABLE Tweets (
+		id INTEGER PRIMARY KEY,
+		created DATETIME NOT NULL,
+		user TEXT NOT NULL,
+		message INTEGER NOT NULL REFERENCES Messages(id),
+		deleted DATETIME
+	);
+	CREATE TABLE Media (
+		id INTEGER PRIMARY KEY,
+		media BLOB
+	);
+	INSERT INTO Messages (json) VALUES ('{"id": 1, "retweet_count": 0}');
+	INSERT INTO Tweets VALUES (1, DATETIME('now'), 'FiloSottile', 1, DATETIME('now'));`
+
+func openTestDB(t *testing.T, schema string) (conn *sqlite.Conn, dbPath string, cleanup func()) {
+	dir, err := ioutil.TempDir("", "covfefe-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbPath = filepath.Join(dir, "twitter.db")
+	conn, err = sqlite.OpenConn("file:"+dbPath, 0)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	cleanup = func() {
+		conn.Close()
+		os.RemoveAll(dir)
+	}
+	if err := sqlitex.ExecScript(conn, schema); err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	return conn, dbPath, cleanup
+}
+
+func queryInt(t *testing.T, conn *sqlite.Conn, query string) int {
+	n, err := sqlitex.ResultInt(conn.Prep(query))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func versions(ms []Migration) []int {
+	var v []int
+	for _, m := range ms {
+		v = append(v, m.Version)
+	}
+	return v
+}
+
+var latestVersion = migrations[len(migrations)-1].Version
+
+func TestMigrateFresh(t *testing.T) {
+	conn, _, cleanup := openTestDB(t, "")
+	defer cleanup()
+
+	pending, err := pendingMigrations(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := versions(pending); v[0] != baseline.Version || v[1] != baseline.Version+1 ||
+		v[len(v)-1] != latestVersion || len(v) != latestVersion-baseline.Version+1 {
+		t.Errorf("pending migrations for a fresh database: %v", v)
+	}
+
+	if err := sqlitex.Exec(conn, "PRAGMA foreign_keys = ON;", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := migrate(conn); err != nil {
+		t.Fatal(err)
+	}
+	if v := queryInt(t, conn, "PRAGMA user_version;"); v != latestVersion {
+		t.Errorf("user_version is %d, expected %d", v, latestVersion)
+	}
+	if queryInt(t, conn, "PRAGMA foreign_keys;") != 1 {
+		t.Error("foreign keys were not turned back on")
+	}
+
+	// Migrating an up to date database is a no-op.
+	if pending, err := pendingMigrations(conn); err != nil || len(pending) != 0 {
+		t.Errorf("pending migrations for an up to date database: %v, %v", versions(pending), err)
+	}
+	tables := queryInt(t, conn, "SELECT COUNT(*) FROM sqlite_master;")
+	if err := migrate(conn); err != nil {
+		t.Fatal(err)
+	}
+	if n := queryInt(t, conn, "SELECT COUNT(*) FROM sqlite_master;"); n != tables {
+		t.Errorf("migrating again changed the schema from %d to %d objects", tables, n)
+	}
+}
+
+func TestMigrateLegacy(t *testing.T) {
+	conn, _, cleanup := openTestDB(t, legacySchema)
+	defer cleanup()
+
+	// Apply the legacy migrations by hand, like they used to be, and check
+	// that each resulting shape is recognized.
+	for i := 0; i < baseline.Version; i++ {
+		if i > 0 {
+			if err := sqlitex.ExecScript(conn, migrations[i-1].SQL); err != nil {
+				t.Fatalf("migration %d: %v", i, err)
+			}
+		}
+		if v, err := legacySchemaVersion(conn); err != nil || v != i {
+			t.Errorf("legacy database after migration %d: detected %d, %v", i, v, err)
+		}
+	}
+
+	conn, _, cleanup = openTestDB(t, legacySchema)
+	defer cleanup()
+	if err := migrate(conn); err != nil {
+		t.Fatal(err)
+	}
+	if v := queryInt(t, conn, "PRAGMA user_version;"); v != latestVersion {
+		t.Errorf("user_version is %d, expected %d", v, latestVersion)
+	}
+	var kinds []string
+	if err := sqlitex.Exec(conn, "SELECT source, kind FROM Messages ORDER BY id;",
+		func(stmt *sqlite.Stmt) error {
+			kinds = append(kinds, stmt.ColumnText(0)+" "+stmt.ColumnText(1))
+			return nil
+		}); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(kinds) != `[["tl:51049452"] tweet ["tl:51049452"] del]` {
+		t.Errorf("migrated messages: %q", kinds)
+	}
+}
+
+func TestMigrateBaselineWithoutVersion(t *testing.T) {
+	// Databases created by hand from the schema at version 6 have no
+	// user_version, but are recognized by Messages.kind.
+	conn, _, cleanup := openTestDB(t, baseline.SQL)
+	defer cleanup()
+
+	pending, err := pendingMigrations(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := versions(pending); len(v) != latestVersion-baseline.Version || v[0] != baseline.Version+1 {
+		t.Errorf("pending migrations for a version 6 database: %v", v)
+	}
+}
+
+func TestMigrateNewer(t *testing.T) {
+	conn, dbPath, cleanup := openTestDB(t, fmt.Sprintf(`
+		CREATE TABLE Messages (id INTEGER PRIMARY KEY);
+		PRAGMA user_version = %d;`, latestVersion+1))
+	defer cleanup()
+
+	if _, err := pendingMigrations(conn); err == nil {
+		t.Error("pendingMigrations accepted a newer database")
+	}
+	if _, err := PendingMigrations(dbPath); err == nil {
+		t.Error("PendingMigrations accepted a newer database")
+	}
+	if err := Migrate(dbPath); err == nil {
+		t.Error("Migrate accepted a newer database")
+	}
+	if v := queryInt(t, conn, "PRAGMA user_version;"); v != latestVersion+1 {
+		t.Errorf("user_version changed to %d", v)
+	}
+}
+
+func TestPendingMigrations(t *testing.T) {
+	conn, dbPath, cleanup := openTestDB(t, legacySchema)
+	defer cleanup()
+	for _, m := range migrations[:4] {
+		if err := sqlitex.ExecScript(conn, m.SQL); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pending, err := PendingMigrations(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := versions(pending); len(v) != latestVersion-4 || v[0] != 5 || v[len(v)-1] != latestVersion {
+		t.Errorf("pending migrations for a version 4 database: %v", v)
+	}
+
+	// Listing them doesn't apply them.
+	if v, err := schemaVersion(conn); err != nil || v != 4 {
+		t.Errorf("schema version after listing migrations: %d, %v", v, err)
+	}
+	if pending, err := PendingMigrations(dbPath); err != nil || len(pending) != len(migrations)-4 {
+		t.Errorf("pending migrations changed after listing them: %v, %v", versions(pending), err)
+	}
+}
@@ -1,5 +0,0 @@
-BEGIN;
-SELECT COUNT(*) FROM Media;
-DROP TABLE Media;
-COMMIT;
-VACUUM;
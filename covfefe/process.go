@@ -1,19 +1,17 @@
 package covfefe
 
 import (
-	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strconv"
 	"strings"
 
 	"github.com/dghubble/go-twitter/twitter"
-	"github.com/h2non/filetype"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 )
@@ -23,6 +21,43 @@ type Message struct {
 	kind   string
 	msg    []byte
 	id     int64
+
+	// sources are all the sources recorded for a stored message, which can be
+	// more than one if it was received multiple times. Set by Rescan.
+	sources []string
+}
+
+// sourceIDs returns the suffixes of the message sources starting with prefix,
+// like the followed user ID of a "fl:<ID>" source.
+func (m *Message) sourceIDs(prefix string) []string {
+	sources := m.sources
+	if sources == nil {
+		sources = []string{m.source}
+	}
+	var ids []string
+	for _, s := range sources {
+		if strings.HasPrefix(s, prefix) {
+			ids = append(ids, strings.TrimPrefix(s, prefix))
+		}
+	}
+	return ids
+}
+
+// mastodonSourcePrefixes are the prefixes of the source IDs which are followed
+// by the URL of the Mastodon account that fetched the message.
+var mastodonSourcePrefixes = []string{"mh:", "mn:", "mf:", "ms:", "mx:"}
+
+// mastodonInstance returns the host of the Mastodon account that fetched the
+// message, which scopes the status IDs in it, or "" if it's not known.
+func (m *Message) mastodonInstance() string {
+	for _, p := range mastodonSourcePrefixes {
+		for _, account := range m.sourceIDs(p) {
+			if u, err := url.Parse(account); err == nil && u.Host != "" {
+				return u.Host
+			}
+		}
+	}
+	return ""
 }
 
 func (c *Covfefe) processTweet(id int64, tweet *twitter.Tweet) {
@@ -52,23 +87,59 @@ func (c *Covfefe) processTweet(id int64, tweet *twitter.Tweet) {
 	}
 
 	c.processUser(id, tweet.User)
-
-	if tweet.RetweetedStatus != nil {
-		c.processTweet(id, tweet.RetweetedStatus)
+	c.processThread(id, tweet)
+
+	// Retweeted and quoted tweets are indexed under their own ID when they
+	// are processed, unless they can't be because they are user-less.
+	c.indexText(tweetText(tweet), "text", tweet.ID, tweet.User.ID, id)
+	if rt := tweet.RetweetedStatus; rt != nil {
+		if rt.User == nil {
+			c.indexText(tweetText(rt), "retweet", tweet.ID, tweet.User.ID, id)
+		}
+		c.processTweet(id, rt)
 	}
-	if tweet.QuotedStatus != nil {
-		c.processTweet(id, tweet.QuotedStatus)
+	if qt := tweet.QuotedStatus; qt != nil {
+		if qt.User == nil {
+			c.indexText(tweetText(qt), "quote", tweet.ID, tweet.User.ID, id)
+		}
+		c.processTweet(id, qt)
 	}
 
-	c.fetchMedia(tweet)
-	c.fetchParent(tweet)
+	c.fetchMedia(id, tweet)
+	c.indexMediaText(id, tweet)
+	c.fetchParent(id, tweet)
 }
 
-func (c *Covfefe) fetchMedia(tweet *twitter.Tweet) {
-	if c.rescan {
-		return
+// processThread records what tweet is replying to and quoting, if anything.
+func (c *Covfefe) processThread(id int64, tweet *twitter.Tweet) {
+	log := log.WithFields(log.Fields{"message": id, "tweet": tweet.ID})
+	if tweet.InReplyToStatusID != 0 {
+		if err := c.insertThreadEdge(tweet.ID, tweet.InReplyToStatusID, "reply", id); err != nil {
+			log.WithError(err).Error("Failed to insert reply")
+		}
+	}
+	quoted := tweet.QuotedStatusID
+	if quoted == 0 && tweet.QuotedStatus != nil {
+		quoted = tweet.QuotedStatus.ID
 	}
+	if quoted != 0 {
+		if err := c.insertThreadEdge(tweet.ID, quoted, "quote", id); err != nil {
+			log.WithError(err).Error("Failed to insert quote")
+		}
+	}
+}
 
+func tweetText(tweet *twitter.Tweet) string {
+	if tweet.ExtendedTweet != nil && tweet.ExtendedTweet.FullText != "" {
+		return tweet.ExtendedTweet.FullText
+	}
+	if tweet.FullText != "" {
+		return tweet.FullText
+	}
+	return tweet.Text
+}
+
+func tweetMedia(tweet *twitter.Tweet) []twitter.MediaEntity {
 	var media []twitter.MediaEntity
 	if tweet.Entities != nil {
 		media = tweet.Entities.Media
@@ -84,92 +155,130 @@ func (c *Covfefe) fetchMedia(tweet *twitter.Tweet) {
 			media = tweet.ExtendedTweet.ExtendedEntities.Media
 		}
 	}
-	for _, m := range media {
+	return media
+}
+
+// indexMediaText indexes the OCR output left next to each stored image,
+// or next to the legacy <media ID>.<ext> files.
+func (c *Covfefe) indexMediaText(id int64, tweet *twitter.Tweet) {
+	for _, m := range tweetMedia(tweet) {
+		if m.SourceStatusID != 0 {
+			continue
+		}
+		hash, err := c.mediaHash(m.ID, "image")
+		if err != nil {
+			log.WithError(err).WithField("media", m.ID).Error("Failed to look up media")
+			continue
+		}
+		name := filepath.Join(c.mediaPath, fmt.Sprintf("%d.txt", m.ID))
+		if hash != "" {
+			name = blobPath(c.mediaPath, hash) + ".txt"
+		}
+		text, err := ioutil.ReadFile(name)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			log.WithError(err).WithField("media", m.ID).Error("Failed to read OCR text")
+			continue
+		}
+		c.indexText(strings.TrimSpace(string(text)), "ocr", tweet.ID, tweet.User.ID, id)
+	}
+}
+
+// fetchMedia queues jobs to save the images attached to a tweet, or the
+// thumbnails of videos and GIFs, and the best quality version of the latter.
+func (c *Covfefe) fetchMedia(id int64, tweet *twitter.Tweet) {
+	if c.rescan {
+		return
+	}
+
+	for _, m := range tweetMedia(tweet) {
 		if m.SourceStatusID != 0 {
 			// We'll find this media attached to the retweet.
 			continue
 		}
-		for retry := 0; retry < 3; retry++ {
-			log := log.WithFields(log.Fields{
-				"retry": retry,
-				"url":   m.MediaURLHttps,
-				"media": m.ID, "tweet": tweet.ID,
-			})
-			body, err := c.httpGet(m.MediaURLHttps)
-			if err != nil {
-				log.WithError(err).Error("Failed to download media")
-				continue
-			}
-			if err := c.saveMedia(body, m.ID); err != nil {
-				log.WithError(err).Error("Failed to save media")
-				continue
-			}
-			break
+		if hash, err := c.mediaHash(m.ID, "image"); err != nil {
+			log.WithError(err).WithField("media", m.ID).Error("Failed to check if media was already saved")
+			continue
+		} else if hash != "" {
+			// Already indexed by indexMediaText.
+			continue
+		}
+		c.enqueueJob("media", &mediaJob{
+			Media: m.ID, Variant: "image", URL: m.MediaURLHttps,
+			Tweet: tweet.ID, User: tweet.User.ID,
+		}, id)
+		if v := bestVideoVariant(m.VideoInfo.Variants); v != nil {
+			c.enqueueJob("media", &mediaJob{
+				Media: m.ID, Variant: "video", URL: v.URL,
+				Tweet: tweet.ID, User: tweet.User.ID,
+			}, id)
 		}
 	}
 }
 
-func (c *Covfefe) fetchParent(tweet *twitter.Tweet) {
+// fetchParent queues a job to fetch the tweet this one is replying to.
+func (c *Covfefe) fetchParent(id int64, tweet *twitter.Tweet) {
 	if c.rescan || tweet.InReplyToStatusID == 0 {
 		return
 	}
 
-	log := log.WithFields(log.Fields{
-		"tweet": tweet.ID, "parent": tweet.InReplyToStatusID,
-	})
-
 	if seen, err := c.seenTweet(tweet.InReplyToStatusID); err != nil {
-		log.WithError(err).Error("Failed to check if parent tweet was already seen")
+		log.WithError(err).WithField("tweet", tweet.ID).Error("Failed to check if parent tweet was already seen")
 		return
 	} else if seen {
-		log.Debug("Parent already in the database")
 		return
 	}
 
-	log.Debug("Fetching parent tweet")
-	parent, err := c.hydrateTweet(context.TODO(), tweet.InReplyToStatusID)
-	if err != nil {
-		log.WithError(err).Error("Failed to hydrate parent tweet")
-		return
-	}
-	c.Handle(&Message{
-		source: fmt.Sprintf("parent:%d", tweet.ID),
-		kind:   "tweet",
-		msg:    parent,
-	})
+	c.enqueueJob("parent", &parentJob{Tweet: tweet.ID, Parent: tweet.InReplyToStatusID}, id)
 }
 
-func (c *Covfefe) saveMedia(data []byte, id int64) error {
-	t, err := filetype.Match(data)
-	if err != nil {
-		return errors.WithStack(err)
+func (c *Covfefe) processUser(id int64, user *twitter.User) {
+	if new, err := c.insertUser(user, id); err != nil {
+		log.WithError(err).WithField("message", id).Error("Failed to insert user")
+	} else if new {
+		c.indexText(user.Description, "bio", 0, user.ID, id)
+	}
+	if user.Status != nil {
+		user.Status.User = user
+		c.processTweet(id, user.Status)
+		user.Status.User = nil
 	}
+}
 
-	name := filepath.Join(c.mediaPath, fmt.Sprintf("%d.%s", id, t.Extension))
-	base := filepath.Join(c.mediaPath, fmt.Sprintf("%d", id))
+// processToot stores a toot fetched by an account on instance, which is the
+// scope of its ID.
+func (c *Covfefe) processToot(id int64, status *mastodonStatus, instance string) {
+	log := log.WithFields(log.Fields{"message": id, "toot": status.URI})
 
-	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
-	if err != nil {
-		return errors.WithStack(err)
+	// Like protected tweets, non-public toots are dropped on the floor.
+	if status.Visibility == "private" || status.Visibility == "direct" {
+		log.Debug("Dropped non-public toot")
+		return
 	}
-	if _, err := f.Write(data); err != nil {
-		return errors.WithStack(err)
+	if status.Account == nil {
+		log.Debug("Account-less toot :(")
+		return
 	}
-	if err := f.Close(); err != nil {
-		return errors.WithStack(err)
+
+	if new, err := c.insertToot(status, instance, id); err != nil {
+		log.WithError(err).Error("Failed to insert toot")
+		return
+	} else if !new {
+		return
 	}
 
-	return exec.Command("tesseract", name, base).Run()
-}
+	c.processMastodonUser(id, status.Account)
 
-func (c *Covfefe) processUser(id int64, user *twitter.User) {
-	if err := c.insertUser(user, id); err != nil {
-		log.WithError(err).WithField("message", id).Error("Failed to insert user")
+	if status.Reblog != nil {
+		c.processToot(id, status.Reblog, instance)
 	}
-	if user.Status != nil {
-		user.Status.User = user
-		c.processTweet(id, user.Status)
-		user.Status.User = nil
+}
+
+func (c *Covfefe) processMastodonUser(id int64, account *mastodonAccount) {
+	if err := c.insertMastodonUser(account, id); err != nil {
+		log.WithError(err).WithField("message", id).Error("Failed to insert Mastodon user")
 	}
 }
 
@@ -272,15 +381,194 @@ func (c *Covfefe) Handle(m *Message) {
 		}
 
 		c.processUser(m.id, user)
-		target, err := strconv.ParseInt(strings.TrimPrefix(m.source, "fl:"), 10, 64)
-		if err != nil {
-			log.WithError(err).WithField("source", m.source).Error("Could not reconstruct target")
-		} else {
+		targets := m.sourceIDs("fl:")
+		if len(targets) == 0 {
+			log.WithField("source", m.source).Error("Could not reconstruct target")
+		}
+		for _, t := range targets {
+			target, err := strconv.ParseInt(t, 10, 64)
+			if err != nil {
+				log.WithError(err).WithField("source", "fl:"+t).Error("Could not reconstruct target")
+				continue
+			}
 			if err := c.insertFollow(user.ID, target, m.id); err != nil {
 				log.WithError(err).WithField("message", m.id).Error("Failed to insert follow")
 			}
 		}
 
+	case "follower-snapshot":
+		snapshot := new(followerSnapshot)
+		if err := json.Unmarshal(m.msg, snapshot); err != nil {
+			log.WithError(err).Warning("Failed to unmarshal message")
+			return
+		}
+
+		if err := c.insertMessage(m); err != nil {
+			log.WithError(err).Error("Failed to insert message")
+			return
+		}
+
+		c.processFollowerSnapshot(m.id, snapshot)
+
+	case "mastodon-status":
+		status := new(mastodonStatus)
+		if err := json.Unmarshal(m.msg, status); err != nil {
+			log.WithError(err).Warning("Failed to unmarshal message")
+			return
+		}
+
+		if status.Visibility == "private" || status.Visibility == "direct" {
+			log.Debug("Dropped non-public message")
+			return
+		}
+
+		if err := c.insertMessage(m); err != nil {
+			log.WithError(err).Error("Failed to insert message")
+			return
+		}
+
+		c.processToot(m.id, status, m.mastodonInstance())
+
+	case "mastodon-notification":
+		notification := new(mastodonNotification)
+		if err := json.Unmarshal(m.msg, notification); err != nil {
+			log.WithError(err).Warning("Failed to unmarshal message")
+			return
+		}
+
+		if s := notification.Status; s != nil && (s.Visibility == "private" || s.Visibility == "direct") {
+			log.Debug("Dropped non-public message")
+			return
+		}
+
+		if err := c.insertMessage(m); err != nil {
+			log.WithError(err).Error("Failed to insert message")
+			return
+		}
+
+		if notification.Account != nil {
+			c.processMastodonUser(m.id, notification.Account)
+		}
+		if notification.Status != nil {
+			c.processToot(m.id, notification.Status, m.mastodonInstance())
+		}
+		if notification.Type == "follow" && notification.Account != nil {
+			targets := m.sourceIDs("mn:")
+			if len(targets) == 0 {
+				log.WithField("source", m.source).Error("Could not reconstruct target")
+			}
+			for _, target := range targets {
+				if err := c.insertMastodonFollow(notification.Account.URL, target, m.id); err != nil {
+					log.WithError(err).WithField("message", m.id).Error("Failed to insert follow")
+				}
+			}
+		}
+
+	case "mastodon-deletion":
+		del := new(mastodonDeletion)
+		if err := json.Unmarshal(m.msg, del); err != nil {
+			log.WithError(err).Warning("Failed to unmarshal message")
+			return
+		}
+
+		if err := c.insertMessage(m); err != nil {
+			log.WithError(err).Error("Failed to insert message")
+			return
+		}
+
+		// Match the instance the same way as processToot, rather than with
+		// del.Instance, which is the API URL and might not have the same
+		// host as the account.
+		instance := m.mastodonInstance()
+		if instance == "" {
+			log.WithField("source", m.source).Error("Could not reconstruct instance")
+			return
+		}
+		c.deletedToot(instance, del.ID, m.id)
+
+	case "archive-account":
+		account := new(archiveAccount)
+		if err := json.Unmarshal(m.msg, account); err != nil {
+			log.WithError(err).Warning("Failed to unmarshal message")
+			return
+		}
+		id, err := strconv.ParseInt(account.AccountID, 10, 64)
+		if err != nil {
+			log.WithError(err).Warning("Invalid account ID")
+			return
+		}
+
+		if err := c.insertMessage(m); err != nil {
+			log.WithError(err).Error("Failed to insert message")
+			return
+		}
+
+		// The archive has the bio in profile.js, but Users rows are only
+		// about tracking changes anyway.
+		c.processUser(m.id, &twitter.User{
+			ID: id, ScreenName: account.Username, Name: account.AccountDisplayName,
+		})
+
+	case "archive-tweet":
+		tweet := new(archiveTweet)
+		if err := json.Unmarshal(m.msg, tweet); err != nil {
+			log.WithError(err).Warning("Failed to unmarshal message")
+			return
+		}
+
+		if err := c.insertMessage(m); err != nil {
+			log.WithError(err).Error("Failed to insert message")
+			return
+		}
+
+		owners := archiveOwners(m)
+		if len(owners) == 0 {
+			log.WithField("source", m.source).Error("Could not reconstruct author")
+			return
+		}
+		// Tweets can only be in the archive of their author.
+		c.processArchiveTweet(m.id, tweet, owners[0])
+
+	case "archive-like":
+		// Likes only have the tweet ID and text, not enough for a Tweets row.
+		if err := c.insertMessage(m); err != nil {
+			log.WithError(err).Error("Failed to insert message")
+			return
+		}
+
+	case "archive-follower", "archive-following":
+		edge := new(struct {
+			AccountID string `json:"accountId"`
+		})
+		if err := json.Unmarshal(m.msg, edge); err != nil {
+			log.WithError(err).Warning("Failed to unmarshal message")
+			return
+		}
+		other, err := strconv.ParseInt(edge.AccountID, 10, 64)
+		if err != nil {
+			log.WithError(err).Warning("Invalid account ID")
+			return
+		}
+
+		if err := c.insertMessage(m); err != nil {
+			log.WithError(err).Error("Failed to insert message")
+			return
+		}
+
+		owners := archiveOwners(m)
+		if len(owners) == 0 {
+			log.WithField("source", m.source).Error("Could not reconstruct target")
+		}
+		for _, owner := range owners {
+			follower, target := other, owner
+			if m.kind == "archive-following" {
+				follower, target = owner, other
+			}
+			if err := c.insertFollow(follower, target, m.id); err != nil {
+				log.WithError(err).WithField("message", m.id).Error("Failed to insert follow")
+			}
+		}
+
 	default:
 		log.Warning("Dropped unknown message")
 		return
@@ -0,0 +1,239 @@
+package covfefe
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// An apiClient makes requests to the Twitter API with one set of credentials,
+// whose rate limits are tracked separately for each endpoint, from the
+// x-rate-limit-remaining and x-rate-limit-reset headers of the responses.
+//
+// Requests to an endpoint are spread evenly over the rest of its window, and
+// transient failures are retried with exponential backoff, so that callers
+// only see permanent errors.
+type apiClient struct {
+	c *http.Client
+
+	mu     sync.Mutex
+	limits map[string]*rateLimit
+}
+
+type rateLimit struct {
+	// mu is held for the whole request, so requests to an endpoint are
+	// serialized.
+	mu sync.Mutex
+
+	known     bool
+	remaining int
+	reset     time.Time
+	last      time.Time
+
+	failures int
+	retryAt  time.Time
+}
+
+// These are vars so tests can speed them up.
+var (
+	apiMinBackoff = 30 * time.Second
+	apiMaxBackoff = 15 * time.Minute
+	// apiDefaultWindow is used if a 429 response has no reset header.
+	apiDefaultWindow = 15 * time.Minute
+	// apiUnknownInterval spaces the requests to an endpoint whose responses
+	// have no rate limit headers, which is the strictest Twitter limit.
+	apiUnknownInterval = 1 * time.Minute
+)
+
+func newAPIClient(c *http.Client) *apiClient {
+	return &apiClient{c: c, limits: make(map[string]*rateLimit)}
+}
+
+func (a *apiClient) limit(endpoint string) *rateLimit {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	l, ok := a.limits[endpoint]
+	if !ok {
+		l = &rateLimit{}
+		a.limits[endpoint] = l
+	}
+	return l
+}
+
+// A rateLimitedError is returned by tryGetJSON if the rate limit of the
+// endpoint is exhausted, or if it's backing off after a failure.
+type rateLimitedError struct {
+	endpoint string
+	reset    time.Time
+}
+
+func (e *rateLimitedError) Error() string {
+	return fmt.Sprintf("rate limited on %s until %v", e.endpoint, e.reset.Format(time.RFC3339))
+}
+
+// getJSON fetches url and decodes the JSON response into v, waiting as long
+// as necessary for the rate limit, and retrying transient errors, until ctx
+// is done.
+func (a *apiClient) getJSON(ctx context.Context, url string, v interface{}) error {
+	return a.get(ctx, url, v, true)
+}
+
+// tryGetJSON is like getJSON, but returns a *rateLimitedError instead of
+// waiting, and doesn't retry or spread out requests.
+func (a *apiClient) tryGetJSON(ctx context.Context, url string, v interface{}) error {
+	return a.get(ctx, url, v, false)
+}
+
+func (a *apiClient) get(ctx context.Context, rawURL string, v interface{}, wait bool) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	endpoint := u.Path
+	log := logrus.WithField("endpoint", endpoint)
+
+	l := a.limit(endpoint)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for {
+		now := time.Now()
+		if d := l.delay(now, wait); d > 0 {
+			if !wait {
+				return &rateLimitedError{endpoint: endpoint, reset: now.Add(d)}
+			}
+			log.WithField("delay", d).Debug("Waiting for rate limit")
+			t := time.NewTimer(d)
+			select {
+			case <-ctx.Done():
+				t.Stop()
+				return ctx.Err()
+			case <-t.C:
+			}
+		}
+
+		l.last = time.Now()
+		retry, err := a.do(ctx, l, rawURL, v)
+		observeFetch(ctx, err)
+		if err == nil || !retry || !wait {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		log.WithError(err).WithField("failures", l.failures).Warn("Request failed, backing off")
+	}
+}
+
+// delay returns how long to wait before the next request. If pace is true,
+// requests are spread over the rest of the window, or apiUnknownInterval apart
+// if the window is unknown. Retries are paced by the backoff instead.
+func (l *rateLimit) delay(now time.Time, pace bool) time.Duration {
+	next := l.retryAt
+	if pace && !l.known && l.failures == 0 && !l.last.IsZero() {
+		next = latest(next, l.last.Add(apiUnknownInterval))
+	}
+	if l.known && now.Before(l.reset) {
+		switch {
+		case l.remaining == 0:
+			// Give the server a second of slack.
+			next = latest(next, l.reset.Add(1*time.Second))
+		case pace:
+			next = latest(next, l.last.Add(l.reset.Sub(l.last)/time.Duration(l.remaining+1)))
+		}
+	}
+	return next.Sub(now)
+}
+
+func latest(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+// do makes one request, updating l. It returns whether errors are transient.
+func (a *apiClient) do(ctx context.Context, l *rateLimit, url string, v interface{}) (retry bool, err error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return false, err
+	}
+	r, err := a.c.Do(req.WithContext(ctx))
+	if err != nil {
+		l.backoff()
+		return true, errors.Wrapf(err, "error getting %s", url)
+	}
+	defer r.Body.Close()
+
+	remaining, errRemaining := strconv.Atoi(r.Header.Get("x-rate-limit-remaining"))
+	reset, errReset := strconv.ParseInt(r.Header.Get("x-rate-limit-reset"), 10, 64)
+	if errRemaining == nil && errReset == nil {
+		l.known, l.remaining, l.reset = true, remaining, time.Unix(reset, 0)
+	}
+
+	switch {
+	case r.StatusCode == http.StatusOK:
+		l.failures, l.retryAt = 0, time.Time{}
+		return false, errors.Wrapf(json.NewDecoder(r.Body).Decode(v),
+			"error reading and decoding %q", url)
+	case r.StatusCode == http.StatusTooManyRequests || r.StatusCode == 420:
+		// 420 is what Twitter used to call "Enhance Your Calm".
+		if !l.known || l.remaining != 0 {
+			l.known, l.remaining, l.reset = true, 0, time.Now().Add(apiDefaultWindow)
+		}
+		return true, errors.Errorf("error getting %s: %s", url, r.Status)
+	case r.StatusCode >= 500:
+		l.backoff()
+		return true, errors.Errorf("error getting %s: %s", url, r.Status)
+	}
+
+	var errs struct {
+		Errors []struct {
+			Message string
+		}
+	}
+	json.NewDecoder(r.Body).Decode(&errs)
+	e := &apiError{url: url, status: r.StatusCode, message: r.Status}
+	if len(errs.Errors) > 0 {
+		e.message = errs.Errors[0].Message
+	}
+	return false, e
+}
+
+// An apiError is a permanent error response, like 401 for revoked
+// credentials.
+type apiError struct {
+	url     string
+	status  int
+	message string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("error getting %s: %s", e.url, e.message)
+}
+
+func (l *rateLimit) backoff() {
+	l.retryAt = time.Now().Add(backoffDelay(l.failures, apiMinBackoff, apiMaxBackoff))
+	l.failures++
+}
+
+// backoffDelay returns min doubled once for each previous consecutive
+// failure, up to max.
+func backoffDelay(failures int, min, max time.Duration) time.Duration {
+	d := min
+	for i := 0; i < failures && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d
+}
@@ -0,0 +1,248 @@
+package covfefe
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dghubble/go-twitter/twitter"
+	"github.com/pkg/errors"
+)
+
+// rateLimitServer emulates the Twitter API rate limits: each path allows limit
+// requests per window, and then returns 429 until the window resets.
+type rateLimitServer struct {
+	limit  int
+	window time.Duration
+	body   string
+
+	mu        sync.Mutex
+	reset     map[string]time.Time
+	remaining map[string]int
+	served    map[string]int
+	limited   map[string]int
+}
+
+func newRateLimitServer(limit int, window time.Duration) *rateLimitServer {
+	return &rateLimitServer{
+		limit: limit, window: window, body: `{"ok": true}`,
+		reset: make(map[string]time.Time), remaining: make(map[string]int),
+		served: make(map[string]int), limited: make(map[string]int),
+	}
+}
+
+func (s *rateLimitServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p := r.URL.Path
+	if now := time.Now(); !now.Before(s.reset[p]) {
+		// The header has a resolution of seconds, so round up the window.
+		s.reset[p] = time.Unix(now.Add(s.window).Unix()+1, 0)
+		s.remaining[p] = s.limit
+	}
+	w.Header().Set("x-rate-limit-reset", strconv.FormatInt(s.reset[p].Unix(), 10))
+	if s.remaining[p] == 0 {
+		s.limited[p]++
+		w.Header().Set("x-rate-limit-remaining", "0")
+		http.Error(w, `{"errors": [{"message": "Rate limit exceeded"}]}`, http.StatusTooManyRequests)
+		return
+	}
+	s.remaining[p]--
+	s.served[p]++
+	w.Header().Set("x-rate-limit-remaining", strconv.Itoa(s.remaining[p]))
+	w.Write([]byte(s.body))
+}
+
+func TestRateLimitWindows(t *testing.T) {
+	srv := newRateLimitServer(2, 1*time.Second)
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+	api := newAPIClient(ts.Client())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	// Two endpoints are scheduled independently.
+	var wg sync.WaitGroup
+	for _, path := range []string{"/a.json", "/b.json"} {
+		path := path
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 5; i++ {
+				var v struct{ OK bool }
+				if err := api.getJSON(ctx, ts.URL+path, &v); err != nil {
+					t.Errorf("%s: request %d: %v", path, i, err)
+					return
+				}
+				if !v.OK {
+					t.Errorf("%s: request %d: bad response", path, i)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	for _, path := range []string{"/a.json", "/b.json"} {
+		if srv.served[path] != 5 {
+			t.Errorf("%s: served %d requests, want 5", path, srv.served[path])
+		}
+		if srv.limited[path] != 0 {
+			t.Errorf("%s: got %d rate limited responses", path, srv.limited[path])
+		}
+	}
+}
+
+func TestRateLimitTry(t *testing.T) {
+	defer func(w time.Duration) { apiDefaultWindow = w }(apiDefaultWindow)
+	apiDefaultWindow = 100 * time.Millisecond
+
+	var mu sync.Mutex
+	var n int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		n++
+		first := n == 1
+		mu.Unlock()
+		if first {
+			// No rate limit headers, like some error responses.
+			w.WriteHeader(420)
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer ts.Close()
+	api := newAPIClient(ts.Client())
+	ctx := context.Background()
+
+	var v interface{}
+	if err := api.tryGetJSON(ctx, ts.URL+"/show.json", &v); err == nil {
+		t.Fatal("expected an error for 420")
+	}
+	err := api.tryGetJSON(ctx, ts.URL+"/show.json", &v)
+	if _, ok := errors.Cause(err).(*rateLimitedError); !ok {
+		t.Fatalf("expected a rateLimitedError, got %v", err)
+	}
+	if n != 1 {
+		t.Errorf("made %d requests while rate limited, want 1", n)
+	}
+	if err := api.getJSON(ctx, ts.URL+"/show.json", &v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRateLimitBackoff(t *testing.T) {
+	defer func(min, max time.Duration) { apiMinBackoff, apiMaxBackoff = min, max }(apiMinBackoff, apiMaxBackoff)
+	apiMinBackoff, apiMaxBackoff = 10*time.Millisecond, 40*time.Millisecond
+
+	var mu sync.Mutex
+	attempts := make(map[string]int)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		attempts[r.URL.Path]++
+		n := attempts[r.URL.Path]
+		mu.Unlock()
+		switch {
+		case r.URL.Path == "/flaky.json" && n <= 3:
+			http.Error(w, "over capacity", http.StatusServiceUnavailable)
+		case r.URL.Path == "/flaky.json":
+			w.Write([]byte(`{}`))
+		default:
+			http.Error(w, `{"errors": [{"message": "Not authorized."}]}`, http.StatusUnauthorized)
+		}
+	}))
+	defer ts.Close()
+	api := newAPIClient(ts.Client())
+	ctx := context.Background()
+
+	var v interface{}
+	start := time.Now()
+	if err := api.getJSON(ctx, ts.URL+"/flaky.json", &v); err != nil {
+		t.Fatal(err)
+	}
+	if attempts["/flaky.json"] != 4 {
+		t.Errorf("made %d attempts, want 4", attempts["/flaky.json"])
+	}
+	if d := time.Since(start); d < 10*time.Millisecond+20*time.Millisecond+40*time.Millisecond {
+		t.Errorf("retried too fast, in %v", d)
+	}
+	if l := api.limit("/flaky.json"); l.failures != 0 {
+		t.Errorf("failures not reset after success: %d", l.failures)
+	}
+
+	// Permanent errors are not retried.
+	if err := api.getJSON(ctx, ts.URL+"/private.json", &v); err == nil {
+		t.Fatal("expected an error for 401")
+	}
+	if attempts["/private.json"] != 1 {
+		t.Errorf("made %d attempts for a permanent error, want 1", attempts["/private.json"])
+	}
+}
+
+func TestFollowTimelinePacing(t *testing.T) {
+	srv := newRateLimitServer(3, 1*time.Second)
+	srv.body = "[]"
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+	target, _ := url.Parse(ts.URL)
+	api := newAPIClient(&http.Client{Transport: rewriteTransport{target}})
+	tc := &twitterClient{api: api, u: &twitter.User{ID: 1, ScreenName: "one"}}
+
+	// The timeline is polled as fast as its rate limit allows, and no faster.
+	// The server rounds the windows up to whole seconds, so there are at
+	// least two in the time allowed.
+	ctx, cancel := context.WithTimeout(context.Background(), 3500*time.Millisecond)
+	defer cancel()
+	if err := tc.followTimeline(ctx, "mentions", make(chan *Message)); err != context.DeadlineExceeded {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	path := "/1.1/statuses/mentions_timeline.json"
+	if srv.served[path] < 4 {
+		t.Errorf("served only %d requests, with a limit of 3 per window", srv.served[path])
+	}
+	if srv.limited[path] != 0 {
+		t.Errorf("got %d rate limited responses", srv.limited[path])
+	}
+}
+
+func TestFollowTimelineUnknownLimits(t *testing.T) {
+	defer func(d time.Duration) { apiUnknownInterval = d }(apiUnknownInterval)
+	apiUnknownInterval = 200 * time.Millisecond
+
+	var mu sync.Mutex
+	var served int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		served++
+		mu.Unlock()
+		w.Write([]byte("[]"))
+	}))
+	defer ts.Close()
+	target, _ := url.Parse(ts.URL)
+	api := newAPIClient(&http.Client{Transport: rewriteTransport{target}})
+	tc := &twitterClient{api: api, u: &twitter.User{ID: 1, ScreenName: "one"}}
+
+	// Without rate limit headers, the timeline is still polled at a steady
+	// pace, instead of as fast as the server answers.
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	if err := tc.followTimeline(ctx, "mentions", make(chan *Message)); err != context.DeadlineExceeded {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if served < 3 || served > 6 {
+		t.Errorf("served %d requests in a second, expected about 5", served)
+	}
+}
@@ -1,8 +1,10 @@
 package covfefe
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
+	"strings"
 
 	"crawshaw.io/sqlite"
 	"crawshaw.io/sqlite/sqlitex"
@@ -12,66 +14,205 @@ import (
 	"github.com/v2pro/plz/gls"
 )
 
-func Rescan(dbPath string) (err error) {
-	// We use a single connection for performance and rollback.
+// derivedTables are the tables regenerated from Messages by a full Rescan.
+var derivedTables = []string{
+	"Tweets", "Users", "Follows", "Threads",
+	"FollowerSnapshots", "FollowEvents",
+	"Toots", "MastodonUsers", "MastodonFollows",
+	"SearchIndex",
+}
+
+// rescanBatch is the number of messages processed in each transaction.
+const rescanBatch = 10000
+
+// Rescan processes the Messages that were stored after the last Rescan
+// checkpoint, and advances the checkpoint.
+//
+// If full is true, the derived tables are first rebuilt from scratch into
+// temporary shadow tables, which are then swapped in a single transaction, so
+// that readers never observe a partial rebuild.
+func Rescan(dbPath, mediaPath string, full bool) (err error) {
+	// We use a single connection for performance, and because the shadow
+	// tables only exist on it.
 	conn, err := sqlite.OpenConn("file:"+dbPath, 0)
 	if err != nil {
 		return errors.Wrap(err, "failed to open database")
 	}
 	defer conn.Close()
-	defer sqlitex.Save(conn)(&err)
 
 	mainID := gls.GoID()
 	c := &Covfefe{
 		withConn: func(f func(conn *sqlite.Conn) error) error {
 			if gls.GoID() != mainID {
 				// This goroutine owns the conn, as it has an open
-				// statement until the end. Also, no locking!
+				// statement until the end of each batch. Also, no locking!
 				panic("rescan should not use multiple goroutines")
 			}
 			return f(conn)
 		},
-		rescan: true,
+		mediaPath: mediaPath,
+		rescan:    true,
 	}
 
 	if err := c.initDB(); err != nil {
 		return err
 	}
 
-	log.Info("Dropping tables...")
+	if full {
+		if err := c.rebuild(conn); err != nil {
+			return err
+		}
+	}
 
-	// Need to have foreign keys OFF for TRUNCATE
-	if err := sqlitex.ExecScript(conn, `
-		DELETE FROM Tweets;
-		DELETE FROM Users;
-		DELETE FROM Follows;
-	`); err != nil {
-		return errors.Wrap(err, "failed to truncate tables")
+	// After a full rebuild, this catches up with messages stored while it
+	// was running, whose processing by Run was lost in the swap.
+	checkpoint, err := rescanCheckpoint(conn)
+	if err != nil {
+		return err
 	}
+	log.WithField("checkpoint", checkpoint).Info("Processing new messages...")
+	if _, err := c.processMessages(conn, checkpoint, true); err != nil {
+		return err
+	}
+
+	log.Info("Finishing up...")
+	return nil
+}
 
-	log.Info("Starting rescan...")
+func (c *Covfefe) rebuild(conn *sqlite.Conn) error {
+	log.Info("Creating shadow tables...")
 
-	count, err := sqlitex.ResultInt64(conn.Prep("SELECT COUNT(*) FROM Messages;"))
+	// TEMP tables shadow the main ones with the same name, so Handle will
+	// write to them without knowing, while other connections keep seeing the
+	// old tables. They disappear with the connection if anything goes wrong.
+	for _, name := range derivedTables {
+		var script []string
+		if err := sqlitex.Exec(conn, `SELECT sql FROM main.sqlite_master
+			WHERE tbl_name = ? AND sql IS NOT NULL ORDER BY type = 'index';`,
+			func(stmt *sqlite.Stmt) error {
+				script = append(script, shadowSQL(stmt.GetText("sql"))+";")
+				return nil
+			}, name); err != nil {
+			return errors.Wrapf(err, "failed to read the schema of %s", name)
+		}
+		if err := sqlitex.ExecScript(conn, strings.Join(script, "\n")); err != nil {
+			return errors.Wrapf(err, "failed to create shadow table for %s", name)
+		}
+	}
+
+	log.Info("Starting full rescan...")
+
+	last, err := c.processMessages(conn, 0, false)
 	if err != nil {
-		return errors.Wrap(err, "failed to count messages")
+		return err
+	}
+
+	log.Info("Swapping tables...")
+
+	return swapShadowTables(conn, last)
+}
+
+// shadowSQL turns the CREATE statement of a main table or index into one
+// for the TEMP schema.
+func shadowSQL(sql string) string {
+	for _, prefix := range []string{
+		"CREATE TABLE ", "CREATE VIRTUAL TABLE ", "CREATE INDEX ", "CREATE UNIQUE INDEX ",
+	} {
+		if strings.HasPrefix(sql, prefix) {
+			return prefix + "temp." + strings.TrimPrefix(sql, prefix)
+		}
+	}
+	return sql
+}
+
+func swapShadowTables(conn *sqlite.Conn, checkpoint int64) (err error) {
+	defer sqlitex.Save(conn)(&err)
+
+	for _, name := range derivedTables {
+		if err := sqlitex.ExecScript(conn, fmt.Sprintf(`
+			DELETE FROM main.%[1]s;
+			INSERT INTO main.%[1]s SELECT * FROM temp.%[1]s;
+			DROP TABLE temp.%[1]s;`, name)); err != nil {
+			return errors.Wrapf(err, "failed to swap %s", name)
+		}
+	}
+	return setRescanCheckpoint(conn, checkpoint)
+}
+
+// processMessages handles all Messages after the given ID in batches, each in
+// its own transaction, and returns the last processed ID. If checkpoint is
+// true, the checkpoint is advanced along with each batch.
+func (c *Covfefe) processMessages(conn *sqlite.Conn, after int64, checkpoint bool) (int64, error) {
+	var count int64
+	if err := sqlitex.Exec(conn, "SELECT COUNT(*) FROM Messages WHERE id > ?;",
+		func(stmt *sqlite.Stmt) error {
+			count = stmt.ColumnInt64(0)
+			return nil
+		}, after); err != nil {
+		return 0, errors.Wrap(err, "failed to count messages")
+	}
+	if count == 0 {
+		return after, nil
 	}
 	pb := progressbar.NewOptions64(count, progressbar.OptionShowCount())
+	defer fmt.Fprintf(os.Stderr, "\n")
+
+	for {
+		last, err := c.processBatch(conn, after, checkpoint, pb)
+		if err != nil {
+			return 0, err
+		}
+		if last == after {
+			return last, nil
+		}
+		after = last
+	}
+}
+
+func (c *Covfefe) processBatch(conn *sqlite.Conn, after int64, checkpoint bool, pb *progressbar.ProgressBar) (last int64, err error) {
+	defer sqlitex.Save(conn)(&err)
 
-	if err := sqlitex.Exec(conn, "SELECT id, json, kind FROM Messages;",
+	last = after
+	if err := sqlitex.Exec(conn, `SELECT id, json, kind, source FROM Messages
+		WHERE id > ? ORDER BY id LIMIT ?;`,
 		func(stmt *sqlite.Stmt) error {
-			c.Handle(&Message{
-				// TODO: needs source for follower processing.
-				id:   stmt.GetInt64("id"),
+			last = stmt.GetInt64("id")
+			m := &Message{
+				id:   last,
 				kind: stmt.GetText("kind"),
 				msg:  []byte(stmt.GetText("json")),
-			})
+			}
+			if err := json.Unmarshal([]byte(stmt.GetText("source")), &m.sources); err != nil {
+				log.WithError(err).WithField("message", last).Error("Failed to parse source")
+			}
+			if len(m.sources) > 0 {
+				m.source = m.sources[0]
+			}
+			c.Handle(m)
 			pb.Add(1)
 			return nil
-		}); err != nil {
-		return errors.Wrap(err, "listing Messages failed")
+		}, after, rescanBatch); err != nil {
+		return 0, errors.Wrap(err, "listing Messages failed")
 	}
 
-	fmt.Fprintf(os.Stderr, "\n")
-	log.Info("Finishing up...")
-	return nil
+	if checkpoint && last != after {
+		if err := setRescanCheckpoint(conn, last); err != nil {
+			return 0, err
+		}
+	}
+	return last, nil
+}
+
+func rescanCheckpoint(conn *sqlite.Conn) (checkpoint int64, err error) {
+	err = sqlitex.Exec(conn, "SELECT message FROM Checkpoints WHERE name = 'rescan';",
+		func(stmt *sqlite.Stmt) error {
+			checkpoint = stmt.GetInt64("message")
+			return nil
+		})
+	return checkpoint, errors.Wrap(err, "failed to read checkpoint")
+}
+
+func setRescanCheckpoint(conn *sqlite.Conn, checkpoint int64) error {
+	return errors.Wrap(sqlitex.Exec(conn, `INSERT OR REPLACE INTO Checkpoints (name, message)
+		VALUES ('rescan', ?);`, nil, checkpoint), "failed to store checkpoint")
 }
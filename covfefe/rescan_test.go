@@ -0,0 +1,108 @@
+package covfefe
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"crawshaw.io/sqlite"
+	"crawshaw.io/sqlite/sqlitex"
+)
+
+// loadTestMessages returns the messages in testdata/rescan/messages.json,
+// which mimic what Run receives from each source.
+func loadTestMessages(t *testing.T) []*Message {
+	data, err := ioutil.ReadFile("testdata/rescan/messages.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var items []struct {
+		Source, Kind string
+		Msg          json.RawMessage
+	}
+	if err := json.Unmarshal(data, &items); err != nil {
+		t.Fatal(err)
+	}
+	var messages []*Message
+	for _, item := range items {
+		messages = append(messages, &Message{source: item.Source, kind: item.Kind, msg: item.Msg})
+	}
+	return messages
+}
+
+// dumpDerivedTables returns every row of the derivedTables, sorted.
+func dumpDerivedTables(t *testing.T, c *Covfefe) map[string][]string {
+	tables := make(map[string][]string)
+	for _, name := range derivedTables {
+		var rows []string
+		if err := c.withConn(func(conn *sqlite.Conn) error {
+			return sqlitex.Exec(conn, "SELECT * FROM "+name+";",
+				func(stmt *sqlite.Stmt) error {
+					var cols []string
+					for i := 0; i < stmt.ColumnCount(); i++ {
+						cols = append(cols, stmt.ColumnText(i))
+					}
+					rows = append(rows, strings.Join(cols, "|"))
+					return nil
+				})
+		}); err != nil {
+			t.Fatal(err)
+		}
+		sort.Strings(rows)
+		tables[name] = rows
+	}
+	return tables
+}
+
+func TestRescan(t *testing.T) {
+	c, dbPath, cleanup := newTestCovfefe(t)
+	defer cleanup()
+
+	messages := loadTestMessages(t)
+	for _, m := range messages {
+		c.Handle(m)
+	}
+	live := dumpDerivedTables(t, c)
+
+	follows := queryStrings(t, c, "SELECT follower || ' ' || target FROM Follows ORDER BY 1;")
+	if exp := []string{"3 1", "4 1", "4 5", "6 1", "6 5"}; !reflect.DeepEqual(follows, exp) {
+		t.Fatalf("Follows = %v, expected %v", follows, exp)
+	}
+	mfollows := queryStrings(t, c, "SELECT target FROM MastodonFollows ORDER BY 1;")
+	if exp := []string{
+		"https://example.social/@alice", "https://example.social/@archivist",
+	}; !reflect.DeepEqual(mfollows, exp) {
+		t.Fatalf("MastodonFollows = %v, expected %v", mfollows, exp)
+	}
+
+	if err := Rescan(dbPath, "", true); err != nil {
+		t.Fatal(err)
+	}
+	if rescanned := dumpDerivedTables(t, c); !reflect.DeepEqual(rescanned, live) {
+		t.Errorf("full Rescan changed the derived tables:\n%v\nexpected:\n%v", rescanned, live)
+	}
+
+	// New messages, including a duplicate with a new source, are picked up by
+	// the next incremental Rescan from where the last one stopped.
+	c.Handle(&Message{source: "fl:7", kind: "follower", msg: messages[5].msg})
+	c.Handle(&Message{source: "fl:7", kind: "follower", msg: []byte(
+		`{"id": 8, "id_str": "8", "screen_name": "erin", "name": "Erin", "description": "erin's bio"}`)})
+	live = dumpDerivedTables(t, c)
+
+	if err := Rescan(dbPath, "", false); err != nil {
+		t.Fatal(err)
+	}
+	if rescanned := dumpDerivedTables(t, c); !reflect.DeepEqual(rescanned, live) {
+		t.Errorf("incremental Rescan changed the derived tables:\n%v\nexpected:\n%v", rescanned, live)
+	}
+
+	if err := Rescan(dbPath, "", true); err != nil {
+		t.Fatal(err)
+	}
+	if rescanned := dumpDerivedTables(t, c); !reflect.DeepEqual(rescanned, live) {
+		t.Errorf("full Rescan changed the derived tables:\n%v\nexpected:\n%v", rescanned, live)
+	}
+}
@@ -0,0 +1,41 @@
+package covfefe
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSearchIndex(t *testing.T) {
+	c, _, cleanup := newTestCovfefe(t)
+	defer cleanup()
+	c.rescan = true // Don't queue parent fetches.
+
+	c.Handle(testTweet(1, 1, 0, "the original aardvark", ""))
+	c.Handle(testTweet(2, 2, 0, "RT @u1: the original…", `, "retweeted_status": {"id": 1, "id_str": "1",
+		"created_at": "Wed Jan 02 10:01:00 +0000 2019", "full_text": "the original aardvark",
+		"user": {"id": 1, "screen_name": "u1"}}`))
+	c.Handle(testTweet(3, 3, 0, "look at this", `, "quoted_status": {"id": 4, "id_str": "4",
+		"created_at": "Wed Jan 02 10:04:00 +0000 2019", "full_text": "a quoted bandicoot",
+		"user": {"id": 4, "screen_name": "u4"}}`))
+	c.Handle(testTweet(5, 5, 0, "and this", `, "quoted_status": {"id": 6, "id_str": "6",
+		"full_text": "a user-less capybara"}`))
+
+	for _, tc := range []struct {
+		query    string
+		expected []string
+	}{
+		// Nested tweets are only indexed once, under their own ID.
+		{"aardvark", []string{"1 text"}},
+		{"original", []string{"1 text", "2 text"}},
+		{"bandicoot", []string{"4 text"}},
+		{"look", []string{"3 text"}},
+		// Unless they can't be stored, for lack of a user.
+		{"capybara", []string{"5 quote"}},
+	} {
+		got := queryStrings(t, c, `SELECT tweet || ' ' || field FROM SearchIndex
+			WHERE SearchIndex MATCH ? ORDER BY tweet`, tc.query)
+		if !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("%q: got %q, expected %q", tc.query, got, tc.expected)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package covfefe
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/dghubble/go-twitter/twitter"
+	"github.com/pkg/errors"
+)
+
+// A Source produces Messages for an account, for example by polling a
+// timeline. Each Message carries its own source ID, like "tl:<user ID>".
+type Source interface {
+	// Run sends Messages to m until ctx is canceled or an unrecoverable
+	// error occurs.
+	Run(ctx context.Context, m chan<- *Message) error
+}
+
+// sources maps the source names usable in Account.Sources to constructors,
+// which receive a rate-limited client for the account and the user it belongs
+// to. Sources of the same account share the client, and so its rate limits.
+var sources = map[string]func(api *apiClient, u *twitter.User) Source{
+	"home":      newTimelineSource("home"),
+	"mentions":  newTimelineSource("mentions"),
+	"user":      newTimelineSource("user"),
+	"likes":     newTimelineSource("likes"),
+	"followers": newFollowersSource,
+}
+
+// DefaultSources are the sources run for accounts that don't specify any.
+var DefaultSources = []string{"home", "mentions", "user", "likes", "followers"}
+
+// checkSources returns an error naming the first source of creds that is not
+// in sources or mastodonSources, so that a typo fails at startup instead of
+// silently not fetching anything.
+func (creds *Credentials) checkSources() error {
+	for i, account := range creds.Accounts {
+		for _, name := range account.Sources {
+			if _, ok := sources[name]; !ok {
+				return errors.Errorf("unknown source %q for account %d (@%s)",
+					name, i, account.ScreenName)
+			}
+		}
+	}
+	for i, account := range creds.Mastodon {
+		for _, name := range account.Sources {
+			if _, ok := mastodonSources[name]; !ok {
+				return errors.Errorf("unknown source %q for Mastodon account %d (%s)",
+					name, i, account.Instance)
+			}
+		}
+	}
+	return nil
+}
+
+func newTimelineSource(timeline string) func(api *apiClient, u *twitter.User) Source {
+	return func(api *apiClient, u *twitter.User) Source {
+		return &timelineSource{t: &twitterClient{api: api, u: u}, timeline: timeline}
+	}
+}
+
+func newFollowersSource(api *apiClient, u *twitter.User) Source {
+	return &followersSource{t: &twitterClient{api: api, u: u}}
+}
+
+// accountSourcePrefixes are the prefixes of the source IDs which are followed
+// by the ID of the account whose credentials received the message.
+var accountSourcePrefixes = []string{"tl", "at", "us", "lk", "fl", "archive"}
+
+// AccountSources returns the source IDs of the messages received on behalf of
+// the Twitter account id, which are the ones its owner is allowed to see.
+func AccountSources(id int64) []string {
+	var sources []string
+	for _, p := range accountSourcePrefixes {
+		sources = append(sources, p+":"+strconv.FormatInt(id, 10))
+	}
+	return sources
+}
@@ -0,0 +1,36 @@
+package covfefe
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunUnknownSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "covfefe-creds")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "creds.json")
+
+	for _, tc := range []struct {
+		creds, unknown string
+	}{
+		{`"Accounts": [{"TOKEN": "t1", "SOURCES": ["home", "mentoins"]}]`, `"mentoins"`},
+		{`"MASTODON": [{"INSTANCE": "https://example.com", "SOURCES": ["home", "notification"]}]`, `"notification"`},
+		// Twitter and Mastodon source names are not interchangeable.
+		{`"MASTODON": [{"INSTANCE": "https://example.com", "SOURCES": ["likes"]}]`, `"likes"`},
+	} {
+		if err := ioutil.WriteFile(path, []byte(`{"API_KEY": "key", `+tc.creds+`}`), 0644); err != nil {
+			t.Fatal(err)
+		}
+		// Run must fail before touching the database or the network.
+		err := Run(filepath.Join(dir, "missing", "twitter.db"), dir, OpenCredentials(path, nil))
+		if err == nil || !strings.Contains(err.Error(), tc.unknown) {
+			t.Errorf("%s: got %v, expected an error about %s", tc.creds, err, tc.unknown)
+		}
+	}
+}
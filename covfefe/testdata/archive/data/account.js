@@ -0,0 +1,10 @@
+window.YTD.account.part0 = [ {
+  "account" : {
+    "email" : "u1@example.com",
+    "createdVia" : "web",
+    "username" : "u1",
+    "accountId" : "1",
+    "createdAt" : "2009-06-18T00:00:00.000Z",
+    "accountDisplayName" : "User One"
+  }
+} ]
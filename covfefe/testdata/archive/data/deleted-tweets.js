@@ -0,0 +1,9 @@
+window.YTD.deleted_tweets.part0 = [ {
+  "tweet" : {
+    "id_str" : "13",
+    "created_at" : "Wed Jan 02 10:03:00 +0000 2019",
+    "deleted_at" : "Thu Jan 03 10:00:00 +0000 2019",
+    "full_text" : "regrets",
+    "entities" : { }
+  }
+} ]
@@ -0,0 +1,6 @@
+window.YTD.like.part0 = [ {
+  "like" : {
+    "tweetId" : "30",
+    "fullText" : "a liked tweet"
+  }
+} ]
@@ -0,0 +1,21 @@
+window.YTD.tweets.part0 = [ {
+  "tweet" : {
+    "id_str" : "10",
+    "created_at" : "Wed Jan 02 10:00:00 +0000 2019",
+    "full_text" : "an archived aardvark",
+    "entities" : { }
+  }
+}, {
+  "tweet" : {
+    "id_str" : "11",
+    "created_at" : "Wed Jan 02 10:01:00 +0000 2019",
+    "full_text" : "@u2 a reply with a picture",
+    "in_reply_to_status_id_str" : "5",
+    "entities" : {
+      "media" : [ {
+        "id_str" : "20",
+        "media_url_https" : "https://pbs.twimg.com/media/pic.png"
+      } ]
+    }
+  }
+} ]
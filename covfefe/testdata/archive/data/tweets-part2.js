@@ -0,0 +1,8 @@
+window.YTD.tweets.part1 = [ {
+  "tweet" : {
+    "id_str" : "12",
+    "created_at" : "Wed Jan 02 10:02:00 +0000 2019",
+    "full_text" : "from the second part",
+    "entities" : { }
+  }
+} ]
@@ -0,0 +1,180 @@
+package covfefe
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"crawshaw.io/sqlite"
+	"crawshaw.io/sqlite/sqlitex"
+	"github.com/pkg/errors"
+)
+
+// maxThreadDepth bounds the walk of the Threads graph, in case of loops.
+const maxThreadDepth = 1000
+
+// A ThreadTweet is a tweet in the conversation returned by Thread.
+type ThreadTweet struct {
+	ID int64
+
+	// Depth is negative for ancestors, zero for the requested tweet, and
+	// positive for descendants.
+	Depth int
+	// Kind is how the tweet relates to Parent, "reply" or "quote", for
+	// descendants.
+	Kind   string
+	Parent int64
+
+	// Missing is true if the tweet is only known as a parent, and the rest of
+	// the fields are empty.
+	Missing bool
+	User    int64
+	Handle  string
+	Text    string
+	Created string
+	// Deleted is the time the deletion was received, if the tweet was
+	// deleted.
+	Deleted string
+}
+
+// Thread returns the conversation around the tweet with the given ID: the
+// chain of tweets it replies to, oldest first, the tweet itself, and then all
+// known replies and quotes of it, depth-first.
+func Thread(conn *sqlite.Conn, id int64) ([]ThreadTweet, error) {
+	seen := map[int64]bool{id: true}
+
+	var ancestors []ThreadTweet
+	for parent := id; len(ancestors) < maxThreadDepth; {
+		var found bool
+		if err := sqlitex.Exec(conn, `SELECT parent FROM Threads
+			WHERE tweet = ? AND kind = 'reply' LIMIT 1;`,
+			func(stmt *sqlite.Stmt) error {
+				parent, found = stmt.GetInt64("parent"), true
+				return nil
+			}, parent); err != nil {
+			return nil, errors.Wrap(err, "failed to query parent")
+		}
+		if !found || seen[parent] {
+			break
+		}
+		seen[parent] = true
+		ancestors = append(ancestors, ThreadTweet{ID: parent})
+	}
+
+	thread := make([]ThreadTweet, 0, len(ancestors)+1)
+	for i := len(ancestors) - 1; i >= 0; i-- {
+		ancestors[i].Depth = -1 - i
+		thread = append(thread, ancestors[i])
+	}
+	thread = append(thread, ThreadTweet{ID: id})
+
+	var walk func(parent int64, depth int) error
+	walk = func(parent int64, depth int) error {
+		if depth > maxThreadDepth {
+			return nil
+		}
+		var children []ThreadTweet
+		if err := sqlitex.Exec(conn, `SELECT tweet, kind FROM Threads
+			WHERE parent = ? ORDER BY tweet;`,
+			func(stmt *sqlite.Stmt) error {
+				children = append(children, ThreadTweet{
+					ID: stmt.GetInt64("tweet"), Kind: stmt.GetText("kind"),
+					Parent: parent, Depth: depth,
+				})
+				return nil
+			}, parent); err != nil {
+			return errors.Wrap(err, "failed to query replies")
+		}
+		for _, child := range children {
+			if seen[child.ID] {
+				continue
+			}
+			seen[child.ID] = true
+			thread = append(thread, child)
+			if err := walk(child.ID, depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(id, 1); err != nil {
+		return nil, err
+	}
+
+	for i := range thread {
+		if err := loadThreadTweet(conn, &thread[i]); err != nil {
+			return nil, err
+		}
+	}
+	return thread, nil
+}
+
+func loadThreadTweet(conn *sqlite.Conn, t *ThreadTweet) error {
+	t.Missing = true
+	return errors.Wrap(sqlitex.Exec(conn, `SELECT Tweets.user, Tweets.created, Messages.json,
+			(SELECT received FROM Messages AS Deletions WHERE Deletions.id = Tweets.deleted),
+			(SELECT handle FROM Users WHERE Users.id = Tweets.user
+				ORDER BY first_seen DESC LIMIT 1)
+		FROM Tweets JOIN Messages ON Messages.id = Tweets.message
+		WHERE Tweets.id = ?;`,
+		func(stmt *sqlite.Stmt) error {
+			t.Missing = false
+			t.User = stmt.ColumnInt64(0)
+			t.Created = stmt.ColumnText(1)
+			t.Text = messageTweetText([]byte(stmt.ColumnText(2)), t.ID)
+			t.Deleted = stmt.ColumnText(3)
+			t.Handle = stmt.ColumnText(4)
+			return nil
+		}, t.ID), "failed to query tweet")
+}
+
+// messageTweetText finds the text of the tweet with the given ID in a message,
+// where it might be nested as a retweet, quote, user status or event target,
+// or be an archive tweet.
+func messageTweetText(msg []byte, id int64) string {
+	return jsonTweetText(messageTweet(msg, id))
+}
+
+// messageTweet finds the JSON object of the tweet with the given ID in a
+// message, or returns nil.
+func messageTweet(msg []byte, id int64) map[string]interface{} {
+	var v interface{}
+	if err := json.Unmarshal(msg, &v); err != nil {
+		return nil
+	}
+	idStr := strconv.FormatInt(id, 10)
+	var find func(v interface{}) map[string]interface{}
+	find = func(v interface{}) map[string]interface{} {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			if v["id_str"] == idStr {
+				return v
+			}
+			for _, v := range v {
+				if t := find(v); t != nil {
+					return t
+				}
+			}
+		case []interface{}:
+			for _, v := range v {
+				if t := find(v); t != nil {
+					return t
+				}
+			}
+		}
+		return nil
+	}
+	return find(v)
+}
+
+func jsonTweetText(tweet map[string]interface{}) string {
+	if ext, ok := tweet["extended_tweet"].(map[string]interface{}); ok {
+		if text, ok := ext["full_text"].(string); ok {
+			return text
+		}
+	}
+	if text, ok := tweet["full_text"].(string); ok {
+		return text
+	}
+	text, _ := tweet["text"].(string)
+	return text
+}
@@ -0,0 +1,85 @@
+package covfefe
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"crawshaw.io/sqlite"
+)
+
+func testTweet(id, user, replyTo int64, text, extra string) *Message {
+	return &Message{source: "h:1", kind: "tweet", msg: []byte(fmt.Sprintf(`{"id": %d, "id_str": "%d",
+		"created_at": "Wed Jan 02 10:%02d:00 +0000 2019", "full_text": %q,
+		"in_reply_to_status_id": %d, "user": {"id": %d, "screen_name": "u%d"}%s}`,
+		id, id, id, text, replyTo, user, user, extra))}
+}
+
+func TestThread(t *testing.T) {
+	c, _, cleanup := newTestCovfefe(t)
+	defer cleanup()
+	c.rescan = true // Don't queue parent fetches.
+
+	c.Handle(testTweet(1, 1, 0, "root", ""))
+	c.Handle(testTweet(2, 2, 1, "reply", ""))
+	c.Handle(testTweet(3, 3, 2, "reply to reply", ""))
+	c.Handle(testTweet(4, 4, 0, "quote", `, "quoted_status_id": 2`))
+	c.Handle(testTweet(5, 5, 1, "sibling", ""))
+	c.Handle(testTweet(6, 6, 99, "orphan", ""))
+	c.Handle(&Message{source: "h:1", kind: "del", msg: []byte(`{"id": 3}`)})
+
+	thread := func(id int64) []ThreadTweet {
+		var thread []ThreadTweet
+		if err := c.withConn(func(conn *sqlite.Conn) (err error) {
+			thread, err = Thread(conn, id)
+			return err
+		}); err != nil {
+			t.Fatal(err)
+		}
+		return thread
+	}
+
+	got := thread(2)
+	type summary struct {
+		ID      int64
+		Depth   int
+		Kind    string
+		Text    string
+		Deleted bool
+	}
+	var gotSummary []summary
+	for _, tt := range got {
+		gotSummary = append(gotSummary, summary{tt.ID, tt.Depth, tt.Kind, tt.Text, tt.Deleted != ""})
+	}
+	if exp := []summary{
+		{1, -1, "", "root", false},
+		{2, 0, "", "reply", false},
+		{3, 1, "reply", "reply to reply", true},
+		{4, 1, "quote", "quote", false},
+	}; !reflect.DeepEqual(gotSummary, exp) {
+		t.Errorf("Thread(2) = %+v, expected %+v", gotSummary, exp)
+	}
+	if got[0].Handle != "u1" {
+		t.Errorf("root handle is %q", got[0].Handle)
+	}
+
+	got = thread(6)
+	if len(got) != 2 || got[0].ID != 99 || !got[0].Missing || got[0].Depth != -1 || got[1].Missing {
+		t.Errorf("Thread(6) = %+v", got)
+	}
+}
+
+func TestMessageTweetText(t *testing.T) {
+	msg := []byte(`{"id_str": "10", "text": "RT @a: hello",
+		"retweeted_status": {"id_str": "9", "text": "hello…",
+			"extended_tweet": {"full_text": "hello world"}}}`)
+	if text := messageTweetText(msg, 9); text != "hello world" {
+		t.Errorf("retweeted text = %q", text)
+	}
+	if text := messageTweetText(msg, 10); text != "RT @a: hello" {
+		t.Errorf("text = %q", text)
+	}
+	if text := messageTweetText(msg, 11); text != "" {
+		t.Errorf("missing tweet text = %q", text)
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"net/http"
 	"time"
 
 	"github.com/dghubble/go-twitter/twitter"
@@ -12,68 +11,64 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
-func getJSON(ctx context.Context, c *http.Client, url string, v interface{}) error {
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return err
-	}
-	r, err := c.Do(req.WithContext(ctx))
-	if err != nil {
-		return errors.Wrapf(err, "error getting %s", url)
-	}
-	defer r.Body.Close()
-
-	if r.StatusCode != http.StatusOK {
-		var errs struct {
-			Errors []struct {
-				Message string
-			}
-		}
-		json.NewDecoder(r.Body).Decode(&errs)
-		for _, e := range errs.Errors {
-			return errors.Errorf("error getting %s: %s", url, e.Message)
-		}
-		return errors.Errorf("error getting %s: %s", url, r.Status)
-	}
-
-	return errors.Wrapf(json.NewDecoder(r.Body).Decode(v),
-		"error reading and decoding %q", url)
-}
-
-func verifyCredentials(ctx context.Context, c *http.Client) (*twitter.User, error) {
+func verifyCredentials(ctx context.Context, api *apiClient) (*twitter.User, error) {
 	url := "https://api.twitter.com/1.1/account/verify_credentials.json?skip_status=true"
 	var u *twitter.User
-	if err := getJSON(ctx, c, url, &u); err != nil {
+	if err := api.tryGetJSON(ctx, url, &u); err != nil {
 		return nil, err
 	}
 	return u, nil
 }
 
 type twitterClient struct {
-	c *http.Client
-	m chan *Message
-	u *twitter.User
+	api *apiClient
+	u   *twitter.User
+}
+
+// timelineSource is a Source that follows one of the timelines understood by
+// followTimeline for the authenticated user.
+type timelineSource struct {
+	t        *twitterClient
+	timeline string
+}
+
+func (s *timelineSource) Run(ctx context.Context, m chan<- *Message) error {
+	return s.t.followTimeline(ctx, s.timeline, m)
+}
+
+// followersSource is a Source that fetches all followers of the authenticated
+// user once a day.
+type followersSource struct {
+	t *twitterClient
+}
+
+func (s *followersSource) Run(ctx context.Context, m chan<- *Message) error {
+	log := logrus.WithFields(logrus.Fields{
+		"account": s.t.u.ScreenName, "id": s.t.u.ID,
+	})
+	for {
+		if err := s.t.fetchFollowers(ctx, s.t.u.ID, m); err != nil {
+			return err
+		}
+		log.Debug("Starting over fetching followers")
+		if err := waitAlive(ctx, 24*time.Hour); err != nil {
+			return err
+		}
+	}
 }
 
-func (t *twitterClient) fetchFollowers(ctx context.Context, followed int64) error {
+func (t *twitterClient) fetchFollowers(ctx context.Context, followed int64, m chan<- *Message) error {
 	log := logrus.WithFields(logrus.Fields{
 		"account": t.u.ScreenName, "followed": followed,
 	})
 
 	source := fmt.Sprintf("fl:%d", followed)
+	snapshot := &followerSnapshot{Followed: followed}
 
-	interval := 1*time.Minute + 5*time.Second
-	tick := time.NewTicker(interval)
-	defer tick.Stop()
-
+	// The rate limit is 15 requests per 15 minutes, so the api client spaces
+	// out the pages.
 	var cursor int64 = -1
 	for cursor != 0 {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		case <-tick.C:
-		}
-
 		url := "https://api.twitter.com/1.1/followers/list.json?cursor=%d&user_id=%d&count=200&tweet_mode=extended"
 		url = fmt.Sprintf(url, cursor, followed)
 
@@ -81,18 +76,8 @@ func (t *twitterClient) fetchFollowers(ctx context.Context, followed int64) erro
 			Users      []json.RawMessage
 			NextCursor int64 `json:"next_cursor"`
 		}
-		const maxRetry = 4
-		for retry := 0; retry <= maxRetry; retry++ {
-			if err := getJSON(ctx, t.c, url, &result); err != nil {
-				if retry == maxRetry {
-					return err
-				} else {
-					log.WithField("retry", retry).WithError(err).Error("Failed to fetch timeline")
-					time.Sleep(interval)
-					continue
-				}
-			}
-			break
+		if err := t.api.getJSON(ctx, url, &result); err != nil {
+			return err
 		}
 
 		log.WithFields(logrus.Fields{
@@ -100,79 +85,87 @@ func (t *twitterClient) fetchFollowers(ctx context.Context, followed int64) erro
 		}).Debug("Fetched followers")
 
 		for _, user := range result.Users {
-			t.m <- &Message{source: source, kind: "follower", msg: user}
+			var u struct {
+				ID int64 `json:"id"`
+			}
+			if err := json.Unmarshal(user, &u); err == nil {
+				snapshot.Followers = append(snapshot.Followers, u.ID)
+			}
+			select {
+			case m <- &Message{source: source, kind: "follower", msg: user}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
 		}
 		cursor = result.NextCursor
 	}
+
+	// Only a complete pass can tell who unfollowed.
+	snapshot.Time = time.Now().UTC()
+	msg, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	select {
+	case m <- &Message{source: source, kind: "follower-snapshot", msg: msg}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 	return nil
 }
 
-func (t *twitterClient) followTimeline(ctx context.Context, timeline string) error {
+func (t *twitterClient) followTimeline(ctx context.Context, timeline string, m chan<- *Message) error {
 	log := logrus.WithFields(logrus.Fields{
 		"account": t.u.ScreenName, "timeline": timeline,
 	})
 
 	var (
-		interval time.Duration
 		source   string
 		endpoint string
 	)
 	switch timeline {
 	case "home":
-		interval = 1*time.Minute + 5*time.Second
 		source = fmt.Sprintf("tl:%d", t.u.ID)
 		endpoint = "statuses/home_timeline"
 	case "mentions":
-		interval = 15 * time.Second
 		source = fmt.Sprintf("at:%d", t.u.ID)
 		endpoint = "statuses/mentions_timeline"
 	case "user":
-		interval = 10 * time.Second
 		source = fmt.Sprintf("us:%d", t.u.ID)
 		endpoint = "statuses/user_timeline"
 	case "likes":
-		interval = 15 * time.Second
 		source = fmt.Sprintf("lk:%d", t.u.ID)
 		endpoint = "favorites/list"
 	default:
 		return errors.Errorf("unknown timeline %q", timeline)
 	}
 
-	tick := time.NewTicker(interval)
-	defer tick.Stop()
-
+	// There's no fixed polling interval: getJSON spreads the requests to each
+	// endpoint over its rate limit window, so every timeline is polled as
+	// often as its own limit allows.
 	var sinceID uint64
 	for {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		case <-tick.C:
-		}
-
 		url := "https://api.twitter.com/1.1/%s.json?count=200&tweet_mode=extended"
 		url = fmt.Sprintf(url, endpoint)
 		if sinceID != 0 { // Twitter hates devs.
 			url = fmt.Sprintf("%s&since_id=%d", url, sinceID)
 		}
+		// getJSON waits for the rate limit and retries transient errors, so
+		// this only fails if something is really wrong, like revoked
+		// credentials, or if ctx is done.
 		var tweets []json.RawMessage
-		const maxRetry = 4
-		for retry := 0; retry <= maxRetry; retry++ {
-			if err := getJSON(ctx, t.c, url, &tweets); err != nil {
-				if retry == maxRetry {
-					return err
-				} else {
-					log.WithField("retry", retry).WithError(err).Error("Failed to fetch timeline")
-					time.Sleep(60 * time.Second)
-					continue
-				}
-			}
-			break
+		if err := t.api.getJSON(ctx, url, &tweets); err != nil {
+			return err
 		}
 
 		log.WithField("tweets", len(tweets)).Debug("Fetched timeline")
 
 		for _, tweet := range tweets {
-			t.m <- &Message{source: source, kind: "tweet", msg: tweet}
+			select {
+			case m <- &Message{source: source, kind: "tweet", msg: tweet}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
 		}
 
 		if len(tweets) > 0 {
@@ -202,7 +195,7 @@ func (c *Covfefe) hydrateTweet(ctx context.Context, id int64) ([]byte, error) {
 		"&include_ext_alt_text=true&tweet_mode=extended"
 	url = fmt.Sprintf(url, id)
 	var tweet json.RawMessage
-	if err := getJSON(ctx, c.httpClient, url, &tweet); err != nil {
+	if err := c.api.tryGetJSON(ctx, url, &tweet); err != nil {
 		return nil, err
 	}
 	return tweet, nil
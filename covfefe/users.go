@@ -0,0 +1,170 @@
+package covfefe
+
+import (
+	"encoding/json"
+	"time"
+
+	"crawshaw.io/sqlite"
+	"crawshaw.io/sqlite/sqlitex"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// followerSnapshot is the message stored at the end of a complete pass of
+// fetchFollowers. Follows and unfollows are derived by diffing consecutive
+// snapshots of the same account.
+type followerSnapshot struct {
+	Followed  int64     `json:"followed"`
+	Followers []int64   `json:"followers"`
+	Time      time.Time `json:"time"`
+}
+
+func (c *Covfefe) processFollowerSnapshot(id int64, snapshot *followerSnapshot) {
+	log := log.WithFields(log.Fields{"message": id, "followed": snapshot.Followed})
+
+	var previous int64
+	var previousJSON []byte
+	err := c.withConn(func(conn *sqlite.Conn) (err error) {
+		defer sqlitex.Save(conn)(&err)
+
+		err = sqlitex.Exec(conn, `INSERT INTO FollowerSnapshots (message, followed, taken, followers)
+			VALUES (?, ?, ?, ?);`, nil, id, snapshot.Followed, snapshot.Time, len(snapshot.Followers))
+		if sqlite.ErrCode(err) == sqlite.SQLITE_CONSTRAINT_PRIMARYKEY {
+			return nil // Already processed.
+		}
+		if err != nil {
+			return err
+		}
+
+		return sqlitex.Exec(conn, `SELECT Messages.id, Messages.json
+			FROM FollowerSnapshots JOIN Messages ON Messages.id = FollowerSnapshots.message
+			WHERE followed = ? AND message < ? ORDER BY message DESC LIMIT 1;`,
+			func(stmt *sqlite.Stmt) error {
+				previous = stmt.GetInt64("id")
+				previousJSON = []byte(stmt.GetText("json"))
+				return nil
+			}, snapshot.Followed, id)
+	})
+	if err != nil {
+		log.WithError(err).Error("Failed to insert follower snapshot")
+		return
+	}
+	if previous == 0 {
+		// The first snapshot is the baseline.
+		return
+	}
+
+	prev := new(followerSnapshot)
+	if err := json.Unmarshal(previousJSON, prev); err != nil {
+		log.WithError(err).WithField("previous", previous).Error("Failed to unmarshal previous snapshot")
+		return
+	}
+	old := make(map[int64]bool)
+	for _, f := range prev.Followers {
+		old[f] = true
+	}
+	new := make(map[int64]bool)
+	for _, f := range snapshot.Followers {
+		new[f] = true
+		if !old[f] {
+			c.insertFollowEvent(f, snapshot.Followed, "follow", id, previous)
+		}
+	}
+	for _, f := range prev.Followers {
+		if !new[f] {
+			c.insertFollowEvent(f, snapshot.Followed, "unfollow", id, previous)
+		}
+	}
+}
+
+// A UserReport is the history of a user, as rendered by webfefe.
+type UserReport struct {
+	ID       int64
+	Profiles []UserProfile
+	// Followers are the changes to the followers of the user, which are
+	// only tracked for accounts we have credentials for.
+	Followers []FollowEvent
+	// Following are the changes to which tracked accounts the user follows.
+	Following []FollowEvent
+	// Tweets are the latest tweets by the user.
+	Tweets []ThreadTweet
+}
+
+// A UserProfile is a distinct combination of profile fields.
+type UserProfile struct {
+	Handle, Name, Bio string
+	// Seen is when the combination was first received.
+	Seen string
+}
+
+// A FollowEvent is a follow or unfollow detected between two snapshots.
+type FollowEvent struct {
+	Follower, Followed int64
+	// Handle is the latest handle of the other side of the edge.
+	Handle string
+	Kind   string
+	// Since and Until are the times of the snapshots the change happened
+	// between.
+	Since, Until string
+}
+
+// UserHistory returns the profile changes, follower changes and latest tweets
+// of the user with the given ID.
+func UserHistory(conn *sqlite.Conn, id int64) (*UserReport, error) {
+	r := &UserReport{ID: id}
+
+	if err := sqlitex.Exec(conn, `SELECT handle, name, bio, Messages.received
+		FROM Users JOIN Messages ON Messages.id = Users.first_seen
+		WHERE Users.id = ? ORDER BY first_seen;`,
+		func(stmt *sqlite.Stmt) error {
+			r.Profiles = append(r.Profiles, UserProfile{
+				Handle: stmt.ColumnText(0), Name: stmt.ColumnText(1),
+				Bio: stmt.ColumnText(2), Seen: stmt.ColumnText(3),
+			})
+			return nil
+		}, id); err != nil {
+		return nil, errors.Wrap(err, "failed to query profiles")
+	}
+
+	events := func(column, other string) ([]FollowEvent, error) {
+		var events []FollowEvent
+		err := sqlitex.Exec(conn, `SELECT follower, followed, kind,
+				(SELECT taken FROM FollowerSnapshots WHERE message = previous),
+				(SELECT taken FROM FollowerSnapshots WHERE message = snapshot),
+				(SELECT handle FROM Users WHERE Users.id = FollowEvents.`+other+`
+					ORDER BY first_seen DESC LIMIT 1)
+			FROM FollowEvents WHERE `+column+` = ? ORDER BY snapshot DESC, rowid;`,
+			func(stmt *sqlite.Stmt) error {
+				events = append(events, FollowEvent{
+					Follower: stmt.ColumnInt64(0), Followed: stmt.ColumnInt64(1),
+					Kind: stmt.ColumnText(2), Since: stmt.ColumnText(3),
+					Until: stmt.ColumnText(4), Handle: stmt.ColumnText(5),
+				})
+				return nil
+			}, id)
+		return events, errors.Wrap(err, "failed to query follow events")
+	}
+	var err error
+	if r.Followers, err = events("followed", "follower"); err != nil {
+		return nil, err
+	}
+	if r.Following, err = events("follower", "followed"); err != nil {
+		return nil, err
+	}
+
+	if err := sqlitex.Exec(conn, `SELECT id FROM Tweets
+		WHERE user = ? ORDER BY created DESC LIMIT 100;`,
+		func(stmt *sqlite.Stmt) error {
+			r.Tweets = append(r.Tweets, ThreadTweet{ID: stmt.GetInt64("id")})
+			return nil
+		}, id); err != nil {
+		return nil, errors.Wrap(err, "failed to query tweets")
+	}
+	for i := range r.Tweets {
+		if err := loadThreadTweet(conn, &r.Tweets[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
@@ -0,0 +1,70 @@
+package covfefe
+
+import (
+	"reflect"
+	"testing"
+
+	"crawshaw.io/sqlite"
+)
+
+func TestUserHistory(t *testing.T) {
+	c, _, cleanup := newTestCovfefe(t)
+	defer cleanup()
+
+	for _, m := range []*Message{
+		{source: "fl:1", kind: "follower", msg: []byte(`{"id": 3, "screen_name": "carol", "name": "Carol"}`)},
+		{source: "fl:1", kind: "follower", msg: []byte(`{"id": 4, "screen_name": "dave", "name": "Dave"}`)},
+		{source: "fl:1", kind: "follower-snapshot", msg: []byte(
+			`{"followed": 1, "followers": [3, 4], "time": "2019-01-01T00:00:00Z"}`)},
+		{source: "fl:1", kind: "follower", msg: []byte(`{"id": 4, "screen_name": "dave", "name": "Dave"}`)},
+		{source: "fl:1", kind: "follower", msg: []byte(`{"id": 5, "screen_name": "erin", "name": "Erin"}`)},
+		{source: "fl:1", kind: "follower-snapshot", msg: []byte(
+			`{"followed": 1, "followers": [4, 5], "time": "2019-01-02T00:00:00Z"}`)},
+		{source: "fl:1", kind: "follower-snapshot", msg: []byte(
+			`{"followed": 1, "followers": [4, 5], "time": "2019-01-03T00:00:00Z"}`)},
+		{source: "h:1", kind: "tweet", msg: []byte(`{"id": 30, "id_str": "30",
+			"created_at": "Wed Jan 02 10:00:00 +0000 2019", "full_text": "hi",
+			"user": {"id": 3, "screen_name": "carol_", "name": "Carol (away)"}}`)},
+	} {
+		c.Handle(m)
+	}
+
+	events := queryStrings(t, c, `SELECT kind || ' ' || follower || ' ' || followed
+		FROM FollowEvents ORDER BY rowid`)
+	if exp := []string{"follow 5 1", "unfollow 3 1"}; !reflect.DeepEqual(events, exp) {
+		t.Errorf("FollowEvents = %v, expected %v", events, exp)
+	}
+
+	report := func(id int64) *UserReport {
+		var r *UserReport
+		if err := c.withConn(func(conn *sqlite.Conn) (err error) {
+			r, err = UserHistory(conn, id)
+			return err
+		}); err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+
+	carol := report(3)
+	var handles []string
+	for _, p := range carol.Profiles {
+		handles = append(handles, p.Handle)
+	}
+	if exp := []string{"carol", "carol_"}; !reflect.DeepEqual(handles, exp) {
+		t.Errorf("carol's handles = %v, expected %v", handles, exp)
+	}
+	if len(carol.Following) != 1 || carol.Following[0].Kind != "unfollow" ||
+		carol.Following[0].Followed != 1 || carol.Following[0].Since != "2019-01-01 00:00:00 +0000 UTC" {
+		t.Errorf("carol's follows = %+v", carol.Following)
+	}
+	if len(carol.Tweets) != 1 || carol.Tweets[0].Text != "hi" {
+		t.Errorf("carol's tweets = %+v", carol.Tweets)
+	}
+
+	followed := report(1)
+	if len(followed.Followers) != 2 || followed.Followers[0].Handle != "erin" ||
+		followed.Followers[1].Handle != "carol_" {
+		t.Errorf("followers changes = %+v", followed.Followers)
+	}
+}
@@ -0,0 +1,288 @@
+// Package attacks implements some of the cryptopals attacks against oracles
+// that can be backed by real targets, like HTTP endpoints or programs.
+//
+// Oracles return an error when they fail to get an answer from the target,
+// which stops the attack.
+package attacks
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// An EncryptionOracle returns the target's encryption of msg, possibly
+// together with secret data.
+type EncryptionOracle func(msg []byte) ([]byte, error)
+
+// A ValidityOracle reports whether the target accepts msg, for example because
+// it's a ciphertext with valid padding.
+type ValidityOracle func(msg []byte) (bool, error)
+
+func detectECB(in []byte, blockSize int) bool {
+	seen := make(map[string]struct{})
+	for i := 0; i+blockSize <= len(in); i += blockSize {
+		val := string(in[i : i+blockSize])
+		if _, ok := seen[val]; ok {
+			return true
+		}
+		seen[val] = struct{}{}
+	}
+	return false
+}
+
+func mod(a, b int) int {
+	return (a%b + b) % b
+}
+
+// RecoverECBSuffix decrypts the secret that an ECB oracle appends to msg, by
+// aligning one unknown byte at a time at the end of a block. The 256 guesses
+// for each byte are queried concurrently, according to opts.
+func RecoverECBSuffix(oracle EncryptionOracle, opts *Options) ([]byte, error) {
+	whole := func(out []byte) string { return string(out) }
+
+	var bs int
+	for blockSize := 2; blockSize < 100; blockSize++ {
+		msg := bytes.Repeat([]byte{42}, blockSize*2)
+		msg = append(msg, 3)
+		out, err := opts.askEncrypt(oracle, msg, whole)
+		if err != nil {
+			return nil, err
+		}
+		if len(out) >= blockSize*2 && detectECB([]byte(out[:blockSize*2]), blockSize) {
+			bs = blockSize
+			break
+		}
+	}
+	if bs == 0 {
+		return nil, errors.New("didn't detect block size")
+	}
+	block := func(skip int) func([]byte) string {
+		return func(out []byte) string {
+			if len(out) < skip+bs {
+				return ""
+			}
+			return string(out[skip : skip+bs])
+		}
+	}
+
+	buildDict := func(known []byte) (map[string]byte, error) {
+		prefix := bytes.Repeat([]byte{42}, bs)
+		prefix = append(prefix, known...)
+		prefix = prefix[len(prefix)-bs+1:]
+
+		blocks := make([]string, 256)
+		_, err := opts.search(256, false, func(b int) (bool, error) {
+			msg := append(append([]byte{}, prefix...), byte(b))
+			out, err := opts.askEncrypt(oracle, msg, block(0))
+			blocks[b] = out
+			return false, err
+		})
+		if err != nil {
+			return nil, err
+		}
+		dict := make(map[string]byte)
+		for b, out := range blocks {
+			dict[out] = byte(b)
+		}
+		return dict, nil
+	}
+
+	empty, err := opts.askEncrypt(oracle, []byte{}, whole)
+	if err != nil {
+		return nil, err
+	}
+	var plaintext []byte
+	for i := 0; i < len(empty); i++ {
+		dict, err := buildDict(plaintext)
+		if err != nil {
+			return nil, err
+		}
+		msg := bytes.Repeat([]byte{42}, mod(bs-i-1, bs))
+		out, err := opts.askEncrypt(oracle, msg, block(i/bs*bs))
+		if err != nil {
+			return nil, err
+		}
+		c, ok := dict[out]
+		if !ok || out == "" {
+			// We ran into the padding, which changes as msg gets longer.
+			break
+		}
+		plaintext = append(plaintext, c)
+		opts.progress(plaintext)
+	}
+
+	if len(plaintext) > 0 && plaintext[len(plaintext)-1] == 1 {
+		plaintext = plaintext[:len(plaintext)-1]
+	}
+	return plaintext, nil
+}
+
+func ecbIndex(in []byte, bs int) int {
+	prev := in[:bs]
+	for i := 1; i < len(in)/bs; i++ {
+		if bytes.Equal(prev, in[i*bs:i*bs+bs]) {
+			return i*bs - bs
+		}
+		prev = in[i*bs : i*bs+bs]
+	}
+	return -1
+}
+
+// RecoverECBSuffixWithPrefix is like RecoverECBSuffix, but for an oracle that
+// also prepends to msg some bytes of constant length.
+func RecoverECBSuffixWithPrefix(oracle EncryptionOracle, opts *Options) ([]byte, error) {
+	whole := func(out []byte) string { return string(out) }
+
+	var bs, pl int
+	res, err := opts.askEncrypt(oracle, bytes.Repeat([]byte{42}, 500), whole)
+	if err != nil {
+		return nil, err
+	}
+	out := []byte(res)
+	for blockSize := 2; blockSize < 100; blockSize++ {
+		if len(out)%blockSize != 0 {
+			continue
+		}
+		i := ecbIndex(out, blockSize)
+		if i < 0 {
+			continue
+		}
+		bs = blockSize
+		for p := 0; p < bs; p++ {
+			msg := append(bytes.Repeat([]byte{42}, p+bs*2), 'X')
+			out, err := opts.askEncrypt(oracle, msg, whole)
+			if err != nil {
+				return nil, err
+			}
+			if len(out)%bs == 0 && ecbIndex([]byte(out), bs) == i {
+				pl = i - p
+				break
+			}
+		}
+		break
+	}
+	if bs == 0 || pl == 0 {
+		return nil, errors.New("didn't detect block or prefix size")
+	}
+
+	return RecoverECBSuffix(func(in []byte) ([]byte, error) {
+		p := bs - pl%bs
+		msg := append(bytes.Repeat([]byte{42}, p), in...)
+		out, err := oracle(msg)
+		if err != nil {
+			return nil, err
+		}
+		if len(out) < pl+p {
+			return nil, errors.New("short ciphertext from oracle")
+		}
+		return out[pl+p:], nil
+	}, opts)
+}
+
+// AttackCBCPaddingOracle decrypts ct, an IV followed by a CBC ciphertext
+// with 16-byte blocks, with an oracle that reports whether a message in the
+// same format decrypts to a correctly PKCS#7 padded plaintext. The padding is
+// left in place. The 256 guesses for each byte are queried concurrently,
+// according to opts.
+func AttackCBCPaddingOracle(ct []byte, oracle ValidityOracle, opts *Options) ([]byte, error) {
+	if len(ct)%16 != 0 || len(ct) < 32 {
+		return nil, errors.New("invalid ciphertext length")
+	}
+
+	// payload makes the last n = len(known)+1 bytes of block decrypt to n,
+	// if p is the byte that precedes known.
+	payload := func(iv, block, known []byte, p byte) []byte {
+		n := len(known) + 1
+		payload := make([]byte, 32)
+		copy(payload, iv)
+		copy(payload[16:], block)
+		payload[16-n] ^= p ^ byte(n)
+		for i, c := range known {
+			payload[16-n+1+i] ^= c ^ byte(n)
+		}
+		return payload
+	}
+
+	findNextByte := func(known, iv, block []byte) (byte, error) {
+		matches, err := opts.search(256, len(known) > 0, func(p int) (bool, error) {
+			return opts.askValid(oracle, payload(iv, block, known, byte(p)))
+		})
+		if err != nil {
+			return 0, err
+		}
+		if len(known) == 0 && len(matches) > 1 {
+			// The last byte can also produce a valid padding longer than one,
+			// which breaks if the byte before it changes.
+			var confirmed []int
+			for _, p := range matches {
+				msg := payload(iv, block, known, byte(p))
+				msg[14] ^= 1
+				valid, err := opts.askValid(oracle, msg)
+				if err != nil {
+					return 0, err
+				}
+				if valid {
+					confirmed = append(confirmed, p)
+				}
+			}
+			matches = confirmed
+		}
+		if len(matches) != 1 {
+			return 0, fmt.Errorf("%d guesses for byte %d of the block are valid", len(matches), 16-len(known))
+		}
+		return byte(matches[0]), nil
+	}
+
+	plaintext := make([]byte, len(ct)-16)
+	for start := len(ct) - 16; start >= 16; start -= 16 {
+		block, iv := ct[start:start+16], ct[start-16:start]
+		known := make([]byte, 16)
+		for n := 1; n <= 16; n++ {
+			c, err := findNextByte(known[16-n+1:], iv, block)
+			if err != nil {
+				return nil, err
+			}
+			known[16-n] = c
+			plaintext[start-16+16-n] = c
+			opts.progress(plaintext[start-16+16-n:])
+		}
+	}
+
+	return plaintext, nil
+}
+
+// AttackCompressionOracle recovers the n bytes that follow known in a secret
+// the oracle compresses together with msg, before encrypting with a stream
+// cipher. Guesses that match the secret compress better, and so produce
+// shorter ciphertexts. alphabet is the set of bytes to try, or all of them if
+// nil. The guesses are queried concurrently, according to opts.
+func AttackCompressionOracle(oracle EncryptionOracle, known []byte, n int, alphabet []byte, opts *Options) ([]byte, error) {
+	if alphabet == nil {
+		for i := 0; i < 256; i++ {
+			alphabet = append(alphabet, byte(i))
+		}
+	}
+	length := func(out []byte) string { return fmt.Sprint(len(out)) }
+	secret := append([]byte{}, known...)
+	target, err := opts.askEncrypt(oracle, secret, length)
+	if err != nil {
+		return nil, err
+	}
+	for len(secret) < len(known)+n {
+		matches, err := opts.search(len(alphabet), true, func(i int) (bool, error) {
+			guess := append(append([]byte{}, secret...), alphabet[i])
+			out, err := opts.askEncrypt(oracle, guess, length)
+			return out == target, err
+		})
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no guess for byte %d compresses", len(secret)-len(known)+1)
+		}
+		secret = append(secret, alphabet[matches[0]])
+		opts.progress(secret)
+	}
+	return secret[len(known):], nil
+}
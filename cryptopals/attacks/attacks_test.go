@@ -0,0 +1,558 @@
+package attacks
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"math/bits"
+	mathrand "math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/md4"
+)
+
+func padPKCS7(in []byte, size int) []byte {
+	n := size - len(in)%size
+	return append(append([]byte{}, in...), bytes.Repeat([]byte{byte(n)}, n)...)
+}
+
+func validPKCS7(in []byte) bool {
+	n := int(in[len(in)-1])
+	if n == 0 || n > len(in) {
+		return false
+	}
+	for _, c := range in[len(in)-n:] {
+		if int(c) != n {
+			return false
+		}
+	}
+	return true
+}
+
+func TestAttackCBCPaddingOracleHTTP(t *testing.T) {
+	key := make([]byte, 16)
+	rand.Read(key)
+	b, _ := aes.NewCipher(key)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		msg, err := hex.DecodeString(r.URL.Query().Get("c"))
+		if err != nil || len(msg) < 32 || len(msg)%16 != 0 {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		pt := make([]byte, len(msg)-16)
+		cipher.NewCBCDecrypter(b, msg[:16]).CryptBlocks(pt, msg[16:])
+		if !validPKCS7(pt) {
+			http.Error(w, "decryption failed", http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	}))
+	defer srv.Close()
+
+	plaintext := []byte("We all live in a yellow submarine")
+	ct := make([]byte, 16)
+	rand.Read(ct)
+	padded := padPKCS7(plaintext, 16)
+	ct = append(ct, make([]byte, len(padded))...)
+	cipher.NewCBCEncrypter(b, ct[:16]).CryptBlocks(ct[16:], padded)
+
+	oracle := &HTTPOracle{URL: srv.URL + "/?c=" + QueryPlaceholder, Encoding: "hex"}
+	res, err := AttackCBCPaddingOracle(ct, oracle.IsValid, &Options{Parallelism: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(res, padded) {
+		t.Errorf("recovered %q", res)
+	}
+
+	if _, err := AttackCBCPaddingOracle(ct, (&HTTPOracle{URL: "http://127.0.0.1:0/"}).IsValid, nil); err == nil {
+		t.Error("expected an error from an unreachable oracle")
+	}
+}
+
+func TestRecoverECBSuffixHTTP(t *testing.T) {
+	key := make([]byte, 16)
+	rand.Read(key)
+	b, _ := aes.NewCipher(key)
+	secret := []byte("Rollin' in my 5.0")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		msg, err := hex.DecodeString(string(body))
+		if err != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		pt := padPKCS7(append(msg, secret...), 16)
+		for i := 0; i < len(pt); i += 16 {
+			b.Encrypt(pt[i:], pt[i:])
+		}
+		fmt.Fprintln(w, hex.EncodeToString(pt))
+	}))
+	defer srv.Close()
+
+	oracle := &HTTPOracle{Method: "POST", URL: srv.URL, Body: QueryPlaceholder, Encoding: "hex"}
+	res, err := RecoverECBSuffix(oracle.Encrypt, &Options{Parallelism: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(res, secret) {
+		t.Errorf("recovered %q", res)
+	}
+}
+
+// noise decides, deterministically for each query and the number of times
+// it was asked, whether an oracle answers wrong (about 2% of the times) or
+// fails (about 5% of the times).
+type noise struct {
+	mu   sync.Mutex
+	seen map[string]int
+
+	inFlight, maxInFlight int
+}
+
+func (n *noise) roll(msg []byte) (wrong, fail bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.seen == nil {
+		n.seen = make(map[string]int)
+	}
+	n.seen[string(msg)]++
+	h := sha256.Sum256(append([]byte(fmt.Sprint(n.seen[string(msg)])), msg...))
+	return h[0] < 5, h[1] < 13
+}
+
+func (n *noise) enter() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.inFlight++
+	if n.inFlight > n.maxInFlight {
+		n.maxInFlight = n.inFlight
+	}
+}
+
+func (n *noise) exit() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.inFlight--
+}
+
+func TestAttackCBCPaddingOracleNoisy(t *testing.T) {
+	b, _ := aes.NewCipher([]byte("YELLOW SUBMARINE"))
+	n := &noise{}
+	oracle := func(msg []byte) (bool, error) {
+		n.enter()
+		defer n.exit()
+		time.Sleep(10 * time.Microsecond)
+		pt := make([]byte, len(msg)-16)
+		cipher.NewCBCDecrypter(b, msg[:16]).CryptBlocks(pt, msg[16:])
+		wrong, fail := n.roll(msg)
+		if fail {
+			return false, errors.New("connection reset")
+		}
+		return validPKCS7(pt) != wrong, nil
+	}
+
+	plaintext := []byte("I'm back and I'm ringin' the bell")
+	padded := padPKCS7(plaintext, 16)
+	ct := make([]byte, 16+len(padded))
+	cipher.NewCBCEncrypter(b, ct[:16]).CryptBlocks(ct[16:], padded)
+
+	var progress []byte
+	res, err := AttackCBCPaddingOracle(ct, oracle, &Options{
+		Parallelism: 8, Retries: 3, Votes: 7,
+		Progress: func(b []byte) { progress = append(progress[:0], b...) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(res, padded) {
+		t.Errorf("recovered %q", res)
+	}
+	if !bytes.Equal(progress, padded) {
+		t.Errorf("last progress was %q", progress)
+	}
+	if n.maxInFlight < 2 || n.maxInFlight > 8 {
+		t.Errorf("%d queries were in flight at once", n.maxInFlight)
+	}
+
+	if res, err := AttackCBCPaddingOracle(ct, oracle, nil); err == nil && bytes.Equal(res, padded) {
+		t.Error("attack without retries and votes succeeded against a noisy oracle")
+	}
+}
+
+func TestRecoverECBSuffixNoisy(t *testing.T) {
+	b, _ := aes.NewCipher([]byte("YELLOW SUBMARINE"))
+	secret := []byte("Rollin' in my 5.0")
+	n := &noise{}
+	oracle := func(msg []byte) ([]byte, error) {
+		pt := padPKCS7(append(msg, secret...), 16)
+		for i := 0; i < len(pt); i += 16 {
+			b.Encrypt(pt[i:], pt[i:])
+		}
+		wrong, fail := n.roll(msg)
+		if fail {
+			return nil, errors.New("connection reset")
+		}
+		if wrong {
+			pt[0] ^= 0xff
+		}
+		return pt, nil
+	}
+
+	res, err := RecoverECBSuffix(oracle, &Options{Parallelism: 8, Retries: 3, Votes: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(res, secret) {
+		t.Errorf("recovered %q", res)
+	}
+}
+
+// jitter returns a delay like network noise: mostly small, with a long tail.
+func jitter(r *mathrand.Rand) time.Duration {
+	d := time.Duration(r.ExpFloat64() * float64(200*time.Microsecond))
+	if r.Intn(20) == 0 {
+		d += 5 * time.Millisecond
+	}
+	return d
+}
+
+func TestTimingSlowest(t *testing.T) {
+	r := mathrand.New(mathrand.NewSource(1))
+	oracle := func(msg []byte) (time.Duration, error) {
+		d := time.Millisecond + jitter(r)
+		if msg[0] == 7 {
+			d += 400 * time.Microsecond
+		}
+		return d, nil
+	}
+	candidates := make([][]byte, 16)
+	for i := range candidates {
+		candidates[i] = []byte{byte(i)}
+	}
+	for _, test := range []TimingTest{BoxTest, MedianTest} {
+		tm := &Timing{Test: test, WarmUp: 10}
+		if c, err := tm.Slowest(oracle, candidates); err != nil || c != 7 {
+			t.Errorf("test %d: got %d, %v", test, c, err)
+		}
+	}
+
+	same := func(msg []byte) (time.Duration, error) {
+		return time.Millisecond + jitter(r), nil
+	}
+	candidates = make([][]byte, 256)
+	for i := range candidates {
+		candidates[i] = []byte{byte(i)}
+	}
+	for _, test := range []TimingTest{BoxTest, MedianTest} {
+		tm := &Timing{Test: test}
+		if c, err := tm.Slowest(same, candidates); err != ErrInconclusive {
+			t.Errorf("test %d: expected ErrInconclusive, got %d, %v", test, c, err)
+		}
+	}
+}
+
+func TestAttackTimingLeakHTTP(t *testing.T) {
+	secret := []byte{0x42, 0xf3}
+	var mu sync.Mutex
+	r := mathrand.New(mathrand.NewSource(1))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		d := jitter(r)
+		mu.Unlock()
+		time.Sleep(d)
+
+		sig, err := hex.DecodeString(req.URL.Query().Get("signature"))
+		if err != nil || len(sig) != len(secret) {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		for i := range sig {
+			time.Sleep(time.Millisecond)
+			if sig[i] != secret[i] {
+				http.Error(w, "invalid signature", http.StatusForbidden)
+				return
+			}
+		}
+		fmt.Fprintln(w, "ok")
+	}))
+	defer srv.Close()
+
+	oracle := &HTTPOracle{URL: srv.URL + "/?signature=" + QueryPlaceholder, Encoding: "hex"}
+	var progress []byte
+	res, err := AttackTimingLeak(oracle.Time, oracle.IsValid, len(secret), &Timing{
+		WarmUp:   20,
+		Progress: func(b []byte) { progress = append(progress[:0], b...) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(res, secret) {
+		t.Errorf("recovered %x", res)
+	}
+	if !bytes.Equal(progress, secret) {
+		t.Errorf("last progress was %x", progress)
+	}
+}
+
+func TestLeakageAnalysis(t *testing.T) {
+	r := mathrand.New(mathrand.NewSource(1))
+	timings := func(delta time.Duration) ([]int, []time.Duration) {
+		classes := make([]int, 100000)
+		times := make([]time.Duration, len(classes))
+		for i := range classes {
+			classes[i] = r.Intn(2)
+			times[i] = time.Microsecond + jitter(r)
+			if classes[i] == 1 {
+				times[i] += delta
+			}
+		}
+		return classes, times
+	}
+	lt := &LeakageTest{}
+
+	res := lt.analyze(timings(20 * time.Microsecond))
+	t.Logf("leaking: %v", res)
+	if !res.Leaks {
+		t.Error("leaking timings were not flagged")
+	}
+
+	res = lt.analyze(timings(0))
+	t.Logf("constant: %v", res)
+	if res.Leaks {
+		t.Error("constant timings were flagged")
+	}
+}
+
+func TestBatchGCD(t *testing.T) {
+	primes := make([]*big.Int, 8)
+	for i := range primes {
+		primes[i], _ = rand.Prime(rand.Reader, 64)
+	}
+	moduli := []*big.Int{
+		new(big.Int).Mul(primes[0], primes[1]),
+		new(big.Int).Mul(primes[2], primes[3]),
+		new(big.Int).Mul(primes[0], primes[4]),
+		new(big.Int).Mul(primes[5], primes[6]),
+		new(big.Int).Mul(primes[7], primes[2]),
+	}
+	expected := []*big.Int{primes[0], primes[2], primes[0], big.NewInt(1), primes[2]}
+	for i, g := range BatchGCD(moduli) {
+		if g.Cmp(expected[i]) != 0 {
+			t.Errorf("modulus %d: got %v, expected %v", i, g, expected[i])
+		}
+	}
+}
+
+func TestExtendSHA1(t *testing.T) {
+	key := []byte("YELLOW SUBMARINE!")
+	msg := []byte("comment1=cooking%20MCs;userdata=foo;comment2=%20like%20a%20pound%20of%20bacon")
+	mac := sha1.Sum(append(append([]byte{}, key...), msg...))
+	newMAC, newMsg, err := ExtendSHA1(mac[:], msg, []byte(";admin=true"), len(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := sha1.Sum(append(append([]byte{}, key...), newMsg...))
+	if !bytes.Equal(newMAC, expected[:]) {
+		t.Error("wrong MAC")
+	}
+	if !bytes.HasPrefix(newMsg, msg) || !bytes.HasSuffix(newMsg, []byte(";admin=true")) {
+		t.Errorf("wrong message %q", newMsg)
+	}
+}
+
+func TestExtendSHA2(t *testing.T) {
+	key := []byte("YELLOW SUBMARINE!")
+	ext := []byte(";admin=true")
+	for n := 0; n <= 300; n += 7 {
+		msg := bytes.Repeat([]byte("a"), n)
+		keyed := append(append([]byte{}, key...), msg...)
+
+		mac256 := sha256.Sum256(keyed)
+		newMAC, newMsg, err := ExtendSHA256(mac256[:], msg, ext, len(key))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h := sha256.Sum256(append(append([]byte{}, key...), newMsg...)); !bytes.Equal(newMAC, h[:]) {
+			t.Fatalf("wrong SHA-256 MAC for %d bytes", n)
+		}
+		if !bytes.HasPrefix(newMsg, msg) || !bytes.HasSuffix(newMsg, ext) {
+			t.Fatalf("wrong SHA-256 message for %d bytes", n)
+		}
+
+		mac512 := sha512.Sum512(keyed)
+		newMAC, newMsg, err = ExtendSHA512(mac512[:], msg, ext, len(key))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h := sha512.Sum512(append(append([]byte{}, key...), newMsg...)); !bytes.Equal(newMAC, h[:]) {
+			t.Fatalf("wrong SHA-512 MAC for %d bytes", n)
+		}
+		if !bytes.HasPrefix(newMsg, msg) || !bytes.HasSuffix(newMsg, ext) {
+			t.Fatalf("wrong SHA-512 message for %d bytes", n)
+		}
+	}
+	if _, _, err := ExtendSHA256(make([]byte, 20), nil, ext, 16); err == nil {
+		t.Error("ExtendSHA256 accepted a SHA-1 MAC")
+	}
+}
+
+func md4Hash(msg []byte) []byte {
+	h := md4.New()
+	h.Write(msg)
+	return h.Sum(nil)
+}
+
+func TestExtendMD4(t *testing.T) {
+	key := []byte("YELLOW SUBMARINE!")
+	msg := []byte("comment1=cooking%20MCs;userdata=foo;comment2=%20like%20a%20pound%20of%20bacon")
+	mac := md4Hash(append(append([]byte{}, key...), msg...))
+	newMAC, newMsg, err := ExtendMD4(mac, msg, []byte(";admin=true"), len(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(newMAC, md4Hash(append(append([]byte{}, key...), newMsg...))) {
+		t.Error("wrong MAC")
+	}
+	if !bytes.HasPrefix(newMsg, msg) || !bytes.HasSuffix(newMsg, []byte(";admin=true")) {
+		t.Errorf("wrong message %q", newMsg)
+	}
+}
+
+// reverseUint32Endian converts the message words printed in the Wang et al.
+// paper to bytes.
+func reverseUint32Endian(t *testing.T, s string) []byte {
+	msg, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < len(msg); i += 4 {
+		msg[i], msg[i+1], msg[i+2], msg[i+3] = msg[i+3], msg[i+2], msg[i+1], msg[i]
+	}
+	return msg
+}
+
+func TestWangConditions(t *testing.T) {
+	msg := make([]byte, 64)
+	rand.Read(msg)
+	s := md4Init
+	var X [16]uint32
+	for i := range X {
+		X[i] = binary.LittleEndian.Uint32(msg[i*4:])
+	}
+	a, b, c, d := s[0], s[1], s[2], s[3]
+	for i := 0; i < 16; i++ {
+		a = bits.RotateLeft32(a+(((c^d)&b)^d)+X[i], md4Shift1[i%4])
+		a, b, c, d = d, a, b, c
+	}
+	aa, bb, cc, dd := md4Round1(msg,
+		func(i int, a, b, c, d, m, s, a0 uint32) uint32 { return a })
+	if a != aa || b != bb || c != cc || d != dd {
+		t.Fatal("round function is wrong")
+	}
+
+	if checkWangConditions(msg) {
+		t.Fatal("check always returns true")
+	}
+	m1 := reverseUint32Endian(t, "4d7a9c8356cb927ab9d5a57857a7a5eede748a3"+
+		"cdcc366b3b683a0203b2a5d9fc69d71b3f9e99198d79f805ea63bb"+
+		"2e845dd8e3197e31fe52794bf08b9e8c3e9")
+	if h, _ := hex.DecodeString("4d7e6a1defa93d2dde05b45d864c429b"); !bytes.Equal(md4Hash(m1), h) {
+		t.Fatal("wrong hash for paper msg")
+	}
+	if !checkWangConditions(m1) {
+		t.Fatal("check false for paper msg")
+	}
+
+	enforceWangConditions(msg)
+	if !checkWangConditions(msg) {
+		t.Fatal("check false after enforcing")
+	}
+
+	m2 := reverseUint32Endian(t, "4d7a9c83d6cb927a29d5a57857a7a5eede748a3cdcc3"+
+		"66b3b683a0203b2a5d9fc69d71b3f9e99198d79f805ea63bb2e8"+
+		"45dc8e3197e31fe52794bf08b9e8c3e9")
+	wangSisterMsg(msg, m1)
+	if !bytes.Equal(m2, msg) {
+		t.Fatal("different sister message")
+	}
+}
+
+func TestFindMD4Collision(t *testing.T) {
+	m1, m2, err := FindMD4Collision(mathrand.New(mathrand.NewSource(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(m1, m2) || !bytes.Equal(md4Hash(m1), md4Hash(m2)) {
+		t.Fatalf("not a collision: %x %x", m1, m2)
+	}
+}
+
+// TestHelperProcess is not a real test: it's the program run by
+// TestCommandOracle. It prints its argument, or its input if none, reversed.
+func TestHelperProcess(t *testing.T) {
+	if os.Getenv("ATTACKS_HELPER_PROCESS") != "1" {
+		return
+	}
+	in := []byte(os.Args[len(os.Args)-1])
+	if in[0] == '-' {
+		in, _ = ioutil.ReadAll(os.Stdin)
+	}
+	for i, j := 0, len(in)-1; i < j; i, j = i+1, j-1 {
+		in[i], in[j] = in[j], in[i]
+	}
+	if bytes.Equal(in, []byte("liaf")) {
+		os.Exit(1)
+	}
+	os.Stdout.Write(in)
+	os.Exit(0)
+}
+
+func TestCommandOracle(t *testing.T) {
+	os.Setenv("ATTACKS_HELPER_PROCESS", "1")
+	defer os.Unsetenv("ATTACKS_HELPER_PROCESS")
+	helper := []string{os.Args[0], "-test.run=TestHelperProcess", "--"}
+
+	o := &CommandOracle{Args: append(helper, QueryPlaceholder)}
+	if out, err := o.Encrypt([]byte("hello")); err != nil {
+		t.Fatal(err)
+	} else if string(out) != "olleh" {
+		t.Errorf("got %q from the arguments", out)
+	}
+	if ok, err := o.IsValid([]byte("fail")); err != nil || ok {
+		t.Errorf("failing command accepted: %v, %v", ok, err)
+	}
+	if _, err := o.Encrypt([]byte("fail")); err == nil {
+		t.Error("expected an error from a failing command")
+	}
+
+	o = &CommandOracle{Args: append(helper, "-"), Encoding: "hex",
+		Accept: regexp.MustCompile("^cb")}
+	if out, err := o.Encrypt([]byte{0xab, 0xcd}); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(out, []byte{0xdc, 0xba}) {
+		t.Errorf("got %x from the standard input", out)
+	}
+	if ok, err := o.IsValid([]byte{0xab, 0xcd}); err != nil || ok {
+		t.Errorf("output not matching Accept was accepted: %v, %v", ok, err)
+	}
+	if ok, err := o.IsValid([]byte{0x00, 0xbc}); err != nil || !ok {
+		t.Errorf("output matching Accept was rejected: %v, %v", ok, err)
+	}
+}
@@ -0,0 +1,220 @@
+package attacks
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// randomBlocks returns a function that fills its argument with the next bytes
+// of an AES-CTR keystream keyed with 16 bytes read from rand. Searches use it
+// to draw candidates quickly and reproducibly.
+func randomBlocks(rand io.Reader) (func(b []byte), error) {
+	key := make([]byte, 16)
+	if _, err := io.ReadFull(rand, key); err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	stream := cipher.NewCTR(block, make([]byte, aes.BlockSize))
+	return func(b []byte) {
+		for i := range b {
+			b[i] = 0
+		}
+		stream.XORKeyStream(b, b)
+	}, nil
+}
+
+// ToyHash is the weak Merkle–Damgård hash of cryptopals challenge 52, with a
+// bitLen-bit state, where bitLen is a multiple of 8 up to 64. Each 16-byte
+// block of msg is encrypted with AES using the zero-padded state as key, and
+// the first bitLen bits of the result are the next state. The initial state is
+// all asterisks, and msg is padded with zeroes to a multiple of 16 bytes, plus
+// a whole block of zeroes if it already was one.
+func ToyHash(msg []byte, bitLen int) []byte {
+	state := bytes.Repeat([]byte("*"), bitLen/8)
+	for len(msg) >= 16 {
+		state = toyState(toyCompressor(state)(msg[:16]), bitLen)
+		msg = msg[16:]
+	}
+	last := make([]byte, 16)
+	copy(last, msg)
+	return toyState(toyCompressor(state)(last), bitLen)
+}
+
+// toyCompressor returns the ToyHash compression function from state, with
+// the next state as an integer.
+func toyCompressor(state []byte) func(block []byte) uint64 {
+	buf := make([]byte, 16)
+	copy(buf, state)
+	b, _ := aes.NewCipher(buf)
+	mask := uint64(1)<<uint(len(state)*8) - 1
+	return func(block []byte) uint64 {
+		b.Encrypt(buf, block)
+		return binary.LittleEndian.Uint64(buf) & mask
+	}
+}
+
+func toyState(n uint64, bitLen int) []byte {
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(buf, n)
+	return buf[:bitLen/8]
+}
+
+func checkBitLen(bitLen int) error {
+	if bitLen <= 0 || bitLen > 64 || bitLen%8 != 0 {
+		return errors.New("bitLen must be a multiple of 8 between 8 and 64")
+	}
+	return nil
+}
+
+// Multicollision returns n pairs of 16-byte blocks, such that all the 2^n
+// messages made by picking one block of each pair, in order, have the same
+// ToyHash, as in Joux, "Multicollisions in Iterated Hash Functions". Each pair
+// is a birthday collision from the state reached by the previous ones, so the
+// cost is only n times 2^(bitLen/2).
+func Multicollision(n, bitLen int, rand io.Reader) ([][2][]byte, error) {
+	if err := checkBitLen(bitLen); err != nil {
+		return nil, err
+	}
+	next, err := randomBlocks(rand)
+	if err != nil {
+		return nil, err
+	}
+	var res [][2][]byte
+	state := bytes.Repeat([]byte("*"), bitLen/8)
+	for i := 0; i < n; i++ {
+		f := toyCompressor(state)
+		seen := make(map[uint64][]byte)
+		for {
+			block := make([]byte, 16)
+			next(block)
+			s := f(block)
+			if other, ok := seen[s]; ok {
+				res = append(res, [2][]byte{other, block})
+				state = toyState(s, bitLen)
+				break
+			}
+			seen[s] = block
+		}
+	}
+	return res, nil
+}
+
+// A NostradamusTree is a diamond structure, from Kelsey and Kohno, "Herding
+// Hash Functions": 2^k ToyHash states, each with a sequence of k blocks that
+// leads from it to the same final state. Its Hash can be published ahead of
+// time as the commitment to a prediction, and then Predict can make any
+// message hash to it.
+type NostradamusTree struct {
+	// Hash is the ToyHash of the messages returned by Predict.
+	Hash []byte
+
+	bitLen int
+	// paths maps each leaf state to its blocks.
+	paths map[uint64][]byte
+}
+
+// NewNostradamusTree builds a tree with 2^k leaves. Each of the 2^k-1 inner
+// nodes costs a birthday search, about 2^(bitLen/2+1) evaluations.
+func NewNostradamusTree(k, bitLen int, rand io.Reader) (*NostradamusTree, error) {
+	if err := checkBitLen(bitLen); err != nil {
+		return nil, err
+	}
+	next, err := randomBlocks(rand)
+	if err != nil {
+		return nil, err
+	}
+
+	type node struct {
+		state uint64
+		// leaves are the states of the leaves under this node.
+		leaves []uint64
+	}
+	paths := make(map[uint64][]byte)
+	var nodes []node
+	for len(nodes) < 1<<uint(k) {
+		state := make([]byte, 8)
+		next(state[:bitLen/8])
+		s := binary.LittleEndian.Uint64(state)
+		if _, ok := paths[s]; ok {
+			continue
+		}
+		paths[s] = nil
+		nodes = append(nodes, node{state: s, leaves: []uint64{s}})
+	}
+
+	for len(nodes) > 1 {
+		var parents []node
+		for i := 0; i < len(nodes); i += 2 {
+			a, b := nodes[i], nodes[i+1]
+			blockA, blockB, s := collideStates(a.state, b.state, bitLen, next)
+			for _, l := range a.leaves {
+				paths[l] = append(paths[l], blockA...)
+			}
+			for _, l := range b.leaves {
+				paths[l] = append(paths[l], blockB...)
+			}
+			parents = append(parents, node{state: s, leaves: append(a.leaves, b.leaves...)})
+		}
+		nodes = parents
+	}
+
+	// Predict returns whole blocks, so ToyHash will add a block of padding.
+	root := toyState(nodes[0].state, bitLen)
+	hash := toyState(toyCompressor(root)(make([]byte, 16)), bitLen)
+	return &NostradamusTree{Hash: hash, bitLen: bitLen, paths: paths}, nil
+}
+
+// collideStates returns a block from the state a and one from the state b
+// that lead to the same state s.
+func collideStates(a, b uint64, bitLen int, next func([]byte)) (blockA, blockB []byte, s uint64) {
+	fa := toyCompressor(toyState(a, bitLen))
+	fb := toyCompressor(toyState(b, bitLen))
+	fromA := make(map[uint64][]byte)
+	for i := 0; i < 1<<uint(bitLen/2); i++ {
+		block := make([]byte, 16)
+		next(block)
+		fromA[fa(block)] = block
+	}
+	blockB = make([]byte, 16)
+	var ok bool
+	for {
+		next(blockB)
+		s = fb(blockB)
+		if blockA, ok = fromA[s]; ok {
+			return blockA, blockB, s
+		}
+	}
+}
+
+// Predict returns msg followed by a linking block and the path of a leaf, so
+// that it hashes to t.Hash. msg must be a multiple of 16 bytes long. Finding
+// the linking block costs about 2^(bitLen-k) evaluations.
+func (t *NostradamusTree) Predict(msg []byte, rand io.Reader) ([]byte, error) {
+	if len(msg)%16 != 0 {
+		return nil, errors.New("message is not a multiple of the block size")
+	}
+	next, err := randomBlocks(rand)
+	if err != nil {
+		return nil, err
+	}
+	state := bytes.Repeat([]byte("*"), t.bitLen/8)
+	for m := msg; len(m) > 0; m = m[16:] {
+		state = toyState(toyCompressor(state)(m[:16]), t.bitLen)
+	}
+	f := toyCompressor(state)
+	block := make([]byte, 16)
+	for {
+		next(block)
+		if path, ok := t.paths[f(block)]; ok {
+			res := append(append([]byte{}, msg...), block...)
+			return append(res, path...), nil
+		}
+	}
+}
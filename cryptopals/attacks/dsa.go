@@ -0,0 +1,68 @@
+package attacks
+
+import (
+	"crypto/dsa"
+	"errors"
+	"math/big"
+)
+
+// hashToInt converts a hash to an integer like FIPS 186-3, taking its leftmost
+// bits, as many as the length of q.
+func hashToInt(hash []byte, q *big.Int) *big.Int {
+	n := q.BitLen()
+	if len(hash) > (n+7)/8 {
+		hash = hash[:(n+7)/8]
+	}
+	h := new(big.Int).SetBytes(hash)
+	if excess := len(hash)*8 - n; excess > 0 {
+		h.Rsh(h, uint(excess))
+	}
+	return h
+}
+
+// RecoverDSAKeyFromRepeatedK returns the private key that produced the
+// signatures (r, s1) and (r, s2) of the hashes h1 and h2, which share r
+// because they were made with the same nonce.
+func RecoverDSAKeyFromRepeatedK(params *dsa.Parameters, r, s1, s2 *big.Int, h1, h2 []byte) (*big.Int, error) {
+	q := params.Q
+	H1, H2 := hashToInt(h1, q), hashToInt(h2, q)
+
+	// k = (H1 - H2) / (s1 - s2)
+	k := new(big.Int).Sub(s1, s2)
+	k.Mod(k, q)
+	if k.ModInverse(k, q) == nil {
+		return nil, errors.New("the signatures are of the same hash")
+	}
+	H := new(big.Int).Sub(H1, H2)
+	k.Mul(k, H.Mod(H, q)).Mod(k, q)
+
+	return keyFromNonce(q, r, s1, H1, k)
+}
+
+// RecoverDSAKeyFromLowK returns the private key that produced the signature
+// (r, s) of the hash h, if the nonce was at most bits long.
+func RecoverDSAKeyFromLowK(params *dsa.Parameters, r, s *big.Int, h []byte, bits int) (*big.Int, error) {
+	H := hashToInt(h, params.Q)
+	k := big.NewInt(1)
+	rr := new(big.Int).Set(params.G)
+	rrModQ := new(big.Int)
+	for k.BitLen() <= bits {
+		if rrModQ.Mod(rr, params.Q).Cmp(r) == 0 {
+			return keyFromNonce(params.Q, r, s, H, k)
+		}
+		rr.Mul(rr, params.G).Mod(rr, params.P)
+		k.Add(k, big1)
+	}
+	return nil, errors.New("the nonce is not low")
+}
+
+// keyFromNonce returns x = (s * k - H) / r.
+func keyFromNonce(q, r, s, H, k *big.Int) (*big.Int, error) {
+	rInv := new(big.Int).ModInverse(r, q)
+	if rInv == nil {
+		return nil, errors.New("invalid r")
+	}
+	x := new(big.Int).Mul(s, k)
+	x.Mod(x, q).Sub(x, H).Mul(x, rInv).Mod(x, q)
+	return x, nil
+}
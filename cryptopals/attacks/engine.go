@@ -0,0 +1,155 @@
+package attacks
+
+import (
+	"sync"
+)
+
+// Options configures how the attacks query their oracle. A nil *Options is
+// valid and uses the defaults.
+type Options struct {
+	// Parallelism is how many queries can be in flight at once. The default
+	// is one.
+	Parallelism int
+
+	// Retries is how many times a query that returns an error is repeated,
+	// before the attack fails.
+	Retries int
+
+	// Votes is how many answers to each query are collected, the most common
+	// of which is used, for oracles that are occasionally wrong. The default
+	// is one. An odd number avoids ties.
+	Votes int
+
+	// Progress, if not nil, is called with the plaintext recovered so far,
+	// or the current best approximation of it. It's not called concurrently.
+	Progress func(partial []byte)
+}
+
+func (o *Options) parallelism() int {
+	if o == nil || o.Parallelism < 1 {
+		return 1
+	}
+	return o.Parallelism
+}
+
+func (o *Options) progress(partial []byte) {
+	if o != nil && o.Progress != nil {
+		o.Progress(partial)
+	}
+}
+
+// ask calls query until it succeeds, up to 1+Retries times, and collects
+// Votes answers, returning the most common. Once an answer has a majority,
+// the remaining votes are skipped.
+func (o *Options) ask(query func() (string, error)) (string, error) {
+	votes, retries := 1, 0
+	if o != nil {
+		if o.Votes > 1 {
+			votes = o.Votes
+		}
+		retries = o.Retries
+	}
+	counts := make(map[string]int)
+	var best string
+	for i := 0; i < votes && counts[best] <= votes/2; i++ {
+		var answer string
+		var err error
+		for try := 0; try <= retries; try++ {
+			if answer, err = query(); err == nil {
+				break
+			}
+		}
+		if err != nil {
+			return "", err
+		}
+		counts[answer]++
+		if counts[answer] > counts[best] {
+			best = answer
+		}
+	}
+	return best, nil
+}
+
+// askValid is ask for a ValidityOracle.
+func (o *Options) askValid(oracle ValidityOracle, msg []byte) (bool, error) {
+	answer, err := o.ask(func() (string, error) {
+		ok, err := oracle(msg)
+		if ok {
+			return "valid", err
+		}
+		return "invalid", err
+	})
+	return answer == "valid", err
+}
+
+// askEncrypt is ask for an EncryptionOracle, with answers compared by the
+// result of key, so that irrelevant differences don't split the vote.
+func (o *Options) askEncrypt(oracle EncryptionOracle, msg []byte, key func([]byte) string) (string, error) {
+	return o.ask(func() (string, error) {
+		out, err := oracle(msg)
+		if err != nil {
+			return "", err
+		}
+		return key(out), nil
+	})
+}
+
+// search calls test for each of n candidates, with up to Parallelism calls
+// at once, and returns the indexes for which it returned true, in order. If
+// first is true, it stops issuing calls after a match, and only returns the
+// lowest match among the calls made.
+func (o *Options) search(n int, first bool, test func(i int) (bool, error)) ([]int, error) {
+	var (
+		mu      sync.Mutex
+		matches = make([]bool, n)
+		found   bool
+		err     error
+		next    int
+	)
+	worker := func() {
+		for {
+			mu.Lock()
+			if next >= n || err != nil || (first && found) {
+				mu.Unlock()
+				return
+			}
+			i := next
+			next++
+			mu.Unlock()
+
+			ok, e := test(i)
+
+			mu.Lock()
+			if e != nil && err == nil {
+				err = e
+			}
+			if ok {
+				matches[i] = true
+				found = true
+			}
+			mu.Unlock()
+		}
+	}
+	var wg sync.WaitGroup
+	for w := 0; w < o.parallelism(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			worker()
+		}()
+	}
+	wg.Wait()
+	if err != nil {
+		return nil, err
+	}
+	var res []int
+	for i, ok := range matches {
+		if ok {
+			res = append(res, i)
+			if first {
+				break
+			}
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,106 @@
+package attacks
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding"
+	"encoding/binary"
+	"errors"
+	"hash"
+)
+
+// mdPadding returns the Merkle–Damgård padding SHA-1, SHA-256 and MD4 append
+// to a message of length n, with the length encoded in order. SHA-512 has
+// 128-byte blocks and a 16-byte length instead, see mdPadding512.
+func mdPadding(n int, order binary.ByteOrder) []byte {
+	pad := make([]byte, 64+8)
+	pad[0] = 0x80
+	padLen := 56 - n%64
+	if n%64 >= 56 {
+		padLen += 64
+	}
+	order.PutUint64(pad[padLen:], uint64(n)<<3)
+	return pad[:padLen+8]
+}
+
+// mdPadding512 returns the padding SHA-512 appends to a message of length n.
+func mdPadding512(n int) []byte {
+	pad := make([]byte, 128+16)
+	pad[0] = 0x80
+	padLen := 112 - n%128
+	if n%128 >= 112 {
+		padLen += 128
+	}
+	// The upper half of the 128-bit length is always zero here.
+	binary.BigEndian.PutUint64(pad[padLen+8:], uint64(n)<<3)
+	return pad[:padLen+16]
+}
+
+// resume returns h with its state replaced by mac, as if it had hashed n
+// bytes, by loading it in the format of the standard library MarshalBinary:
+// magic || state || buffer || length. n must be a multiple of blockSize, so
+// that the buffer is empty.
+func resume(h hash.Hash, magic string, mac []byte, blockSize, n int) (hash.Hash, error) {
+	state := []byte(magic)
+	state = append(state, mac...)
+	state = append(state, make([]byte, blockSize)...)
+	state = append(state, make([]byte, 8)...)
+	binary.BigEndian.PutUint64(state[len(state)-8:], uint64(n))
+	if err := h.(encoding.BinaryUnmarshaler).UnmarshalBinary(state); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// ExtendSHA1 forges a SHA-1(key || message) MAC for msg, its padding and
+// extension, given the MAC of msg and the length of the secret key.
+func ExtendSHA1(mac, msg, extension []byte, keyLen int) (newMAC, newMsg []byte, err error) {
+	if len(mac) != sha1.Size {
+		return nil, nil, errors.New("wrong MAC length")
+	}
+	newMsg = append(newMsg, msg...)
+	newMsg = append(newMsg, mdPadding(keyLen+len(msg), binary.BigEndian)...)
+
+	h, err := resume(sha1.New(), "sha\x01", mac, sha1.BlockSize, keyLen+len(newMsg))
+	if err != nil {
+		return nil, nil, err
+	}
+	h.Write(extension)
+	newMsg = append(newMsg, extension...)
+	return h.Sum(nil), newMsg, nil
+}
+
+// ExtendSHA256 is like ExtendSHA1, for SHA-256(key || message) MACs.
+func ExtendSHA256(mac, msg, extension []byte, keyLen int) (newMAC, newMsg []byte, err error) {
+	if len(mac) != sha256.Size {
+		return nil, nil, errors.New("wrong MAC length")
+	}
+	newMsg = append(newMsg, msg...)
+	newMsg = append(newMsg, mdPadding(keyLen+len(msg), binary.BigEndian)...)
+
+	h, err := resume(sha256.New(), "sha\x03", mac, sha256.BlockSize, keyLen+len(newMsg))
+	if err != nil {
+		return nil, nil, err
+	}
+	h.Write(extension)
+	newMsg = append(newMsg, extension...)
+	return h.Sum(nil), newMsg, nil
+}
+
+// ExtendSHA512 is like ExtendSHA1, for SHA-512(key || message) MACs.
+func ExtendSHA512(mac, msg, extension []byte, keyLen int) (newMAC, newMsg []byte, err error) {
+	if len(mac) != sha512.Size {
+		return nil, nil, errors.New("wrong MAC length")
+	}
+	newMsg = append(newMsg, msg...)
+	newMsg = append(newMsg, mdPadding512(keyLen+len(msg))...)
+
+	h, err := resume(sha512.New(), "sha\x07", mac, sha512.BlockSize, keyLen+len(newMsg))
+	if err != nil {
+		return nil, nil, err
+	}
+	h.Write(extension)
+	newMsg = append(newMsg, extension...)
+	return h.Sum(nil), newMsg, nil
+}
@@ -0,0 +1,143 @@
+package attacks
+
+import (
+	"fmt"
+	"math"
+	mathrand "math/rand"
+	"sort"
+	"time"
+)
+
+// A LeakageTest checks whether the running time of a function depends on its
+// input, like dudect (Reparaz, Balasch and Verbauwhede, "Dude, is my code
+// constant time?"). It is the defensive counterpart of Timing.
+//
+// The function is run on inputs of two classes, typically a fixed one and
+// random ones, in random order, and the two timing distributions are compared
+// with Welch's t-test. The test is repeated on the fastest measurements at
+// several cutoffs, since the slow tail is mostly noise.
+type LeakageTest struct {
+	// Measurements is how many times the function is run. It defaults to
+	// 100000. The first tenth is only used to pick the cutoffs.
+	Measurements int
+
+	// Threshold is how large |t| must be to report a leak. It defaults to 10,
+	// which dudect considers definitely not constant time.
+	Threshold float64
+}
+
+// Leakage is the result of a LeakageTest.
+type Leakage struct {
+	// T is the t statistic of largest magnitude among the tests.
+	T float64
+	// Cutoff is the fraction of the fastest measurements that T was computed
+	// on, or 1 if all of them.
+	Cutoff float64
+	// Samples is how many measurements T was computed on.
+	Samples int
+
+	// Leaks reports whether |T| is above the threshold.
+	Leaks bool
+}
+
+func (l *Leakage) String() string {
+	verdict := "no leak detected"
+	if l.Leaks {
+		verdict = "leaks"
+	}
+	return fmt.Sprintf("%s: t = %.2f over %d samples, with cutoff %.3f", verdict, l.T, l.Samples, l.Cutoff)
+}
+
+// welch accumulates the running mean and variance of two classes.
+type welch struct {
+	n, mean, m2 [2]float64
+}
+
+func (w *welch) push(class int, x float64) {
+	w.n[class]++
+	delta := x - w.mean[class]
+	w.mean[class] += delta / w.n[class]
+	w.m2[class] += delta * (x - w.mean[class])
+}
+
+func (w *welch) t() float64 {
+	if w.n[0] < 2 || w.n[1] < 2 {
+		return 0
+	}
+	v0 := w.m2[0] / (w.n[0] - 1)
+	v1 := w.m2[1] / (w.n[1] - 1)
+	if v0+v1 == 0 {
+		return 0
+	}
+	return (w.mean[0] - w.mean[1]) / math.Sqrt(v0/w.n[0]+v1/w.n[1])
+}
+
+func (l *LeakageTest) threshold() float64 {
+	if l.Threshold == 0 {
+		return 10
+	}
+	return l.Threshold
+}
+
+// Run measures fn on inputs produced by input for class 0 or 1. All inputs
+// are generated before measuring.
+func (l *LeakageTest) Run(fn func(input []byte), input func(class int) []byte) *Leakage {
+	n := l.Measurements
+	if n == 0 {
+		n = 100000
+	}
+
+	classes := make([]int, n)
+	inputs := make([][]byte, n)
+	for i := range inputs {
+		classes[i] = mathrand.Intn(2)
+		inputs[i] = input(classes[i])
+	}
+	times := make([]time.Duration, n)
+	for i := range inputs {
+		start := time.Now()
+		fn(inputs[i])
+		times[i] = time.Since(start)
+	}
+	return l.analyze(classes, times)
+}
+
+// analyze compares the timings of the two classes, where times[i] is the
+// measurement of an input of class classes[i].
+func (l *LeakageTest) analyze(classes []int, times []time.Duration) *Leakage {
+	n := len(times)
+	// Pick the cutoffs from the first measurements, with more of them close
+	// to the whole set, and discard those measurements.
+	warmUp := n / 10
+	first := append([]time.Duration{}, times[:warmUp]...)
+	sort.Slice(first, func(i, j int) bool { return first[i] < first[j] })
+	const crops = 100
+	fractions := make([]float64, crops+1)
+	cutoffs := make([]time.Duration, crops+1)
+	fractions[0], cutoffs[0] = 1, math.MaxInt64
+	for k := 1; k <= crops; k++ {
+		fractions[k] = 1 - math.Pow(0.5, 10*float64(k)/crops)
+		if warmUp > 0 {
+			cutoffs[k] = first[int(fractions[k]*float64(warmUp-1))]
+		}
+	}
+
+	tests := make([]welch, crops+1)
+	for i := warmUp; i < n; i++ {
+		for k := range tests {
+			if times[i] <= cutoffs[k] {
+				tests[k].push(classes[i], float64(times[i]))
+			}
+		}
+	}
+
+	res := &Leakage{}
+	for k := range tests {
+		if t := tests[k].t(); math.Abs(t) > math.Abs(res.T) {
+			res.T, res.Cutoff = t, fractions[k]
+			res.Samples = int(tests[k].n[0] + tests[k].n[1])
+		}
+	}
+	res.Leaks = math.Abs(res.T) > l.threshold()
+	return res
+}
@@ -0,0 +1,209 @@
+package attacks
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/bits"
+)
+
+var md4Init = [4]uint32{0x67452301, 0xefcdab89, 0x98badcfe, 0x10325476}
+
+var md4Shift1 = []int{3, 7, 11, 19}
+var md4Shift2 = []int{3, 5, 9, 13}
+var md4Shift3 = []int{3, 9, 11, 15}
+
+var md4Index2 = []int{0, 4, 8, 12, 1, 5, 9, 13, 2, 6, 10, 14, 3, 7, 11, 15}
+var md4Index3 = []int{0, 8, 4, 12, 2, 10, 6, 14, 1, 9, 5, 13, 3, 11, 7, 15}
+
+// md4Block applies the MD4 compression function to the state s for each
+// 64-byte block of p.
+func md4Block(s *[4]uint32, p []byte) {
+	var X [16]uint32
+	for ; len(p) >= 64; p = p[64:] {
+		for i := range X {
+			X[i] = binary.LittleEndian.Uint32(p[i*4:])
+		}
+		a, b, c, d := s[0], s[1], s[2], s[3]
+		for i := 0; i < 16; i++ {
+			a = bits.RotateLeft32(a+(b&c|^b&d)+X[i], md4Shift1[i%4])
+			a, b, c, d = d, a, b, c
+		}
+		for i := 0; i < 16; i++ {
+			a = bits.RotateLeft32(a+(b&c|b&d|c&d)+X[md4Index2[i]]+0x5a827999, md4Shift2[i%4])
+			a, b, c, d = d, a, b, c
+		}
+		for i := 0; i < 16; i++ {
+			a = bits.RotateLeft32(a+(b^c^d)+X[md4Index3[i]]+0x6ed9eba1, md4Shift3[i%4])
+			a, b, c, d = d, a, b, c
+		}
+		s[0] += a
+		s[1] += b
+		s[2] += c
+		s[3] += d
+	}
+}
+
+// md4Sum returns the MD4 hash of msg, starting from the state s, reached
+// after hashing n bytes.
+func md4Sum(s [4]uint32, n int, msg []byte) []byte {
+	msg = append(append([]byte{}, msg...), mdPadding(n+len(msg), binary.LittleEndian)...)
+	md4Block(&s, msg)
+	sum := make([]byte, 16)
+	for i, v := range s {
+		binary.LittleEndian.PutUint32(sum[i*4:], v)
+	}
+	return sum
+}
+
+// ExtendMD4 forges an MD4(key || message) MAC for msg, its padding and
+// extension, given the MAC of msg and the length of the secret key.
+func ExtendMD4(mac, msg, extension []byte, keyLen int) (newMAC, newMsg []byte, err error) {
+	if len(mac) != 16 {
+		return nil, nil, errors.New("wrong MAC length")
+	}
+	newMsg = append(newMsg, msg...)
+	newMsg = append(newMsg, mdPadding(keyLen+len(msg), binary.LittleEndian)...)
+
+	var s [4]uint32
+	for i := range s {
+		s[i] = binary.LittleEndian.Uint32(mac[i*4:])
+	}
+	newMAC = md4Sum(s, keyLen+len(newMsg), extension)
+	newMsg = append(newMsg, extension...)
+	return newMAC, newMsg, nil
+}
+
+// md4Round1 computes the first round of MD4 on a 64-byte msg from the initial
+// state. After each step, callback is called with the step number, the new
+// value a, the other state words, and the message word, shift and previous
+// value of a used to compute it, and a is replaced with its return value.
+func md4Round1(msg []byte, callback func(i int, a, b, c, d, m, s, a0 uint32) uint32) (a, b, c, d uint32) {
+	a, b, c, d = md4Init[0], md4Init[1], md4Init[2], md4Init[3]
+	for i := 0; i < 16; i++ {
+		m, s := binary.LittleEndian.Uint32(msg[i*4:]), md4Shift1[i%4]
+		a0 := a
+		a = bits.RotateLeft32(a+(b&c|^b&d)+m, s)
+		a = callback(i, a, b, c, d, m, uint32(s), a0)
+		a, b, c, d = d, a, b, c
+	}
+	return
+}
+
+type wangConditionType int
+
+const (
+	w0 wangConditionType = iota // set to 0
+	w1                          // set to 1
+	wP                          // set to match previous variable
+)
+
+// wangConditions are the sufficient conditions on the first round chaining
+// values from Table 6 of Wang et al.
+var wangConditions = [16][]struct {
+	bitIdx uint // 1-INDEXED
+	_type  wangConditionType
+}{
+	{{7, wP}},
+	{{7, w0}, {8, wP}, {11, wP}},
+	{{7, w1}, {8, w1}, {11, w0}, {26, wP}},
+	{{7, w1}, {8, w0}, {11, w0}, {26, w0}},
+	{{8, w1}, {11, w1}, {26, w0}, {14, wP}},
+	{{14, w0}, {19, wP}, {20, wP}, {21, wP}, {22, wP}, {26, w1}},
+	{{13, wP}, {14, w0}, {15, wP}, {19, w0}, {20, w0}, {21, w1}, {22, w0}},
+	{{13, w1}, {14, w1}, {15, w0}, {17, wP}, {19, w0}, {20, w0}, {21, w0}, {22, w0}},
+	{{13, w1}, {14, w1}, {15, w1}, {17, w0}, {19, w0}, {20, w0}, {21, w0}, {23, wP}, {22, w1}, {26, wP}},
+	{{13, w1}, {14, w1}, {15, w1}, {17, w0}, {20, w0}, {21, w1}, {22, w1}, {23, w0}, {26, w1}, {30, wP}},
+	{{17, w1}, {20, w0}, {21, w0}, {22, w0}, {23, w0}, {26, w0}, {30, w1}, {32, wP}},
+	{{20, w0}, {21, w1}, {22, w1}, {23, wP}, {26, w1}, {30, w0}, {32, w0}},
+	{{23, w0}, {26, w0}, {27, wP}, {29, wP}, {30, w1}, {32, w0}},
+	{{23, w0}, {26, w0}, {27, w1}, {29, w1}, {30, w0}, {32, w1}},
+	{{19, wP}, {23, w1}, {26, w1}, {27, w0}, {29, w0}, {30, w0}},
+	{{19, w0}, {26, wP}, {27, w1}, {29, w1}, {30, w0}},
+}
+
+// wangFix returns a with the conditions of step i satisfied, given the
+// previous chaining value b.
+func wangFix(i int, a, b uint32) uint32 {
+	for _, cond := range wangConditions[i] {
+		mask := uint32(1) << (cond.bitIdx - 1)
+		switch cond._type {
+		case w0:
+			a &^= mask
+		case w1:
+			a |= mask
+		case wP:
+			a = a&^mask | b&mask
+		default:
+			panic("invalid condition")
+		}
+	}
+	return a
+}
+
+func checkWangConditions(msg []byte) bool {
+	allValid := true
+	md4Round1(msg, func(i int, a, b, c, d, m, s, a0 uint32) uint32 {
+		if wangFix(i, a, b) != a {
+			allValid = false
+		}
+		return a
+	})
+	return allValid
+}
+
+// enforceWangConditions modifies msg so that the first round satisfies the
+// conditions, by fixing each chaining value and solving for its message word.
+func enforceWangConditions(msg []byte) {
+	md4Round1(msg, func(i int, a, b, c, d, m, s, a0 uint32) uint32 {
+		a = wangFix(i, a, b)
+		m1 := bits.RotateLeft32(a, -int(s)) - a0 - (b&c | ^b&d)
+		binary.LittleEndian.PutUint32(msg[i*4:], m1)
+		return a
+	})
+}
+
+// wangSisterMsg sets msg1 to msg with the differential of section 4.1 of
+// Wang et al. applied.
+func wangSisterMsg(msg1, msg []byte) {
+	for i := 0; i < 16; i++ {
+		v := binary.LittleEndian.Uint32(msg[i*4:])
+		switch i {
+		case 1:
+			v += 1 << 31
+		case 2:
+			v += 1 << 31
+			v -= 1 << 28
+		case 12:
+			v -= 1 << 16
+		}
+		binary.LittleEndian.PutUint32(msg1[i*4:], v)
+	}
+}
+
+// FindMD4Collision returns two different 64-byte messages with the same MD4
+// hash, using the differential and the first round message modifications of
+// Wang et al., "Cryptanalysis of the Hash Functions MD4 and RIPEMD".
+//
+// The candidate messages are derived from 16 bytes read from rand, so the
+// same rand produces the same collision.
+func FindMD4Collision(rand io.Reader) (m1, m2 []byte, err error) {
+	next, err := randomBlocks(rand)
+	if err != nil {
+		return nil, nil, err
+	}
+	m1, m2 = make([]byte, 64), make([]byte, 64)
+	for {
+		next(m1)
+		enforceWangConditions(m1)
+		wangSisterMsg(m2, m1)
+		// The padding block is the same, so the states after the first
+		// block are enough.
+		s1, s2 := md4Init, md4Init
+		md4Block(&s1, m1)
+		md4Block(&s2, m2)
+		if s1 == s2 {
+			return m1, m2, nil
+		}
+	}
+}
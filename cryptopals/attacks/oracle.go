@@ -0,0 +1,242 @@
+package attacks
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// QueryPlaceholder is replaced with the encoded query in the templates of
+// HTTPOracle and CommandOracle.
+const QueryPlaceholder = "{{query}}"
+
+// An Encoding is how queries are sent to a target, and how its responses are
+// read: "hex", "base64", or "raw" (the default).
+type Encoding string
+
+func (e Encoding) encode(b []byte) (string, error) {
+	switch e {
+	case "hex":
+		return hex.EncodeToString(b), nil
+	case "base64":
+		return base64.StdEncoding.EncodeToString(b), nil
+	case "raw", "":
+		return string(b), nil
+	}
+	return "", fmt.Errorf("unknown encoding %q", e)
+}
+
+func (e Encoding) decode(b []byte) ([]byte, error) {
+	switch e {
+	case "hex":
+		return hex.DecodeString(string(bytes.TrimSpace(b)))
+	case "base64":
+		return base64.StdEncoding.DecodeString(string(bytes.TrimSpace(b)))
+	case "raw", "":
+		return b, nil
+	}
+	return nil, fmt.Errorf("unknown encoding %q", e)
+}
+
+// An HTTPOracle makes a request to an HTTP endpoint for each query. Its
+// Encrypt, IsValid and Time methods can be used as EncryptionOracle,
+// ValidityOracle and TimingOracle.
+type HTTPOracle struct {
+	// Client is used to make the requests. If nil, http.DefaultClient is used.
+	Client *http.Client
+
+	// Method defaults to GET.
+	Method string
+	// URL and Body can contain QueryPlaceholder. In the URL, the encoded
+	// query is also escaped.
+	URL, Body string
+	Header    http.Header
+
+	// Encoding applies to both the query and the response body.
+	Encoding Encoding
+
+	// Accept, if not nil, must match the response body for IsValid to return
+	// true, whatever the status code. Otherwise, any 2xx response is valid.
+	Accept *regexp.Regexp
+}
+
+func (o *HTTPOracle) client() *http.Client {
+	if o.Client == nil {
+		return http.DefaultClient
+	}
+	return o.Client
+}
+
+func (o *HTTPOracle) request(query []byte) (*http.Request, error) {
+	q, err := o.Encoding.encode(query)
+	if err != nil {
+		return nil, err
+	}
+	method := o.Method
+	if method == "" {
+		method = "GET"
+	}
+	var reqBody io.Reader
+	if o.Body != "" {
+		reqBody = strings.NewReader(strings.Replace(o.Body, QueryPlaceholder, q, -1))
+	}
+	u := strings.Replace(o.URL, QueryPlaceholder, url.QueryEscape(q), -1)
+	req, err := http.NewRequest(method, u, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range o.Header {
+		req.Header[k] = v
+	}
+	return req, nil
+}
+
+func (o *HTTPOracle) do(query []byte) (body []byte, success bool, err error) {
+	req, err := o.request(query)
+	if err != nil {
+		return nil, false, err
+	}
+	res, err := o.client().Do(req)
+	if err != nil {
+		return nil, false, err
+	}
+	defer res.Body.Close()
+	body, err = ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, false, err
+	}
+	return body, res.StatusCode >= 200 && res.StatusCode < 300, nil
+}
+
+// Encrypt returns the decoded body of the response to msg. Non-2xx responses
+// are errors.
+func (o *HTTPOracle) Encrypt(msg []byte) ([]byte, error) {
+	body, ok, err := o.do(msg)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("unsuccessful response: %q", body)
+	}
+	return o.Encoding.decode(body)
+}
+
+// IsValid reports whether the response to msg is accepted.
+func (o *HTTPOracle) IsValid(msg []byte) (bool, error) {
+	body, ok, err := o.do(msg)
+	if err != nil || o.Accept == nil {
+		return ok, err
+	}
+	return o.Accept.Match(body), nil
+}
+
+// Time returns how long the target took to respond to msg, from when the
+// request was written to when the first byte of the response was received,
+// which leaves out connecting and reading the body. Any response is accepted.
+// It can be used as a TimingOracle.
+func (o *HTTPOracle) Time(msg []byte) (time.Duration, error) {
+	req, err := o.request(msg)
+	if err != nil {
+		return 0, err
+	}
+	var start, end time.Time
+	trace := &httptrace.ClientTrace{
+		WroteRequest:         func(httptrace.WroteRequestInfo) { start = time.Now() },
+		GotFirstResponseByte: func() { end = time.Now() },
+	}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+	res, err := o.client().Do(req)
+	if err != nil {
+		return 0, err
+	}
+	// Drain the body, so that the connection can be reused.
+	_, err = io.Copy(ioutil.Discard, res.Body)
+	res.Body.Close()
+	if err != nil {
+		return 0, err
+	}
+	if start.IsZero() || end.IsZero() {
+		return 0, errors.New("failed to time the request")
+	}
+	return end.Sub(start), nil
+}
+
+// A CommandOracle runs a program for each query. Its Encrypt and IsValid
+// methods can be used as EncryptionOracle and ValidityOracle.
+type CommandOracle struct {
+	// Args are the program and its arguments, which can contain
+	// QueryPlaceholder. If none does, the encoded query is written to the
+	// standard input of the program.
+	Args []string
+
+	// Encoding applies to both the query and the standard output.
+	Encoding Encoding
+
+	// Accept, if not nil, must match the standard output for IsValid to
+	// return true, whatever the exit status. Otherwise, the program must
+	// exit successfully.
+	Accept *regexp.Regexp
+}
+
+func (o *CommandOracle) run(query []byte) (out []byte, success bool, err error) {
+	if len(o.Args) == 0 {
+		return nil, false, errors.New("no command")
+	}
+	q, err := o.Encoding.encode(query)
+	if err != nil {
+		return nil, false, err
+	}
+	args := make([]string, len(o.Args))
+	inArgs := false
+	for i, a := range o.Args {
+		if strings.Contains(a, QueryPlaceholder) {
+			inArgs = true
+		}
+		args[i] = strings.Replace(a, QueryPlaceholder, q, -1)
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	if !inArgs {
+		cmd.Stdin = strings.NewReader(q)
+	}
+	out, err = cmd.Output()
+	if _, ok := err.(*exec.ExitError); ok {
+		return out, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return out, true, nil
+}
+
+// Encrypt returns the decoded output of the program for msg. A failing
+// program is an error.
+func (o *CommandOracle) Encrypt(msg []byte) ([]byte, error) {
+	out, ok, err := o.run(msg)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("command failed, with output %q", out)
+	}
+	return o.Encoding.decode(out)
+}
+
+// IsValid reports whether the output of the program for msg is accepted.
+func (o *CommandOracle) IsValid(msg []byte) (bool, error) {
+	out, ok, err := o.run(msg)
+	if err != nil || o.Accept == nil {
+		return ok, err
+	}
+	return o.Accept.Match(out), nil
+}
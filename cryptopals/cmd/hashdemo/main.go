@@ -0,0 +1,225 @@
+// Command hashdemo produces the artifacts of the cryptopals hash function
+// attacks, for demonstrations.
+//
+//	hashdemo [-seed n] md4-collision [-n pairs] [-out dir]
+//	hashdemo extend [-hash sha1|sha256|sha512|md4] -mac hex -message msg -append ext [-key-length 16]
+//	hashdemo [-seed n] multicollision [-bits 32] [-n 8] [-out dir]
+//	hashdemo [-seed n] nostradamus [-bits 32] [-k 10] [-out dir] [message]...
+//
+// md4-collision writes pairs of different files with the same MD4 hash, found
+// with the Wang et al. attack. extend forges a secret-prefix MAC for the
+// message followed by its padding and the extension. multicollision finds 2^n
+// messages with the same ToyHash, the weak hash of challenge 52, and
+// nostradamus commits to a ToyHash and then produces, for each message, a
+// message that starts with it and hashes to the commitment.
+//
+// Every random choice is derived from -seed, so the same seed always produces
+// the same output. Without -seed, a random seed is picked and logged. To
+// predict, run nostradamus once without messages, publish the hash, then run
+// it again with the same seed, -bits and -k, and the messages.
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	mathrand "math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"filippo.io/mostly-harmless/cryptopals/attacks"
+	"golang.org/x/crypto/md4"
+)
+
+func main() {
+	seedFlag := flag.Int64("seed", 0, "The seed of all random choices (default random)")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: hashdemo [-seed n] md4-collision|extend|multicollision|nostradamus [flags] [args]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	seed := *seedFlag
+	if seed == 0 && flag.Arg(0) != "extend" {
+		seed = time.Now().UnixNano()
+		log.Printf("Using -seed %d", seed)
+	}
+	if err := run(flag.Args(), mathrand.New(mathrand.NewSource(seed)), os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// run executes the command in args, with rand as the source of all random
+// choices, and writes its results to w.
+func run(args []string, rand io.Reader, w io.Writer) error {
+	fs := flag.NewFlagSet(args[0], flag.ContinueOnError)
+	switch args[0] {
+	case "md4-collision":
+		n := fs.Int("n", 1, "How many pairs to find")
+		out := fs.String("out", ".", "The directory to write the pairs to")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		return md4Collisions(*n, *out, rand, w)
+	case "extend":
+		hash := fs.String("hash", "sha1", "The hash of the MAC, sha1, sha256, sha512 or md4")
+		mac := fs.String("mac", "", "The MAC of the message, in hex")
+		msg := fs.String("message", "", "The message")
+		ext := fs.String("append", "", "The extension to append")
+		keyLen := fs.Int("key-length", 16, "The length of the secret key")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		return extend(*hash, *mac, *msg, *ext, *keyLen, w)
+	case "multicollision":
+		bitLen := fs.Int("bits", 32, "The size of the ToyHash state")
+		n := fs.Int("n", 8, "How many collisions to chain, for 2^n messages")
+		out := fs.String("out", "", "The directory to write the 2^n messages to, if any")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		return multicollision(*n, *bitLen, *out, rand, w)
+	case "nostradamus":
+		bitLen := fs.Int("bits", 32, "The size of the ToyHash state")
+		k := fs.Int("k", 10, "The depth of the tree, with 2^k leaves")
+		out := fs.String("out", "", "The directory to write the messages to, if any")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		return nostradamus(*k, *bitLen, *out, fs.Args(), rand, w)
+	}
+	return fmt.Errorf("unknown command %q", args[0])
+}
+
+func writeFile(dir, name string, data []byte) (string, error) {
+	path := filepath.Join(dir, name)
+	return path, ioutil.WriteFile(path, data, 0644)
+}
+
+func md4Collisions(n int, out string, rand io.Reader, w io.Writer) error {
+	for i := 1; i <= n; i++ {
+		m1, m2, err := attacks.FindMD4Collision(rand)
+		if err != nil {
+			return err
+		}
+		h := md4.New()
+		h.Write(m1)
+		sum := h.Sum(nil)
+		h.Reset()
+		h.Write(m2)
+		if sum2 := h.Sum(nil); !bytes.Equal(sum, sum2) {
+			return fmt.Errorf("not a collision: %x %x", sum, sum2)
+		}
+
+		name1, err := writeFile(out, fmt.Sprintf("md4-collision-%d-a.bin", i), m1)
+		if err != nil {
+			return err
+		}
+		name2, err := writeFile(out, fmt.Sprintf("md4-collision-%d-b.bin", i), m2)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%x  %s\n%x  %s\n", sum, name1, sum, name2)
+	}
+	return nil
+}
+
+func extend(hash, macHex, msg, ext string, keyLen int, w io.Writer) error {
+	mac, err := hex.DecodeString(macHex)
+	if err != nil {
+		return fmt.Errorf("invalid MAC: %v", err)
+	}
+	var newMAC, newMsg []byte
+	switch hash {
+	case "sha1":
+		newMAC, newMsg, err = attacks.ExtendSHA1(mac, []byte(msg), []byte(ext), keyLen)
+	case "sha256":
+		newMAC, newMsg, err = attacks.ExtendSHA256(mac, []byte(msg), []byte(ext), keyLen)
+	case "sha512":
+		newMAC, newMsg, err = attacks.ExtendSHA512(mac, []byte(msg), []byte(ext), keyLen)
+	case "md4":
+		newMAC, newMsg, err = attacks.ExtendMD4(mac, []byte(msg), []byte(ext), keyLen)
+	default:
+		return fmt.Errorf("unknown hash %q", hash)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "mac: %x\nmessage: %x\nquoted: %q\n", newMAC, newMsg, newMsg)
+	return nil
+}
+
+func multicollision(n, bitLen int, out string, rand io.Reader, w io.Writer) error {
+	if out != "" && n > 16 {
+		return errors.New("refusing to write more than 2^16 files")
+	}
+	pairs, err := attacks.Multicollision(n, bitLen, rand)
+	if err != nil {
+		return err
+	}
+	for i, p := range pairs {
+		fmt.Fprintf(w, "block %d: %x %x\n", i+1, p[0], p[1])
+	}
+
+	var hash []byte
+	for sel := 0; sel < 1<<uint(len(pairs)); sel++ {
+		var msg []byte
+		for i, p := range pairs {
+			msg = append(msg, p[sel>>uint(i)&1]...)
+		}
+		if h := attacks.ToyHash(msg, bitLen); hash == nil {
+			hash = h
+		} else if !bytes.Equal(h, hash) {
+			return fmt.Errorf("message %d has hash %x instead of %x", sel, h, hash)
+		}
+		if out == "" {
+			continue
+		}
+		if _, err := writeFile(out, fmt.Sprintf("multicollision-%d.bin", sel), msg); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(w, "hash: %x\n", hash)
+	return nil
+}
+
+func nostradamus(k, bitLen int, out string, msgs []string, rand io.Reader, w io.Writer) error {
+	tree, err := attacks.NewNostradamusTree(k, bitLen, rand)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "prediction: %x\n", tree.Hash)
+
+	for i, m := range msgs {
+		// Pad with spaces to a whole block, so the message reads the same.
+		if len(m)%16 != 0 {
+			m += strings.Repeat(" ", 16-len(m)%16)
+		}
+		msg, err := tree.Predict([]byte(m), rand)
+		if err != nil {
+			return err
+		}
+		if h := attacks.ToyHash(msg, bitLen); !bytes.Equal(h, tree.Hash) {
+			return fmt.Errorf("message %d has hash %x instead of %x", i+1, h, tree.Hash)
+		}
+		fmt.Fprintf(w, "message %d: %x\n", i+1, msg)
+		if out == "" {
+			continue
+		}
+		if _, err := writeFile(out, fmt.Sprintf("nostradamus-%d.bin", i+1), msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	mathrand "math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/mostly-harmless/cryptopals/attacks"
+	"golang.org/x/crypto/md4"
+)
+
+func runOutput(t *testing.T, seed int64, args ...string) map[string]string {
+	out := &bytes.Buffer{}
+	if err := run(args, mathrand.New(mathrand.NewSource(seed)), out); err != nil {
+		t.Fatal(err)
+	}
+	res := make(map[string]string)
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		kv := strings.SplitN(line, ": ", 2)
+		if len(kv) != 2 {
+			t.Fatalf("unexpected output line %q", line)
+		}
+		res[kv[0]] = kv[1]
+	}
+	return res
+}
+
+func TestExtend(t *testing.T) {
+	key := []byte("a secret key")
+	msg := "user=bob;role=user"
+	hashes := map[string]func() hash.Hash{
+		"sha1": sha1.New, "sha256": sha256.New, "sha512": sha512.New, "md4": md4.New,
+	}
+	for name, newHash := range hashes {
+		sum := func(msg []byte) []byte {
+			h := newHash()
+			h.Write(append(append([]byte{}, key...), msg...))
+			return h.Sum(nil)
+		}
+		out := runOutput(t, 1, "extend", "-hash", name, "-mac", hex.EncodeToString(sum([]byte(msg))),
+			"-message", msg, "-append", ";role=admin", "-key-length", fmt.Sprint(len(key)))
+		newMsg, err := hex.DecodeString(out["message"])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.HasPrefix(newMsg, []byte(msg)) || !bytes.HasSuffix(newMsg, []byte(";role=admin")) {
+			t.Errorf("%s: wrong message %q", name, newMsg)
+		}
+		if out["mac"] != hex.EncodeToString(sum(newMsg)) {
+			t.Errorf("%s: wrong MAC %s", name, out["mac"])
+		}
+	}
+}
+
+func TestMulticollision(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hashdemo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	out := runOutput(t, 1, "multicollision", "-bits", "24", "-n", "4", "-out", dir)
+	names, err := filepath.Glob(filepath.Join(dir, "multicollision-*.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 16 {
+		t.Fatalf("got %d messages, expected 16", len(names))
+	}
+	seen := make(map[string]bool)
+	for _, name := range names {
+		msg, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		seen[string(msg)] = true
+		if h := hex.EncodeToString(attacks.ToyHash(msg, 24)); h != out["hash"] {
+			t.Errorf("%s has hash %s, expected %s", name, h, out["hash"])
+		}
+	}
+	if len(seen) != 16 {
+		t.Errorf("got %d different messages, expected 16", len(seen))
+	}
+}
+
+func TestNostradamus(t *testing.T) {
+	commitment := runOutput(t, 42, "nostradamus", "-bits", "24", "-k", "6")
+	out := runOutput(t, 42, "nostradamus", "-bits", "24", "-k", "6", "Final score: 3-1", "It will rain")
+	if out["prediction"] != commitment["prediction"] {
+		t.Fatalf("the same seed made prediction %s, then %s", commitment["prediction"], out["prediction"])
+	}
+	for i, prefix := range []string{"Final score: 3-1", "It will rain    "} {
+		msg, err := hex.DecodeString(out[fmt.Sprintf("message %d", i+1)])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.HasPrefix(msg, []byte(prefix)) {
+			t.Errorf("message %q doesn't start with %q", msg, prefix)
+		}
+		if h := hex.EncodeToString(attacks.ToyHash(msg, 24)); h != out["prediction"] {
+			t.Errorf("message %d has hash %s, expected %s", i+1, h, out["prediction"])
+		}
+	}
+}
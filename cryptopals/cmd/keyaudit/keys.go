@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/dsa"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/elgamal"
+	"golang.org/x/crypto/ssh"
+)
+
+// dhGroup is a set of PKCS #3 DH parameters.
+type dhGroup struct {
+	P, G *big.Int
+}
+
+// newKey returns a Key for pub, or false if it's of a kind that keyaudit
+// doesn't check, like an elliptic curve key.
+func newKey(source string, pub interface{}) (Key, bool) {
+	k := Key{Source: source, pub: pub}
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		k.Type, k.Bits = "rsa", pub.N.BitLen()
+	case *dsa.PublicKey:
+		k.Type, k.Bits = "dsa", pub.P.BitLen()
+	case *elgamal.PublicKey:
+		k.Type, k.Bits = "elgamal", pub.P.BitLen()
+	case *dhGroup:
+		k.Type, k.Bits = "dh", pub.P.BitLen()
+	default:
+		return k, false
+	}
+	return k, true
+}
+
+// readKeys parses all the keys in a PEM file, an SSH authorized_keys file,
+// or a PGP keyring, armored or not.
+func readKeys(name string, data []byte) ([]Key, error) {
+	switch {
+	case bytes.Contains(data, []byte("-----BEGIN PGP")):
+		el, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		return pgpKeys(name, el), nil
+	case bytes.Contains(data, []byte("-----BEGIN ")):
+		return pemKeys(name, data)
+	case len(data) > 0 && data[0]&0x80 != 0:
+		el, err := openpgp.ReadKeyRing(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		return pgpKeys(name, el), nil
+	default:
+		return sshKeys(name, data)
+	}
+}
+
+func pgpKeys(name string, el openpgp.EntityList) []Key {
+	var keys []Key
+	for _, e := range el {
+		pks := []interface{}{e.PrimaryKey.PublicKey}
+		ids := []string{e.PrimaryKey.KeyIdString()}
+		for _, s := range e.Subkeys {
+			pks = append(pks, s.PublicKey.PublicKey)
+			ids = append(ids, s.PublicKey.KeyIdString())
+		}
+		for i, pk := range pks {
+			if k, ok := newKey(name+":"+ids[i], pk); ok {
+				keys = append(keys, k)
+			}
+		}
+	}
+	return keys
+}
+
+func pemKeys(name string, data []byte) ([]Key, error) {
+	var keys []Key
+	for n := 1; ; n++ {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		pub, err := parsePEMBlock(block)
+		if err != nil {
+			return nil, fmt.Errorf("%s: block %d: %v", name, n, err)
+		}
+		if k, ok := newKey(fmt.Sprintf("%s:%d", name, n), pub); ok {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%s: no supported PEM key found", name)
+	}
+	return keys, nil
+}
+
+func parsePEMBlock(block *pem.Block) (interface{}, error) {
+	switch block.Type {
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		priv, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return &priv.PublicKey, nil
+	case "PUBLIC KEY":
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	case "PRIVATE KEY":
+		priv, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		if priv, ok := priv.(*rsa.PrivateKey); ok {
+			return &priv.PublicKey, nil
+		}
+		return nil, nil
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return cert.PublicKey, nil
+	case "DSA PRIVATE KEY":
+		var k struct {
+			Version       int
+			P, Q, G, Y, X *big.Int
+		}
+		if _, err := asn1.Unmarshal(block.Bytes, &k); err != nil {
+			return nil, err
+		}
+		return &dsa.PublicKey{Parameters: dsa.Parameters{P: k.P, Q: k.Q, G: k.G}, Y: k.Y}, nil
+	case "DH PARAMETERS":
+		var params struct {
+			P, G               *big.Int
+			PrivateValueLength int `asn1:"optional"`
+		}
+		if _, err := asn1.Unmarshal(block.Bytes, &params); err != nil {
+			return nil, err
+		}
+		return &dhGroup{P: params.P, G: params.G}, nil
+	}
+	return nil, fmt.Errorf("unsupported PEM type %q", block.Type)
+}
+
+func sshKeys(name string, data []byte) ([]Key, error) {
+	var keys []Key
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; s.Scan(); n++ {
+		line := bytes.TrimSpace(s.Bytes())
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		pub, _, _, _, err := ssh.ParseAuthorizedKey(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", name, n, err)
+		}
+		cpk, ok := pub.(ssh.CryptoPublicKey)
+		if !ok {
+			continue
+		}
+		if k, ok := newKey(fmt.Sprintf("%s:%d", name, n), cpk.CryptoPublicKey()); ok {
+			keys = append(keys, k)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%s: no supported key found", name)
+	}
+	return keys, nil
+}
+
+// A signature is a DSA signature from a corpus.
+type signature struct {
+	Source string
+	R, S   *big.Int
+	Hash   []byte
+}
+
+// readSignatures parses a corpus in the format of cryptopals challenge 44:
+// for each signature, a "msg:" line with the message, "s:" and "r:" lines in
+// decimal, and an optional "m:" line with the hex SHA-1 hash of the message.
+// If there is no "msg:" line, the "m:" line is required.
+func readSignatures(name string, data []byte) ([]signature, error) {
+	var sigs []signature
+	var cur map[string]string
+	var start int
+	flush := func() error {
+		if cur == nil {
+			return nil
+		}
+		sig := signature{Source: fmt.Sprintf("%s:%d", name, start)}
+		var ok bool
+		if sig.R, ok = new(big.Int).SetString(cur["r"], 10); !ok {
+			return fmt.Errorf("%s: invalid r", sig.Source)
+		}
+		if sig.S, ok = new(big.Int).SetString(cur["s"], 10); !ok {
+			return fmt.Errorf("%s: invalid s", sig.Source)
+		}
+		if msg, ok := cur["msg"]; ok {
+			h := sha1.Sum([]byte(msg))
+			sig.Hash = h[:]
+		} else if m, ok := cur["m"]; ok {
+			// Some corpora drop the leading zeroes of the hash.
+			m = strings.Repeat("0", sha1.Size*2-len(m)) + m
+			h, err := hex.DecodeString(m)
+			if err != nil {
+				return fmt.Errorf("%s: invalid m: %v", sig.Source, err)
+			}
+			sig.Hash = h
+		} else {
+			return fmt.Errorf("%s: missing msg or m", sig.Source)
+		}
+		sigs = append(sigs, sig)
+		cur = nil
+		return nil
+	}
+
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSuffix(s.Text(), "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		i := strings.Index(line, ": ")
+		if i < 0 {
+			return nil, fmt.Errorf("%s:%d: invalid line", name, n)
+		}
+		k, v := line[:i], line[i+2:]
+		if _, dup := cur[k]; dup || (k == "msg" && cur != nil) {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+		}
+		if cur == nil {
+			cur, start = make(map[string]string), n
+		}
+		cur[k] = v
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	if len(sigs) == 0 {
+		return nil, errors.New(name + ": no signatures found")
+	}
+	return sigs, nil
+}
@@ -0,0 +1,400 @@
+// Command keyaudit checks public keys and DSA signatures for the weaknesses
+// exploited by the cryptopals attacks, and prints its findings as JSON.
+//
+//	keyaudit [-signer key] [-signatures corpus]... keys...
+//
+// Key files can be PEM (PKCS #1, PKIX, certificates, DSA private keys and DH
+// parameters), SSH authorized_keys, or PGP keyrings, and can contain multiple
+// keys. Signature corpora are in the format of cryptopals challenge 44, and
+// were made by the DSA key in the -signer file.
+//
+// keyaudit looks for
+//
+//   - RSA moduli that share a factor, found with batch GCD, or that repeat;
+//   - small or invalid RSA public exponents, and small moduli;
+//   - DSA parameters where g doesn't generate the subgroup of order q;
+//   - DH and ElGamal groups that are not safe primes, that have degenerate
+//     generators or public values, or that are small;
+//   - DSA signatures with repeated or small nonces, which reveal the key.
+package main
+
+import (
+	"crypto/dsa"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"os"
+	"strings"
+
+	"filippo.io/mostly-harmless/cryptopals/attacks"
+	"golang.org/x/crypto/openpgp/elgamal"
+)
+
+// A Report is the output of keyaudit.
+type Report struct {
+	Keys       []Key     `json:"keys"`
+	Signatures int       `json:"signatures"`
+	Findings   []Finding `json:"findings"`
+}
+
+// A Key is a public key or group that was checked.
+type Key struct {
+	// Source is the file name, followed by the index of the PEM block, the
+	// line of the SSH key, or the PGP key ID.
+	Source string `json:"source"`
+	// Type is rsa, dsa, dh or elgamal.
+	Type string `json:"type"`
+	Bits int    `json:"bits"`
+
+	pub interface{}
+}
+
+// A Finding is a weakness of one or more keys or signatures.
+type Finding struct {
+	Check string `json:"check"`
+	// Severity is critical, if the weakness breaks the key, or warning.
+	Severity   string   `json:"severity"`
+	Keys       []string `json:"keys,omitempty"`
+	Signatures []string `json:"signatures,omitempty"`
+	Detail     string   `json:"detail"`
+
+	// Factor and PrivateKey are the secrets recovered, in hex.
+	Factor     string `json:"factor,omitempty"`
+	PrivateKey string `json:"private_key,omitempty"`
+}
+
+type stringsFlag []string
+
+func (s *stringsFlag) String() string     { return strings.Join(*s, ",") }
+func (s *stringsFlag) Set(v string) error { *s = append(*s, v); return nil }
+
+func main() {
+	var corpora stringsFlag
+	flag.Var(&corpora, "signatures", "A corpus of DSA signatures by the -signer key (can be repeated)")
+	signerFlag := flag.String("signer", "", "The file of the DSA key that made the -signatures")
+	flag.Parse()
+
+	var keys []Key
+	for _, name := range flag.Args() {
+		k, err := readKeyFile(name)
+		if err != nil {
+			log.Fatal(err)
+		}
+		keys = append(keys, k...)
+	}
+
+	var signer *dsa.PublicKey
+	var sigs []signature
+	if len(corpora) > 0 {
+		if *signerFlag == "" {
+			log.Fatal("-signatures requires -signer")
+		}
+		k, err := readKeyFile(*signerFlag)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(k) != 1 || k[0].Type != "dsa" {
+			log.Fatalf("%s: expected a single DSA key", *signerFlag)
+		}
+		signer = k[0].pub.(*dsa.PublicKey)
+		keys = append(keys, k[0])
+		for _, name := range corpora {
+			data, err := ioutil.ReadFile(name)
+			if err != nil {
+				log.Fatal(err)
+			}
+			s, err := readSignatures(name, data)
+			if err != nil {
+				log.Fatal(err)
+			}
+			sigs = append(sigs, s...)
+		}
+	}
+	if len(keys) == 0 {
+		log.Fatal("no keys to audit")
+	}
+
+	r := &Report{Keys: keys, Signatures: len(sigs), Findings: audit(keys, signer, sigs)}
+	e := json.NewEncoder(os.Stdout)
+	e.SetIndent("", "\t")
+	if err := e.Encode(r); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func readKeyFile(name string) ([]Key, error) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return readKeys(name, data)
+}
+
+var big1 = big.NewInt(1)
+
+// audit runs all checks. Findings is never nil, so that it's encoded as [].
+func audit(keys []Key, signer *dsa.PublicKey, sigs []signature) []Finding {
+	findings := []Finding{}
+	var rsaKeys []Key
+	for _, k := range keys {
+		switch pub := k.pub.(type) {
+		case *rsa.PublicKey:
+			rsaKeys = append(rsaKeys, k)
+			findings = append(findings, checkRSAKey(k.Source, pub)...)
+		case *dsa.PublicKey:
+			findings = append(findings, checkDSAKey(k.Source, pub)...)
+		case *elgamal.PublicKey:
+			findings = append(findings, checkDHGroup(k.Source, pub.P, pub.G)...)
+			findings = append(findings, checkDHPublic(k.Source, pub.P, pub.Y)...)
+		case *dhGroup:
+			findings = append(findings, checkDHGroup(k.Source, pub.P, pub.G)...)
+		}
+	}
+	findings = append(findings, checkRSAModuli(rsaKeys)...)
+	if signer != nil {
+		findings = append(findings, checkDSASignatures(signer, sigs)...)
+	}
+	return findings
+}
+
+func checkRSAKey(source string, pub *rsa.PublicKey) []Finding {
+	var res []Finding
+	switch {
+	case pub.E < 3 || pub.E%2 == 0:
+		res = append(res, Finding{Check: "rsa-invalid-exponent", Severity: "critical",
+			Keys: []string{source}, Detail: fmt.Sprintf("e = %d is not a valid public exponent", pub.E)})
+	case pub.E < 65537:
+		res = append(res, Finding{Check: "rsa-small-exponent", Severity: "warning",
+			Keys: []string{source}, Detail: fmt.Sprintf("e = %d allows recovering short or "+
+				"broadcast plaintexts with integer roots, and forging signatures for "+
+				"verifiers that don't check the whole padding (BB06)", pub.E)})
+	}
+	switch bits := pub.N.BitLen(); {
+	case bits < 1024:
+		res = append(res, Finding{Check: "rsa-small-modulus", Severity: "critical",
+			Keys: []string{source}, Detail: fmt.Sprintf("the modulus is only %d bits", bits)})
+	case bits < 2048:
+		res = append(res, Finding{Check: "rsa-small-modulus", Severity: "warning",
+			Keys: []string{source}, Detail: fmt.Sprintf("the modulus is only %d bits", bits)})
+	}
+	return res
+}
+
+// checkRSAModuli looks for repeated moduli, and for moduli that share a
+// factor, with batch GCD.
+func checkRSAModuli(keys []Key) []Finding {
+	var res []Finding
+	var unique []*big.Int
+	sources := make(map[string][]Key)
+	for _, k := range keys {
+		N := k.pub.(*rsa.PublicKey).N
+		s := N.Text(16)
+		if _, ok := sources[s]; !ok {
+			unique = append(unique, N)
+		}
+		sources[s] = append(sources[s], k)
+	}
+	for _, N := range unique {
+		ks := sources[N.Text(16)]
+		if len(ks) < 2 {
+			continue
+		}
+		f := Finding{Check: "rsa-repeated-modulus", Severity: "warning",
+			Detail: "the same key appears more than once"}
+		for _, k := range ks {
+			f.Keys = append(f.Keys, k.Source)
+			if k.pub.(*rsa.PublicKey).E != ks[0].pub.(*rsa.PublicKey).E {
+				f.Severity = "critical"
+				f.Detail = "the modulus is used with different exponents, which allows " +
+					"decrypting messages encrypted to both"
+			}
+		}
+		res = append(res, f)
+	}
+
+	gcds := attacks.BatchGCD(unique)
+	for i, N := range unique {
+		if gcds[i].Cmp(big1) == 0 {
+			continue
+		}
+		f := Finding{Check: "rsa-shared-factor", Severity: "critical",
+			Detail: "the modulus of the first key shares a prime factor with the others, " +
+				"so they can all be factored"}
+		for _, k := range sources[N.Text(16)] {
+			f.Keys = append(f.Keys, k.Source)
+		}
+		// If all the factors are shared, each with a different modulus, find
+		// them one by one.
+		factor := gcds[i]
+		for j, M := range unique {
+			if factor.Cmp(N) != 0 {
+				break
+			}
+			if j != i {
+				if g := new(big.Int).GCD(nil, nil, N, M); g.Cmp(big1) != 0 {
+					factor = g
+				}
+			}
+		}
+		for j, M := range unique {
+			if j != i && new(big.Int).GCD(nil, nil, factor, M).Cmp(big1) != 0 {
+				for _, k := range sources[M.Text(16)] {
+					f.Keys = append(f.Keys, k.Source)
+				}
+			}
+		}
+		f.Factor = factor.Text(16)
+		res = append(res, f)
+	}
+	return res
+}
+
+func checkDSAKey(source string, pub *dsa.PublicKey) []Finding {
+	var res []Finding
+	bad := func(detail string) {
+		res = append(res, Finding{Check: "dsa-invalid-parameters", Severity: "critical",
+			Keys: []string{source}, Detail: detail})
+	}
+	P, Q, G := pub.P, pub.Q, pub.G
+	pMinus1 := new(big.Int).Sub(P, big1)
+	switch {
+	case !P.ProbablyPrime(20) || !Q.ProbablyPrime(20):
+		bad("p or q is not prime")
+	case new(big.Int).Mod(pMinus1, Q).Sign() != 0:
+		bad("q does not divide p - 1")
+	case G.Cmp(big1) <= 0 || G.Cmp(pMinus1) >= 0:
+		bad(fmt.Sprintf("g = %v, which allows forging signatures for any message", G))
+	case new(big.Int).Exp(G, Q, P).Cmp(big1) != 0:
+		bad("g does not generate the subgroup of order q")
+	case pub.Y.Cmp(big1) <= 0 || pub.Y.Cmp(pMinus1) >= 0 ||
+		new(big.Int).Exp(pub.Y, Q, P).Cmp(big1) != 0:
+		bad("y is not in the subgroup of order q")
+	}
+	if bits := P.BitLen(); bits < 2048 {
+		res = append(res, Finding{Check: "dsa-small-modulus", Severity: "warning",
+			Keys: []string{source}, Detail: fmt.Sprintf("p is only %d bits", bits)})
+	}
+	return res
+}
+
+// smallFactors returns the prime factors of n smaller than bound.
+func smallFactors(n *big.Int, bound int64) []int64 {
+	var res []int64
+	n = new(big.Int).Set(n)
+	d, m := new(big.Int), new(big.Int)
+	for f := int64(2); f < bound; f++ {
+		d.SetInt64(f)
+		if m.Mod(n, d).Sign() != 0 {
+			continue
+		}
+		res = append(res, f)
+		for m.Mod(n, d).Sign() == 0 {
+			n.Div(n, d)
+		}
+	}
+	return res
+}
+
+func checkDHGroup(source string, P, G *big.Int) []Finding {
+	f := func(check, severity, detail string) Finding {
+		return Finding{Check: check, Severity: severity, Keys: []string{source}, Detail: detail}
+	}
+	if !P.ProbablyPrime(20) {
+		return []Finding{f("dh-composite-modulus", "critical", "p is not prime")}
+	}
+	var res []Finding
+	pMinus1 := new(big.Int).Sub(P, big1)
+	if G.Cmp(big1) <= 0 || G.Cmp(pMinus1) >= 0 {
+		res = append(res, f("dh-degenerate-generator", "critical", fmt.Sprintf("g = %v, "+
+			"so the shared secret is predictable", G)))
+	}
+	q := new(big.Int).Rsh(pMinus1, 1)
+	if !q.ProbablyPrime(20) {
+		detail := "p is not a safe prime, so unless g generates a large prime " +
+			"order subgroup and peers validate public values, small subgroup " +
+			"attacks can recover private keys"
+		if fs := smallFactors(pMinus1, 1<<16); len(fs) > 1 {
+			detail += fmt.Sprintf("; p - 1 has the small factors %v", fs)
+		}
+		res = append(res, f("dh-unsafe-group", "warning", detail))
+	}
+	if bits := P.BitLen(); bits < 2048 {
+		res = append(res, f("dh-small-modulus", "warning", fmt.Sprintf("p is only %d bits", bits)))
+	}
+	return res
+}
+
+func checkDHPublic(source string, P, Y *big.Int) []Finding {
+	if Y.Cmp(big1) > 0 && Y.Cmp(new(big.Int).Sub(P, big1)) < 0 {
+		return nil
+	}
+	return []Finding{{Check: "dh-degenerate-public", Severity: "critical", Keys: []string{source},
+		Detail: fmt.Sprintf("y = %v, so the shared secret is predictable", Y)}}
+}
+
+// lowNonceBits is the largest nonce size checked by checkDSASignatures.
+const lowNonceBits = 16
+
+// checkDSASignatures looks for signatures that share a nonce, or that have a
+// small one, and recovers the private key from them.
+func checkDSASignatures(pub *dsa.PublicKey, sigs []signature) []Finding {
+	var res []Finding
+	verified := func(x *big.Int) string {
+		if new(big.Int).Exp(pub.G, x, pub.P).Cmp(pub.Y) == 0 {
+			return "the recovered private key matches the public key"
+		}
+		return "the recovered private key does not match the public key"
+	}
+
+	byR := make(map[string][]signature)
+	var rs []string
+	for _, s := range sigs {
+		r := s.R.String()
+		if _, ok := byR[r]; !ok {
+			rs = append(rs, r)
+		}
+		byR[r] = append(byR[r], s)
+	}
+	for _, r := range rs {
+		group := byR[r]
+		if len(group) < 2 {
+			s := group[0]
+			x, err := attacks.RecoverDSAKeyFromLowK(&pub.Parameters, s.R, s.S, s.Hash, lowNonceBits)
+			if err == nil {
+				res = append(res, Finding{Check: "dsa-small-nonce", Severity: "critical",
+					Signatures: []string{s.Source}, PrivateKey: x.Text(16),
+					Detail: fmt.Sprintf("the nonce is at most %d bits; %s", lowNonceBits, verified(x))})
+			}
+			continue
+		}
+		f := Finding{Check: "dsa-repeated-nonce", Severity: "critical"}
+		for _, s := range group {
+			f.Signatures = append(f.Signatures, s.Source)
+		}
+		x, err := recoverFromGroup(pub, group)
+		if err != nil {
+			f.Detail = "the signatures share a nonce, but are of the same message"
+		} else {
+			f.Detail = "the signatures share a nonce; " + verified(x)
+			f.PrivateKey = x.Text(16)
+		}
+		res = append(res, f)
+	}
+	return res
+}
+
+func recoverFromGroup(pub *dsa.PublicKey, group []signature) (*big.Int, error) {
+	for _, s := range group[1:] {
+		x, err := attacks.RecoverDSAKeyFromRepeatedK(&pub.Parameters,
+			group[0].R, group[0].S, s.S, group[0].Hash, s.Hash)
+		if err == nil {
+			return x, nil
+		}
+	}
+	return nil, errors.New("no usable pair")
+}
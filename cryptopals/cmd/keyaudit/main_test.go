@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"crypto/dsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/ssh"
+)
+
+func hexToBig(t *testing.T, s string) *big.Int {
+	res, ok := new(big.Int).SetString(s, 16)
+	if !ok {
+		t.Fatal("failed to decode big.Int:", s)
+	}
+	return res
+}
+
+func prime(t *testing.T, bits int) *big.Int {
+	p, err := rand.Prime(rand.Reader, bits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestAudit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keyaudit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	write := func(name string, data []byte) string {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	// Two RSA keys that share a factor, one as PEM and one for SSH, and one
+	// with e = 3.
+	p, q1, q2 := prime(t, 1024), prime(t, 1024), prime(t, 1024)
+	shared1 := &rsa.PublicKey{N: new(big.Int).Mul(p, q1), E: 65537}
+	shared2 := &rsa.PublicKey{N: new(big.Int).Mul(p, q2), E: 65537}
+	small := &rsa.PublicKey{N: new(big.Int).Mul(prime(t, 1024), prime(t, 1024)), E: 3}
+	spki, err := x509.MarshalPKIXPublicKey(small)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaFile := write("rsa.pem", append(
+		pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(shared1)}),
+		pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: spki})...))
+	sshKey, err := ssh.NewPublicKey(shared2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sshFile := write("authorized_keys", append([]byte("# comment\n"), ssh.MarshalAuthorizedKey(sshKey)...))
+
+	// A PGP key with nothing wrong.
+	e, err := openpgp.NewEntity("Alice", "", "alice@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := &bytes.Buffer{}
+	w, err := armor.Encode(buf, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Serialize(w); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	pgpFile := write("alice.asc", buf.Bytes())
+
+	// A DH group with g = 1 and a prime that's not safe, and one that's fine
+	// but small (the 1536-bit MODP group from RFC 3526).
+	unsafe, _ := asn1.Marshal(struct{ P, G *big.Int }{prime(t, 512), big.NewInt(1)})
+	modp, _ := asn1.Marshal(struct{ P, G *big.Int }{hexToBig(t, "ffffffffffffffffc90fdaa22168c234c4c6628b80dc1cd129024e088a67cc74020bbea63b139b22514a08798e3404ddef9519b3cd3a431b302b0a6df25f14374fe1356d6d51c245e485b576625e7ec6f44c42e9a637ed6b0bff5cb6f406b7edee386bfb5a899fa5ae9f24117c4b1fe649286651ece45b3dc2007cb8a163bf0598da48361c55d39a69163fa8fd24cf5f83655d23dca3ad961c62f356208552bb9ed529077096966d670c354e4abc9804f1746c08ca237327ffffffffffffffff"), big.NewInt(2)})
+	dhFile := write("dh.pem", append(
+		pem.EncodeToMemory(&pem.Block{Type: "DH PARAMETERS", Bytes: unsafe}),
+		pem.EncodeToMemory(&pem.Block{Type: "DH PARAMETERS", Bytes: modp})...))
+
+	// A DSA key with the cryptopals parameters, and signatures with a repeated
+	// and a small nonce.
+	priv := &dsa.PrivateKey{}
+	priv.P = hexToBig(t, "800000000000000089e1855218a0e7dac38136ffafa72eda7859f2171e25e65eac698c1702578b07dc2a1076da241c76c62d374d8389ea5aeffd3226a0530cc565f3bf6b50929139ebeac04f48c3c84afb796d61e5a4f9a8fda812ab59494232c7d2b4deb50aa18ee9e132bfa85ac4374d7f9091abc3d015efc871a584471bb1")
+	priv.Q = hexToBig(t, "f4f47f05794b256174bba6e9b396a7707e563c5b")
+	priv.G = hexToBig(t, "5958c9d3898b224b12672c0b98e06c60df923cb8bc999d119458fef538b8fa4046c8db53039db620c094c9fa077ef389b5322a559946a71903f990f1f7e0e025e2d7f7cf494aff1a0470f5b64c36b625a097f1651fe775323556fe00b3608c887892878480e99041be601a62166ca6894bdd41a7054ec89f756ba9fc95302291")
+	if err := dsa.GenerateKey(priv, rand.Reader); err != nil {
+		t.Fatal(err)
+	}
+	dsaKey, err := ssh.NewPublicKey(&priv.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signerFile := write("signer.pub", ssh.MarshalAuthorizedKey(dsaKey))
+	sign := func(msg string, k *big.Int) string {
+		h := sha1.Sum([]byte(msg))
+		r := new(big.Int).Exp(priv.G, k, priv.P)
+		r.Mod(r, priv.Q)
+		s := new(big.Int).Mul(priv.X, r)
+		s.Add(s, new(big.Int).SetBytes(h[:]))
+		s.Mul(s, new(big.Int).ModInverse(k, priv.Q)).Mod(s, priv.Q)
+		return fmt.Sprintf("msg: %s\ns: %v\nr: %v\nm: %x\n", msg, s, r, h)
+	}
+	k, _ := rand.Int(rand.Reader, priv.Q)
+	corpus := sign("Listen for me, you better listen for me now. ", k) +
+		sign("Pure black people mon is all I mon know. ", new(big.Int).Add(k, big1)) +
+		sign("Yeah me shoes a an tear up an' now me toes is a show a ", k) +
+		sign("For those that envy a MC it can be hazardous to your health ", big.NewInt(4242))
+	corpusFile := write("44.txt", []byte(corpus))
+
+	var keys []Key
+	for _, name := range []string{rsaFile, sshFile, pgpFile, dhFile, signerFile} {
+		k, err := readKeyFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, k...)
+	}
+	if len(keys) != 8 {
+		t.Errorf("got %d keys, expected 8", len(keys))
+	}
+	sigs, err := readSignatures(corpusFile, []byte(corpus))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sigs) != 4 {
+		t.Errorf("got %d signatures, expected 4", len(sigs))
+	}
+
+	found := make(map[string][]Finding)
+	for _, f := range audit(keys, &priv.PublicKey, sigs) {
+		t.Logf("%s %s %v %v: %s", f.Severity, f.Check, f.Keys, f.Signatures, f.Detail)
+		found[f.Check] = append(found[f.Check], f)
+	}
+	expect := func(check string, n int) []Finding {
+		if len(found[check]) != n {
+			t.Errorf("got %d %s findings, expected %d", len(found[check]), check, n)
+		}
+		return found[check]
+	}
+	for _, f := range expect("rsa-shared-factor", 2) {
+		if f.Factor != p.Text(16) || len(f.Keys) != 2 {
+			t.Errorf("wrong shared factor finding: %+v", f)
+		}
+	}
+	expect("rsa-small-exponent", 1)
+	expect("dh-degenerate-generator", 1)
+	expect("dh-unsafe-group", 1)
+	expect("dh-small-modulus", 2)
+	expect("dsa-small-modulus", 1)
+	expect("dsa-invalid-parameters", 0)
+	for _, f := range append(expect("dsa-repeated-nonce", 1), expect("dsa-small-nonce", 1)...) {
+		if f.PrivateKey != priv.X.Text(16) {
+			t.Errorf("wrong private key in %+v", f)
+		}
+	}
+	if n := len(found["dsa-repeated-nonce"]); n > 0 && len(found["dsa-repeated-nonce"][0].Signatures) != 2 {
+		t.Errorf("wrong signatures in %+v", found["dsa-repeated-nonce"][0])
+	}
+}
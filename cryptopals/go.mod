@@ -0,0 +1,5 @@
+module filippo.io/mostly-harmless/cryptopals
+
+go 1.12
+
+require golang.org/x/crypto v0.0.0-20190308221718-c2843e01d9a2
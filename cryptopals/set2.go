@@ -5,12 +5,13 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
-	"fmt"
 	mathrand "math/rand"
 	"net/url"
 	"strconv"
 	"strings"
 	"time"
+
+	"filippo.io/mostly-harmless/cryptopals/attacks"
 )
 
 func padPKCS7(in []byte, size int) []byte {
@@ -107,58 +108,22 @@ func newECBSuffixOracle(secret []byte) func([]byte) []byte {
 	}
 }
 
-func recoverECBSuffix(oracle func([]byte) []byte) []byte {
-	var bs int
-	for blockSize := 2; blockSize < 100; blockSize++ {
-		msg := bytes.Repeat([]byte{42}, blockSize*2)
-		msg = append(msg, 3)
-		if detectECB(oracle(msg)[:blockSize*2], blockSize) {
-			bs = blockSize
-			break
-		}
-	}
-	if bs == 0 {
-		panic("didn't detect block size")
-	}
-	fmt.Println("bs:", bs)
-
-	buildDict := func(known []byte) map[string]byte {
-		dict := make(map[string]byte)
-
-		msg := bytes.Repeat([]byte{42}, bs)
-		msg = append(msg, known...)
-		msg = append(msg, '?')
-		msg = msg[len(msg)-bs:]
-
-		for b := 0; b < 256; b++ {
-			msg[bs-1] = byte(b)
-			res := string(oracle(msg)[:bs])
-			dict[res] = byte(b)
-		}
-		return dict
-	}
-
-	dict := buildDict(nil)
-	msg := bytes.Repeat([]byte{42}, bs-1)
-	res := string(oracle(msg)[:bs])
-	firstByte := dict[res]
-	fmt.Printf("First byte: %c / %v\n", firstByte, firstByte)
+// encryptionOracle and validityOracle adapt the oracles of the challenges,
+// which can't fail, to the attacks package.
+func encryptionOracle(f func([]byte) []byte) attacks.EncryptionOracle {
+	return func(msg []byte) ([]byte, error) { return f(msg), nil }
+}
 
-	var plaintext []byte
-	for i := 0; i < len(oracle([]byte{})); i++ {
-		dict := buildDict(plaintext)
-		msg := bytes.Repeat([]byte{42}, mod(bs-i-1, bs))
-		skip := i / bs * bs
-		res := string(oracle(msg)[skip : skip+bs])
-		plaintext = append(plaintext, dict[res])
+func validityOracle(f func([]byte) bool) attacks.ValidityOracle {
+	return func(msg []byte) (bool, error) { return f(msg), nil }
+}
 
-		// lines := bytes.SplitAfter(plaintext, []byte{'\n'})
-		// fmt.Printf("\r%s", lines[len(lines)-1])
-		fmt.Printf("%c", dict[res])
+func recoverECBSuffix(oracle func([]byte) []byte) []byte {
+	res, err := attacks.RecoverECBSuffix(encryptionOracle(oracle), &attacks.Options{Parallelism: 16})
+	if err != nil {
+		panic(err)
 	}
-	fmt.Printf("\n")
-
-	return nil
+	return res
 }
 
 func mod(a, b int) int {
@@ -259,38 +224,11 @@ func ecbIndex(in []byte, bs int) int {
 }
 
 func recoverECBSuffixWithPrefix(oracle func([]byte) []byte) []byte {
-	var bs, pl int
-	out := oracle(bytes.Repeat([]byte{42}, 500))
-	for blockSize := 2; blockSize < 100; blockSize++ {
-		if len(out)%blockSize != 0 {
-			continue
-		}
-		i := ecbIndex(out, blockSize)
-		if i < 0 {
-			continue
-		}
-		bs = blockSize
-		fmt.Println("bs:", bs)
-		for p := 0; p < bs; p++ {
-			msg := append(bytes.Repeat([]byte{42}, p+bs*2), 'X')
-			if ecbIndex(oracle(msg), bs) == i {
-				pl = i - p
-				fmt.Println("pl:", pl)
-				break
-			}
-		}
-		break
-	}
-	if bs == 0 || pl == 0 {
-		panic("didn't detect block or prefix size")
+	res, err := attacks.RecoverECBSuffixWithPrefix(encryptionOracle(oracle), nil)
+	if err != nil {
+		panic(err)
 	}
-
-	return recoverECBSuffix(func(in []byte) []byte {
-		p := bs - pl%bs
-		msg := append(bytes.Repeat([]byte{42}, p), in...)
-		out := oracle(msg)
-		return out[pl+p:]
-	})
+	return res
 }
 
 func newCBCCookieOracles() (
@@ -5,9 +5,15 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/bits"
 	mathrand "math/rand"
+	"sort"
 	"time"
 	"unicode"
+
+	"filippo.io/mostly-harmless/cryptopals/attacks"
 )
 
 func newCBCPaddingOracles(plaintext []byte) (
@@ -33,69 +39,12 @@ func newCBCPaddingOracles(plaintext []byte) (
 }
 
 func attackCBCPaddingOracle(ct []byte, checkMessagePadding func(ct []byte) bool) []byte {
-	findNextByte := func(known, iv, block []byte) []byte {
-		if len(block) != 16 || len(iv) != 16 || len(known) >= 16 {
-			panic("wrong lengths for findNextByte")
-		}
-		payload := make([]byte, 32)
-		copy(payload[16:], block)
-		plaintext := append([]byte{0}, known...)
-
-		for p := 0; p < 256; p++ {
-			copy(payload, iv)
-			plaintext[0] = byte(p)
-
-			// neuter the plaintext bytes
-			for i := range plaintext {
-				payload[len(payload)-1-16-i] ^= plaintext[len(plaintext)-1-i]
-			}
-
-			// apply valid padding
-			for i := range plaintext {
-				payload[len(payload)-1-16-i] ^= byte(len(plaintext))
-			}
-
-			// check we actually changed something
-			if bytes.Equal(payload[:16], iv) {
-				continue
-			}
-
-			if checkMessagePadding(payload) {
-				return plaintext
-			}
-		}
-
-		// if the only one that works is not changing anything,
-		// there's already a padding of len len(plaintext)
-		plaintext[0] = byte(len(plaintext))
-		for _, c := range plaintext {
-			if c != byte(len(plaintext)) {
-				// TODO: make test case for this
-				plaintext[1] ^= byte(len(plaintext))
-				return plaintext[1:] // correct and retry
-			}
-		}
-		return plaintext
-	}
-
-	if len(ct)%16 != 0 {
-		panic("attackCBCPaddingOracle: invalid ciphertext length")
-	}
-
-	var plaintext []byte
-	for b := 0; b < len(ct)/16-1; b++ {
-		var known []byte
-		blockStart := len(ct) - b*16 - 16
-		block := ct[blockStart : blockStart+16]
-		iv := ct[blockStart-16 : blockStart]
-		for len(known) < 16 {
-			known = findNextByte(known, iv, block)
-			// log.Printf("guess: %x", known)
-		}
-		plaintext = append(known, plaintext...)
+	res, err := attacks.AttackCBCPaddingOracle(ct, validityOracle(checkMessagePadding),
+		&attacks.Options{Parallelism: 16})
+	if err != nil {
+		panic(err)
 	}
-
-	return plaintext
+	return res
 }
 
 func encryptCTR(src []byte, b cipher.Block, nonce []byte) []byte {
@@ -193,14 +142,16 @@ func (m *MT19937) ExtractNumber() uint32 {
 		m.twist()
 	}
 
-	y := m.mt[m.index]
+	y := temperMT19937(m.mt[m.index])
+	m.index++
+	return y
+}
 
+func temperMT19937(y uint32) uint32 {
 	y ^= y >> 11
 	y ^= y << 7 & 2636928640
 	y ^= y << 15 & 4022730752
 	y ^= y >> 18
-
-	m.index++
 	return y
 }
 
@@ -310,3 +261,321 @@ func detectMT19937Token(token []byte) bool {
 	}
 	return false
 }
+
+// An mtOutput is a partial observation of an MT19937 output: the bits set in
+// mask are the ones of value. index counts the outputs from the first one the
+// recovered generator will produce, and doesn't need to be contiguous.
+type mtOutput struct {
+	index       int
+	value, mask uint32
+}
+
+// The variables of the linear system solved by recoverMT19937 are the bits of
+// the 624 untempered outputs that precede output 0, which make up the state.
+// Only the top bit of the first one is ever used, so the rank is at most 19937.
+const (
+	mtVars  = 624 * 32
+	mtWords = mtVars / 64
+	mtRank  = mtVars - 31
+)
+
+// mtSymbolicWord is the bits of an untempered MT19937 output, as linear
+// combinations of the variables.
+type mtSymbolicWord [32][]uint64
+
+// mtTemperRows[j] is the mask of the bits of an untempered output that are
+// XOR'd together to make bit j of the tempered output.
+var mtTemperRows = func() (rows [32]uint32) {
+	for k := uint(0); k < 32; k++ {
+		t := temperMT19937(1 << k)
+		for j := uint(0); j < 32; j++ {
+			rows[j] |= (t >> j & 1) << k
+		}
+	}
+	return
+}()
+
+// mtSystem is a system of linear equations over GF(2) on the variables, kept
+// in echelon form: pivots[p] is nil or the equation with highest variable p.
+type mtSystem struct {
+	pivots [mtVars][]uint64
+	rhs    [mtVars]uint8
+	rank   int
+}
+
+// add reduces the equation row · x = b against the pivots and inserts it, if
+// it's independent. row is modified.
+func (s *mtSystem) add(row []uint64, b uint8) error {
+	for w := mtWords - 1; w >= 0; {
+		if row[w] == 0 {
+			w--
+			continue
+		}
+		p := w*64 + 63 - bits.LeadingZeros64(row[w])
+		piv := s.pivots[p]
+		if piv == nil {
+			s.pivots[p], s.rhs[p] = row, b
+			s.rank++
+			return nil
+		}
+		for i := 0; i <= w; i++ {
+			row[i] ^= piv[i]
+		}
+		b ^= s.rhs[p]
+	}
+	if b != 0 {
+		return errors.New("inconsistent observations")
+	}
+	return nil
+}
+
+// solve returns a solution, with the free variables set to zero.
+func (s *mtSystem) solve() []uint64 {
+	x := make([]uint64, mtWords)
+	for p, row := range s.pivots {
+		if row == nil {
+			continue
+		}
+		v := s.rhs[p]
+		for i := 0; i <= p/64; i++ {
+			v ^= uint8(bits.OnesCount64(row[i]&x[i]) & 1)
+		}
+		x[p/64] |= uint64(v) << uint(p%64)
+	}
+	return x
+}
+
+// recoverMT19937 returns a clone of the MT19937 generator that produced the
+// outputs, positioned to produce output 0 next. Each output bit is a linear
+// function of the state, through the tempering and the twist, so the state is
+// found by Gaussian elimination once the observed bits have full rank, which
+// takes at least 19937 of them, and in practice more when only some bits of
+// each output are known.
+func recoverMT19937(outputs []mtOutput) (*MT19937, error) {
+	outputs = append([]mtOutput{}, outputs...)
+	sort.Slice(outputs, func(i, j int) bool { return outputs[i].index < outputs[j].index })
+
+	// xs is a ring buffer of the symbolic untempered outputs, with x_n at
+	// n mod 624. It starts with the variables, x_-624 to x_-1.
+	var xs [624]mtSymbolicWord
+	for k := range xs {
+		for i := range xs[k] {
+			xs[k][i] = make([]uint64, mtWords)
+			v := k*32 + i
+			xs[k][i][v/64] = 1 << uint(v%64)
+		}
+	}
+	xor := func(dst, a, b []uint64) {
+		for i := range dst {
+			dst[i] = a[i] ^ b[i]
+		}
+	}
+	var next mtSymbolicWord
+	for i := range next {
+		next[i] = make([]uint64, mtWords)
+	}
+	n := 0
+	// step computes x_n = x_n-227 ^ twist(x_n-624, x_n-623).
+	step := func() {
+		a, b, c := &xs[n%624], &xs[(n+1)%624], &xs[(n+397)%624]
+		// y is the top bit of a and the rest of b, and it's shifted right by
+		// one, with its bottom bit selecting the XOR with 0x9908b0df.
+		for i := 0; i < 31; i++ {
+			copy(next[i], c[i])
+			y := b[i+1]
+			if i+1 == 31 {
+				y = a[31]
+			}
+			xor(next[i], next[i], y)
+		}
+		copy(next[31], c[31])
+		for i := uint(0); i < 32; i++ {
+			if 0x9908b0df>>i&1 != 0 {
+				xor(next[i], next[i], b[0])
+			}
+		}
+		xs[n%624], next = next, *a
+		n++
+	}
+
+	s := &mtSystem{}
+	for _, o := range outputs {
+		if o.index < 0 {
+			return nil, errors.New("negative output index")
+		}
+		for n <= o.index {
+			step()
+		}
+		x := &xs[o.index%624]
+		for j := uint(0); j < 32 && s.rank < mtRank; j++ {
+			if o.mask>>j&1 == 0 {
+				continue
+			}
+			row := make([]uint64, mtWords)
+			for k := uint(0); k < 32; k++ {
+				if mtTemperRows[j]>>k&1 != 0 {
+					xor(row, row, x[k])
+				}
+			}
+			if err := s.add(row, uint8(o.value>>j&1)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if s.rank < mtRank {
+		return nil, fmt.Errorf("not enough observations: %d of %d bits of state", s.rank, mtRank)
+	}
+
+	sol := s.solve()
+	m := &MT19937{index: 624}
+	for k := range m.mt {
+		m.mt[k] = uint32(sol[k/2] >> uint(k%2*32))
+	}
+
+	// The observations past full rank were not used, so check them all.
+	check := *m
+	pos, last := 0, uint32(0)
+	for _, o := range outputs {
+		for ; pos <= o.index; pos++ {
+			last = check.ExtractNumber()
+		}
+		if (last^o.value)&o.mask != 0 {
+			return nil, errors.New("inconsistent observations")
+		}
+	}
+	return m, nil
+}
+
+// pythonRandom is Python's random.Random, which is built on MT19937.
+type pythonRandom struct {
+	mt *MT19937
+}
+
+// newPythonRandom returns the generator of random.seed(seed).
+func newPythonRandom(seed uint64) *pythonRandom {
+	// init_by_array, with the seed split in 32-bit words.
+	key := []uint32{uint32(seed)}
+	if seed>>32 != 0 {
+		key = append(key, uint32(seed>>32))
+	}
+	m := NewMT19937(19650218)
+	mt := &m.mt
+	i, j := 1, 0
+	for k := 624; k > 0; k-- {
+		mt[i] = (mt[i] ^ (mt[i-1]^mt[i-1]>>30)*1664525) + key[j] + uint32(j)
+		i, j = i+1, j+1
+		if i >= 624 {
+			mt[0], i = mt[623], 1
+		}
+		if j >= len(key) {
+			j = 0
+		}
+	}
+	for k := 623; k > 0; k-- {
+		mt[i] = (mt[i] ^ (mt[i-1]^mt[i-1]>>30)*1566083941) - uint32(i)
+		i++
+		if i >= 624 {
+			mt[0], i = mt[623], 1
+		}
+	}
+	mt[0] = 0x80000000
+	return &pythonRandom{mt: m}
+}
+
+// clonePythonRandom returns a clone of a Python generator, positioned at
+// output 0. See recoverMT19937.
+func clonePythonRandom(outputs []mtOutput) (*pythonRandom, error) {
+	m, err := recoverMT19937(outputs)
+	if err != nil {
+		return nil, err
+	}
+	return &pythonRandom{mt: m}, nil
+}
+
+// random returns a float64 in [0, 1), made of two outputs.
+func (r *pythonRandom) random() float64 {
+	a, b := r.mt.ExtractNumber()>>5, r.mt.ExtractNumber()>>6
+	return (float64(a)*67108864 + float64(b)) / 9007199254740992
+}
+
+// getrandbits returns k random bits, with k between 1 and 32.
+func (r *pythonRandom) getrandbits(k uint) uint32 {
+	return r.mt.ExtractNumber() >> (32 - k)
+}
+
+// randbelow returns an integer in [0, n), with n below 2^32, using as many
+// outputs as it takes for getrandbits to return one.
+func (r *pythonRandom) randbelow(n int) int {
+	k := uint(bits.Len(uint(n)))
+	x := r.getrandbits(k)
+	for int(x) >= n {
+		x = r.getrandbits(k)
+	}
+	return int(x)
+}
+
+// randint returns an integer in [a, b].
+func (r *pythonRandom) randint(a, b int) int {
+	return a + r.randbelow(b-a+1)
+}
+
+// pythonRandomOutputs returns what a value f returned by random() reveals of
+// the outputs index and index+1: their top 27 and 26 bits.
+func pythonRandomOutputs(index int, f float64) []mtOutput {
+	x := uint64(f * 9007199254740992)
+	return []mtOutput{
+		{index: index, value: uint32(x>>26) << 5, mask: 0xffffffe0},
+		{index: index + 1, value: uint32(x) << 6, mask: 0xffffffc0},
+	}
+}
+
+// pythonGetrandbitsOutput returns what a value x returned by getrandbits(k)
+// reveals of the output index: its top k bits.
+func pythonGetrandbitsOutput(index int, x uint32, k uint) mtOutput {
+	return mtOutput{index: index, value: x << (32 - k), mask: ^uint32(0) << (32 - k)}
+}
+
+// goRandSource is a clone of a source returned by Go's math/rand.NewSource.
+// That's not MT19937, but an additive lagged Fibonacci generator,
+//
+//	x_n = x_n-607 + x_n-273 mod 2^64
+//
+// whose state is just its last 607 outputs. goRandSource implements
+// rand.Source64, so rand.New(src) predicts any method of the original
+// rand.Rand, if called in the same sequence.
+type goRandSource struct {
+	vec [607]uint64
+	n   int
+}
+
+// cloneGoRand returns a clone of the source that produced outputs, which are
+// at least 607 consecutive results of Uint64 or Int63, positioned to produce
+// the output that follows them.
+//
+// Since the top bit doesn't affect the others, 63-bit outputs are enough to
+// predict the next Int63 results, and so all the methods of rand.Rand except
+// Uint64. Truncated outputs, like those of Intn, are not: unlike MT19937, the
+// generator is not linear over GF(2), because of the carries.
+func cloneGoRand(outputs []uint64) (*goRandSource, error) {
+	if len(outputs) < 607 {
+		return nil, errors.New("need at least 607 consecutive outputs")
+	}
+	g := &goRandSource{}
+	copy(g.vec[:], outputs[len(outputs)-607:])
+	return g, nil
+}
+
+func (g *goRandSource) Uint64() uint64 {
+	x := g.vec[g.n] + g.vec[(g.n+334)%607]
+	g.vec[g.n] = x
+	g.n = (g.n + 1) % 607
+	return x
+}
+
+func (g *goRandSource) Int63() int64 {
+	return int64(g.Uint64() & (1<<63 - 1))
+}
+
+func (g *goRandSource) Seed(int64) {
+	panic("a cloned source can't be seeded")
+}
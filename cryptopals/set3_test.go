@@ -451,3 +451,112 @@ func TestProblem24(t *testing.T) {
 		t.Error("Detected non-MT19937 token.")
 	}
 }
+
+func TestPythonRandom(t *testing.T) {
+	r := newPythonRandom(42)
+	for _, f := range []float64{0.6394267984578837, 0.025010755222666936, 0.27502931836911926} {
+		if x := r.random(); x != f {
+			t.Errorf("random() = %v, expected %v", x, f)
+		}
+	}
+	r = newPythonRandom(42)
+	for _, x := range []uint32{2746317213, 478163327, 107420369} {
+		if y := r.getrandbits(32); y != x {
+			t.Errorf("getrandbits(32) = %v, expected %v", y, x)
+		}
+	}
+	if y := r.getrandbits(7); y != 94 {
+		t.Errorf("getrandbits(7) = %v, expected 94", y)
+	}
+	r = newPythonRandom(1<<40 + 5)
+	for _, x := range []int{517, 530, 276, 680, 949} {
+		if y := r.randint(1, 1000); y != x {
+			t.Errorf("randint(1, 1000) = %v, expected %v", y, x)
+		}
+	}
+	if x := newPythonRandom(0).random(); x != 0.8444218515250481 {
+		t.Errorf("random() = %v with seed 0", x)
+	}
+}
+
+func TestRecoverMT19937(t *testing.T) {
+	// Calls to random(), skipping one in three.
+	target := newPythonRandom(rand.Uint64())
+	var outputs []mtOutput
+	index := 0
+	for i := 0; i < 2000; i++ {
+		f := target.random()
+		if i%3 != 2 {
+			outputs = append(outputs, pythonRandomOutputs(index, f)...)
+		}
+		index += 2
+	}
+	start := time.Now()
+	clone, err := clonePythonRandom(outputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log("recovered the state from random() in", time.Since(start))
+	for i := 0; i < index; i++ {
+		clone.mt.ExtractNumber()
+	}
+	for i := 0; i < 100; i++ {
+		if x, y := target.randint(1, 1000), clone.randint(1, 1000); x != y {
+			t.Fatalf("randint(1, 1000) = %d, predicted %d", x, y)
+		}
+	}
+
+	// The bottom byte of each output, like rand() % 256.
+	mt := NewMT19937(rand.Uint32())
+	outputs = nil
+	for i := 0; i < 5000; i++ {
+		outputs = append(outputs, mtOutput{index: i, value: mt.ExtractNumber() & 0xff, mask: 0xff})
+	}
+	m, err := recoverMT19937(outputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5000; i++ {
+		m.ExtractNumber()
+	}
+	for i := 0; i < 1000; i++ {
+		if mt.ExtractNumber() != m.ExtractNumber() {
+			t.Fatal("wrong prediction after recovering from the bottom byte")
+		}
+	}
+
+	// Top bits from getrandbits, with a wrong one.
+	target = newPythonRandom(rand.Uint64())
+	outputs = nil
+	for i := 0; i < 1000; i++ {
+		outputs = append(outputs, pythonGetrandbitsOutput(i, target.getrandbits(30), 30))
+	}
+	if _, err := recoverMT19937(outputs[:100]); err == nil {
+		t.Error("recovered the state from too few outputs")
+	}
+	outputs[999].value ^= 1 << 31
+	if _, err := recoverMT19937(outputs); err == nil {
+		t.Error("inconsistent outputs were accepted")
+	}
+}
+
+func TestCloneGoRand(t *testing.T) {
+	target := rand.New(rand.NewSource(time.Now().UnixNano()))
+	var outputs []uint64
+	for i := 0; i < 700; i++ {
+		outputs = append(outputs, uint64(target.Int63()))
+	}
+	src, err := cloneGoRand(outputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clone := rand.New(src)
+	for i := 0; i < 1000; i++ {
+		if x, y := target.Intn(1000), clone.Intn(1000); x != y {
+			t.Fatalf("Intn(1000) = %d, predicted %d", x, y)
+		}
+		if x, y := target.Float64(), clone.Float64(); x != y {
+			t.Fatalf("Float64() = %v, predicted %v", x, y)
+		}
+	}
+}
@@ -8,9 +8,12 @@ import (
 	"crypto/sha1"
 	"encoding/binary"
 	"fmt"
+	"math/bits"
 	"regexp"
 	"strings"
 	"time"
+
+	"filippo.io/mostly-harmless/cryptopals/attacks"
 )
 
 func newCTREditOracles(plaintext []byte) (
@@ -341,22 +344,27 @@ func checkSecretPrefixMAC(key, message, mac []byte) bool {
 	return bytes.Equal(mac, sha1[:])
 }
 
-func mdPadding(len int) []byte {
+// mdPadding returns the padding SHA-1 and SHA-2 append to a message of length
+// len, for blocks of blockSize bytes: a 1 bit, 0 bits, and the length in bits
+// as a big-endian integer in the last blockSize/8 bytes of the block.
+func mdPadding(len, blockSize int) []byte {
 	buf := &bytes.Buffer{}
 
-	// Padding.  Add a 1 bit and 0 bits until 56 bytes mod 64.
-	var tmp [64]byte
+	// Padding.  Add a 1 bit and 0 bits until blockSize/8 bytes before the
+	// end of a block.
+	lenSize := blockSize / 8
+	tmp := make([]byte, blockSize)
 	tmp[0] = 0x80
-	if len%64 < 56 {
-		buf.Write(tmp[0 : 56-len%64])
+	if len%blockSize < blockSize-lenSize {
+		buf.Write(tmp[0 : blockSize-lenSize-len%blockSize])
 	} else {
-		buf.Write(tmp[0 : 64+56-len%64])
+		buf.Write(tmp[0 : 2*blockSize-lenSize-len%blockSize])
 	}
 
 	// Length in bits.
-	len <<= 3
-	putUint64(tmp[:], uint64(len))
-	buf.Write(tmp[0:8])
+	tmp[0] = 0
+	putUint64(tmp[lenSize-8:], uint64(len)<<3)
+	buf.Write(tmp[0:lenSize])
 
 	return buf.Bytes()
 }
@@ -385,22 +393,11 @@ func newSecretPrefixMACOracle() (
 }
 
 func extendSHA1(mac, msg, extension []byte) (newMAC, newMSG []byte) {
-	newMSG = append(newMSG, msg...)
-	newMSG = append(newMSG, mdPadding(len(msg)+16)...)
-
-	s := &SHA1{}
-	s.h[0] = binary.BigEndian.Uint32(mac[0:])
-	s.h[1] = binary.BigEndian.Uint32(mac[4:])
-	s.h[2] = binary.BigEndian.Uint32(mac[8:])
-	s.h[3] = binary.BigEndian.Uint32(mac[12:])
-	s.h[4] = binary.BigEndian.Uint32(mac[16:])
-	s.len = uint64(len(newMSG) + 16)
-
-	s.Write(extension)
-	newMSG = append(newMSG, extension...)
-
-	sha1 := s.checkSum()
-	return sha1[:], newMSG
+	newMAC, newMSG, err := attacks.ExtendSHA1(mac, msg, extension, 16)
+	if err != nil {
+		panic(err)
+	}
+	return
 }
 
 func makeSHA1AdminCookie(cookie []byte) []byte {
@@ -409,6 +406,263 @@ func makeSHA1AdminCookie(cookie []byte) []byte {
 	return append(newMAC, newMSG...)
 }
 
+// ************* SHA-256 and SHA-512 code *************
+
+const (
+	chunk256 = 64
+	chunk512 = 128
+)
+
+var _K256 = [64]uint32{
+	0x428a2f98, 0x71374491, 0xb5c0fbcf, 0xe9b5dba5, 0x3956c25b, 0x59f111f1, 0x923f82a4, 0xab1c5ed5,
+	0xd807aa98, 0x12835b01, 0x243185be, 0x550c7dc3, 0x72be5d74, 0x80deb1fe, 0x9bdc06a7, 0xc19bf174,
+	0xe49b69c1, 0xefbe4786, 0x0fc19dc6, 0x240ca1cc, 0x2de92c6f, 0x4a7484aa, 0x5cb0a9dc, 0x76f988da,
+	0x983e5152, 0xa831c66d, 0xb00327c8, 0xbf597fc7, 0xc6e00bf3, 0xd5a79147, 0x06ca6351, 0x14292967,
+	0x27b70a85, 0x2e1b2138, 0x4d2c6dfc, 0x53380d13, 0x650a7354, 0x766a0abb, 0x81c2c92e, 0x92722c85,
+	0xa2bfe8a1, 0xa81a664b, 0xc24b8b70, 0xc76c51a3, 0xd192e819, 0xd6990624, 0xf40e3585, 0x106aa070,
+	0x19a4c116, 0x1e376c08, 0x2748774c, 0x34b0bcb5, 0x391c0cb3, 0x4ed8aa4a, 0x5b9cca4f, 0x682e6ff3,
+	0x748f82ee, 0x78a5636f, 0x84c87814, 0x8cc70208, 0x90befffa, 0xa4506ceb, 0xbef9a3f7, 0xc67178f2,
+}
+
+var _K512 = [80]uint64{
+	0x428a2f98d728ae22, 0x7137449123ef65cd, 0xb5c0fbcfec4d3b2f, 0xe9b5dba58189dbbc,
+	0x3956c25bf348b538, 0x59f111f1b605d019, 0x923f82a4af194f9b, 0xab1c5ed5da6d8118,
+	0xd807aa98a3030242, 0x12835b0145706fbe, 0x243185be4ee4b28c, 0x550c7dc3d5ffb4e2,
+	0x72be5d74f27b896f, 0x80deb1fe3b1696b1, 0x9bdc06a725c71235, 0xc19bf174cf692694,
+	0xe49b69c19ef14ad2, 0xefbe4786384f25e3, 0x0fc19dc68b8cd5b5, 0x240ca1cc77ac9c65,
+	0x2de92c6f592b0275, 0x4a7484aa6ea6e483, 0x5cb0a9dcbd41fbd4, 0x76f988da831153b5,
+	0x983e5152ee66dfab, 0xa831c66d2db43210, 0xb00327c898fb213f, 0xbf597fc7beef0ee4,
+	0xc6e00bf33da88fc2, 0xd5a79147930aa725, 0x06ca6351e003826f, 0x142929670a0e6e70,
+	0x27b70a8546d22ffc, 0x2e1b21385c26c926, 0x4d2c6dfc5ac42aed, 0x53380d139d95b3df,
+	0x650a73548baf63de, 0x766a0abb3c77b2a8, 0x81c2c92e47edaee6, 0x92722c851482353b,
+	0xa2bfe8a14cf10364, 0xa81a664bbc423001, 0xc24b8b70d0f89791, 0xc76c51a30654be30,
+	0xd192e819d6ef5218, 0xd69906245565a910, 0xf40e35855771202a, 0x106aa07032bbd1b8,
+	0x19a4c116b8d2d0c8, 0x1e376c085141ab53, 0x2748774cdf8eeb99, 0x34b0bcb5e19b48a8,
+	0x391c0cb3c5c95a63, 0x4ed8aa4ae3418acb, 0x5b9cca4f7763e373, 0x682e6ff3d6b2b8a3,
+	0x748f82ee5defb2fc, 0x78a5636f43172f60, 0x84c87814a1f0ab72, 0x8cc702081a6439ec,
+	0x90befffa23631e28, 0xa4506cebde82bde9, 0xbef9a3f7b2c67915, 0xc67178f2e372532b,
+	0xca273eceea26619c, 0xd186b8c721c0c207, 0xeada7dd6cde0eb1e, 0xf57d4f7fee6ed178,
+	0x06f067aa72176fba, 0x0a637dc5a2c898a6, 0x113f9804bef90dae, 0x1b710b35131c471b,
+	0x28db77f523047d84, 0x32caab7b40c72493, 0x3c9ebe0a15c9bebc, 0x431d67c49c100d4c,
+	0x4cc5d4becb3e42b6, 0x597f299cfc657e2a, 0x5fcb6fab3ad6faec, 0x6c44198c4a475817,
+}
+
+type SHA256 struct {
+	h   [8]uint32
+	x   [chunk256]byte
+	nx  int
+	len uint64
+}
+
+func (d *SHA256) Reset() {
+	d.h = [8]uint32{0x6a09e667, 0xbb67ae85, 0x3c6ef372, 0xa54ff53a,
+		0x510e527f, 0x9b05688c, 0x1f83d9ab, 0x5be0cd19}
+	d.nx = 0
+	d.len = 0
+}
+
+func NewSHA256() *SHA256 {
+	d := new(SHA256)
+	d.Reset()
+	return d
+}
+
+// SetState makes d continue from the state that produced digest, after
+// hashing len bytes, including the padding.
+func (d *SHA256) SetState(digest []byte, len uint64) {
+	if len%chunk256 != 0 {
+		panic("len is not a multiple of the block size")
+	}
+	for i := range d.h {
+		d.h[i] = binary.BigEndian.Uint32(digest[i*4:])
+	}
+	d.nx = 0
+	d.len = len
+}
+
+func (d *SHA256) Write(p []byte) (nn int, err error) {
+	nn = len(p)
+	d.len += uint64(nn)
+	if d.nx > 0 {
+		n := copy(d.x[d.nx:], p)
+		d.nx += n
+		if d.nx == chunk256 {
+			sha256Block(d, d.x[:])
+			d.nx = 0
+		}
+		p = p[n:]
+	}
+	if len(p) >= chunk256 {
+		n := len(p) &^ (chunk256 - 1)
+		sha256Block(d, p[:n])
+		p = p[n:]
+	}
+	if len(p) > 0 {
+		d.nx = copy(d.x[:], p)
+	}
+	return
+}
+
+func (d *SHA256) checkSum() [32]byte {
+	d.Write(mdPadding(int(d.len), chunk256))
+	if d.nx != 0 {
+		panic("d.nx != 0")
+	}
+
+	var digest [32]byte
+	for i, h := range d.h {
+		putUint32(digest[i*4:], h)
+	}
+	return digest
+}
+
+func sha256Block(dig *SHA256, p []byte) {
+	var w [64]uint32
+	for len(p) >= chunk256 {
+		for i := 0; i < 16; i++ {
+			w[i] = binary.BigEndian.Uint32(p[i*4:])
+		}
+		for i := 16; i < 64; i++ {
+			v1, v2 := w[i-2], w[i-15]
+			t1 := bits.RotateLeft32(v1, -17) ^ bits.RotateLeft32(v1, -19) ^ v1>>10
+			t2 := bits.RotateLeft32(v2, -7) ^ bits.RotateLeft32(v2, -18) ^ v2>>3
+			w[i] = t1 + w[i-7] + t2 + w[i-16]
+		}
+
+		a, b, c, d, e, f, g, h := dig.h[0], dig.h[1], dig.h[2], dig.h[3],
+			dig.h[4], dig.h[5], dig.h[6], dig.h[7]
+		for i := 0; i < 64; i++ {
+			t1 := h + (bits.RotateLeft32(e, -6) ^ bits.RotateLeft32(e, -11) ^ bits.RotateLeft32(e, -25)) +
+				(e&f ^ ^e&g) + _K256[i] + w[i]
+			t2 := (bits.RotateLeft32(a, -2) ^ bits.RotateLeft32(a, -13) ^ bits.RotateLeft32(a, -22)) +
+				(a&b ^ a&c ^ b&c)
+			a, b, c, d, e, f, g, h = t1+t2, a, b, c, d+t1, e, f, g
+		}
+
+		for i, v := range [8]uint32{a, b, c, d, e, f, g, h} {
+			dig.h[i] += v
+		}
+		p = p[chunk256:]
+	}
+}
+
+type SHA512 struct {
+	h   [8]uint64
+	x   [chunk512]byte
+	nx  int
+	len uint64
+}
+
+func (d *SHA512) Reset() {
+	d.h = [8]uint64{0x6a09e667f3bcc908, 0xbb67ae8584caa73b, 0x3c6ef372fe94f82b, 0xa54ff53a5f1d36f1,
+		0x510e527fade682d1, 0x9b05688c2b3e6c1f, 0x1f83d9abfb41bd6b, 0x5be0cd19137e2179}
+	d.nx = 0
+	d.len = 0
+}
+
+func NewSHA512() *SHA512 {
+	d := new(SHA512)
+	d.Reset()
+	return d
+}
+
+// SetState makes d continue from the state that produced digest, after
+// hashing len bytes, including the padding.
+func (d *SHA512) SetState(digest []byte, len uint64) {
+	if len%chunk512 != 0 {
+		panic("len is not a multiple of the block size")
+	}
+	for i := range d.h {
+		d.h[i] = binary.BigEndian.Uint64(digest[i*8:])
+	}
+	d.nx = 0
+	d.len = len
+}
+
+func (d *SHA512) Write(p []byte) (nn int, err error) {
+	nn = len(p)
+	d.len += uint64(nn)
+	if d.nx > 0 {
+		n := copy(d.x[d.nx:], p)
+		d.nx += n
+		if d.nx == chunk512 {
+			sha512Block(d, d.x[:])
+			d.nx = 0
+		}
+		p = p[n:]
+	}
+	if len(p) >= chunk512 {
+		n := len(p) &^ (chunk512 - 1)
+		sha512Block(d, p[:n])
+		p = p[n:]
+	}
+	if len(p) > 0 {
+		d.nx = copy(d.x[:], p)
+	}
+	return
+}
+
+func (d *SHA512) checkSum() [64]byte {
+	d.Write(mdPadding(int(d.len), chunk512))
+	if d.nx != 0 {
+		panic("d.nx != 0")
+	}
+
+	var digest [64]byte
+	for i, h := range d.h {
+		putUint64(digest[i*8:], h)
+	}
+	return digest
+}
+
+func sha512Block(dig *SHA512, p []byte) {
+	var w [80]uint64
+	for len(p) >= chunk512 {
+		for i := 0; i < 16; i++ {
+			w[i] = binary.BigEndian.Uint64(p[i*8:])
+		}
+		for i := 16; i < 80; i++ {
+			v1, v2 := w[i-2], w[i-15]
+			t1 := bits.RotateLeft64(v1, -19) ^ bits.RotateLeft64(v1, -61) ^ v1>>6
+			t2 := bits.RotateLeft64(v2, -1) ^ bits.RotateLeft64(v2, -8) ^ v2>>7
+			w[i] = t1 + w[i-7] + t2 + w[i-16]
+		}
+
+		a, b, c, d, e, f, g, h := dig.h[0], dig.h[1], dig.h[2], dig.h[3],
+			dig.h[4], dig.h[5], dig.h[6], dig.h[7]
+		for i := 0; i < 80; i++ {
+			t1 := h + (bits.RotateLeft64(e, -14) ^ bits.RotateLeft64(e, -18) ^ bits.RotateLeft64(e, -41)) +
+				(e&f ^ ^e&g) + _K512[i] + w[i]
+			t2 := (bits.RotateLeft64(a, -28) ^ bits.RotateLeft64(a, -34) ^ bits.RotateLeft64(a, -39)) +
+				(a&b ^ a&c ^ b&c)
+			a, b, c, d, e, f, g, h = t1+t2, a, b, c, d+t1, e, f, g
+		}
+
+		for i, v := range [8]uint64{a, b, c, d, e, f, g, h} {
+			dig.h[i] += v
+		}
+		p = p[chunk512:]
+	}
+}
+
+// ************* end SHA-256 and SHA-512 code *************
+
+func extendSHA256(mac, msg, extension []byte) (newMAC, newMSG []byte) {
+	newMAC, newMSG, err := attacks.ExtendSHA256(mac, msg, extension, 16)
+	if err != nil {
+		panic(err)
+	}
+	return
+}
+
+func extendSHA512(mac, msg, extension []byte) (newMAC, newMSG []byte) {
+	newMAC, newMSG, err := attacks.ExtendSHA512(mac, msg, extension, 16)
+	if err != nil {
+		panic(err)
+	}
+	return
+}
+
 // ******************** MD4 code **********************
 
 const (
@@ -631,21 +885,11 @@ func md4Padding(len int) []byte {
 }
 
 func extendMD4(mac, msg, extension []byte) (newMAC, newMSG []byte) {
-	newMSG = append(newMSG, msg...)
-	newMSG = append(newMSG, md4Padding(len(msg)+16)...)
-
-	s := &MD4{}
-	s.s[0] = binary.LittleEndian.Uint32(mac[0:])
-	s.s[1] = binary.LittleEndian.Uint32(mac[4:])
-	s.s[2] = binary.LittleEndian.Uint32(mac[8:])
-	s.s[3] = binary.LittleEndian.Uint32(mac[12:])
-	s.len = uint64(len(newMSG) + 16)
-
-	s.Write(extension)
-	newMSG = append(newMSG, extension...)
-
-	md4 := s.checkSum()
-	return md4[:], newMSG
+	newMAC, newMSG, err := attacks.ExtendMD4(mac, msg, extension, 16)
+	if err != nil {
+		panic(err)
+	}
+	return
 }
 
 func makeMD4AdminCookie(cookie []byte) []byte {
@@ -717,45 +961,31 @@ func recoverSignatureFromTiming(message []byte,
 
 func recoverSignatureFromAverageTiming(message []byte,
 	check func(message, signature []byte) bool) []byte {
-	timeIt := func(signature []byte) time.Duration {
+	timeIt := func(signature []byte) (time.Duration, error) {
 		start := time.Now()
 		check(message, signature)
-		return time.Since(start)
-	}
-	delta := 4 * time.Millisecond
-	averageTime := func(signature []byte) time.Duration {
-		var total time.Duration
-		var maxTime time.Duration
-		for i := 0; i < 32; i++ {
-			t := timeIt(signature)
-			total += t
-			if t > maxTime {
-				maxTime = t
-			}
-		}
-		avg := total / 32
-		// if maxTime-avg > delta {
-		// 	panic("too much variance")
-		// }
-		return avg
+		return time.Since(start), nil
 	}
+	timing := &attacks.Timing{MinSamples: 3}
 	signature := make([]byte, signatureLen)
-	for pos := range signature {
-		baseline := averageTime(signature)
-		var found bool
-		for k := 0; k < 256; k++ {
+	for pos := range signature[:signatureLen-1] {
+		candidates := make([][]byte, 256)
+		for k := range candidates {
 			signature[pos] = byte(k)
-			fmt.Printf("\r%x", signature)
-			if averageTime(signature)-baseline > delta {
-				found = true
-				break
-			}
+			candidates[k] = append([]byte{}, signature...)
 		}
-		if !found {
-			// Maybe it was 0 to begin with.
-			signature[pos] = 0
+		// If the measurements are inconclusive, Slowest still returns the
+		// best guess, and a wrong one will just make the signature invalid.
+		k, _ := timing.Slowest(timeIt, candidates)
+		signature[pos] = byte(k)
+		fmt.Printf("\r%x", signature[:pos+1])
+	}
+	for k := 0; k < 256; k++ {
+		signature[signatureLen-1] = byte(k)
+		if check(message, signature) {
+			break
 		}
 	}
-	fmt.Printf("\n")
+	fmt.Printf("\r%x\n", signature)
 	return signature
 }
@@ -4,8 +4,13 @@ import (
 	"bytes"
 	"crypto/aes"
 	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
 	"testing"
 	"time"
+
+	"filippo.io/mostly-harmless/cryptopals/attacks"
 )
 
 func TestProblem25(t *testing.T) {
@@ -59,7 +64,7 @@ func TestProblem29(t *testing.T) {
 
 	ss := NewSHA1()
 	ss.Write(msg)
-	ss.Write(mdPadding(len(msg)))
+	ss.Write(mdPadding(len(msg), chunk))
 
 	if ss.nx != 0 {
 		t.Fatal("data still buffered")
@@ -103,6 +108,51 @@ func TestProblem30(t *testing.T) {
 	}
 }
 
+func TestSHA2(t *testing.T) {
+	msg := make([]byte, 300)
+	rand.Read(msg)
+	for n := 0; n <= len(msg); n++ {
+		s := NewSHA256()
+		s.Write(msg[:n/3])
+		s.Write(msg[n/3 : n])
+		if h := s.checkSum(); h != sha256.Sum256(msg[:n]) {
+			t.Fatalf("wrong SHA-256 for %d bytes", n)
+		}
+		ss := NewSHA512()
+		ss.Write(msg[:n/3])
+		ss.Write(msg[n/3 : n])
+		if h := ss.checkSum(); h != sha512.Sum512(msg[:n]) {
+			t.Fatalf("wrong SHA-512 for %d bytes", n)
+		}
+	}
+}
+
+func TestExtendSHA2(t *testing.T) {
+	key := make([]byte, 16)
+	rand.Read(key)
+	ext := []byte(";admin=true")
+	for n := 0; n <= 300; n += 7 {
+		msg := bytes.Repeat([]byte("a"), n)
+		mac := sha256.Sum256(append(append([]byte{}, key...), msg...))
+		newMAC, newMSG := extendSHA256(mac[:], msg, ext)
+		if h := sha256.Sum256(append(append([]byte{}, key...), newMSG...)); !bytes.Equal(newMAC, h[:]) {
+			t.Fatalf("wrong SHA-256 MAC for %d bytes", n)
+		}
+		if !bytes.HasPrefix(newMSG, msg) || !bytes.HasSuffix(newMSG, ext) {
+			t.Fatalf("wrong SHA-256 message for %d bytes", n)
+		}
+
+		mac512 := sha512.Sum512(append(append([]byte{}, key...), msg...))
+		newMAC, newMSG = extendSHA512(mac512[:], msg, ext)
+		if h := sha512.Sum512(append(append([]byte{}, key...), newMSG...)); !bytes.Equal(newMAC, h[:]) {
+			t.Fatalf("wrong SHA-512 MAC for %d bytes", n)
+		}
+		if !bytes.HasPrefix(newMSG, msg) || !bytes.HasSuffix(newMSG, ext) {
+			t.Fatalf("wrong SHA-512 message for %d bytes", n)
+		}
+	}
+}
+
 func TestProblem31(t *testing.T) {
 	check := newHMACOracle(50 * time.Millisecond)
 	msg := []byte("I AM ROOT")
@@ -126,3 +176,35 @@ func TestProblem32(t *testing.T) {
 		t.Error("wrong signature")
 	}
 }
+
+var compareSink bool
+
+func TestConstantTimeCompare(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping wall-clock timing test in short mode")
+	}
+	secret := make([]byte, signatureLen)
+	rand.Read(secret)
+	input := func(class int) []byte {
+		in := make([]byte, len(secret))
+		if class == 0 {
+			copy(in, secret)
+		} else {
+			rand.Read(in)
+		}
+		return in
+	}
+	lt := &attacks.LeakageTest{}
+
+	res := lt.Run(func(in []byte) { compareSink = equal(in, secret, 0) }, input)
+	t.Logf("equal: %v", res)
+	if !res.Leaks {
+		t.Error("equal was not flagged")
+	}
+
+	res = lt.Run(func(in []byte) { compareSink = subtle.ConstantTimeCompare(in, secret) == 1 }, input)
+	t.Logf("subtle.ConstantTimeCompare: %v", res)
+	if res.Leaks {
+		t.Error("subtle.ConstantTimeCompare was flagged")
+	}
+}
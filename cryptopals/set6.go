@@ -2,6 +2,7 @@ package cryptopals
 
 import (
 	"bytes"
+	"crypto/dsa"
 	"crypto/md5"
 	"crypto/rand"
 	"crypto/rsa"
@@ -11,6 +12,8 @@ import (
 	"math/big"
 	"os"
 	"strconv"
+
+	"filippo.io/mostly-harmless/cryptopals/attacks"
 )
 
 func decryptRSAOnceOracle() (
@@ -138,55 +141,29 @@ func (dsa dsaParams) Verify(y, r, s *big.Int, msg []byte) bool {
 	return v.Cmp(r) == 0
 }
 
+func stdDSAParams(d dsaParams) *dsa.Parameters {
+	p := dsa.Parameters(d)
+	return &p
+}
+
 func recoverDSAKeyFromLowK(dsa dsaParams, y, r, s *big.Int, msg []byte) *big.Int {
 	h := sha1.Sum(msg)
-	H := new(big.Int).SetBytes(h[:])
-	rInv := new(big.Int).ModInverse(r, dsa.Q)
-
-	k := big.NewInt(1)
-	rr := new(big.Int).Set(dsa.G)
-	rrModQ := new(big.Int).Mod(rr, dsa.Q)
-	for k.BitLen() <= 16 {
-		if rrModQ.Mod(rr, dsa.Q).Cmp(r) == 0 {
-			x := new(big.Int).Mul(s, k)
-			x.Mod(x, dsa.Q).Sub(x, H).Mul(x, rInv).Mod(x, dsa.Q)
-			return x
-		}
-		rr.Mul(rr, dsa.G).Mod(rr, dsa.P)
-		k.Add(k, big1)
+	x, err := attacks.RecoverDSAKeyFromLowK(stdDSAParams(dsa), r, s, h[:], 16)
+	if err != nil {
+		panic(err)
 	}
-
-	// Old, slower method.
-	yy := new(big.Int)
-	for k.BitLen() <= 16 {
-		x := new(big.Int).Mul(s, k)
-		x.Mod(x, dsa.Q).Sub(x, H).Mul(x, rInv).Mod(x, dsa.Q)
-
-		if yy.Exp(dsa.G, x, dsa.P).Cmp(y) == 0 {
-			return x
-		}
-
-		k.Add(k, big1)
+	if new(big.Int).Exp(dsa.G, x, dsa.P).Cmp(y) != 0 {
+		panic("key not found")
 	}
-
-	panic("key not found")
+	return x
 }
 
 func recoverDSAKeyFromRepeatedK(dsa dsaParams, r, s1, s2 *big.Int, msg1, msg2 []byte) *big.Int {
-	k := new(big.Int).Sub(s1, s2)
-	k.Mod(k, dsa.Q)
-	k.ModInverse(k, dsa.Q)
-
 	h1, h2 := sha1.Sum(msg1), sha1.Sum(msg2)
-	H1 := new(big.Int).SetBytes(h1[:])
-	H := new(big.Int).SetBytes(h2[:])
-	H.Sub(H1, H).Mod(H, dsa.Q)
-
-	k.Mul(k, H).Mod(k, dsa.Q)
-
-	rInv := new(big.Int).ModInverse(r, dsa.Q)
-	x := new(big.Int).Mul(s1, k)
-	x.Mod(x, dsa.Q).Sub(x, H1).Mul(x, rInv).Mod(x, dsa.Q)
+	x, err := attacks.RecoverDSAKeyFromRepeatedK(stdDSAParams(dsa), r, s1, s2, h1[:], h2[:])
+	if err != nil {
+		panic(err)
+	}
 	return x
 }
 
@@ -309,105 +286,11 @@ func divRoundUp(res, x, y *big.Int) {
 }
 
 func attackBB98(pub *rsa.PublicKey, cc []byte, isPaddingValid func([]byte) bool) []byte {
-	if !isPaddingValid(cc) {
-		panic("must start from a valid ciphertext")
-	}
-	if pub.N.BitLen()%8 != 0 {
-		panic("key length must be a multiple of 8")
-	}
-
-	c := new(big.Int).SetBytes(cc)
-	e := big.NewInt(int64(pub.E))
-	tryS := func(s *big.Int) bool {
-		c1 := new(big.Int).Exp(s, e, pub.N)
-		c1.Mul(c1, c).Mod(c1, pub.N)
-		return isPaddingValid(c1.Bytes())
-	}
-
-	B := new(big.Int).Lsh(big1, uint(pub.N.BitLen()-16))
-	B2, B3 := new(big.Int).Mul(B, big2), new(big.Int).Mul(B, big3)
-
-	newRanges := func(s *big.Int, ranges [][2]*big.Int) [][2]*big.Int {
-		var res [][2]*big.Int
-		r, maxR := new(big.Int), new(big.Int)
-		a, b := new(big.Int), new(big.Int)
-
-		for i := range ranges {
-			lower, upper := ranges[i][0], ranges[i][1]
-			// ( as − 3B + 1 ) / n
-			r.Mul(lower, s).Sub(r, B3).Add(r, big1)
-			divRoundUp(r, r, pub.N)
-			// ( bs − 2B ) / n
-			maxR.Mul(upper, s).Sub(maxR, B2).Div(maxR, pub.N)
-
-			for r.Cmp(maxR) <= 0 {
-				newLower, newUpper := lower, upper
-
-				// ( 2B + rn ) / s <- round up
-				divRoundUp(a, a.Mul(r, pub.N).Add(a, B2), s)
-				if a.Cmp(lower) > 0 {
-					newLower = new(big.Int).Set(a)
-				}
-				// ( 3B − 1 + rn ) / s <- round down
-				b.Mul(r, pub.N).Add(b, B3).Sub(b, big1).Div(b, s)
-				if b.Cmp(upper) < 0 {
-					newUpper = new(big.Int).Set(b)
-				}
-
-				res = append(res, [2]*big.Int{newLower, newUpper})
-				r.Add(r, big1)
-			}
-		}
-
-		return res
-	}
-
-	lower, upper := new(big.Int).Set(B2), new(big.Int).Sub(B3, big1)
-	s, r, maxS := new(big.Int), new(big.Int), new(big.Int)
-	i := 1
-	for {
-		if i == 1 {
-			// n / 3B
-			divRoundUp(s, pub.N, B3)
-			for !tryS(s) {
-				s.Add(s, big1)
-			}
-		} else {
-			// 2 * ( bs − 2B ) / N
-			divRoundUp(r, r.Mul(upper, s).Sub(r, B2).Mul(r, big2), pub.N)
-		searchLoop:
-			for {
-				// ( 2B + rn ) / b
-				divRoundUp(s, s.Mul(r, pub.N).Add(s, B2), upper)
-				// ( 3B + rn ) / a
-				divRoundUp(maxS, maxS.Mul(r, pub.N).Add(maxS, B3), lower)
-				for s.Cmp(maxS) < 0 {
-					if tryS(s) {
-						break searchLoop
-					}
-					s.Add(s, big1)
-				}
-				r.Add(r, big1)
-			}
-		}
-
-		ranges := newRanges(s, [][2]*big.Int{{lower, upper}})
-		for len(ranges) != 1 {
-			s.Add(s, big1)
-			for !tryS(s) {
-				s.Add(s, big1)
-			}
-			ranges = newRanges(s, ranges)
-		}
-		lower, upper = ranges[0][0], ranges[0][1]
-
-		fmt.Fprintf(os.Stderr, "%q\n", lower.Bytes())
-		if upper.Cmp(lower) == 0 {
-			break
-		}
-
-		i++
+	res, err := attacks.AttackBB98(pub, cc, validityOracle(isPaddingValid), &attacks.Options{
+		Progress: func(lower []byte) { printProgress(lower, true) },
+	})
+	if err != nil {
+		panic(err)
 	}
-
-	return lower.Bytes()
+	return res
 }
@@ -12,11 +12,12 @@ import (
 	"errors"
 	"fmt"
 	"net/url"
-	"os"
 	"runtime"
 	"strconv"
 	"strings"
 	"sync"
+
+	"filippo.io/mostly-harmless/cryptopals/attacks"
 )
 
 func makeCBCMAC(msg, iv []byte, b cipher.Block) []byte {
@@ -255,23 +256,12 @@ Content-Length: %d
 }
 
 func attackCompressionOracle(oracle func(body []byte) []byte) []byte {
-	secret := []byte("sessionid=")
-	n := len(oracle(secret))
-	for len(secret) < len("sessionid=")+43 {
-		secret = append(secret, '*')
-		for i := 0; i < 256; i++ {
-			secret[len(secret)-1] = byte(i)
-			printProgress(secret, false)
-			if len(oracle(secret)) == n {
-				break
-			}
-			if i == 255 {
-				panic("not found")
-			}
-		}
+	secret, err := attacks.AttackCompressionOracle(encryptionOracle(oracle), []byte("sessionid="), 43, nil,
+		&attacks.Options{Parallelism: 16})
+	if err != nil {
+		panic(err)
 	}
-	fmt.Fprintf(os.Stderr, "\r%s=\n", secret)
-	return append(secret[len("sessionid="):], '=')
+	return append(secret, '=')
 }
 
 func hashCore(prevState []byte, bitLen int) func(nextState, msgBlock []byte) {
@@ -315,47 +305,14 @@ func shortHash(bitLen int) func([]byte) []byte {
 		panic("bitLen must be a multiple of 8")
 	}
 	return func(msg []byte) []byte {
-		state := bytes.Repeat([]byte("*"), bitLen/8)
-
-		for len(msg) >= 16 {
-			hashCore(state, bitLen)(state, msg[:16])
-			msg = msg[16:]
-		}
-
-		finalMsg := make([]byte, 16)
-		copy(finalMsg, msg)
-		hashCore(state, bitLen)(state, finalMsg)
-
-		return state
+		return attacks.ToyHash(msg, bitLen)
 	}
 }
 
 func findCollisions(num, bitLen int) [][2][]byte {
-	if bitLen > 64 {
-		panic("bitLen too high")
-	}
-	var res [][2][]byte
-	state := bytes.Repeat([]byte("*"), bitLen/8)
-	for i := 0; i < num; i++ {
-		outputs := make(map[uint64]string)
-		block := make([]byte, 16)
-		var nextState uint64
-
-		b := hashCoreToInt(state, bitLen)
-		randAES, _ := aes.NewCipher([]byte("YELLOW SUBMARINE"))
-
-		for {
-			randAES.Encrypt(block, block)
-			nextState = b(block)
-
-			if _, ok := outputs[nextState]; ok {
-				break
-			}
-			outputs[nextState] = string(block)
-		}
-
-		res = append(res, [2][]byte{block, []byte(outputs[nextState])})
-		hashCore(state, bitLen)(state, block)
+	res, err := attacks.Multicollision(num, bitLen, rand.Reader)
+	if err != nil {
+		panic(err)
 	}
 	return res
 }
@@ -506,284 +463,28 @@ func preimageWithExpandableMessage(pieces []expMsgPiece, finalState []byte, msg
 	return coll
 }
 
-func collideStates(a, b []byte, bitLen int) []byte {
-	ba, bb := hashCoreToInt(a, bitLen), hashCoreToInt(b, bitLen)
-	block := make([]byte, 16)
-	randAES, _ := aes.NewCipher([]byte("YELLOW SUBMARINE"))
-	for {
-		randAES.Encrypt(block, block)
-		if ba(block) == bb(block) {
-			break
-		}
-	}
-	return block
-}
-
-type nostradamusNode struct {
-	nextState []byte
-	block     []byte
-	children  [2]*nostradamusNode
-}
-
-func makeNostradamusTree(k, bitLen int) *nostradamusNode {
-	var leaves []*nostradamusNode
-	for i := 0; i < 1<<uint(k); i++ {
-		state := make([]byte, bitLen/8)
-		rand.Read(state)
-		leaves = append(leaves, &nostradamusNode{
-			nextState: state,
-		})
-	}
-	for round := 0; round < k; round++ {
-		var newLeaves []*nostradamusNode
-		for i := 0; i < len(leaves)/2; i++ {
-			a, b := leaves[i*2], leaves[i*2+1]
-			block := collideStates(a.nextState, b.nextState, bitLen)
-			state := make([]byte, bitLen/8)
-			hashCore(a.nextState, bitLen)(state, block)
-			newLeaves = append(newLeaves, &nostradamusNode{
-				nextState: state,
-				block:     block,
-				children:  [2]*nostradamusNode{a, b},
-			})
-		}
-		leaves = newLeaves
-	}
-	if len(leaves) != 1 {
-		println(len(leaves))
-		panic("I can't trees")
+func makeNostradamusTree(k, bitLen int) *attacks.NostradamusTree {
+	root, err := attacks.NewNostradamusTree(k, bitLen, rand.Reader)
+	if err != nil {
+		panic(err)
 	}
-	root := leaves[0]
-
-	// Hash the padding into the root node final status.
-	hashCore(root.nextState, bitLen)(root.nextState, make([]byte, 16))
-
 	return root
 }
 
-func stateToUint64(state []byte) uint64 {
-	buf := make([]byte, 16)
-	copy(buf, state)
-	return binary.LittleEndian.Uint64(buf)
-}
-
-func uint64ToState(n uint64, bitLen int) []byte {
-	buf := make([]byte, 16)
-	binary.LittleEndian.PutUint64(buf, n)
-	state := make([]byte, bitLen/8)
-	copy(state, buf)
-	return state
-}
-
-func makeNostradamusPrediction(root *nostradamusNode, msg []byte, bitLen int) []byte {
-	intermediates := make(map[uint64][][]byte)
-
-	var exploreTree func(node *nostradamusNode, blocks [][]byte)
-	exploreTree = func(node *nostradamusNode, blocks [][]byte) {
-		if node.children[0] != nil {
-			exploreTree(node.children[0], append(blocks, node.block))
-			exploreTree(node.children[1], append(blocks, node.block))
-		} else {
-			blocksCopy := make([][]byte, len(blocks))
-			copy(blocksCopy, blocks)
-			intermediates[stateToUint64(node.nextState)] = blocksCopy
-		}
-	}
-	exploreTree(root, nil)
-
-	m := msg
-	state := bytes.Repeat([]byte("*"), bitLen/8)
-	for len(m) >= 16 {
-		hashCore(state, bitLen)(state, m[:16])
-		m = m[16:]
-	}
-
-	var nextState uint64
-	block := make([]byte, 16)
-	randAES, _ := aes.NewCipher([]byte("YELLOW SUBMARINE"))
-	b := hashCoreToInt(state, bitLen)
-	for {
-		randAES.Encrypt(block, block)
-		nextState = b(block)
-		if _, ok := intermediates[nextState]; ok {
-			break
-		}
-	}
-
-	msg = append(msg, block...)
-	blocks := intermediates[nextState]
-	for i := range blocks {
-		msg = append(msg, blocks[len(blocks)-i-1]...)
+func makeNostradamusPrediction(root *attacks.NostradamusTree, msg []byte) []byte {
+	msg, err := root.Predict(msg, rand.Reader)
+	if err != nil {
+		panic(err)
 	}
 	return msg
 }
 
-func md4Round1(msg []byte, callback func(i int, a, b, c, d, m, s, a0 uint32) uint32) (a, b, c, d uint32) {
-	a = 0x67452301
-	b = 0xefcdab89
-	c = 0x98badcfe
-	d = 0x10325476
-
-	var X [16]uint32
-	for i := 0; i < 16; i++ {
-		X[i] = uint32(msg[i*4]) | uint32(msg[i*4+1])<<8 |
-			uint32(msg[i*4+2])<<16 | uint32(msg[i*4+3])<<24
-	}
-
-	f := func(a, b, c, d, m, s uint32) uint32 {
-		f := (b & c) | (^b & d)
-		a = a + f + m
-		a = a<<s | a>>(32-s)
-		return a
-	}
-
-	for i := 0; i < 4; i++ {
-		aa := a
-		a = f(a, b, c, d, X[i*4], 3)
-		a = callback(i*4, a, b, c, d, X[i*4], 3, aa)
-		dd := d
-		d = f(d, a, b, c, X[i*4+1], 7)
-		d = callback(i*4+1, d, a, b, c, X[i*4+1], 7, dd)
-		cc := c
-		c = f(c, d, a, b, X[i*4+2], 11)
-		c = callback(i*4+2, c, d, a, b, X[i*4+2], 11, cc)
-		bb := b
-		b = f(b, c, d, a, X[i*4+3], 19)
-		b = callback(i*4+3, b, c, d, a, X[i*4+3], 19, bb)
-	}
-
-	return
-}
-
-type wangConditionType int
-
-const (
-	w0 wangConditionType = iota // set to 0
-	w1                          // set to 1
-	wP                          // set to match previous variable
-)
-
-var wangConditions = [16][]struct {
-	bitIdx uint // 1-INDEXED
-	_type  wangConditionType
-}{
-	{{7, wP}},
-	{{7, w0}, {8, wP}, {11, wP}},
-	{{7, w1}, {8, w1}, {11, w0}, {26, wP}},
-	{{7, w1}, {8, w0}, {11, w0}, {26, w0}},
-	{{8, w1}, {11, w1}, {26, w0}, {14, wP}},
-	{{14, w0}, {19, wP}, {20, wP}, {21, wP}, {22, wP}, {26, w1}},
-	{{13, wP}, {14, w0}, {15, wP}, {19, w0}, {20, w0}, {21, w1}, {22, w0}},
-	{{13, w1}, {14, w1}, {15, w0}, {17, wP}, {19, w0}, {20, w0}, {21, w0}, {22, w0}},
-	{{13, w1}, {14, w1}, {15, w1}, {17, w0}, {19, w0}, {20, w0}, {21, w0}, {23, wP}, {22, w1}, {26, wP}},
-	{{13, w1}, {14, w1}, {15, w1}, {17, w0}, {20, w0}, {21, w1}, {22, w1}, {23, w0}, {26, w1}, {30, wP}},
-	{{17, w1}, {20, w0}, {21, w0}, {22, w0}, {23, w0}, {26, w0}, {30, w1}, {32, wP}},
-	{{20, w0}, {21, w1}, {22, w1}, {23, wP}, {26, w1}, {30, w0}, {32, w0}},
-	{{23, w0}, {26, w0}, {27, wP}, {29, wP}, {30, w1}, {32, w0}},
-	{{23, w0}, {26, w0}, {27, w1}, {29, w1}, {30, w0}, {32, w1}},
-	{{19, wP}, {23, w1}, {26, w1}, {27, w0}, {29, w0}, {30, w0}},
-	{{19, w0}, {26, wP}, {27, w1}, {29, w1}, {30, w0}},
-}
-
-func checkWangConditions(msg []byte) bool {
-	allValid := true
-	check := func(i int, a, b, c, d, m, s, a0 uint32) uint32 {
-		for _, cond := range wangConditions[i] {
-			bit0 := (b >> (cond.bitIdx - 1)) & 1
-			bit1 := (a >> (cond.bitIdx - 1)) & 1
-			switch cond._type {
-			case w0:
-				if bit1 != 0 {
-					allValid = false
-				}
-			case w1:
-				if bit1 != 1 {
-					allValid = false
-				}
-			case wP:
-				if bit1 != bit0 {
-					allValid = false
-				}
-			default:
-				panic("invalid condition")
-			}
-		}
-		return a
-	}
-	md4Round1(msg, check)
-	return allValid
-}
-
-func enforceWangConditions(msg []byte) {
-	enforce := func(i int, a, b, c, d, m, s, a0 uint32) uint32 {
-		for _, cond := range wangConditions[i] {
-			bit0 := (b >> (cond.bitIdx - 1)) & 1
-			bit1 := (a >> (cond.bitIdx - 1)) & 1
-			switch cond._type {
-			case w0:
-				if bit1 != 0 {
-					a ^= 1 << (cond.bitIdx - 1)
-				}
-			case w1:
-				if bit1 != 1 {
-					a ^= 1 << (cond.bitIdx - 1)
-				}
-			case wP:
-				if bit1 != bit0 {
-					a ^= 1 << (cond.bitIdx - 1)
-				}
-			default:
-				panic("invalid condition")
-			}
-		}
-		m1 := a>>s | a<<(32-s)
-		m1 -= a0
-		m1 -= (b & c) | (^b & d)
-		binary.LittleEndian.PutUint32(msg[i*4:], m1)
-		return a
-	}
-	md4Round1(msg, enforce)
-}
-
-func wangSisterMsg(msg1, msg []byte) {
-	// 4.1 The Collision Differential for MD4
-	for i := 0; i < 16; i++ {
-		v := binary.LittleEndian.Uint32(msg[i*4:])
-		switch i {
-		case 1:
-			v += 1 << 31
-		case 2:
-			v += 1 << 31
-			v -= 1 << 28
-		case 12:
-			v -= 1 << 16
-		}
-		binary.LittleEndian.PutUint32(msg1[i*4:], v)
-	}
-}
-
-func searchMD4Collisions() []byte {
-	msg, msg1 := make([]byte, 64), make([]byte, 64)
-	randAES, _ := aes.NewCipher([]byte("YELLOW SUBMARINE"))
-	md4 := NewMD4()
-	for {
-		for i := 0; i < 4; i++ {
-			randAES.Encrypt(msg[16*i:], msg[16*i:])
-		}
-
-		enforceWangConditions(msg)
-		wangSisterMsg(msg1, msg)
-
-		md4.Reset()
-		md4.Write(msg)
-		h0 := md4.checkSum()
-		md4.Reset()
-		md4.Write(msg1)
-		h1 := md4.checkSum()
-		if bytes.Equal(h0, h1) {
-			return msg
-		}
+func searchMD4Collisions() (m1, m2 []byte) {
+	m1, m2, err := attacks.FindMD4Collision(rand.Reader)
+	if err != nil {
+		panic(err)
 	}
+	return m1, m2
 }
 
 func rc4Map(z int) map[byte]float64 {
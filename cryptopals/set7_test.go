@@ -165,8 +165,8 @@ func TestProblem54(t *testing.T) {
 	for i := 0; i < 1<<8; i++ {
 		msg := make([]byte, 16*5)
 		rand.Read(msg)
-		msg = makeNostradamusPrediction(root, msg, bitLen) // cost: 2^(bitLen-8)
-		if !bytes.Equal(hash(msg), root.nextState) {
+		msg = makeNostradamusPrediction(root, msg) // cost: 2^(bitLen-8)
+		if !bytes.Equal(hash(msg), root.Hash) {
 			t.Error("wrong prediction")
 		}
 	}
@@ -174,44 +174,6 @@ func TestProblem54(t *testing.T) {
 }
 
 func TestProblem55(t *testing.T) {
-	md4Block := func(p []byte) (a, b, c, d uint32) {
-		a = _Init0
-		b = _Init1
-		c = _Init2
-		d = _Init3
-		var X [16]uint32
-
-		j := 0
-		for i := 0; i < 16; i++ {
-			X[i] = uint32(p[j]) | uint32(p[j+1])<<8 | uint32(p[j+2])<<16 | uint32(p[j+3])<<24
-			j += 4
-		}
-
-		// Round 1.
-		for i := uint(0); i < 16; i++ {
-			x := i
-			s := shift1[i%4]
-			f := ((c ^ d) & b) ^ d
-			a += f + X[x]
-			a = a<<s | a>>(32-s)
-			a, b, c, d = d, a, b, c
-		}
-
-		return
-	}
-
-	msg := make([]byte, 64)
-	rand.Read(msg)
-	aa, bb, cc, dd := md4Block(msg)
-	a, b, c, d := md4Round1(msg,
-		func(i int, a, b, c, d, m, s, a0 uint32) uint32 { return a })
-	if a != aa || b != bb || c != cc || d != dd {
-		t.Fatal("round function is wrong")
-	}
-
-	if checkWangConditions(msg) {
-		t.Fatal("check always returns true")
-	}
 	m1 := decodeHex(t, "4d7a9c8356cb927ab9d5a57857a7a5eede748a3"+
 		"cdcc366b3b683a0203b2a5d9fc69d71b3f9e99198d79f805ea63bb"+
 		"2e845dd8e3197e31fe52794bf08b9e8c3e9")
@@ -222,29 +184,13 @@ func TestProblem55(t *testing.T) {
 	if !bytes.Equal(md4.checkSum(), h) {
 		t.Fatal("wrong hash for paper msg")
 	}
-	if !checkWangConditions(m1) {
-		t.Fatal("check false for paper msg")
-	}
-
-	enforceWangConditions(msg)
-	if !checkWangConditions(msg) {
-		t.Fatal("check false after enforcing")
-	}
 
-	m2 := decodeHex(t, "4d7a9c83d6cb927a29d5a57857a7a5eede748a3cdcc3"+
-		"66b3b683a0203b2a5d9fc69d71b3f9e99198d79f805ea63bb2e8"+
-		"45dc8e3197e31fe52794bf08b9e8c3e9")
-	reverseUint32Endian(m2)
-	wangSisterMsg(msg, m1)
-	if !bytes.Equal(m2, msg) {
-		t.Fatal("different sister message")
-	}
-
-	coll := searchMD4Collisions()
+	coll, coll1 := searchMD4Collisions()
 	t.Logf("m = %x", coll)
-	coll1 := make([]byte, 64)
-	wangSisterMsg(coll1, coll)
 	t.Logf("m1 = %x", coll1)
+	if bytes.Equal(coll, coll1) {
+		t.Fatal("same message")
+	}
 	md4 = NewMD4()
 	md4.Write(coll)
 	h = md4.checkSum()
@@ -0,0 +1,1864 @@
+package cryptopals
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/big"
+	mathrand "math/rand"
+)
+
+var bobMessage = []byte("crazy flamboyant for the rap enjoyment")
+
+func macSecret(secret, msg []byte) []byte {
+	h := hmac.New(sha256.New, secret)
+	h.Write(msg)
+	return h.Sum(nil)
+}
+
+// smallFactors returns the distinct prime factors of n smaller than bound.
+func smallFactors(n *big.Int, bound int64) []int64 {
+	var res []int64
+	n = new(big.Int).Set(n)
+	d, m := new(big.Int), new(big.Int)
+	for f := int64(2); f < bound; f++ {
+		d.SetInt64(f)
+		if m.Mod(n, d).Sign() != 0 {
+			continue
+		}
+		res = append(res, f)
+		for m.Mod(n, d).Sign() == 0 {
+			n.Div(n, d)
+		}
+	}
+	return res
+}
+
+// crt returns x modulo the product m of the (coprime) moduli, such that
+// x = residues[i] mod moduli[i].
+func crt(residues, moduli []*big.Int) (x, m *big.Int) {
+	x, m = big.NewInt(0), big.NewInt(1)
+	for i := range moduli {
+		t := new(big.Int).Sub(residues[i], x)
+		t.Mul(t, new(big.Int).ModInverse(m, moduli[i]))
+		t.Mod(t, moduli[i])
+		x.Add(x, t.Mul(t, m))
+		m.Mul(m, moduli[i])
+	}
+	return
+}
+
+type dhSubgroupParams struct {
+	dhParams
+	q *big.Int
+}
+
+var dh57Params, dh58Params dhSubgroupParams
+
+func init() {
+	dh57Params.p, _ = new(big.Int).SetString("7199773997391911030609999317773941274322764333428698921736339643928346453700085358802973900485592910475480089726140708102474957429903531369589969318716771", 10)
+	dh57Params.g, _ = new(big.Int).SetString("4565356397095740655436854503483826832136106141639563487732438195343690437606117828318042418238184896212352329118608100083187535033402010599512641674644143", 10)
+	dh57Params.q, _ = new(big.Int).SetString("236234353446506858198510045061214171961", 10)
+
+	dh58Params.p, _ = new(big.Int).SetString("11470374874925275658116663507232161402086650258453896274534991676898999262641581519101074740642369848233294239851519212341844337347119899874391456329785623", 10)
+	dh58Params.g, _ = new(big.Int).SetString("622952335333961296978159266084741085889881358738459939978290179936063635566740258555167783009058567397963466103140082647486611657350811560630587013183357", 10)
+	dh58Params.q, _ = new(big.Int).SetString("335062023296420808191071248367701059461", 10)
+}
+
+func (dh dhSubgroupParams) Private() *big.Int {
+	for {
+		x, err := rand.Int(rand.Reader, dh.q)
+		if err != nil {
+			panic(err)
+		}
+		if x.Sign() > 0 {
+			return x
+		}
+	}
+}
+
+func newDHSubgroupOracle(dh dhSubgroupParams) (
+	pub *big.Int,
+	exchange func(h *big.Int) (msg, mac []byte),
+) {
+	x := dh.Private()
+	pub = dh.Public(x)
+	exchange = func(h *big.Int) (msg, mac []byte) {
+		K := dh.Secret(x, h)
+		return bobMessage, macSecret(K.Bytes(), bobMessage)
+	}
+	return
+}
+
+func dhElementOfOrder(p *big.Int, r int64) *big.Int {
+	e := new(big.Int).Sub(p, big1)
+	e.Div(e, big.NewInt(r))
+	for {
+		h, _ := rand.Int(rand.Reader, p)
+		if h.Exp(h, e, p).Cmp(big1) > 0 {
+			return h
+		}
+	}
+}
+
+// attackDHSmallSubgroups recovers Bob's key modulo the factors of (p-1)/q
+// smaller than bound, by sending him elements of those small subgroups and
+// brute-forcing the MAC of his reply. It stops once the modulus exceeds limit,
+// if not nil.
+func attackDHSmallSubgroups(dh dhSubgroupParams, exchange func(h *big.Int) (msg, mac []byte),
+	bound int64, limit *big.Int) (x, m *big.Int) {
+	j := new(big.Int).Sub(dh.p, big1)
+	j.Div(j, dh.q)
+	var residues, moduli []*big.Int
+	m = big.NewInt(1)
+	for _, r := range smallFactors(j, bound) {
+		if limit != nil && m.Cmp(limit) > 0 {
+			break
+		}
+		h := dhElementOfOrder(dh.p, r)
+		msg, mac := exchange(h)
+		K := big.NewInt(1)
+		for k := int64(0); k < r; k++ {
+			if hmac.Equal(macSecret(K.Bytes(), msg), mac) {
+				residues = append(residues, big.NewInt(k))
+				moduli = append(moduli, big.NewInt(r))
+				m.Mul(m, big.NewInt(r))
+				break
+			}
+			K.Mul(K, h).Mod(K, dh.p)
+		}
+	}
+	return crt(residues, moduli)
+}
+
+func attackDHSubgroupConfinement(dh dhSubgroupParams, exchange func(h *big.Int) (msg, mac []byte)) *big.Int {
+	x, m := attackDHSmallSubgroups(dh, exchange, 1<<16, dh.q)
+	if m.Cmp(dh.q) <= 0 {
+		panic("not enough small subgroups")
+	}
+	return x
+}
+
+// A cyclicGroup is a group that newKangarooTrap can walk. Elements are opaque.
+type cyclicGroup interface {
+	op(x, y interface{}) interface{}
+	exp(x interface{}, k *big.Int) interface{}
+	equal(x, y interface{}) bool
+	// index maps an element to a pseudo-random number.
+	index(x interface{}) uint64
+}
+
+type multiplicativeGroup struct{ p *big.Int }
+
+func (g multiplicativeGroup) op(x, y interface{}) interface{} {
+	r := new(big.Int).Mul(x.(*big.Int), y.(*big.Int))
+	return r.Mod(r, g.p)
+}
+
+func (g multiplicativeGroup) exp(x interface{}, k *big.Int) interface{} {
+	return new(big.Int).Exp(x.(*big.Int), k, g.p)
+}
+
+func (g multiplicativeGroup) equal(x, y interface{}) bool {
+	return x.(*big.Int).Cmp(y.(*big.Int)) == 0
+}
+
+func (g multiplicativeGroup) index(x interface{}) uint64 {
+	return lowBits(x.(*big.Int))
+}
+
+func lowBits(x *big.Int) uint64 {
+	if x.Sign() == 0 {
+		return 0
+	}
+	return uint64(x.Bits()[0])
+}
+
+// newKangarooTrap runs the tame kangaroo of Pollard's lambda method for the
+// interval [a, b], and returns a function that looks for the index of y in it
+// by running a wild kangaroo into the trap. The tame run is the same for any
+// y, so it's done once for all the targets.
+func newKangarooTrap(grp cyclicGroup, g interface{}, a, b *big.Int) func(y interface{}) (*big.Int, bool) {
+	width := new(big.Int).Sub(b, a)
+	mean := new(big.Int).Sqrt(width)
+	mean.Rsh(mean, 1)
+	k := uint64(1)
+	for new(big.Int).SetUint64((1<<k-1)/k).Cmp(mean) < 0 {
+		k++
+	}
+	mean.SetUint64((1<<k - 1) / k)
+
+	// Randomize the jump function, so that a failed search can be retried.
+	salt := mathrand.Uint64()
+	f := func(y interface{}) uint64 { return (grp.index(y) ^ salt) % k }
+	jumps := make([]interface{}, k)
+	distances := make([]*big.Int, k)
+	for i := range jumps {
+		distances[i] = new(big.Int).Lsh(big1, uint(i))
+		jumps[i] = grp.exp(g, distances[i])
+	}
+
+	xT, yT := new(big.Int), grp.exp(g, b)
+	for i := int64(0); i < 4*mean.Int64(); i++ {
+		j := f(yT)
+		xT.Add(xT, distances[j])
+		yT = grp.op(yT, jumps[j])
+	}
+	limit := new(big.Int).Add(width, xT)
+
+	return func(y interface{}) (*big.Int, bool) {
+		xW, yW := new(big.Int), y
+		for xW.Cmp(limit) <= 0 {
+			j := f(yW)
+			xW.Add(xW, distances[j])
+			yW = grp.op(yW, jumps[j])
+			if grp.equal(yW, yT) {
+				x := new(big.Int).Add(b, xT)
+				return x.Sub(x, xW), true
+			}
+		}
+		return nil, false
+	}
+}
+
+// attackDHSubgroupKangaroo recovers Bob's key modulo the small factors of
+// (p-1)/q as in attackDHSmallSubgroups, and the rest with the kangaroo.
+func attackDHSubgroupKangaroo(dh dhSubgroupParams, pub *big.Int,
+	exchange func(h *big.Int) (msg, mac []byte)) *big.Int {
+	n, r := attackDHSmallSubgroups(dh, exchange, 1<<16, nil)
+
+	// x = n + m*r, so y * g^-n = (g^r)^m with m in [0, q/r].
+	g := new(big.Int).Exp(dh.g, r, dh.p)
+	y := new(big.Int).Exp(dh.g, n, dh.p)
+	y.ModInverse(y, dh.p).Mul(y, pub).Mod(y, dh.p)
+	upper := new(big.Int).Div(dh.q, r)
+	for i := 0; i < 5; i++ {
+		catch := newKangarooTrap(multiplicativeGroup{dh.p}, g, big.NewInt(0), upper)
+		if m, ok := catch(y); ok {
+			return m.Mul(m, r).Add(m, n)
+		}
+	}
+	panic("key not found")
+}
+
+// An ecPoint is an affine point. The nil *ecPoint is the point at infinity.
+type ecPoint struct {
+	x, y *big.Int
+}
+
+func (p *ecPoint) Equal(q *ecPoint) bool {
+	if p == nil || q == nil {
+		return p == q
+	}
+	return p.x.Cmp(q.x) == 0 && p.y.Cmp(q.y) == 0
+}
+
+type curve interface {
+	Add(p1, p2 *ecPoint) *ecPoint
+	randomPoint() *ecPoint
+}
+
+func scalarMult(c curve, P *ecPoint, k *big.Int) *ecPoint {
+	var R *ecPoint
+	for i := k.BitLen() - 1; i >= 0; i-- {
+		R = c.Add(R, R)
+		if k.Bit(i) == 1 {
+			R = c.Add(R, P)
+		}
+	}
+	return R
+}
+
+// pointOfOrder returns a point of order the product of factors, which must
+// be distinct primes dividing the order of the curve.
+func pointOfOrder(c curve, order *big.Int, factors ...int64) *ecPoint {
+	var res *ecPoint
+	for _, f := range factors {
+		r := big.NewInt(f)
+		e := new(big.Int).Set(order)
+		for new(big.Int).Mod(e, r).Sign() == 0 {
+			e.Div(e, r)
+		}
+		// e*P has order a power of r, which is brought down to r.
+		var P *ecPoint
+		for P == nil {
+			P = scalarMult(c, c.randomPoint(), e)
+		}
+		for Q := scalarMult(c, P, r); Q != nil; Q = scalarMult(c, P, r) {
+			P = Q
+		}
+		res = c.Add(res, P)
+	}
+	return res
+}
+
+type curveGroup struct{ c curve }
+
+func (g curveGroup) op(x, y interface{}) interface{} {
+	return g.c.Add(x.(*ecPoint), y.(*ecPoint))
+}
+
+func (g curveGroup) exp(x interface{}, k *big.Int) interface{} {
+	return scalarMult(g.c, x.(*ecPoint), k)
+}
+
+func (g curveGroup) equal(x, y interface{}) bool {
+	return x.(*ecPoint).Equal(y.(*ecPoint))
+}
+
+func (g curveGroup) index(x interface{}) uint64 {
+	if x.(*ecPoint) == nil {
+		return 0
+	}
+	return lowBits(x.(*ecPoint).x)
+}
+
+// A weierstrassCurve is y^2 = x^3 + ax + b over GF(p).
+type weierstrassCurve struct {
+	p, a, b *big.Int
+}
+
+func (c *weierstrassCurve) Add(p1, p2 *ecPoint) *ecPoint {
+	if p1 == nil {
+		return p2
+	}
+	if p2 == nil {
+		return p1
+	}
+	num, den := new(big.Int), new(big.Int)
+	if p1.x.Cmp(p2.x) == 0 {
+		if p1.y.Cmp(p2.y) != 0 || p1.y.Sign() == 0 {
+			return nil
+		}
+		num.Mul(p1.x, p1.x).Mul(num, big3).Add(num, c.a)
+		den.Lsh(p1.y, 1)
+	} else {
+		num.Sub(p2.y, p1.y)
+		den.Sub(p2.x, p1.x)
+	}
+	den.Mod(den, c.p).ModInverse(den, c.p)
+	l := num.Mul(num, den).Mod(num, c.p)
+	x := new(big.Int).Mul(l, l)
+	x.Sub(x, p1.x).Sub(x, p2.x).Mod(x, c.p)
+	y := den.Sub(p1.x, x)
+	y.Mul(y, l).Sub(y, p1.y).Mod(y, c.p)
+	return &ecPoint{x, y}
+}
+
+func (c *weierstrassCurve) Neg(P *ecPoint) *ecPoint {
+	if P == nil {
+		return nil
+	}
+	return &ecPoint{P.x, new(big.Int).Sub(c.p, P.y)}
+}
+
+func (c *weierstrassCurve) ScalarMult(P *ecPoint, k *big.Int) *ecPoint {
+	return scalarMult(c, P, k)
+}
+
+func (c *weierstrassCurve) IsOnCurve(P *ecPoint) bool {
+	if P == nil {
+		return true
+	}
+	y2 := new(big.Int).Mul(P.y, P.y)
+	return y2.Mod(y2, c.p).Cmp(c.rhs(P.x)) == 0
+}
+
+func (c *weierstrassCurve) rhs(x *big.Int) *big.Int {
+	y2 := new(big.Int).Mul(x, x)
+	y2.Add(y2, c.a).Mul(y2, x).Add(y2, c.b)
+	return y2.Mod(y2, c.p)
+}
+
+func (c *weierstrassCurve) randomPoint() *ecPoint {
+	for {
+		x, _ := rand.Int(rand.Reader, c.p)
+		if y := new(big.Int).ModSqrt(c.rhs(x), c.p); y != nil {
+			return &ecPoint{x, y}
+		}
+	}
+}
+
+func (c *weierstrassCurve) marshal(P *ecPoint) []byte {
+	if P == nil {
+		return []byte{0}
+	}
+	size := (c.p.BitLen() + 7) / 8
+	out := make([]byte, 1+2*size)
+	out[0] = 4
+	xb, yb := P.x.Bytes(), P.y.Bytes()
+	copy(out[1+size-len(xb):], xb)
+	copy(out[1+2*size-len(yb):], yb)
+	return out
+}
+
+// ecParams is a curve with a generator G of prime order n.
+type ecParams struct {
+	curve *weierstrassCurve
+	G     *ecPoint
+	n     *big.Int
+}
+
+var cryptopalsECParams ecParams
+
+// invalidCurves59 differ from cryptopalsECParams only in b, which the
+// addition formulas don't use.
+var invalidCurves59 []invalidCurve
+
+type invalidCurve struct {
+	b, order *big.Int
+}
+
+func init() {
+	p, _ := new(big.Int).SetString("233970423115425145524320034830162017933", 10)
+	a := new(big.Int).Sub(p, big.NewInt(95051))
+	cryptopalsECParams.curve = &weierstrassCurve{p: p, a: a, b: big.NewInt(11279326)}
+	gy, _ := new(big.Int).SetString("85518893674295321206118380980485522083", 10)
+	cryptopalsECParams.G = &ecPoint{big.NewInt(182), gy}
+	cryptopalsECParams.n, _ = new(big.Int).SetString("29246302889428143187362802287225875743", 10)
+
+	for _, c := range []struct {
+		b     int64
+		order string
+	}{
+		{210, "233970423115425145550826547352470124412"},
+		{504, "233970423115425145544350131142039591210"},
+		{727, "233970423115425145545378039958152057148"},
+	} {
+		order, _ := new(big.Int).SetString(c.order, 10)
+		invalidCurves59 = append(invalidCurves59, invalidCurve{big.NewInt(c.b), order})
+	}
+}
+
+func (ec ecParams) Generate() (d *big.Int, Q *ecPoint) {
+	for {
+		d, _ = rand.Int(rand.Reader, ec.n)
+		if d.Sign() > 0 {
+			return d, ec.curve.ScalarMult(ec.G, d)
+		}
+	}
+}
+
+func newECDHOracle(ec ecParams) (
+	pub *ecPoint,
+	exchange func(h *ecPoint) (msg, mac []byte),
+) {
+	x, pub := ec.Generate()
+	exchange = func(h *ecPoint) (msg, mac []byte) {
+		K := ec.curve.ScalarMult(h, x)
+		return bobMessage, macSecret(ec.curve.marshal(K), bobMessage)
+	}
+	return
+}
+
+// attackECDHInvalidCurve recovers Bob's key by sending him points of small
+// order on curves with a different b, which he doesn't notice.
+func attackECDHInvalidCurve(ec ecParams, invalid []invalidCurve,
+	exchange func(h *ecPoint) (msg, mac []byte)) *big.Int {
+	var residues, moduli []*big.Int
+	m := big.NewInt(1)
+	for _, ic := range invalid {
+		c := &weierstrassCurve{p: ec.curve.p, a: ec.curve.a, b: ic.b}
+		for _, r := range smallFactors(ic.order, 1<<16) {
+			R := big.NewInt(r)
+			if m.Cmp(ec.n) > 0 || new(big.Int).Mod(m, R).Sign() == 0 {
+				continue
+			}
+			h := pointOfOrder(c, ic.order, r)
+			msg, mac := exchange(h)
+			var K *ecPoint
+			for k := int64(0); k < r; k++ {
+				if hmac.Equal(macSecret(c.marshal(K), msg), mac) {
+					residues = append(residues, big.NewInt(k))
+					moduli = append(moduli, R)
+					m.Mul(m, R)
+					break
+				}
+				K = c.Add(K, h)
+			}
+		}
+	}
+	if m.Cmp(ec.n) <= 0 {
+		panic("not enough small subgroups")
+	}
+	x, _ := crt(residues, moduli)
+	return x
+}
+
+// A montgomeryCurve is Bv^2 = u^3 + Au^2 + u over GF(p). ecPoint.x and
+// ecPoint.y hold u and v.
+type montgomeryCurve struct {
+	p, A, B *big.Int
+}
+
+func (c *montgomeryCurve) Add(p1, p2 *ecPoint) *ecPoint {
+	if p1 == nil {
+		return p2
+	}
+	if p2 == nil {
+		return p1
+	}
+	num, den := new(big.Int), new(big.Int)
+	if p1.x.Cmp(p2.x) == 0 {
+		if p1.y.Cmp(p2.y) != 0 || p1.y.Sign() == 0 {
+			return nil
+		}
+		num.Mul(p1.x, p1.x).Mul(num, big3)
+		num.Add(num, new(big.Int).Lsh(new(big.Int).Mul(c.A, p1.x), 1)).Add(num, big1)
+		den.Mul(c.B, p1.y).Lsh(den, 1)
+	} else {
+		num.Sub(p2.y, p1.y)
+		den.Sub(p2.x, p1.x)
+	}
+	den.Mod(den, c.p).ModInverse(den, c.p)
+	l := num.Mul(num, den).Mod(num, c.p)
+	u := new(big.Int).Mul(l, l)
+	u.Mul(u, c.B).Sub(u, c.A).Sub(u, p1.x).Sub(u, p2.x).Mod(u, c.p)
+	v := den.Sub(p1.x, u)
+	v.Mul(v, l).Sub(v, p1.y).Mod(v, c.p)
+	return &ecPoint{u, v}
+}
+
+func (c *montgomeryCurve) ScalarMult(P *ecPoint, k *big.Int) *ecPoint {
+	return scalarMult(c, P, k)
+}
+
+func (c *montgomeryCurve) rhs(u *big.Int) *big.Int {
+	v2 := new(big.Int).Add(u, c.A)
+	v2.Mul(v2, u).Add(v2, big1).Mul(v2, u)
+	return v2.Mod(v2, c.p)
+}
+
+// liftU returns a point with the given u coordinate, or nil if there is none.
+func (c *montgomeryCurve) liftU(u *big.Int) *ecPoint {
+	v2 := c.rhs(u)
+	v2.Mul(v2, new(big.Int).ModInverse(c.B, c.p)).Mod(v2, c.p)
+	v := new(big.Int).ModSqrt(v2, c.p)
+	if v == nil {
+		return nil
+	}
+	return &ecPoint{new(big.Int).Set(u), v}
+}
+
+func (c *montgomeryCurve) randomPoint() *ecPoint {
+	for {
+		u, _ := rand.Int(rand.Reader, c.p)
+		if P := c.liftU(u); P != nil {
+			return P
+		}
+	}
+}
+
+// ladder computes the u coordinate of k*P from the u coordinate of P alone.
+// It doesn't depend on B, so it will happily compute on the twist.
+func (c *montgomeryCurve) ladder(u, k *big.Int) *big.Int {
+	p := c.p
+	mod := func(x *big.Int) *big.Int { return x.Mod(x, p) }
+	u2, w2 := big.NewInt(1), big.NewInt(0)
+	u3, w3 := new(big.Int).Set(u), big.NewInt(1)
+	for i := p.BitLen() - 1; i >= 0; i-- {
+		b := k.Bit(i)
+		if b == 1 {
+			u2, u3 = u3, u2
+			w2, w3 = w3, w2
+		}
+		t1 := new(big.Int).Mul(u2, u3)
+		t1.Sub(t1, new(big.Int).Mul(w2, w3))
+		t2 := new(big.Int).Mul(u2, w3)
+		t2.Sub(t2, new(big.Int).Mul(w2, u3))
+		nu3 := mod(t1.Mul(t1, t1))
+		nw3 := mod(t2.Mul(t2, t2).Mul(t2, u))
+		t3 := new(big.Int).Mul(u2, u2)
+		t4 := new(big.Int).Mul(w2, w2)
+		uw := new(big.Int).Mul(u2, w2)
+		nu2 := new(big.Int).Sub(t3, t4)
+		nu2 = mod(nu2.Mul(nu2, nu2))
+		nw2 := new(big.Int).Mul(c.A, uw)
+		nw2.Add(nw2, t3).Add(nw2, t4).Mul(nw2, uw).Lsh(nw2, 2)
+		u2, w2, u3, w3 = nu2, mod(nw2), nu3, nw3
+		if b == 1 {
+			u2, u3 = u3, u2
+			w2, w3 = w3, w2
+		}
+	}
+	w2.Exp(w2, new(big.Int).Sub(p, big2), p)
+	return mod(w2.Mul(w2, u2))
+}
+
+func (c *montgomeryCurve) marshalU(u *big.Int) []byte {
+	out := make([]byte, (c.p.BitLen()+7)/8)
+	b := u.Bytes()
+	copy(out[len(out)-len(b):], b)
+	return out
+}
+
+// montgomeryParams is a curve with a base point u of prime order n, and the
+// order of the whole curve.
+type montgomeryParams struct {
+	curve       *montgomeryCurve
+	u, n, order *big.Int
+}
+
+var cryptopalsMontgomeryParams montgomeryParams
+
+func init() {
+	cryptopalsMontgomeryParams.curve = &montgomeryCurve{
+		p: cryptopalsECParams.curve.p, A: big.NewInt(534), B: big.NewInt(1)}
+	cryptopalsMontgomeryParams.u = big.NewInt(4)
+	cryptopalsMontgomeryParams.n = cryptopalsECParams.n
+	cryptopalsMontgomeryParams.order = new(big.Int).Lsh(cryptopalsECParams.n, 3)
+}
+
+func newECDHLadderOracle(mp montgomeryParams) (
+	pub *big.Int,
+	exchange func(u *big.Int) (msg, mac []byte),
+) {
+	var x *big.Int
+	for x == nil || x.Sign() == 0 {
+		x, _ = rand.Int(rand.Reader, mp.n)
+	}
+	pub = mp.curve.ladder(mp.u, x)
+	exchange = func(u *big.Int) (msg, mac []byte) {
+		K := mp.curve.ladder(u, x)
+		return bobMessage, macSecret(mp.curve.marshalU(K), bobMessage)
+	}
+	return
+}
+
+// attackECDHTwist recovers Bob's key by sending him u coordinates of points
+// of small order on the quadratic twist of the curve. Since only u is
+// exchanged, each residue is only learned up to sign, and the signs are
+// reconciled by sending points of the product of two orders. What's left is
+// recovered with the kangaroo on the curve itself.
+//
+// Both x and n-x are valid keys for the same public u, and either is returned.
+func attackECDHTwist(mp montgomeryParams, pub *big.Int,
+	exchange func(u *big.Int) (msg, mac []byte)) *big.Int {
+	c, p := mp.curve, mp.curve.p
+	twistOrder := new(big.Int).Lsh(p, 1)
+	twistOrder.Add(twistOrder, big2).Sub(twistOrder, mp.order)
+	d := big.NewInt(2)
+	for big.Jacobi(d, p) != -1 {
+		d.Add(d, big1)
+	}
+	twist := &montgomeryCurve{p: p, A: c.A, B: d}
+
+	var residues, moduli []*big.Int
+	for _, r := range smallFactors(twistOrder, 1<<22) {
+		if r == 2 {
+			continue
+		}
+		h := pointOfOrder(twist, twistOrder, r)
+		msg, mac := exchange(h.x)
+		var K *ecPoint
+		for k := int64(0); k <= r/2; k++ {
+			u := new(big.Int)
+			if K != nil {
+				u = K.x
+			}
+			if hmac.Equal(macSecret(c.marshalU(u), msg), mac) {
+				residues = append(residues, big.NewInt(k))
+				moduli = append(moduli, big.NewInt(r))
+				break
+			}
+			K = twist.Add(K, h)
+		}
+	}
+
+	base := -1
+	for i := range residues {
+		if base < 0 {
+			if residues[i].Sign() != 0 {
+				base = i
+			}
+			continue
+		}
+		if residues[i].Sign() == 0 {
+			continue
+		}
+		r0, ri := moduli[base].Int64(), moduli[i].Int64()
+		h := pointOfOrder(twist, twistOrder, r0, ri)
+		msg, mac := exchange(h.x)
+		k, _ := crt([]*big.Int{residues[base], residues[i]}, []*big.Int{moduli[base], moduli[i]})
+		K := twist.ScalarMult(h, k)
+		if K == nil || !hmac.Equal(macSecret(c.marshalU(K.x), msg), mac) {
+			residues[i].Sub(moduli[i], residues[i])
+		}
+	}
+	A, R := crt(residues, moduli)
+
+	// x = ±A mod R, and x*G = ±Z, so for some sign σ and |m| <= n/R
+	// σ*x*G = Z = (σA + mR)*G.
+	G := c.liftU(mp.u)
+	Z := c.liftU(pub)
+	RG := c.ScalarMult(G, R)
+	M := new(big.Int).Div(mp.n, R)
+	M.Add(M, big1)
+	AG := c.ScalarMult(G, A)
+	negAG := &ecPoint{AG.x, new(big.Int).Sub(p, AG.y)}
+	for i := 0; i < 5; i++ {
+		catch := newKangarooTrap(curveGroup{c}, RG, new(big.Int).Neg(M), M)
+		for _, target := range []struct {
+			y *ecPoint
+			a *big.Int
+		}{
+			{c.Add(Z, negAG), A},
+			{c.Add(Z, AG), new(big.Int).Neg(A)},
+		} {
+			if m, ok := catch(target.y); ok {
+				x := m.Mul(m, R).Add(m, target.a)
+				return x.Mod(x, mp.n)
+			}
+		}
+	}
+	panic("key not found")
+}
+
+func (ec ecParams) hash(msg []byte) *big.Int {
+	h := sha256.Sum256(msg)
+	H := new(big.Int).SetBytes(h[:])
+	if excess := len(h)*8 - ec.n.BitLen(); excess > 0 {
+		H.Rsh(H, uint(excess))
+	}
+	return H
+}
+
+func (ec ecParams) Sign(d *big.Int, msg []byte) (r, s *big.Int) {
+	for {
+		k, _ := rand.Int(rand.Reader, ec.n)
+		if r, s = ec.signWithNonce(d, k, msg); r != nil {
+			return
+		}
+	}
+}
+
+func (ec ecParams) signWithNonce(d, k *big.Int, msg []byte) (r, s *big.Int) {
+	if k.Sign() == 0 {
+		return nil, nil
+	}
+	r = new(big.Int).Mod(ec.curve.ScalarMult(ec.G, k).x, ec.n)
+	s = new(big.Int).Mul(d, r)
+	s.Add(s, ec.hash(msg)).Mul(s, new(big.Int).ModInverse(k, ec.n)).Mod(s, ec.n)
+	if r.Sign() == 0 || s.Sign() == 0 {
+		return nil, nil
+	}
+	return
+}
+
+func (ec ecParams) Verify(Q *ecPoint, msg []byte, r, s *big.Int) bool {
+	if r.Sign() <= 0 || s.Sign() <= 0 || r.Cmp(ec.n) >= 0 || s.Cmp(ec.n) >= 0 {
+		return false
+	}
+	w := new(big.Int).ModInverse(s, ec.n)
+	u1 := new(big.Int).Mul(ec.hash(msg), w)
+	u1.Mod(u1, ec.n)
+	u2 := new(big.Int).Mul(r, w)
+	u2.Mod(u2, ec.n)
+	R := ec.curve.Add(ec.curve.ScalarMult(ec.G, u1), ec.curve.ScalarMult(Q, u2))
+	if R == nil {
+		return false
+	}
+	return new(big.Int).Mod(R.x, ec.n).Cmp(r) == 0
+}
+
+// duplicateECDSAKey returns a new generator, and a key pair for it, under
+// which (r, s) is also a valid signature of msg.
+func duplicateECDSAKey(ec ecParams, Q *ecPoint, msg []byte, r, s *big.Int) (
+	ec1 ecParams, d1 *big.Int, Q1 *ecPoint) {
+	w := new(big.Int).ModInverse(s, ec.n)
+	u1 := new(big.Int).Mul(ec.hash(msg), w)
+	u1.Mod(u1, ec.n)
+	u2 := new(big.Int).Mul(r, w)
+	u2.Mod(u2, ec.n)
+	R := ec.curve.Add(ec.curve.ScalarMult(ec.G, u1), ec.curve.ScalarMult(Q, u2))
+
+	d1, _ = ec.Generate()
+	t := new(big.Int).Mul(u2, d1)
+	t.Add(t, u1).Mod(t, ec.n).ModInverse(t, ec.n)
+	ec1 = ecParams{curve: ec.curve, G: ec.curve.ScalarMult(R, t), n: ec.n}
+	Q1 = ec.curve.ScalarMult(ec1.G, d1)
+	return
+}
+
+var sha256DigestInfo = []byte{0x30, 0x31, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01,
+	0x65, 0x03, 0x04, 0x02, 0x01, 0x05, 0x00, 0x04, 0x20}
+
+func padPKCS1Signature(msg []byte, size int) []byte {
+	h := sha256.Sum256(msg)
+	em := make([]byte, size)
+	em[1] = 0x01
+	for i := 2; i < size-len(sha256DigestInfo)-len(h)-1; i++ {
+		em[i] = 0xff
+	}
+	copy(em[size-len(h)-len(sha256DigestInfo):], sha256DigestInfo)
+	copy(em[size-len(h):], h[:])
+	return em
+}
+
+func rsaSignPKCS1(priv *rsa.PrivateKey, msg []byte) []byte {
+	return rsaDecrypt(padPKCS1Signature(msg, (priv.N.BitLen()+7)/8), priv)
+}
+
+// rsaVerifyPKCS1 takes N and e separately, as the e of duplicateRSAKey
+// doesn't fit in a rsa.PublicKey.
+func rsaVerifyPKCS1(N, e *big.Int, msg, sig []byte) bool {
+	S := new(big.Int).SetBytes(sig)
+	if S.Cmp(N) >= 0 {
+		return false
+	}
+	size := (N.BitLen() + 7) / 8
+	em := make([]byte, size)
+	m := S.Exp(S, e, N).Bytes()
+	copy(em[size-len(m):], m)
+	return bytes.Equal(em, padPKCS1Signature(msg, size))
+}
+
+func primesBelow(n int) []int64 {
+	composite := make([]bool, n)
+	var res []int64
+	for i := 2; i < n; i++ {
+		if composite[i] {
+			continue
+		}
+		res = append(res, int64(i))
+		for j := i * i; j < n; j += i {
+			composite[j] = true
+		}
+	}
+	return res
+}
+
+// bsgs solves g^x = y mod p for x in [0, order) with baby-step giant-step.
+func bsgs(g, y, p *big.Int, order int64) (int64, bool) {
+	m := int64(math.Sqrt(float64(order))) + 1
+	table := make(map[string]int64, m)
+	e := big.NewInt(1)
+	for j := int64(0); j < m; j++ {
+		if _, ok := table[string(e.Bytes())]; !ok {
+			table[string(e.Bytes())] = j
+		}
+		e.Mul(e, g).Mod(e, p)
+	}
+	step := e.ModInverse(e, p)
+	c := new(big.Int).Set(y)
+	for i := int64(0); i <= m; i++ {
+		if j, ok := table[string(c.Bytes())]; ok {
+			return (i*m + j) % order, true
+		}
+		c.Mul(c, step).Mod(c, p)
+	}
+	return 0, false
+}
+
+// pohligHellman solves g^x = y mod p, where p-1 is the product of the
+// distinct primes in factors.
+func pohligHellman(g, y, p *big.Int, factors []int64) (*big.Int, bool) {
+	var residues, moduli []*big.Int
+	pm1 := new(big.Int).Sub(p, big1)
+	for _, f := range factors {
+		e := new(big.Int).Div(pm1, big.NewInt(f))
+		x, ok := bsgs(new(big.Int).Exp(g, e, p), new(big.Int).Exp(y, e, p), p, f)
+		if !ok {
+			return nil, false
+		}
+		residues = append(residues, big.NewInt(x))
+		moduli = append(moduli, big.NewInt(f))
+	}
+	x, _ := crt(residues, moduli)
+	return x, true
+}
+
+// smoothPrime returns a prime p of the given size such that p-1 is 2 times
+// distinct primes from candidates, s generates the whole multiplicative group,
+// and m is a non-residue (so that its discrete log is odd).
+func smoothPrime(bits int, candidates []int64, s, m *big.Int) (p *big.Int, factors []int64) {
+	for {
+		perm := mathrand.Perm(len(candidates))
+		prod := big.NewInt(2)
+		factors = []int64{2}
+		i := 0
+		for ; i < len(perm) && prod.BitLen() < bits-16; i++ {
+			f := candidates[perm[i]]
+			prod.Mul(prod, big.NewInt(f))
+			factors = append(factors, f)
+		}
+	search:
+		for ; i < len(perm); i++ {
+			f := candidates[perm[i]]
+			pm1 := new(big.Int).Mul(prod, big.NewInt(f))
+			if pm1.BitLen() != bits {
+				continue
+			}
+			p = new(big.Int).Add(pm1, big1)
+			if !p.ProbablyPrime(20) || big.Jacobi(m, p) != -1 {
+				continue
+			}
+			factors := append(factors, f)
+			for _, f := range factors {
+				e := new(big.Int).Div(pm1, big.NewInt(f))
+				if new(big.Int).Exp(s, e, p).Cmp(big1) == 0 {
+					continue search
+				}
+			}
+			return p, factors
+		}
+	}
+}
+
+// duplicateRSAKey returns a key pair under which sig is also a valid PKCS #1
+// v1.5 signature of msg. The primes are chosen so that discrete logs are
+// easy, and e solves sig^e = pad(msg) mod N.
+func duplicateRSAKey(pub *rsa.PublicKey, msg, sig []byte) (N, e, d *big.Int) {
+	size := (pub.N.BitLen() + 7) / 8
+	S := new(big.Int).SetBytes(sig)
+	m := new(big.Int).SetBytes(padPKCS1Signature(msg, size))
+	primes := primesBelow(1 << 16)[1:]
+	for {
+		p, pFactors := smoothPrime(size*8/2, primes, S, m)
+		used := make(map[int64]bool)
+		for _, f := range pFactors {
+			used[f] = true
+		}
+		var rest []int64
+		for _, f := range primes {
+			if !used[f] {
+				rest = append(rest, f)
+			}
+		}
+		q, qFactors := smoothPrime(size*8/2, rest, S, m)
+		N = new(big.Int).Mul(p, q)
+		if N.Cmp(S) <= 0 || (N.BitLen()+7)/8 != size {
+			continue
+		}
+
+		ep, ok := pohligHellman(S, m, p, pFactors)
+		if !ok {
+			continue
+		}
+		eq, ok := pohligHellman(S, m, q, qFactors)
+		if !ok {
+			continue
+		}
+		// gcd(p-1, q-1) = 2, and both logs are odd.
+		pm1 := new(big.Int).Sub(p, big1)
+		qm1half := new(big.Int).Rsh(q, 1)
+		e, lcm := crt([]*big.Int{ep, eq.Mod(eq, qm1half)}, []*big.Int{pm1, qm1half})
+		lcm.Lsh(lcm, 1)
+		if d = new(big.Int).ModInverse(e, lcm); d != nil {
+			return N, e, d
+		}
+	}
+}
+
+type ecdsaSignature struct {
+	msg  []byte
+	r, s *big.Int
+}
+
+// newBiasedECDSAOracle signs with nonces whose lowest bias bits are zero.
+func newBiasedECDSAOracle(ec ecParams, bias uint) (
+	Q *ecPoint,
+	sign func(msg []byte) (r, s *big.Int),
+) {
+	d, Q := ec.Generate()
+	sign = func(msg []byte) (r, s *big.Int) {
+		for {
+			k, _ := rand.Int(rand.Reader, new(big.Int).Rsh(ec.n, bias))
+			if r, s = ec.signWithNonce(d, k.Lsh(k, bias), msg); r != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// lll reduces the basis b in place, with δ = 3/4. It keeps the Gram-Schmidt
+// coefficients as exact rationals, following Cohen's algorithm 2.6.3.
+func lll(b [][]*big.Int) {
+	n := len(b)
+	dot := func(x, y []*big.Int) *big.Rat {
+		sum, t := new(big.Int), new(big.Int)
+		for i := range x {
+			sum.Add(sum, t.Mul(x[i], y[i]))
+		}
+		return new(big.Rat).SetInt(sum)
+	}
+	mu := make([][]*big.Rat, n)
+	for i := range mu {
+		mu[i] = make([]*big.Rat, n)
+	}
+	B := make([]*big.Rat, n)
+	gramSchmidt := func(k int) {
+		for j := 0; j < k; j++ {
+			t := dot(b[k], b[j])
+			for i := 0; i < j; i++ {
+				u := new(big.Rat).Mul(mu[j][i], mu[k][i])
+				t.Sub(t, u.Mul(u, B[i]))
+			}
+			mu[k][j] = t.Quo(t, B[j])
+		}
+		B[k] = dot(b[k], b[k])
+		for j := 0; j < k; j++ {
+			u := new(big.Rat).Mul(mu[k][j], mu[k][j])
+			B[k].Sub(B[k], u.Mul(u, B[j]))
+		}
+	}
+	half := big.NewRat(1, 2)
+	reduce := func(k, l int) {
+		if new(big.Rat).Abs(mu[k][l]).Cmp(half) <= 0 {
+			return
+		}
+		// q = floor(mu + 1/2)
+		t := new(big.Rat).Add(mu[k][l], half)
+		q := new(big.Int).Div(t.Num(), t.Denom())
+		for i := range b[k] {
+			b[k][i].Sub(b[k][i], new(big.Int).Mul(q, b[l][i]))
+		}
+		Q := new(big.Rat).SetInt(q)
+		mu[k][l].Sub(mu[k][l], Q)
+		for i := 0; i < l; i++ {
+			mu[k][i].Sub(mu[k][i], new(big.Rat).Mul(Q, mu[l][i]))
+		}
+	}
+	swap := func(k, kmax int) {
+		b[k], b[k-1] = b[k-1], b[k]
+		for j := 0; j < k-1; j++ {
+			mu[k][j], mu[k-1][j] = mu[k-1][j], mu[k][j]
+		}
+		m := mu[k][k-1]
+		Bn := new(big.Rat).Mul(m, m)
+		Bn.Mul(Bn, B[k-1]).Add(Bn, B[k])
+		mu[k][k-1] = new(big.Rat).Mul(m, B[k-1])
+		mu[k][k-1].Quo(mu[k][k-1], Bn)
+		B[k] = new(big.Rat).Mul(B[k-1], B[k])
+		B[k].Quo(B[k], Bn)
+		B[k-1] = Bn
+		for i := k + 1; i <= kmax; i++ {
+			t := mu[i][k]
+			mu[i][k] = new(big.Rat).Mul(m, t)
+			mu[i][k].Sub(mu[i][k-1], mu[i][k])
+			mu[i][k-1] = new(big.Rat).Mul(mu[k][k-1], mu[i][k])
+			mu[i][k-1].Add(mu[i][k-1], t)
+		}
+	}
+
+	gramSchmidt(0)
+	threeQuarters := big.NewRat(3, 4)
+	for k, kmax := 1, 0; k < n; {
+		if k > kmax {
+			kmax = k
+			gramSchmidt(k)
+		}
+		reduce(k, k-1)
+		lovasz := new(big.Rat).Mul(mu[k][k-1], mu[k][k-1])
+		lovasz.Sub(threeQuarters, lovasz).Mul(lovasz, B[k-1])
+		if B[k].Cmp(lovasz) < 0 {
+			swap(k, kmax)
+			if k > 1 {
+				k--
+			}
+			continue
+		}
+		for l := k - 2; l >= 0; l-- {
+			reduce(k, l)
+		}
+		k++
+	}
+}
+
+// recoverECDSAKeyFromBiasedNonces solves the hidden number problem posed by
+// signatures whose nonces k have their lowest bias bits set to zero.
+//
+// With k = 2^l * b, b = u + d*t mod n for t = r / (s * 2^l) and
+// u = H / (s * 2^l), where b is small. So (b_1, ..., b_N, d, n) is a short
+// vector of the lattice generated by the rows
+//
+//	n*2^l  0     ...  0         0  0
+//	0      n*2^l ...  0         0  0
+//	...
+//	t_1*2^l      ...  t_N*2^l   1  0
+//	u_1*2^l      ...  u_N*2^l   0  n
+//
+// (scaled by 2^l to keep it integer) and LLL finds it.
+func recoverECDSAKeyFromBiasedNonces(ec ecParams, Q *ecPoint, sigs []ecdsaSignature, bias uint) *big.Int {
+	n := ec.n
+	N := len(sigs)
+	scale := new(big.Int).Lsh(big1, bias)
+	basis := make([][]*big.Int, N+2)
+	for i := range basis {
+		basis[i] = make([]*big.Int, N+2)
+		for j := range basis[i] {
+			basis[i][j] = new(big.Int)
+		}
+	}
+	for i, sig := range sigs {
+		basis[i][i].Mul(n, scale)
+		sInv := new(big.Int).Mul(sig.s, scale)
+		sInv.ModInverse(sInv, n)
+		t := basis[N][i].Mul(sig.r, sInv)
+		t.Mod(t, n).Mul(t, scale)
+		u := basis[N+1][i].Mul(ec.hash(sig.msg), sInv)
+		u.Mod(u, n).Mul(u, scale)
+	}
+	basis[N][N].SetInt64(1)
+	basis[N+1][N+1].Set(n)
+
+	lll(basis)
+
+	for _, row := range basis {
+		d := new(big.Int)
+		switch {
+		case row[N+1].Cmp(n) == 0:
+			d.Set(row[N])
+		case new(big.Int).Neg(row[N+1]).Cmp(n) == 0:
+			d.Neg(row[N])
+		default:
+			continue
+		}
+		d.Mod(d, n)
+		if ec.curve.ScalarMult(ec.G, d).Equal(Q) {
+			return d
+		}
+	}
+	return nil
+}
+
+// gfElement is an element of GF(2^128) as used by GCM: the bits of the block,
+// most significant first, are the coefficients of x^0 to x^127. It doubles as
+// a vector of 128 bits for the linear algebra of the truncated MAC attack.
+type gfElement struct{ hi, lo uint64 }
+
+var gfOne = gfElement{hi: 1 << 63}
+
+func gfElementFromBytes(b []byte) gfElement {
+	var block [16]byte
+	copy(block[:], b)
+	return gfElement{binary.BigEndian.Uint64(block[:]), binary.BigEndian.Uint64(block[8:])}
+}
+
+func gfBasis(i int) gfElement {
+	var e gfElement
+	return e.setBit(i)
+}
+
+func (x gfElement) Bytes() []byte {
+	b := make([]byte, 16)
+	binary.BigEndian.PutUint64(b, x.hi)
+	binary.BigEndian.PutUint64(b[8:], x.lo)
+	return b
+}
+
+func (x gfElement) isZero() bool { return x.hi == 0 && x.lo == 0 }
+
+func (x gfElement) bit(i int) uint64 {
+	if i < 64 {
+		return x.hi >> uint(63-i) & 1
+	}
+	return x.lo >> uint(127-i) & 1
+}
+
+func (x gfElement) setBit(i int) gfElement {
+	if i < 64 {
+		x.hi |= 1 << uint(63-i)
+	} else {
+		x.lo |= 1 << uint(127-i)
+	}
+	return x
+}
+
+func (x gfElement) add(y gfElement) gfElement {
+	return gfElement{x.hi ^ y.hi, x.lo ^ y.lo}
+}
+
+// mulX returns x times the polynomial x.
+func (x gfElement) mulX() gfElement {
+	carry := x.lo & 1
+	x.lo = x.lo>>1 | x.hi<<63
+	x.hi >>= 1
+	if carry == 1 {
+		x.hi ^= 0xe1 << 56
+	}
+	return x
+}
+
+func (x gfElement) mul(y gfElement) gfElement {
+	var z gfElement
+	for i := 0; i < 128; i++ {
+		if x.bit(i) == 1 {
+			z = z.add(y)
+		}
+		y = y.mulX()
+	}
+	return z
+}
+
+func (x gfElement) inverse() gfElement {
+	// x^(2^128 - 2)
+	r := gfOne
+	for i := 0; i < 127; i++ {
+		r = r.mul(r).mul(x)
+	}
+	return r.mul(r)
+}
+
+func randomGFElement() gfElement {
+	return gfElement{mathrand.Uint64(), mathrand.Uint64()}
+}
+
+// gcmBlocks returns the blocks GHASH runs over.
+func gcmBlocks(ad, ct []byte) []gfElement {
+	var blocks []gfElement
+	for _, b := range [][]byte{ad, ct} {
+		for i := 0; i < len(b); i += 16 {
+			end := i + 16
+			if end > len(b) {
+				end = len(b)
+			}
+			blocks = append(blocks, gfElementFromBytes(b[i:end]))
+		}
+	}
+	return append(blocks, gcmLengthBlock(len(ad), len(ct)))
+}
+
+func gcmLengthBlock(adLen, ctLen int) gfElement {
+	return gfElement{uint64(adLen) * 8, uint64(ctLen) * 8}
+}
+
+func ghash(h gfElement, ad, ct []byte) gfElement {
+	var y gfElement
+	for _, b := range gcmBlocks(ad, ct) {
+		y = y.add(b).mul(h)
+	}
+	return y
+}
+
+// gcm is AES-GCM with 12-byte nonces and tags of tagSize bytes, which can be
+// shorter than the standard library allows.
+type gcm struct {
+	b       cipher.Block
+	h       gfElement
+	tagSize int
+}
+
+func newGCM(key []byte, tagSize int) *gcm {
+	b, err := aes.NewCipher(key)
+	if err != nil {
+		panic(err)
+	}
+	h := make([]byte, 16)
+	b.Encrypt(h, h)
+	return &gcm{b: b, h: gfElementFromBytes(h), tagSize: tagSize}
+}
+
+func (g *gcm) counter(nonce []byte) []byte {
+	if len(nonce) != 12 {
+		panic("gcm: wrong nonce size")
+	}
+	return append(append([]byte{}, nonce...), 0, 0, 0, 1)
+}
+
+func (g *gcm) xorKeyStream(nonce, dst, src []byte) {
+	ctr := g.counter(nonce)
+	ctr[15]++
+	cipher.NewCTR(g.b, ctr).XORKeyStream(dst, src)
+}
+
+func (g *gcm) tag(nonce, ad, ct []byte) []byte {
+	s := make([]byte, 16)
+	g.b.Encrypt(s, g.counter(nonce))
+	return xor(s, ghash(g.h, ad, ct).Bytes())[:g.tagSize]
+}
+
+func (g *gcm) seal(nonce, plaintext, ad []byte) (ct, tag []byte) {
+	ct = make([]byte, len(plaintext))
+	g.xorKeyStream(nonce, ct, plaintext)
+	return ct, g.tag(nonce, ad, ct)
+}
+
+func (g *gcm) open(nonce, ct, tag, ad []byte) ([]byte, error) {
+	if !hmac.Equal(g.tag(nonce, ad, ct), tag) {
+		return nil, errors.New("gcm: message authentication failed")
+	}
+	plaintext := make([]byte, len(ct))
+	g.xorKeyStream(nonce, plaintext, ct)
+	return plaintext, nil
+}
+
+// forgeGCM returns the tag for newAD and newCT, under the same key and nonce
+// as a valid ad, ct and tag, given the authentication key h.
+func forgeGCM(h gfElement, ad, ct, tag, newAD, newCT []byte) []byte {
+	s := xor(tag, ghash(h, ad, ct).Bytes()[:len(tag)])
+	return xor(s, ghash(h, newAD, newCT).Bytes()[:len(tag)])
+}
+
+func newRepeatedNonceGCMOracle() (
+	encrypt func(ad, msg []byte) (nonce, ct, tag []byte),
+	isValid func(nonce, ad, ct, tag []byte) bool,
+) {
+	key := make([]byte, 16)
+	rand.Read(key)
+	g := newGCM(key, 16)
+	nonce := make([]byte, 12)
+	rand.Read(nonce)
+	encrypt = func(ad, msg []byte) ([]byte, []byte, []byte) {
+		ct, tag := g.seal(nonce, msg, ad)
+		return nonce, ct, tag
+	}
+	isValid = func(nonce, ad, ct, tag []byte) bool {
+		_, err := g.open(nonce, ct, tag, ad)
+		return err == nil
+	}
+	return
+}
+
+// A gfPoly is a polynomial over GF(2^128), with the coefficients in
+// ascending order of degree.
+type gfPoly []gfElement
+
+func (f gfPoly) trim() gfPoly {
+	for len(f) > 0 && f[len(f)-1].isZero() {
+		f = f[:len(f)-1]
+	}
+	return f
+}
+
+func (f gfPoly) degree() int {
+	return len(f.trim()) - 1
+}
+
+func (f gfPoly) add(g gfPoly) gfPoly {
+	if len(f) < len(g) {
+		f, g = g, f
+	}
+	res := append(gfPoly{}, f...)
+	for i := range g {
+		res[i] = res[i].add(g[i])
+	}
+	return res.trim()
+}
+
+func (f gfPoly) mul(g gfPoly) gfPoly {
+	if len(f) == 0 || len(g) == 0 {
+		return nil
+	}
+	res := make(gfPoly, len(f)+len(g)-1)
+	for i := range f {
+		for j := range g {
+			res[i+j] = res[i+j].add(f[i].mul(g[j]))
+		}
+	}
+	return res.trim()
+}
+
+func (f gfPoly) divMod(g gfPoly) (q, r gfPoly) {
+	g = g.trim()
+	if len(g) == 0 {
+		panic("division by zero polynomial")
+	}
+	r = append(gfPoly{}, f.trim()...)
+	inv := g[len(g)-1].inverse()
+	if len(r) >= len(g) {
+		q = make(gfPoly, len(r)-len(g)+1)
+	}
+	for len(r) >= len(g) {
+		c := r[len(r)-1].mul(inv)
+		shift := len(r) - len(g)
+		q[shift] = c
+		for i := range g {
+			r[shift+i] = r[shift+i].add(g[i].mul(c))
+		}
+		r = r.trim()
+	}
+	return q.trim(), r
+}
+
+func (f gfPoly) mulMod(g, m gfPoly) gfPoly {
+	_, r := f.mul(g).divMod(m)
+	return r
+}
+
+func (f gfPoly) monic() gfPoly {
+	f = f.trim()
+	inv := f[len(f)-1].inverse()
+	res := make(gfPoly, len(f))
+	for i := range f {
+		res[i] = f[i].mul(inv)
+	}
+	return res
+}
+
+func polyGCD(f, g gfPoly) gfPoly {
+	f, g = f.trim(), g.trim()
+	for len(g) > 0 {
+		_, r := f.divMod(g)
+		f, g = g, r
+	}
+	return f.monic()
+}
+
+// roots returns the distinct roots of f.
+func (f gfPoly) roots() []gfElement {
+	f = f.monic()
+	// gcd(f, x^(2^128) - x) is the product of the linear factors of f.
+	x := gfPoly{{}, gfOne}
+	t := x
+	for i := 0; i < 128; i++ {
+		t = t.mulMod(t, f)
+	}
+	return polyGCD(f, t.add(x)).splitRoots()
+}
+
+// splitRoots finds the roots of a product of distinct linear factors, with
+// the equal-degree factorization of Cantor and Zassenhaus: the trace of a*x
+// is 0 or 1 at each root, so gcd(f, Tr(a*x)) is a random subset of factors.
+func (f gfPoly) splitRoots() []gfElement {
+	switch f.degree() {
+	case 0:
+		return nil
+	case 1:
+		return []gfElement{f.monic()[0]}
+	}
+	for {
+		ax := gfPoly{{}, randomGFElement()}
+		t, tr := ax, ax
+		for i := 1; i < 128; i++ {
+			t = t.mulMod(t, f)
+			tr = tr.add(t)
+		}
+		g := polyGCD(f, tr)
+		if d := g.degree(); d > 0 && d < f.degree() {
+			q, _ := f.divMod(g)
+			return append(g.splitRoots(), q.splitRoots()...)
+		}
+	}
+}
+
+// gcmTagPolynomial returns the polynomial in h that is the GHASH of ad and
+// ct plus tag. For two messages under the same nonce, the masks of the tags
+// cancel out in the sum of their polynomials, which has h as a root.
+func gcmTagPolynomial(ad, ct, tag []byte) gfPoly {
+	blocks := gcmBlocks(ad, ct)
+	f := make(gfPoly, len(blocks)+1)
+	f[0] = gfElementFromBytes(tag)
+	for i, b := range blocks {
+		f[len(blocks)-i] = b
+	}
+	return f
+}
+
+// recoverGCMKeyFromRepeatedNonce returns the candidates for h that are
+// consistent with all the messages, encrypted under the same nonce.
+func recoverGCMKeyFromRepeatedNonce(ads, cts, tags [][]byte) []gfElement {
+	f0 := gcmTagPolynomial(ads[0], cts[0], tags[0])
+	var candidates []gfElement
+	for i := 1; i < len(cts); i++ {
+		roots := f0.add(gcmTagPolynomial(ads[i], cts[i], tags[i])).roots()
+		if i == 1 {
+			candidates = roots
+			continue
+		}
+		var res []gfElement
+		for _, c := range candidates {
+			for _, r := range roots {
+				if c == r {
+					res = append(res, c)
+				}
+			}
+		}
+		candidates = res
+	}
+	return candidates
+}
+
+func newTruncatedGCMOracle(tagSize int) (
+	encrypt func(msg []byte) (nonce, ct, tag []byte),
+	isValid func(nonce, ct, tag []byte) bool,
+) {
+	key := make([]byte, 16)
+	rand.Read(key)
+	g := newGCM(key, tagSize)
+	encrypt = func(msg []byte) (nonce, ct, tag []byte) {
+		nonce = make([]byte, 12)
+		rand.Read(nonce)
+		ct, tag = g.seal(nonce, msg, nil)
+		return
+	}
+	isValid = func(nonce, ct, tag []byte) bool {
+		_, err := g.open(nonce, ct, tag, nil)
+		return err == nil
+	}
+	return
+}
+
+// A gcmSlot is a ciphertext block whose coefficient in GHASH is h^(2^j).
+// Since squaring is linear in GF(2^128), the error from flipping bits of
+// such blocks is a linear function of h.
+type gcmSlot struct {
+	block, j int
+}
+
+func gcmSlots(ctLen int) []gcmSlot {
+	n := (ctLen + 15) / 16
+	var slots []gcmSlot
+	for j := 1; 1<<uint(j) <= n+1; j++ {
+		// Block i is the coefficient of h^(n+1-i).
+		i := n + 1 - 1<<uint(j)
+		if (i+1)*16 <= ctLen {
+			slots = append(slots, gcmSlot{block: i, j: j})
+		}
+	}
+	return slots
+}
+
+// bitVector is a vector over GF(2).
+type bitVector []uint64
+
+func newBitVector(n int) bitVector { return make(bitVector, (n+63)/64) }
+
+func (v bitVector) get(i int) uint64 { return v[i/64] >> uint(i%64) & 1 }
+func (v bitVector) set(i int)        { v[i/64] |= 1 << uint(i%64) }
+func (v bitVector) xor(w bitVector) {
+	for i := range v {
+		v[i] ^= w[i]
+	}
+}
+
+// solveGF2 solves the system whose rows have n coefficients followed by the
+// constant term, returning one solution and a basis of the kernel.
+func solveGF2(rows []bitVector, n int) (sol bitVector, kernel []bitVector, ok bool) {
+	var pivots []int
+	r := 0
+	for c := 0; c < n && r < len(rows); c++ {
+		p := -1
+		for i := r; i < len(rows); i++ {
+			if rows[i].get(c) == 1 {
+				p = i
+				break
+			}
+		}
+		if p < 0 {
+			continue
+		}
+		rows[r], rows[p] = rows[p], rows[r]
+		for i := range rows {
+			if i != r && rows[i].get(c) == 1 {
+				rows[i].xor(rows[r])
+			}
+		}
+		pivots = append(pivots, c)
+		r++
+	}
+	for _, row := range rows[r:] {
+		if row.get(n) == 1 {
+			return nil, nil, false
+		}
+	}
+	sol = newBitVector(n)
+	isPivot := make(map[int]bool)
+	for i, c := range pivots {
+		isPivot[c] = true
+		if rows[i].get(n) == 1 {
+			sol.set(c)
+		}
+	}
+	for f := 0; f < n; f++ {
+		if isPivot[f] {
+			continue
+		}
+		v := newBitVector(n)
+		v.set(f)
+		for i, c := range pivots {
+			if rows[i].get(f) == 1 {
+				v.set(c)
+			}
+		}
+		kernel = append(kernel, v)
+	}
+	return sol, kernel, true
+}
+
+// gfEquations are linear equations row·h = 0 on the bits of h, kept in
+// reduced row echelon form.
+type gfEquations struct {
+	rows   []gfElement
+	pivots []int
+}
+
+func (e *gfEquations) add(row gfElement) {
+	for i, r := range e.rows {
+		if row.bit(e.pivots[i]) == 1 {
+			row = row.add(r)
+		}
+	}
+	if row.isZero() {
+		return
+	}
+	p := 0
+	for row.bit(p) == 0 {
+		p++
+	}
+	for i, r := range e.rows {
+		if r.bit(p) == 1 {
+			e.rows[i] = r.add(row)
+		}
+	}
+	e.rows = append(e.rows, row)
+	e.pivots = append(e.pivots, p)
+}
+
+func (e *gfEquations) nullSpace() []gfElement {
+	isPivot := make(map[int]bool)
+	for _, p := range e.pivots {
+		isPivot[p] = true
+	}
+	var basis []gfElement
+	for f := 0; f < 128; f++ {
+		if isPivot[f] {
+			continue
+		}
+		v := gfBasis(f)
+		for i, r := range e.rows {
+			if r.bit(f) == 1 {
+				v = v.setBit(e.pivots[i])
+			}
+		}
+		basis = append(basis, v)
+	}
+	return basis
+}
+
+// attackTruncatedGCM recovers h from a valid message with a short tag and
+// a forgery oracle, with Ferguson's attack.
+func attackTruncatedGCM(nonce, ct, tag []byte, isValid func(nonce, ct, tag []byte) bool) gfElement {
+	return recoverGCMKeyFromForgeries(nonce, ct, tag, gcmSlots(len(ct)), gfElement{}, isValid)
+}
+
+// attackTruncatedGCMWithExtension is attackTruncatedGCM for a short message:
+// it prepends zero blocks to the ciphertext to reach the given number of
+// blocks. That doesn't change the coefficients of the original blocks, and
+// it changes the length block by a known amount, so the error stays linear.
+func attackTruncatedGCMWithExtension(nonce, ct, tag []byte, blocks int,
+	isValid func(nonce, ct, tag []byte) bool) gfElement {
+	prefix := blocks - (len(ct)+15)/16
+	if prefix <= 0 {
+		return attackTruncatedGCM(nonce, ct, tag, isValid)
+	}
+	ext := append(make([]byte, prefix*16), ct...)
+	delta := gcmLengthBlock(0, len(ext)).add(gcmLengthBlock(0, len(ct)))
+	return recoverGCMKeyFromForgeries(nonce, ext, tag, gcmSlots(len(ext)), delta, isValid)
+}
+
+// recoverGCMKeyFromForgeries flips bits of the slots of ct so that the
+// GHASH error, plus delta*h, is zero in as many bits of the tag as possible,
+// and submits forgeries until one is accepted. Then the other bits of the
+// tag are also zero, which gives linear equations on h. As more are known, h
+// is confined to a smaller subspace and more tag bits can be zeroed.
+func recoverGCMKeyFromForgeries(nonce, ct, tag []byte, slots []gcmSlot, delta gfElement,
+	isValid func(nonce, ct, tag []byte) bool) gfElement {
+	tagBits := len(tag) * 8
+	vars := 128 * len(slots)
+	eqs := &gfEquations{}
+	for {
+		X := eqs.nullSpace() // h = X * y for some y.
+		m := len(X)
+		if m == 1 {
+			return X[0]
+		}
+
+		// Pick the flips d so that the first k rows of (Ad + M_delta) * X
+		// are zero, which are k*m linear equations on d.
+		k := (vars - 16) / m
+		if k > tagBits-1 {
+			k = tagBits - 1
+		}
+		var sol bitVector
+		var kernel []bitVector
+		for ok := false; !ok; k-- {
+			rows := make([]bitVector, k*m)
+			for i := range rows {
+				rows[i] = newBitVector(vars + 1)
+			}
+			for s, slot := range slots {
+				for c, xc := range X {
+					z := xc
+					for i := 0; i < slot.j; i++ {
+						z = z.mul(z)
+					}
+					for pos := 0; pos < 128; pos++ {
+						for r := 0; r < k; r++ {
+							if z.bit(r) == 1 {
+								rows[r*m+c].set(s*128 + pos)
+							}
+						}
+						z = z.mulX()
+					}
+				}
+			}
+			for c, xc := range X {
+				z := delta.mul(xc)
+				for r := 0; r < k; r++ {
+					if z.bit(r) == 1 {
+						rows[r*m+c].set(vars)
+					}
+				}
+			}
+			sol, kernel, ok = solveGF2(rows, vars)
+		}
+		k++
+
+		forged := make([]byte, len(ct))
+		for {
+			d := append(bitVector{}, sol...)
+			for _, v := range kernel {
+				if mathrand.Intn(2) == 1 {
+					d.xor(v)
+				}
+			}
+			flips := make([]gfElement, len(slots))
+			copy(forged, ct)
+			for s, slot := range slots {
+				for pos := 0; pos < 128; pos++ {
+					if d.get(s*128+pos) == 1 {
+						flips[s] = flips[s].setBit(pos)
+					}
+				}
+				xorInPlace(forged[slot.block*16:slot.block*16+16], flips[s].Bytes())
+			}
+			if !isValid(nonce, forged, tag) {
+				continue
+			}
+
+			// The error e(h) = sum(d_s * h^(2^j_s)) + delta*h is zero in all
+			// the tag bits for the real h.
+			var columns [128]gfElement
+			for col := range columns {
+				e := delta.mul(gfBasis(col))
+				for s, slot := range slots {
+					z := gfBasis(col)
+					for i := 0; i < slot.j; i++ {
+						z = z.mul(z)
+					}
+					e = e.add(flips[s].mul(z))
+				}
+				columns[col] = e
+			}
+			for r := k; r < tagBits; r++ {
+				var row gfElement
+				for col, e := range columns {
+					if e.bit(r) == 1 {
+						row = row.setBit(col)
+					}
+				}
+				eqs.add(row)
+			}
+			break
+		}
+	}
+}
+
+func xorInPlace(dst, src []byte) {
+	for i := range dst {
+		dst[i] ^= src[i]
+	}
+}
+
+// ecFault is the condition under which the broken implementation of
+// newFaultyECDHOracle fails an addition: the product of the x coordinates
+// having faultBits trailing zeroes.
+func ecFault(c *weierstrassCurve, p1, p2 *ecPoint, faultBits uint) bool {
+	if p1 == nil || p2 == nil {
+		return false
+	}
+	t := new(big.Int).Mul(p1.x, p2.x)
+	t.Mod(t, c.p)
+	return t.Sign() == 0 || t.TrailingZeroBits() >= faultBits
+}
+
+// faultyScalarMult computes k*P for k of exactly bitLen bits, with
+// double-and-add, failing if any addition of P hits ecFault.
+func faultyScalarMult(c *weierstrassCurve, P *ecPoint, k *big.Int, bitLen int, faultBits uint) (*ecPoint, error) {
+	R := P
+	for i := bitLen - 2; i >= 0; i-- {
+		R = c.Add(R, R)
+		if k.Bit(i) == 1 {
+			if ecFault(c, R, P, faultBits) {
+				return nil, errors.New("fault")
+			}
+			R = c.Add(R, P)
+		}
+	}
+	return R, nil
+}
+
+// ecKeyBitLen is the length of the keys of newFaultyECDHOracle, which have
+// their top bit set like clamped X25519 keys.
+func ecKeyBitLen(ec ecParams) int {
+	return ec.n.BitLen() - 1
+}
+
+func newFaultyECDHOracle(ec ecParams, faultBits uint) (
+	pub *ecPoint,
+	exchange func(h *ecPoint) (msg, mac []byte, err error),
+) {
+	bitLen := ecKeyBitLen(ec)
+	x, _ := rand.Int(rand.Reader, new(big.Int).Lsh(big1, uint(bitLen-1)))
+	x.SetBit(x, bitLen-1, 1)
+	pub = ec.curve.ScalarMult(ec.G, x)
+	exchange = func(h *ecPoint) (msg, mac []byte, err error) {
+		K, err := faultyScalarMult(ec.curve, h, x, bitLen, faultBits)
+		if err != nil {
+			return nil, nil, err
+		}
+		return bobMessage, macSecret(ec.curve.marshal(K), bobMessage), nil
+	}
+	return
+}
+
+// attackECDHFaults recovers Bob's key one bit at a time, from the top. For
+// the next bit, it finds a point P such that Bob would fail adding P to
+// 2*prefix*P if the bit is set. If the bit is not set, Bob can still fail
+// later, so a set bit is only trusted if confirmed by several points.
+func attackECDHFaults(ec ecParams, faultBits uint,
+	exchange func(h *ecPoint) (msg, mac []byte, err error)) *big.Int {
+	const confirmations = 4
+	c := ec.curve
+	bitLen := ecKeyBitLen(ec)
+	k := big.NewInt(1)
+	for i := bitLen - 2; i >= 0; i-- {
+		bit := uint(1)
+		for j := 0; j < confirmations; j++ {
+			P := findFaultingPoint(c, k, faultBits)
+			if _, _, err := exchange(P); err == nil {
+				bit = 0
+				break
+			}
+		}
+		k.Lsh(k, 1)
+		k.SetBit(k, 0, bit)
+	}
+	return k
+}
+
+// findFaultingPoint returns a point P for which the addition of P to
+// 2*prefix*P faults, but the computation of prefix*P doesn't. It walks
+// P = P0 + j*S to get each 2*prefix*P with a single addition.
+func findFaultingPoint(c *weierstrassCurve, prefix *big.Int, faultBits uint) *ecPoint {
+	e := new(big.Int).Lsh(prefix, 1)
+	P, S := c.randomPoint(), c.randomPoint()
+	T, U := c.ScalarMult(P, e), c.ScalarMult(S, e)
+	for {
+		if ecFault(c, T, P, faultBits) {
+			if _, err := faultyScalarMult(c, P, prefix, prefix.BitLen(), faultBits); err == nil {
+				return P
+			}
+		}
+		P, T = c.Add(P, S), c.Add(T, U)
+	}
+}
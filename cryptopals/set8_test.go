@@ -0,0 +1,288 @@
+package cryptopals
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func readECDSASignatures(t *testing.T, name string) []ecdsaSignature {
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var sigs []ecdsaSignature
+	var sig ecdsaSignature
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := s.Text()
+		switch {
+		case strings.HasPrefix(line, "msg: "):
+			sig.msg = []byte(strings.TrimPrefix(line, "msg: "))
+		case strings.HasPrefix(line, "r: "):
+			sig.r = decToBig(t, strings.TrimPrefix(line, "r: "))
+		case strings.HasPrefix(line, "s: "):
+			sig.s = decToBig(t, strings.TrimPrefix(line, "s: "))
+			sigs = append(sigs, sig)
+		}
+	}
+	if err := s.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return sigs
+}
+
+func TestProblem57(t *testing.T) {
+	pub, exchange := newDHSubgroupOracle(dh57Params)
+	x := attackDHSubgroupConfinement(dh57Params, exchange)
+	if dh57Params.Public(x).Cmp(pub) != 0 {
+		t.Fatal("wrong key")
+	}
+}
+
+func TestProblem58(t *testing.T) {
+	grp := multiplicativeGroup{dh58Params.p}
+	for _, tc := range []struct {
+		y        string
+		upper, x int64
+	}{
+		{"7760073848032689505395005705677365876654629189298052775754597607446617558600394076764814236081991643094239886772481052254010323780165093955236429914607119", 1 << 20, 705485},
+		{"9388897478013399550694114614498790691034187453089355259602614074132918843899833277397448144245883225611726912025846772975325932794909655215329941809013733", 1 << 40, 359579674340},
+	} {
+		y := decToBig(t, tc.y)
+		for i := 0; ; i++ {
+			catch := newKangarooTrap(grp, dh58Params.g, big.NewInt(0), big.NewInt(tc.upper))
+			if x, ok := catch(y); ok {
+				if x.Int64() != tc.x {
+					t.Fatal("wrong index", x)
+				}
+				break
+			}
+			if i == 4 {
+				t.Fatal("index not found")
+			}
+		}
+	}
+
+	pub, exchange := newDHSubgroupOracle(dh58Params)
+	start := time.Now()
+	x := attackDHSubgroupKangaroo(dh58Params, pub, exchange)
+	t.Log("recovered key in:", time.Since(start))
+	if dh58Params.Public(x).Cmp(pub) != 0 {
+		t.Fatal("wrong key")
+	}
+}
+
+func TestProblem59(t *testing.T) {
+	ec := cryptopalsECParams
+	if ec.curve.ScalarMult(ec.G, ec.n) != nil {
+		t.Fatal("G is not of order n")
+	}
+	for _, ic := range invalidCurves59 {
+		c := &weierstrassCurve{p: ec.curve.p, a: ec.curve.a, b: ic.b}
+		if c.ScalarMult(c.randomPoint(), ic.order) != nil {
+			t.Fatal("wrong order for b =", ic.b)
+		}
+	}
+
+	pub, exchange := newECDHOracle(ec)
+	x := attackECDHInvalidCurve(ec, invalidCurves59, exchange)
+	if !ec.curve.ScalarMult(ec.G, x).Equal(pub) {
+		t.Fatal("wrong key")
+	}
+}
+
+func TestProblem60(t *testing.T) {
+	mp := cryptopalsMontgomeryParams
+	wG := cryptopalsECParams.G
+	// The Weierstrass curve is the Montgomery one with u = x - 178.
+	G := mp.curve.liftU(mp.u)
+	if G == nil || new(big.Int).Sub(wG.x, big.NewInt(178)).Cmp(mp.u) != 0 {
+		t.Fatal("base point is not on the curve")
+	}
+	k := big.NewInt(123456789)
+	if mp.curve.ladder(mp.u, k).Cmp(mp.curve.ScalarMult(G, k).x) != 0 {
+		t.Fatal("ladder does not match the group law")
+	}
+	if mp.curve.ladder(mp.u, mp.n).Sign() != 0 {
+		t.Fatal("base point is not of order n")
+	}
+
+	pub, exchange := newECDHLadderOracle(mp)
+	start := time.Now()
+	x := attackECDHTwist(mp, pub, exchange)
+	t.Log("recovered key in:", time.Since(start))
+	if mp.curve.ladder(mp.u, x).Cmp(pub) != 0 {
+		t.Fatal("wrong key")
+	}
+}
+
+func TestProblem61(t *testing.T) {
+	ec := cryptopalsECParams
+	msg := []byte("Hello, ECDSA!")
+	d, Q := ec.Generate()
+	r, s := ec.Sign(d, msg)
+	if !ec.Verify(Q, msg, r, s) {
+		t.Fatal("valid signature did not verify")
+	}
+	if ec.Verify(Q, []byte("Hello, DSA!"), r, s) {
+		t.Fatal("invalid signature did verify")
+	}
+	ec1, _, Q1 := duplicateECDSAKey(ec, Q, msg, r, s)
+	if !ec1.Verify(Q1, msg, r, s) {
+		t.Error("signature did not verify under the duplicate key")
+	}
+
+	priv, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := rsaSignPKCS1(priv, msg)
+	if !rsaVerifyPKCS1(priv.N, big.NewInt(int64(priv.E)), msg, sig) {
+		t.Fatal("valid signature did not verify")
+	}
+	N, e, d1 := duplicateRSAKey(&priv.PublicKey, msg, sig)
+	if !rsaVerifyPKCS1(N, e, msg, sig) {
+		t.Error("signature did not verify under the duplicate key")
+	}
+	m := new(big.Int).SetBytes([]byte("not the message"))
+	if new(big.Int).Exp(new(big.Int).Exp(m, e, N), d1, N).Cmp(m) != 0 {
+		t.Error("duplicate key does not decrypt")
+	}
+}
+
+func TestProblem62(t *testing.T) {
+	ec := cryptopalsECParams
+	Q, sign := newBiasedECDSAOracle(ec, 8)
+	var sigs []ecdsaSignature
+	for i := 0; i < 24; i++ {
+		msg := []byte(fmt.Sprintf("Sample message %d", i))
+		r, s := sign(msg)
+		if !ec.Verify(Q, msg, r, s) {
+			t.Fatal("valid signature did not verify")
+		}
+		sigs = append(sigs, ecdsaSignature{msg, r, s})
+	}
+	if recoverECDSAKeyFromBiasedNonces(ec, Q, sigs, 8) == nil {
+		t.Fatal("key not found")
+	}
+
+	Q = &ecPoint{hexToBig(t, "ab798e7dda07cc15fd7adfd04913197b"), hexToBig(t, "228988dd6f12e2fc7b2632a4c53b0a0f")}
+	d := recoverECDSAKeyFromBiasedNonces(ec, Q, readECDSASignatures(t, "testdata/62.txt"), 8)
+	if d == nil {
+		t.Fatal("key not found")
+	}
+	fingerprint := sha1.Sum([]byte(fmt.Sprintf("%x", d)))
+	if !bytes.Equal(fingerprint[:], decodeHex(t, "c1a14934bbcd5aea5e2985b8b83e0ab7cae9d96b")) {
+		t.Error("wrong key")
+	}
+}
+
+func TestProblem63(t *testing.T) {
+	key := make([]byte, 16)
+	rand.Read(key)
+	nonce := make([]byte, 12)
+	rand.Read(nonce)
+	b, _ := aes.NewCipher(key)
+	aead, _ := cipher.NewGCM(b)
+	g := newGCM(key, 16)
+	for _, n := range []int{0, 1, 16, 37, 64} {
+		msg := make([]byte, n)
+		rand.Read(msg)
+		ad := []byte("some associated data")
+		ct, tag := g.seal(nonce, msg, ad)
+		if !bytes.Equal(append(ct, tag...), aead.Seal(nil, nonce, msg, ad)) {
+			t.Fatal("GCM does not match crypto/cipher")
+		}
+	}
+	x, y := randomGFElement(), randomGFElement()
+	if x.mul(x.inverse()) != gfOne || x.mul(y) != y.mul(x) {
+		t.Fatal("broken field arithmetic")
+	}
+
+	encrypt, isValid := newRepeatedNonceGCMOracle()
+	var ads, cts, tags [][]byte
+	for _, msg := range []string{
+		"Attack at dawn, bring coffee.",
+		"Retreat at dusk, bring more coffee and some snacks.",
+		"Never mind.",
+	} {
+		ad := []byte("from: alice")
+		_, ct, tag := encrypt(ad, []byte(msg))
+		ads, cts, tags = append(ads, ad), append(cts, ct), append(tags, tag)
+	}
+	nonce, ct, tag := encrypt(ads[0], []byte("Transfer $10 to Bob"))
+	newAD := []byte("from: admin")
+	newCT := xor(ct, xor([]byte("Transfer $10 to Bob"), []byte("Transfer $99 to Eve")))
+	var forged bool
+	for _, h := range recoverGCMKeyFromRepeatedNonce(ads, cts, tags) {
+		if isValid(nonce, newAD, newCT, forgeGCM(h, ads[0], ct, tag, newAD, newCT)) {
+			forged = true
+		}
+	}
+	if !forged {
+		t.Error("forgery failed")
+	}
+}
+
+func TestProblem64(t *testing.T) {
+	encrypt, isValid := newTruncatedGCMOracle(2)
+	msg := make([]byte, 64*16)
+	rand.Read(msg)
+	nonce, ct, tag := encrypt(msg)
+	var forgeries int
+	h := attackTruncatedGCM(nonce, ct, tag, func(nonce, ct, tag []byte) bool {
+		forgeries++
+		return isValid(nonce, ct, tag)
+	})
+	t.Log("forgery attempts:", forgeries)
+
+	newCT := append([]byte{}, ct...)
+	newCT[0] ^= 1
+	if !isValid(nonce, newCT, forgeGCM(h, nil, ct, tag, nil, newCT)) {
+		t.Error("wrong authentication key")
+	}
+}
+
+func TestProblem65(t *testing.T) {
+	encrypt, isValid := newTruncatedGCMOracle(2)
+	msg := make([]byte, 100)
+	rand.Read(msg)
+	nonce, ct, tag := encrypt(msg)
+	h := attackTruncatedGCMWithExtension(nonce, ct, tag, 64, isValid)
+
+	newCT := append([]byte{}, ct...)
+	newCT[0] ^= 1
+	if !isValid(nonce, newCT, forgeGCM(h, nil, ct, tag, nil, newCT)) {
+		t.Error("wrong authentication key")
+	}
+}
+
+func TestProblem66(t *testing.T) {
+	ec := cryptopalsECParams
+	k := big.NewInt(0xdeadbeef)
+	P := ec.curve.randomPoint()
+	if R, err := faultyScalarMult(ec.curve, P, k, k.BitLen(), 128); err != nil ||
+		!R.Equal(ec.curve.ScalarMult(P, k)) {
+		t.Fatal("broken scalar multiplication")
+	}
+
+	pub, exchange := newFaultyECDHOracle(ec, 10)
+	start := time.Now()
+	x := attackECDHFaults(ec, 10, exchange)
+	t.Log("recovered key in:", time.Since(start))
+	if !ec.curve.ScalarMult(ec.G, x).Equal(pub) {
+		t.Fatal("wrong key")
+	}
+}